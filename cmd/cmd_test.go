@@ -10,10 +10,13 @@ import (
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"runtime"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/junaid2005p/surge/internal/config"
+	"github.com/junaid2005p/surge/internal/downloader"
 )
 
 // =============================================================================
@@ -254,6 +257,37 @@ func TestHandleDownload_PathTraversal(t *testing.T) {
 	}
 }
 
+func TestHandleReplace_BadRequests(t *testing.T) {
+	orig := serverProgram
+	serverProgram = nil
+	defer func() { serverProgram = orig }()
+
+	tests := []struct {
+		name   string
+		method string
+		body   string
+		want   int
+	}{
+		{"wrong method", http.MethodGet, "", http.StatusMethodNotAllowed},
+		{"invalid JSON", http.MethodPost, "not json", http.StatusBadRequest},
+		{"missing new_url", http.MethodPost, `{"id": "abc"}`, http.StatusBadRequest},
+		{"missing download", http.MethodPost, `{"new_url": "https://x.com/f?sig=2"}`, http.StatusBadRequest},
+		{"not running", http.MethodPost, `{"id": "abc", "new_url": "https://x.com/f?sig=2"}`, http.StatusServiceUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/replace", bytes.NewBufferString(tt.body))
+			rec := httptest.NewRecorder()
+			handleReplace(rec, req)
+
+			if rec.Code != tt.want {
+				t.Errorf("Expected %d, got %d", tt.want, rec.Code)
+			}
+		})
+	}
+}
+
 // Note: Testing successful handleDownload requires a running serverProgram
 // which is difficult to set up in unit tests. Integration tests would be better.
 
@@ -485,6 +519,77 @@ func TestGetCmd_Args(t *testing.T) {
 	}
 }
 
+func TestHeadlessRuntime(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("relies on XDG_CONFIG_HOME")
+	}
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+
+	settings := config.DefaultSettings()
+	settings.Connections.DNS = "1.1.1.1"
+	settings.Connections.TLSCAFile = "/etc/corp/ca.pem"
+	settings.Connections.TLSMinVersion = "1.3"
+	if err := config.SaveSettings(settings); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, insecure := range []bool{false, true} {
+		rt, err := headlessRuntime(insecure)
+		if err != nil {
+			t.Fatalf("headlessRuntime(%v): %v", insecure, err)
+		}
+		if rt.DNS != "1.1.1.1" || rt.TLSCAFile != "/etc/corp/ca.pem" || rt.TLSMinVersion != "1.3" {
+			t.Errorf("headlessRuntime(%v) ignored settings.json: %+v", insecure, rt)
+		}
+		if rt.TLSInsecure != insecure {
+			t.Errorf("headlessRuntime(%v).TLSInsecure = %v", insecure, rt.TLSInsecure)
+		}
+	}
+
+	if err := os.WriteFile(config.GetSettingsPath(), []byte("{not json"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := headlessRuntime(false); err == nil {
+		t.Error("headlessRuntime should fail on invalid settings")
+	}
+}
+
+func TestGrabCmd_Flags(t *testing.T) {
+	for name, shorthand := range map[string]string{"output": "o", "filter": "f", "type": "t", "list": "l", "port": "p"} {
+		flag := grabCmd.Flags().Lookup(name)
+		if flag == nil {
+			t.Errorf("Missing %q flag", name)
+			continue
+		}
+		if flag.Shorthand != shorthand {
+			t.Errorf("%q: expected shorthand %q, got %q", name, shorthand, flag.Shorthand)
+		}
+	}
+	if def := grabCmd.Flags().Lookup("type").DefValue; def != downloader.LinkCategoryFiles {
+		t.Errorf("--type default = %q, want %q", def, downloader.LinkCategoryFiles)
+	}
+}
+
+func TestFilterGrabbedLinks(t *testing.T) {
+	links := []downloader.GrabbedLink{
+		{URL: "https://m.local/a.iso", Name: "a.iso", Category: downloader.LinkCategoryArchive},
+		{URL: "https://m.local/b.mp4", Name: "b.mp4", Category: downloader.LinkCategoryVideo},
+		{URL: "https://m.local/c.iso", Name: "c.iso", Category: downloader.LinkCategoryArchive},
+		{URL: "https://m.local/index.html", Name: "index.html", Category: downloader.LinkCategoryWeb},
+	}
+
+	if got := filterGrabbedLinks(links, downloader.LinkCategoryFiles, nil); len(got) != 3 {
+		t.Errorf("files category kept %d links, want 3", len(got))
+	}
+	if got := filterGrabbedLinks(links, downloader.LinkCategoryAll, []string{"*.iso", "*.mp4"}); len(got) != 3 {
+		t.Errorf("two filters kept %d links, want 3", len(got))
+	}
+	got := filterGrabbedLinks(links, downloader.LinkCategoryArchive, []string{"c.is"})
+	if len(got) != 1 || got[0].Name != "c.iso" {
+		t.Errorf("archive + substring filter = %+v, want c.iso", got)
+	}
+}
+
 // =============================================================================
 // progressChannelBuffer Constant Test
 // =============================================================================
@@ -863,3 +968,18 @@ func TestFindAvailablePort_HighPort(t *testing.T) {
 		t.Errorf("Expected port >= 60000, got %d", port)
 	}
 }
+
+func TestFormatHostProfile(t *testing.T) {
+	row := formatHostProfile(config.HostProfile{
+		Host:          "cdn.example.com",
+		Connections:   8,
+		ChunkSize:     4 * 1024 * 1024,
+		Throughput:    50 * 1024 * 1024,
+		SupportsRange: true,
+		Downloads:     3,
+	})
+	fields := strings.Split(row, "\t")
+	if len(fields) != 7 || fields[0] != "cdn.example.com" || fields[1] != "8" || fields[4] != "yes" || fields[5] != "3" {
+		t.Errorf("formatHostProfile = %q", row)
+	}
+}
@@ -0,0 +1,97 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/junaid2005p/surge/internal/config"
+
+	"github.com/spf13/cobra"
+)
+
+var credentialsCmd = &cobra.Command{
+	Use:   "credentials",
+	Short: "Manage credentials stored for hosts and services",
+	Long: `Manage the Surge credential store (credentials.json in the Surge config directory).
+
+Entries are keyed by host[:port] or by service name. For s3:// downloads the
+endpoint host is tried first, then "s3"; the username is the access key ID and
+the password the secret access key.`,
+}
+
+var credentialsSetCmd = &cobra.Command{
+	Use:   "set [host]",
+	Short: "Add or replace the credential for a host",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		username, _ := cmd.Flags().GetString("username")
+		password, _ := cmd.Flags().GetString("password")
+		token, _ := cmd.Flags().GetString("token")
+		passwordStdin, _ := cmd.Flags().GetBool("password-stdin")
+
+		if passwordStdin {
+			line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+			if err != nil && line == "" {
+				fmt.Fprintf(os.Stderr, "Error: reading password from stdin: %v\n", err)
+				os.Exit(1)
+			}
+			password = strings.TrimRight(line, "\r\n")
+		}
+
+		cred := config.Credential{Host: args[0], Username: username, Password: password, Token: token}
+		if err := config.SetCredential(cred); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Saved credential for %s\n", args[0])
+	},
+}
+
+var credentialsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List hosts with stored credentials (secrets are not shown)",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		creds, err := config.LoadCredentials()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		if len(creds) == 0 {
+			fmt.Println("No stored credentials")
+			return
+		}
+		for _, c := range creds {
+			fmt.Printf("%s\t%s\n", c.Host, c.Username)
+		}
+	},
+}
+
+var credentialsRemoveCmd = &cobra.Command{
+	Use:   "remove [host]",
+	Short: "Remove the credential for a host",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		removed, err := config.RemoveCredential(args[0])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		if !removed {
+			fmt.Fprintf(os.Stderr, "No credential stored for %s\n", args[0])
+			os.Exit(1)
+		}
+		fmt.Printf("Removed credential for %s\n", args[0])
+	},
+}
+
+func init() {
+	credentialsSetCmd.Flags().StringP("username", "u", "", "username (S3: access key ID)")
+	credentialsSetCmd.Flags().String("password", "", "password (S3: secret access key)")
+	credentialsSetCmd.Flags().Bool("password-stdin", false, "read the password from stdin")
+	credentialsSetCmd.Flags().String("token", "", "session or bearer token")
+
+	credentialsCmd.AddCommand(credentialsSetCmd, credentialsListCmd, credentialsRemoveCmd)
+}
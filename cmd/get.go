@@ -10,8 +10,10 @@ import (
 	"os"
 	"time"
 
+	"github.com/junaid2005p/surge/internal/config"
 	"github.com/junaid2005p/surge/internal/downloader"
 	"github.com/junaid2005p/surge/internal/messages"
+	"github.com/junaid2005p/surge/internal/tui"
 	"github.com/junaid2005p/surge/internal/utils"
 
 	tea "github.com/charmbracelet/bubbletea"
@@ -21,18 +23,41 @@ import (
 
 const progressChannelBuffer = 100
 
-// runHeadless runs a download without TUI, printing progress to stderr
-func runHeadless(ctx context.Context, url, outPath string, verbose bool) error {
+// headlessRuntime returns the download settings from settings.json for
+// headless downloads; insecure comes from --insecure
+func headlessRuntime(insecure bool) (*downloader.RuntimeConfig, error) {
+	settings, err := config.LoadSettings()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load settings: %w", err)
+	}
+	runtime := tui.ConvertRuntimeConfig(settings.ToRuntimeConfig())
+	runtime.TLSInsecure = insecure
+	return runtime, nil
+}
+
+// runHeadless runs a download without TUI, printing progress to stderr.
+// A non-nil crawl recursively downloads url if it is a directory listing.
+// runtime may be nil for the defaults.
+func runHeadless(ctx context.Context, url, outPath string, crawl *downloader.CrawlOptions, runtime *downloader.RuntimeConfig, verbose bool) error {
 	eventCh := make(chan tea.Msg, progressChannelBuffer)
 
 	startTime := time.Now()
 	var totalSize int64
 	var lastProgress int64
+	var discovered []messages.DiscoveredFile
 
 	// Start download in background
 	errCh := make(chan error, 1)
 	go func() {
-		err := downloader.Download(ctx, url, outPath, verbose, eventCh, uuid.New().String())
+		err := downloader.TUIDownload(ctx, downloader.DownloadConfig{
+			URL:        url,
+			OutputPath: outPath,
+			ID:         uuid.New().String(),
+			Verbose:    verbose,
+			ProgressCh: eventCh,
+			Crawl:      crawl,
+			Runtime:    runtime,
+		})
 		errCh <- err
 		close(eventCh)
 	}()
@@ -62,12 +87,34 @@ func runHeadless(ctx context.Context, url, outPath string, verbose bool) error {
 			fmt.Fprintf(os.Stderr, "Complete: %s in %s (%.2f MB/s)\n",
 				utils.ConvertBytesToHumanReadable(totalSize),
 				elapsed.Round(time.Millisecond), speed)
+		case messages.DownloadsDiscoveredMsg:
+			fmt.Fprintf(os.Stderr, "Found %d files in %s\n", len(m.Files), m.Source)
+			discovered = append(discovered, m.Files...)
 		case messages.DownloadErrorMsg:
 			return m.Err
 		}
 	}
 
-	return <-errCh
+	if err := <-errCh; err != nil {
+		return err
+	}
+	return downloadDiscovered(ctx, discovered, runtime, verbose)
+}
+
+// downloadDiscovered downloads the files a source expanded into (e.g. a WebDAV
+// folder) one after another, carrying on past individual failures
+func downloadDiscovered(ctx context.Context, files []messages.DiscoveredFile, runtime *downloader.RuntimeConfig, verbose bool) error {
+	failed := 0
+	for _, f := range files {
+		if err := runHeadless(ctx, f.URL, f.OutputPath, nil, runtime, verbose); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s: %v\n", f.URL, err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d files failed", failed, len(files))
+	}
+	return nil
 }
 
 // sendToServer sends a download request to a running surge server
@@ -102,6 +149,21 @@ var getCmd = &cobra.Command{
 	Short: "Download a file in headless mode or send to running server",
 	Long: `Download a file from a URL without the TUI interface.
 
+Magnet links and .torrent files (local paths or URLs) are downloaded over BitTorrent.
+HLS playlists (.m3u8) are downloaded segment by segment and joined into a single file.
+DASH manifests (.mpd) are saved as one fragmented MP4 per selected video/audio representation.
+WebDAV shares (webdav:// or webdavs://, or http(s) folders answering PROPFIND) download
+single files with multiple connections; folders are fetched recursively, keeping their layout.
+S3 objects (s3://bucket/key) are fetched with signed ranged requests; s3://bucket/prefix/
+downloads every object under the prefix. Credentials come from AWS_ACCESS_KEY_ID /
+AWS_SECRET_ACCESS_KEY, ~/.aws/credentials or "surge credentials set".
+OCI images (oci://registry/repo:tag or @sha256:...) download every blob in parallel,
+verify their digests and write an OCI image layout directory.
+With -r, an HTTP directory listing (Apache/nginx/lighttpd autoindex) is crawled up to
+--depth levels and every file matching --include/--exclude is downloaded into the mirrored
+directory layout; files that already exist with the same size are skipped.
+With --insecure, TLS certificates are not verified (public key pins from tls.json still are).
+
 Use --headless for CLI-only downloads (useful for scripting).
 Use --port to send the download to a running Surge instance.`,
 	Args: cobra.ExactArgs(1),
@@ -110,6 +172,34 @@ Use --port to send the download to a running Surge instance.`,
 		outPath, _ := cmd.Flags().GetString("output")
 		verbose, _ := cmd.Flags().GetBool("verbose")
 		port, _ := cmd.Flags().GetInt("port")
+		recursive, _ := cmd.Flags().GetBool("recursive")
+		depth, _ := cmd.Flags().GetInt("depth")
+		include, _ := cmd.Flags().GetStringSlice("include")
+		exclude, _ := cmd.Flags().GetStringSlice("exclude")
+		insecure, _ := cmd.Flags().GetBool("insecure")
+
+		var crawl *downloader.CrawlOptions
+		if recursive {
+			if depth < 0 {
+				fmt.Fprintln(os.Stderr, "Error: --depth must not be negative")
+				os.Exit(1)
+			}
+			if port > 0 {
+				fmt.Fprintln(os.Stderr, "Error: --recursive is only supported for headless downloads")
+				os.Exit(1)
+			}
+			crawl = &downloader.CrawlOptions{Depth: depth, Include: include, Exclude: exclude}
+		}
+
+		if insecure && port > 0 {
+			fmt.Fprintln(os.Stderr, "Error: --insecure is only supported for headless downloads")
+			os.Exit(1)
+		}
+
+		// Local .torrent files must resolve from the server's working directory too
+		if p := downloader.LocalTorrentFile(url); p != "" {
+			url = p
+		}
 
 		if outPath == "" && port == 0 {
 			// Only default to "." for headless mode.
@@ -127,8 +217,13 @@ Use --port to send the download to a running Surge instance.`,
 		}
 
 		// Default: headless download
+		runtime, err := headlessRuntime(insecure)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
 		ctx := context.Background()
-		if err := runHeadless(ctx, url, outPath, verbose); err != nil {
+		if err := runHeadless(ctx, url, outPath, crawl, runtime, verbose); err != nil {
 			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 			os.Exit(1)
 		}
@@ -139,4 +234,9 @@ func init() {
 	getCmd.Flags().StringP("output", "o", "", "output directory")
 	getCmd.Flags().BoolP("verbose", "v", false, "verbose output")
 	getCmd.Flags().IntP("port", "p", 0, "send to running surge server on this port")
+	getCmd.Flags().BoolP("recursive", "r", false, "crawl an HTTP directory listing and download every file below it")
+	getCmd.Flags().Int("depth", downloader.DefaultCrawlDepth, "subdirectory levels to follow with --recursive")
+	getCmd.Flags().StringSlice("include", nil, "with --recursive, only download files matching these glob patterns")
+	getCmd.Flags().StringSlice("exclude", nil, "with --recursive, skip files matching these glob patterns")
+	getCmd.Flags().BoolP("insecure", "k", false, "do not verify TLS certificates")
 }
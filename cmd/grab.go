@@ -0,0 +1,109 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+
+	"github.com/junaid2005p/surge/internal/downloader"
+	"github.com/junaid2005p/surge/internal/messages"
+
+	"github.com/spf13/cobra"
+)
+
+// filterGrabbedLinks keeps the links in category that match any of the filters (all links when none are given)
+func filterGrabbedLinks(links []downloader.GrabbedLink, category string, filters []string) []downloader.GrabbedLink {
+	var kept []downloader.GrabbedLink
+	for _, l := range links {
+		if !l.InCategory(category) {
+			continue
+		}
+		if len(filters) > 0 && !slices.ContainsFunc(filters, l.Matches) {
+			continue
+		}
+		kept = append(kept, l)
+	}
+	return kept
+}
+
+var grabCmd = &cobra.Command{
+	Use:   "grab [page-url]",
+	Short: "Download the links found on a web page",
+	Long: `Fetch an HTML page, extract every href/src link and download the ones that match.
+
+Links are classified as video, audio, image, archive, document, program, web or other
+by extension and MIME type. By default every link except web pages, scripts and
+stylesheets is taken; use --type to pick a category and --filter to narrow it down
+with glob patterns (matched against the file name) or plain substrings.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		outPath, _ := cmd.Flags().GetString("output")
+		verbose, _ := cmd.Flags().GetBool("verbose")
+		port, _ := cmd.Flags().GetInt("port")
+		filters, _ := cmd.Flags().GetStringSlice("filter")
+		category, _ := cmd.Flags().GetString("type")
+		listOnly, _ := cmd.Flags().GetBool("list")
+
+		if !slices.Contains(downloader.LinkCategories, category) {
+			fmt.Fprintf(os.Stderr, "Error: unknown --type %q (one of %v)\n", category, downloader.LinkCategories)
+			os.Exit(1)
+		}
+
+		runtime, err := headlessRuntime(false)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		ctx := context.Background()
+		links, err := downloader.GrabLinks(ctx, args[0], runtime)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		links = filterGrabbedLinks(links, category, filters)
+		if len(links) == 0 {
+			fmt.Fprintln(os.Stderr, "No matching links found")
+			os.Exit(1)
+		}
+
+		if listOnly {
+			for _, l := range links {
+				fmt.Printf("%-8s %s\n", l.Category, l.URL)
+			}
+			return
+		}
+
+		if port > 0 {
+			for _, l := range links {
+				if err := sendToServer(l.URL, outPath, port); err != nil {
+					fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+					os.Exit(1)
+				}
+			}
+			return
+		}
+
+		if outPath == "" {
+			outPath = "."
+		}
+		fmt.Fprintf(os.Stderr, "Found %d links on %s\n", len(links), args[0])
+		files := make([]messages.DiscoveredFile, len(links))
+		for i, l := range links {
+			files[i] = messages.DiscoveredFile{URL: l.URL, OutputPath: outPath}
+		}
+		if err := downloadDiscovered(ctx, files, runtime, verbose); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	grabCmd.Flags().StringP("output", "o", "", "output directory")
+	grabCmd.Flags().BoolP("verbose", "v", false, "verbose output")
+	grabCmd.Flags().IntP("port", "p", 0, "send the links to a running surge server on this port")
+	grabCmd.Flags().StringSliceP("filter", "f", nil, "only take links matching these glob patterns or substrings")
+	grabCmd.Flags().StringP("type", "t", downloader.LinkCategoryFiles, "link category: files, video, audio, image, archive, document, program, other, web or all")
+	grabCmd.Flags().BoolP("list", "l", false, "print the matching links instead of downloading them")
+}
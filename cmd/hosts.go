@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/junaid2005p/surge/internal/config"
+	"github.com/junaid2005p/surge/internal/utils"
+
+	"github.com/spf13/cobra"
+)
+
+var hostsCmd = &cobra.Command{
+	Use:   "hosts",
+	Short: "List the tuning profiles learned for hosts",
+	Long: `List what Surge learned about each host it downloaded from (hosts.json in the
+Surge config directory): the connection count and chunk size that gave the
+best throughput, and whether the host supports range requests. New downloads
+from a host start from its profile.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		profiles, err := config.LoadHostProfiles()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		if len(profiles) == 0 {
+			fmt.Println("No learned host profiles")
+			return
+		}
+		fmt.Println("HOST\tCONNS\tCHUNK\tBEST SPEED\tRANGES\tDOWNLOADS\tUPDATED")
+		for _, p := range profiles {
+			fmt.Println(formatHostProfile(p))
+		}
+	},
+}
+
+var hostsResetCmd = &cobra.Command{
+	Use:   "reset [host...]",
+	Short: "Forget the learned profiles of the given hosts, or of all hosts",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) == 0 {
+			if err := config.ResetHostProfiles(); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Println("Reset all host profiles")
+			return
+		}
+
+		failed := false
+		for _, host := range args {
+			removed, err := config.RemoveHostProfile(host)
+			switch {
+			case err != nil:
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			case !removed:
+				fmt.Fprintf(os.Stderr, "No profile learned for %s\n", host)
+				failed = true
+			default:
+				fmt.Printf("Reset profile for %s\n", host)
+			}
+		}
+		if failed {
+			os.Exit(1)
+		}
+	},
+}
+
+// formatHostProfile renders a profile as a tab separated row
+func formatHostProfile(p config.HostProfile) string {
+	chunk := "-"
+	if p.ChunkSize > 0 {
+		chunk = utils.ConvertBytesToHumanReadable(p.ChunkSize)
+	}
+	ranges := "no"
+	if p.SupportsRange {
+		ranges = "yes"
+	}
+	return fmt.Sprintf("%s\t%d\t%s\t%s/s\t%s\t%d\t%s",
+		p.Host, p.Connections, chunk, utils.ConvertBytesToHumanReadable(int64(p.Throughput)),
+		ranges, p.Downloads, time.Unix(p.UpdatedAt, 0).Format("2006-01-02 15:04"))
+}
+
+func init() {
+	hostsCmd.AddCommand(hostsResetCmd)
+}
@@ -8,6 +8,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/junaid2005p/surge/internal/config"
 	"github.com/junaid2005p/surge/internal/tui"
@@ -101,6 +102,9 @@ func startHTTPServer(ln net.Listener, port int) {
 	// Download endpoint
 	mux.HandleFunc("/download", handleDownload)
 
+	// Replace URL endpoint (e.g. an expired signed link)
+	mux.HandleFunc("/replace", handleReplace)
+
 	server := &http.Server{Handler: corsMiddleware(mux)}
 	if err := server.Serve(ln); err != nil && err != http.ErrServerClosed {
 		utils.Debug("HTTP server error: %v", err)
@@ -172,6 +176,67 @@ func handleDownload(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// replaceTimeout bounds how long /replace waits for the new URL to be checked
+const replaceTimeout = 90 * time.Second
+
+// ReplaceRequest asks to move a paused or failed download to a new URL,
+// keeping its progress. The download is picked by ID, or else by its current URL.
+type ReplaceRequest struct {
+	ID     string `json:"id,omitempty"`
+	URL    string `json:"url,omitempty"`
+	NewURL string `json:"new_url"`
+}
+
+func handleReplace(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req ReplaceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	if req.NewURL == "" {
+		http.Error(w, "new_url is required", http.StatusBadRequest)
+		return
+	}
+	if req.ID == "" && req.URL == "" {
+		http.Error(w, "id or url is required", http.StatusBadRequest)
+		return
+	}
+	if serverProgram == nil {
+		http.Error(w, "Surge is not running", http.StatusServiceUnavailable)
+		return
+	}
+
+	utils.Debug("Received replace request: ID=%s, URL=%s, NewURL=%s", req.ID, req.URL, req.NewURL)
+
+	// The TUI owns the downloads; it checks the new URL and reports back
+	result := make(chan error, 1)
+	serverProgram.Send(tui.ReplaceURLMsg{ID: req.ID, URL: req.URL, NewURL: req.NewURL, Result: result})
+
+	select {
+	case err := <-result:
+		if err != nil {
+			http.Error(w, "Could not replace URL: "+err.Error(), http.StatusConflict)
+			return
+		}
+	case <-time.After(replaceTimeout):
+		http.Error(w, "Timed out checking the new URL", http.StatusGatewayTimeout)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"status":  "replaced",
+		"message": "Download resumed from the new URL",
+	})
+}
+
 // Execute adds all child commands to the root command and sets flags appropriately.
 func Execute() {
 	if err := rootCmd.Execute(); err != nil {
@@ -181,5 +246,8 @@ func Execute() {
 
 func init() {
 	rootCmd.AddCommand(getCmd)
+	rootCmd.AddCommand(credentialsCmd)
+	rootCmd.AddCommand(grabCmd)
+	rootCmd.AddCommand(hostsCmd)
 	rootCmd.SetVersionTemplate("Surge version {{.Version}}\n")
 }
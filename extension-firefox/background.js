@@ -147,6 +147,31 @@ browser.downloads.onCreated.addListener(async (downloadItem) => {
     }
 });
 
+// Magnet links open an external handler instead of starting a download,
+// so offer them to Surge from the link context menu
+const MAGNET_MENU_ID = "surge-magnet";
+
+browser.runtime.onInstalled.addListener(() => {
+    browser.contextMenus.create({
+        id: MAGNET_MENU_ID,
+        title: "Download with Surge",
+        contexts: ["link"],
+        targetUrlPatterns: ["magnet:*"],
+    });
+});
+
+browser.contextMenus.onClicked.addListener(async (info) => {
+    if (info.menuItemId !== MAGNET_MENU_ID || !info.linkUrl) return;
+
+    const success = await sendToSurge(info.linkUrl, "");
+    browser.notifications.create({
+        type: "basic",
+        iconUrl: "icons/icon48.png",
+        title: "Surge",
+        message: success ? "Magnet link sent to Surge" : "Surge is not running",
+    });
+});
+
 // Handle messages from popup
 browser.runtime.onMessage.addListener((message, sender, sendResponse) => {
     if (message.type === "checkHealth") {
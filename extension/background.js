@@ -136,6 +136,31 @@ chrome.downloads.onCreated.addListener(async (downloadItem) => {
     }
 });
 
+// Magnet links open an external handler instead of starting a download,
+// so offer them to Surge from the link context menu
+const MAGNET_MENU_ID = "surge-magnet";
+
+chrome.runtime.onInstalled.addListener(() => {
+    chrome.contextMenus.create({
+        id: MAGNET_MENU_ID,
+        title: "Download with Surge",
+        contexts: ["link"],
+        targetUrlPatterns: ["magnet:*"],
+    });
+});
+
+chrome.contextMenus.onClicked.addListener(async (info) => {
+    if (info.menuItemId !== MAGNET_MENU_ID || !info.linkUrl) return;
+
+    const success = await sendToSurge(info.linkUrl, "");
+    chrome.notifications.create({
+        type: "basic",
+        iconUrl: "icons/icon48.png",
+        title: "Surge",
+        message: success ? "Magnet link sent to Surge" : "Surge is not running",
+    });
+});
+
 // Handle messages from popup
 chrome.runtime.onMessage.addListener((message, sender, sendResponse) => {
     if (message.type === "checkHealth") {
@@ -0,0 +1,108 @@
+package config
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Credential is a secret Surge uses to authenticate against a host or service.
+// For S3, Username is the access key ID and Password the secret access key.
+type Credential struct {
+	Host     string `json:"host"` // host[:port], or a service name such as "s3"
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	Token    string `json:"token,omitempty"` // Session or bearer token
+}
+
+// GetCredentialsPath returns the path to the credential store.
+func GetCredentialsPath() string {
+	return filepath.Join(GetSurgeDir(), "credentials.json")
+}
+
+// LoadCredentials reads the credential store. Returns an empty list if it doesn't exist.
+func LoadCredentials() ([]Credential, error) {
+	data, err := os.ReadFile(GetCredentialsPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var creds []Credential
+	if err := json.Unmarshal(data, &creds); err != nil {
+		return nil, err
+	}
+	return creds, nil
+}
+
+// SaveCredentials writes the credential store atomically, readable only by the user.
+func SaveCredentials(creds []Credential) error {
+	path := GetCredentialsPath()
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	sort.Slice(creds, func(i, j int) bool { return creds[i].Host < creds[j].Host })
+	data, err := json.MarshalIndent(creds, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tempPath := path + ".tmp"
+	if err := os.WriteFile(tempPath, data, 0600); err != nil {
+		return err
+	}
+
+	return os.Rename(tempPath, path)
+}
+
+// LookupCredential returns the stored credential for the first matching host
+// (compared case-insensitively), or nil if none is stored.
+func LookupCredential(hosts ...string) *Credential {
+	creds, err := LoadCredentials()
+	if err != nil {
+		return nil
+	}
+	for _, host := range hosts {
+		for i := range creds {
+			if strings.EqualFold(creds[i].Host, host) {
+				return &creds[i]
+			}
+		}
+	}
+	return nil
+}
+
+// SetCredential adds or replaces the credential for c.Host.
+func SetCredential(c Credential) error {
+	creds, err := LoadCredentials()
+	if err != nil {
+		return err
+	}
+	for i := range creds {
+		if strings.EqualFold(creds[i].Host, c.Host) {
+			creds[i] = c
+			return SaveCredentials(creds)
+		}
+	}
+	return SaveCredentials(append(creds, c))
+}
+
+// RemoveCredential deletes the credential for host. Reports whether one was stored.
+func RemoveCredential(host string) (bool, error) {
+	creds, err := LoadCredentials()
+	if err != nil {
+		return false, err
+	}
+	for i := range creds {
+		if strings.EqualFold(creds[i].Host, host) {
+			return true, SaveCredentials(append(creds[:i], creds[i+1:]...))
+		}
+	}
+	return false, nil
+}
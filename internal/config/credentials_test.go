@@ -0,0 +1,67 @@
+package config
+
+import (
+	"os"
+	"runtime"
+	"testing"
+)
+
+func TestCredentialStore(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("relies on XDG_CONFIG_HOME")
+	}
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+
+	creds, err := LoadCredentials()
+	if err != nil || len(creds) != 0 {
+		t.Fatalf("LoadCredentials on a missing store = %v, %v; want empty", creds, err)
+	}
+	if LookupCredential("s3") != nil {
+		t.Error("LookupCredential should return nil for an empty store")
+	}
+
+	if err := SetCredential(Credential{Host: "s3", Username: "AKID", Password: "secret"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetCredential(Credential{Host: "minio.local:9000", Username: "minio", Password: "pw"}); err != nil {
+		t.Fatal(err)
+	}
+	// Replaces the existing entry, matching case-insensitively
+	if err := SetCredential(Credential{Host: "S3", Username: "AKID2", Password: "secret2"}); err != nil {
+		t.Fatal(err)
+	}
+
+	creds, err = LoadCredentials()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(creds) != 2 {
+		t.Fatalf("store has %d entries, want 2: %+v", len(creds), creds)
+	}
+
+	if c := LookupCredential("unknown", "s3"); c == nil || c.Username != "AKID2" {
+		t.Errorf("LookupCredential fallback = %+v, want AKID2", c)
+	}
+	if c := LookupCredential("MINIO.local:9000", "s3"); c == nil || c.Username != "minio" {
+		t.Errorf("LookupCredential = %+v, want minio", c)
+	}
+
+	info, err := os.Stat(GetCredentialsPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0600 {
+		t.Errorf("credential store permissions = %o, want 600", perm)
+	}
+
+	removed, err := RemoveCredential("s3")
+	if err != nil || !removed {
+		t.Fatalf("RemoveCredential = %v, %v", removed, err)
+	}
+	if removed, _ := RemoveCredential("s3"); removed {
+		t.Error("second RemoveCredential should report nothing removed")
+	}
+	if LookupCredential("s3") != nil {
+		t.Error("credential still present after removal")
+	}
+}
@@ -0,0 +1,162 @@
+package config
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HostProfile is what Surge learned about downloading from a host. New
+// downloads from the host start from it instead of the static heuristics.
+type HostProfile struct {
+	Host          string  `json:"host"`                 // host[:port], lower case
+	Connections   int     `json:"connections"`          // Connection count that gave the best throughput
+	ChunkSize     int64   `json:"chunk_size,omitempty"` // Chunk size used at that throughput
+	Throughput    float64 `json:"throughput"`           // Best throughput in bytes/s
+	SupportsRange bool    `json:"supports_range"`
+	Downloads     int     `json:"downloads"` // Downloads the profile was learned from
+	UpdatedAt     int64   `json:"updated_at"`
+}
+
+const (
+	// A download at least this fraction of the best throughput replaces the
+	// learned settings, so the profile follows the newest good result
+	hostProfileKeepRatio = 0.8
+	// Otherwise the best throughput decays by this factor, so a lasting
+	// change of conditions wins eventually
+	hostProfileDecay = 0.9
+)
+
+// hostsMu serializes read-modify-write cycles of the host profile store
+var hostsMu sync.Mutex
+
+// GetHostsPath returns the path to the learned host profiles.
+func GetHostsPath() string {
+	return filepath.Join(GetSurgeDir(), "hosts.json")
+}
+
+// LoadHostProfiles reads the learned host profiles. Returns an empty list if
+// there are none.
+func LoadHostProfiles() ([]HostProfile, error) {
+	data, err := os.ReadFile(GetHostsPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var profiles []HostProfile
+	if err := json.Unmarshal(data, &profiles); err != nil {
+		return nil, err
+	}
+	return profiles, nil
+}
+
+// SaveHostProfiles writes the host profiles atomically.
+func SaveHostProfiles(profiles []HostProfile) error {
+	path := GetHostsPath()
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	sort.Slice(profiles, func(i, j int) bool { return profiles[i].Host < profiles[j].Host })
+	data, err := json.MarshalIndent(profiles, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tempPath := path + ".tmp"
+	if err := os.WriteFile(tempPath, data, 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tempPath, path)
+}
+
+// LookupHostProfile returns the learned profile for host, or nil if there is none.
+func LookupHostProfile(host string) *HostProfile {
+	profiles, err := LoadHostProfiles()
+	if err != nil {
+		return nil
+	}
+	for i := range profiles {
+		if strings.EqualFold(profiles[i].Host, host) {
+			return &profiles[i]
+		}
+	}
+	return nil
+}
+
+// RecordHostProfile merges the result of a finished download from p.Host into
+// the store. Its settings replace the learned ones unless it was clearly
+// slower than the best download so far. A download without range support
+// (a single connection for the whole file) only records that: it keeps the
+// settings learned from ranged downloads, which it cannot be compared with.
+func RecordHostProfile(p HostProfile) error {
+	hostsMu.Lock()
+	defer hostsMu.Unlock()
+
+	profiles, err := LoadHostProfiles()
+	if err != nil {
+		return err
+	}
+
+	p.Host = strings.ToLower(p.Host)
+	p.UpdatedAt = time.Now().Unix()
+	for i := range profiles {
+		cur := &profiles[i]
+		if cur.Host != p.Host {
+			continue
+		}
+		cur.Downloads++
+		cur.UpdatedAt = p.UpdatedAt
+		switch {
+		case !p.SupportsRange:
+			cur.SupportsRange = false
+		case !cur.SupportsRange || p.Throughput >= cur.Throughput*hostProfileKeepRatio:
+			cur.SupportsRange = true
+			cur.Connections, cur.ChunkSize, cur.Throughput = p.Connections, p.ChunkSize, p.Throughput
+		default:
+			cur.Throughput *= hostProfileDecay
+		}
+		return SaveHostProfiles(profiles)
+	}
+
+	p.Downloads = 1
+	return SaveHostProfiles(append(profiles, p))
+}
+
+// RemoveHostProfile forgets what was learned about host. Reports whether there
+// was a profile.
+func RemoveHostProfile(host string) (bool, error) {
+	hostsMu.Lock()
+	defer hostsMu.Unlock()
+
+	profiles, err := LoadHostProfiles()
+	if err != nil {
+		return false, err
+	}
+	for i := range profiles {
+		if strings.EqualFold(profiles[i].Host, host) {
+			return true, SaveHostProfiles(append(profiles[:i], profiles[i+1:]...))
+		}
+	}
+	return false, nil
+}
+
+// ResetHostProfiles forgets all learned host profiles.
+func ResetHostProfiles() error {
+	hostsMu.Lock()
+	defer hostsMu.Unlock()
+
+	if err := os.Remove(GetHostsPath()); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package config
+
+import (
+	"runtime"
+	"testing"
+)
+
+func TestHostProfileStore(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("relies on XDG_CONFIG_HOME")
+	}
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+
+	if LookupHostProfile("cdn.example.com") != nil {
+		t.Error("LookupHostProfile should return nil for an empty store")
+	}
+
+	first := HostProfile{Host: "CDN.example.com", Connections: 8, ChunkSize: 4 << 20, Throughput: 50e6, SupportsRange: true}
+	if err := RecordHostProfile(first); err != nil {
+		t.Fatal(err)
+	}
+	if err := RecordHostProfile(HostProfile{Host: "mirror.example.org", Connections: 1, Throughput: 5e6}); err != nil {
+		t.Fatal(err)
+	}
+
+	p := LookupHostProfile("cdn.example.com")
+	if p == nil || p.Host != "cdn.example.com" || p.Connections != 8 || p.Downloads != 1 || p.UpdatedAt == 0 {
+		t.Fatalf("learned profile = %+v", p)
+	}
+
+	// A clearly slower download keeps the learned settings, but the best
+	// throughput decays
+	if err := RecordHostProfile(HostProfile{Host: "cdn.example.com", Connections: 2, Throughput: 10e6, SupportsRange: true}); err != nil {
+		t.Fatal(err)
+	}
+	p = LookupHostProfile("cdn.example.com")
+	if p.Connections != 8 || p.Downloads != 2 || p.Throughput != 50e6*hostProfileDecay {
+		t.Errorf("after a slow download: %+v", p)
+	}
+
+	// A download nearly as fast replaces them
+	if err := RecordHostProfile(HostProfile{Host: "cdn.example.com", Connections: 12, ChunkSize: 8 << 20, Throughput: 40e6, SupportsRange: true}); err != nil {
+		t.Fatal(err)
+	}
+	if p = LookupHostProfile("cdn.example.com"); p.Connections != 12 || p.ChunkSize != 8<<20 || p.Downloads != 3 {
+		t.Errorf("after a comparable download: %+v", p)
+	}
+
+	// A download served whole keeps the ranged settings
+	if err := RecordHostProfile(HostProfile{Host: "cdn.example.com", Connections: 1, Throughput: 60e6}); err != nil {
+		t.Fatal(err)
+	}
+	if p = LookupHostProfile("cdn.example.com"); p.Connections != 12 || p.ChunkSize != 8<<20 || p.Throughput != 40e6 || p.SupportsRange || p.Downloads != 4 {
+		t.Errorf("after a download without ranges: %+v", p)
+	}
+
+	// The next ranged download replaces the settings of a host that served
+	// the last one whole
+	if err := RecordHostProfile(HostProfile{Host: "mirror.example.org", Connections: 6, ChunkSize: 2 << 20, Throughput: 3e6, SupportsRange: true}); err != nil {
+		t.Fatal(err)
+	}
+	if p = LookupHostProfile("mirror.example.org"); p.Connections != 6 || p.Throughput != 3e6 || !p.SupportsRange {
+		t.Errorf("after a ranged download: %+v", p)
+	}
+
+	removed, err := RemoveHostProfile("CDN.EXAMPLE.COM")
+	if err != nil || !removed {
+		t.Fatalf("RemoveHostProfile = %v, %v", removed, err)
+	}
+	if removed, _ := RemoveHostProfile("cdn.example.com"); removed {
+		t.Error("second RemoveHostProfile should report nothing removed")
+	}
+
+	if err := ResetHostProfiles(); err != nil {
+		t.Fatal(err)
+	}
+	if profiles, err := LoadHostProfiles(); err != nil || len(profiles) != 0 {
+		t.Errorf("profiles after reset = %v, %v", profiles, err)
+	}
+}
@@ -0,0 +1,74 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Resolver is an external program that turns landing page URLs (video sites,
+// file hosts) into direct download URLs. It is run as `Command Args... URL`
+// and prints JSON describing the files on stdout.
+type Resolver struct {
+	Name    string   `json:"name"`
+	Command string   `json:"command"`
+	Args    []string `json:"args,omitempty"`
+	Hosts   []string `json:"hosts,omitempty"`   // Hosts handled, including their subdomains
+	Pattern string   `json:"pattern,omitempty"` // Regular expression matched against the whole URL
+	Timeout int      `json:"timeout,omitempty"` // Seconds, 0 = default
+}
+
+// Matches reports whether the resolver handles rawurl
+func (r Resolver) Matches(rawurl string) bool {
+	if u, err := url.Parse(rawurl); err == nil {
+		host := strings.ToLower(u.Hostname())
+		for _, h := range r.Hosts {
+			h = strings.ToLower(strings.TrimPrefix(h, "."))
+			if host == h || strings.HasSuffix(host, "."+h) {
+				return true
+			}
+		}
+	}
+	if r.Pattern != "" {
+		if re, err := regexp.Compile(r.Pattern); err == nil && re.MatchString(rawurl) {
+			return true
+		}
+	}
+	return false
+}
+
+// GetResolversPath returns the path to the resolver plugin list.
+func GetResolversPath() string {
+	return filepath.Join(GetSurgeDir(), "resolvers.json")
+}
+
+// LoadResolvers reads the resolver plugin list. Returns an empty list if it doesn't exist.
+func LoadResolvers() ([]Resolver, error) {
+	data, err := os.ReadFile(GetResolversPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var resolvers []Resolver
+	if err := json.Unmarshal(data, &resolvers); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", GetResolversPath(), err)
+	}
+	for _, r := range resolvers {
+		if r.Command == "" {
+			return nil, fmt.Errorf("resolver %q has no command", r.Name)
+		}
+		if r.Pattern != "" {
+			if _, err := regexp.Compile(r.Pattern); err != nil {
+				return nil, fmt.Errorf("resolver %q: invalid pattern: %w", r.Name, err)
+			}
+		}
+	}
+	return resolvers, nil
+}
@@ -0,0 +1,76 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestResolverMatches(t *testing.T) {
+	r := Resolver{Hosts: []string{"video.example", ".Files.Example"}, Pattern: `^https://share\.local/s/[a-z0-9]+$`}
+
+	tests := []struct {
+		url  string
+		want bool
+	}{
+		{"https://video.example/watch?v=1", true},
+		{"https://www.video.example/watch?v=1", true},
+		{"https://dl.files.example:8443/f/1", true},
+		{"https://notvideo.example/watch", false},
+		{"https://share.local/s/abc123", true},
+		{"https://share.local/s/abc123/extra", false},
+		{"not a url", false},
+	}
+	for _, tt := range tests {
+		if got := r.Matches(tt.url); got != tt.want {
+			t.Errorf("Matches(%q) = %v, want %v", tt.url, got, tt.want)
+		}
+	}
+
+	if (Resolver{Command: "x"}).Matches("https://video.example/") {
+		t.Error("a resolver without hosts or pattern should match nothing")
+	}
+}
+
+func TestLoadResolvers(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("relies on XDG_CONFIG_HOME")
+	}
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+
+	resolvers, err := LoadResolvers()
+	if err != nil || len(resolvers) != 0 {
+		t.Fatalf("LoadResolvers without a file = %v, %v; want empty", resolvers, err)
+	}
+
+	write := func(content string) {
+		t.Helper()
+		if err := os.MkdirAll(filepath.Dir(GetResolversPath()), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(GetResolversPath(), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write(`[{"name":"yt-dlp","command":"surge-ytdlp","hosts":["youtube.com"],"timeout":120}]`)
+	resolvers, err = LoadResolvers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resolvers) != 1 || resolvers[0].Command != "surge-ytdlp" || resolvers[0].Timeout != 120 {
+		t.Errorf("LoadResolvers = %+v", resolvers)
+	}
+
+	for _, invalid := range []string{
+		`[{"name":"no command","hosts":["a.example"]}]`,
+		`[{"name":"bad pattern","command":"x","pattern":"("}]`,
+		`{not json`,
+	} {
+		write(invalid)
+		if _, err := LoadResolvers(); err == nil {
+			t.Errorf("LoadResolvers(%s) should fail", invalid)
+		}
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 )
 
@@ -21,13 +22,35 @@ type GeneralSettings struct {
 	WarnOnDuplicate    bool   `json:"warn_on_duplicate"`
 	ExtensionPrompt    bool   `json:"extension_prompt"`
 	AutoResume         bool   `json:"auto_resume"`
+	PreallocateFiles   bool   `json:"preallocate_files"`
+	MinFreeSpace       int    `json:"min_free_space"` // MB
 }
 
 // ConnectionSettings contains network connection parameters.
 type ConnectionSettings struct {
-	MaxConnectionsPerHost int    `json:"max_connections_per_host"`
-	MaxGlobalConnections  int    `json:"max_global_connections"`
-	UserAgent             string `json:"user_agent"`
+	MaxConnectionsPerHost int     `json:"max_connections_per_host"`
+	MaxGlobalConnections  int     `json:"max_global_connections"`
+	UserAgent             string  `json:"user_agent"`
+	SSHKeyFile            string  `json:"ssh_key_file"`
+	TorrentDownloadLimit  int     `json:"torrent_download_limit"`
+	TorrentUploadLimit    int     `json:"torrent_upload_limit"`
+	TorrentSeedRatio      float64 `json:"torrent_seed_ratio"`
+	StreamQuality         string  `json:"stream_quality"`
+	S3Endpoint            string  `json:"s3_endpoint"`
+	S3Region              string  `json:"s3_region"`
+	S3PathStyle           bool    `json:"s3_path_style"`
+	OCIPlatform           string  `json:"oci_platform"`
+	HTTP3                 string  `json:"http3"`             // "off", "auto" or "on"
+	HTTP3Hosts            string  `json:"http3_hosts"`       // Comma separated hosts that always try HTTP/3
+	HTTP3Connections      int     `json:"http3_connections"` // QUIC connections per host
+	HTTP2                 string  `json:"http2"`             // "off", "connections" or "streams"
+	IPVersion             string  `json:"ip_version"`        // "auto", "ipv4", "ipv6", "prefer-ipv4" or "prefer-ipv6"
+	DNS                   string  `json:"dns"`               // "system", a DNS server or a DNS-over-HTTPS URL
+	Resolve               string  `json:"resolve"`           // Comma separated host:port:address overrides
+	TLSCAFile             string  `json:"tls_ca_file"`       // PEM bundle trusted in addition to the system roots
+	TLSClientCert         string  `json:"tls_client_cert"`   // PEM client certificate for mutual TLS
+	TLSClientKey          string  `json:"tls_client_key"`    // PEM key of TLSClientCert, if not in the same file
+	TLSMinVersion         string  `json:"tls_min_version"`   // "", "1.0", "1.1", "1.2" or "1.3"
 }
 
 // ChunkSettings contains download chunk configuration.
@@ -45,6 +68,8 @@ type PerformanceSettings struct {
 	SlowWorkerGracePeriod time.Duration `json:"slow_worker_grace_period"`
 	StallTimeout          time.Duration `json:"stall_timeout"`
 	SpeedEmaAlpha         float64       `json:"speed_ema_alpha"`
+	MaxDownloadRetries    int           `json:"max_download_retries"`
+	DownloadRetryDelay    time.Duration `json:"download_retry_delay"`
 }
 
 // SettingMeta provides metadata for a single setting (for UI rendering).
@@ -63,11 +88,33 @@ func GetSettingsMetadata() map[string][]SettingMeta {
 			{Key: "warn_on_duplicate", Label: "Warn on Duplicate", Description: "Show warning when adding a download that already exists.", Type: "bool"},
 			{Key: "extension_prompt", Label: "Extension Prompt", Description: "Prompt for confirmation when adding downloads via browser extension.", Type: "bool"},
 			{Key: "auto_resume", Label: "Auto Resume", Description: "Automatically resume paused downloads on startup.", Type: "bool"},
+			{Key: "preallocate_files", Label: "Preallocate Files", Description: "Reserve the full size of a download on disk before it starts, so a full disk fails early instead of partway through. Can take a moment for large files on some filesystems.", Type: "bool"},
+			{Key: "min_free_space", Label: "Min Free Space", Description: "Free disk space in MB to keep. Downloads that would leave less do not start, and all downloads pause when a disk runs this low. Downloads always pause below 32 MB. 0 (the default) to disable.", Type: "int"},
 		},
 		"Connections": {
 			{Key: "max_connections_per_host", Label: "Max Connections/Host", Description: "Maximum concurrent connections per host (1-64).", Type: "int"},
 			{Key: "max_global_connections", Label: "Max Global Connections", Description: "Maximum total concurrent connections across all downloads.", Type: "int"},
 			{Key: "user_agent", Label: "User Agent", Description: "Custom User-Agent string for HTTP requests. Leave empty for default.", Type: "string"},
+			{Key: "ssh_key_file", Label: "SSH Key File", Description: "Private key used for sftp:// downloads. Leave empty to try ~/.ssh/id_ed25519, id_ecdsa and id_rsa.", Type: "string"},
+			{Key: "torrent_download_limit", Label: "Torrent Download Limit", Description: "Maximum torrent download speed in KB/s. 0 for unlimited.", Type: "int"},
+			{Key: "torrent_upload_limit", Label: "Torrent Upload Limit", Description: "Maximum torrent upload speed in KB/s. 0 for unlimited.", Type: "int"},
+			{Key: "torrent_seed_ratio", Label: "Seed Ratio", Description: "Keep seeding completed torrents until uploaded/size reaches this ratio. 0 to stop when complete.", Type: "float64"},
+			{Key: "stream_quality", Label: "Stream Quality", Description: "Rendition to download from HLS playlists and DASH manifests: best, worst, a resolution (720p, 1280x720) or a bandwidth cap (2500k).", Type: "string"},
+			{Key: "s3_endpoint", Label: "S3 Endpoint", Description: "Endpoint for s3:// downloads from S3-compatible stores (e.g. http://minio.local:9000). Leave empty for AWS or $AWS_ENDPOINT_URL.", Type: "string"},
+			{Key: "s3_region", Label: "S3 Region", Description: "Region used to sign s3:// requests. Leave empty for $AWS_REGION or us-east-1.", Type: "string"},
+			{Key: "s3_path_style", Label: "S3 Path-Style", Description: "Address buckets as endpoint/bucket/key instead of bucket.endpoint/key. Most MinIO and Ceph setups need this.", Type: "bool"},
+			{Key: "oci_platform", Label: "OCI Platform", Description: "Platform pulled from multi-platform oci:// images (e.g. linux/arm64). Leave empty for linux on this machine's architecture.", Type: "string"},
+			{Key: "http3", Label: "HTTP/3", Description: "Download over HTTP/3 (QUIC): off, auto (hosts that advertise it with Alt-Svc) or on (try it for every https host). Falls back to TCP when it fails.", Type: "string"},
+			{Key: "http3_hosts", Label: "HTTP/3 Hosts", Description: "Comma separated hosts (subdomains included) that always try HTTP/3 first, whatever the HTTP/3 mode.", Type: "string"},
+			{Key: "http3_connections", Label: "HTTP/3 Connections", Description: "QUIC connections per host. The range requests of a download run as streams spread across them; 1 puts them all on one connection.", Type: "int"},
+			{Key: "http2", Label: "HTTP/2", Description: "off: HTTP/1.1 with a TCP connection per worker. connections: HTTP/2, still with a separate TCP connection per worker. streams: HTTP/2 servers get at most 8 workers sharing one connection as streams, counted as one connection against the global limit.", Type: "string"},
+			{Key: "ip_version", Label: "IP Version", Description: "Addresses used when a host resolves to several: auto, ipv4, ipv6, prefer-ipv4 or prefer-ipv6. Connections are spread over them and drift toward the fastest.", Type: "string"},
+			{Key: "dns", Label: "DNS Resolver", Description: "Resolver for download hosts: system, a DNS server (e.g. 1.1.1.1 or 10.0.0.2:5353) or a DNS-over-HTTPS URL (e.g. https://cloudflare-dns.com/dns-query).", Type: "string"},
+			{Key: "resolve", Label: "Resolve Overrides", Description: "Comma separated host:port:address entries that skip DNS, like curl --resolve (e.g. example.com:443:10.0.0.5). Use * as the port to match any port.", Type: "string"},
+			{Key: "tls_ca_file", Label: "TLS CA Bundle", Description: "PEM file of CA certificates trusted in addition to the system roots, e.g. for internal servers with a private CA. Per-host options go in tls.json.", Type: "string"},
+			{Key: "tls_client_cert", Label: "TLS Client Cert", Description: "PEM client certificate presented to servers that require mutual TLS.", Type: "string"},
+			{Key: "tls_client_key", Label: "TLS Client Key", Description: "PEM private key of the client certificate. Leave empty if it is in the certificate file.", Type: "string"},
+			{Key: "tls_min_version", Label: "TLS Min Version", Description: "Minimum TLS version: 1.0, 1.1, 1.2 or 1.3. Leave empty for the default (1.2).", Type: "string"},
 		},
 		"Chunks": {
 			{Key: "min_chunk_size", Label: "Min Chunk Size", Description: "Minimum download chunk size in MB (e.g., 2).", Type: "int64"},
@@ -77,10 +124,12 @@ func GetSettingsMetadata() map[string][]SettingMeta {
 		},
 		"Performance": {
 			{Key: "max_task_retries", Label: "Max Task Retries", Description: "Number of times to retry a failed chunk before giving up.", Type: "int"},
-			{Key: "slow_worker_threshold", Label: "Slow Worker Threshold", Description: "Restart workers slower than this fraction of mean speed (0.0-1.0).", Type: "float64"},
+			{Key: "slow_worker_threshold", Label: "Slow Worker Threshold", Description: "Restart workers slower than this fraction of mean speed (0.0-1.0). Workers above 100 KB/s are never restarted for being slow.", Type: "float64"},
 			{Key: "slow_worker_grace_period", Label: "Slow Worker Grace", Description: "Grace period before checking worker speed (e.g., 5s).", Type: "duration"},
-			{Key: "stall_timeout", Label: "Stall Timeout", Description: "Restart workers with no data for this duration (e.g., 5s).", Type: "duration"},
+			{Key: "stall_timeout", Label: "Stall Timeout", Description: "Restart a connection that receives no data for this long (e.g., 5s). At most one connection per host is restarted every 10s.", Type: "duration"},
 			{Key: "speed_ema_alpha", Label: "Speed EMA Alpha", Description: "Exponential moving average smoothing factor (0.0-1.0).", Type: "float64"},
+			{Key: "max_download_retries", Label: "Max Download Retries", Description: "Times a failed download is retried automatically, resuming from its saved progress. 0 to disable.", Type: "int"},
+			{Key: "download_retry_delay", Label: "Download Retry Delay", Description: "Wait before the first automatic retry (e.g., 10s). Doubles for each further attempt, with some jitter.", Type: "duration"},
 		},
 	}
 }
@@ -106,11 +155,33 @@ func DefaultSettings() *Settings {
 			WarnOnDuplicate:    true,
 			ExtensionPrompt:    false,
 			AutoResume:         false,
+			PreallocateFiles:   false,
+			MinFreeSpace:       0, // Off; pausing on low space is opt-in
 		},
 		Connections: ConnectionSettings{
 			MaxConnectionsPerHost: 32,
 			MaxGlobalConnections:  100,
 			UserAgent:             "", // Empty means use default UA
+			SSHKeyFile:            "", // Empty means try the default ~/.ssh keys
+			TorrentDownloadLimit:  0,  // Unlimited
+			TorrentUploadLimit:    0,  // Unlimited
+			TorrentSeedRatio:      0,  // Stop when complete
+			StreamQuality:         "best",
+			S3Endpoint:            "", // Empty means AWS (or $AWS_ENDPOINT_URL)
+			S3Region:              "", // Empty means $AWS_REGION or us-east-1
+			S3PathStyle:           false,
+			OCIPlatform:           "", // Empty means linux/<host architecture>
+			HTTP3:                 "off",
+			HTTP3Hosts:            "",
+			HTTP3Connections:      1,
+			HTTP2:                 "off",
+			IPVersion:             "auto",
+			DNS:                   "system",
+			Resolve:               "",
+			TLSCAFile:             "",
+			TLSClientCert:         "",
+			TLSClientKey:          "",
+			TLSMinVersion:         "",
 		},
 		Chunks: ChunkSettings{
 			MinChunkSize:     2 * MB,
@@ -122,8 +193,10 @@ func DefaultSettings() *Settings {
 			MaxTaskRetries:        3,
 			SlowWorkerThreshold:   0.3,
 			SlowWorkerGracePeriod: 5 * time.Second,
-			StallTimeout:          3 * time.Second,
+			StallTimeout:          5 * time.Second,
 			SpeedEmaAlpha:         0.3,
+			MaxDownloadRetries:    3,
+			DownloadRetryDelay:    10 * time.Second,
 		},
 	}
 }
@@ -183,6 +256,26 @@ type RuntimeConfig struct {
 	MaxConnectionsPerHost int
 	MaxGlobalConnections  int
 	UserAgent             string
+	SSHKeyFile            string
+	TorrentDownloadLimit  int
+	TorrentUploadLimit    int
+	TorrentSeedRatio      float64
+	StreamQuality         string
+	S3Endpoint            string
+	S3Region              string
+	S3PathStyle           bool
+	OCIPlatform           string
+	HTTP3                 string
+	HTTP3Hosts            []string
+	HTTP3Connections      int
+	HTTP2                 string
+	IPVersion             string
+	DNS                   string
+	Resolve               []string
+	TLSCAFile             string
+	TLSClientCert         string
+	TLSClientKey          string
+	TLSMinVersion         string
 	MinChunkSize          int64
 	MaxChunkSize          int64
 	TargetChunkSize       int64
@@ -192,6 +285,10 @@ type RuntimeConfig struct {
 	SlowWorkerGracePeriod time.Duration
 	StallTimeout          time.Duration
 	SpeedEmaAlpha         float64
+	MaxDownloadRetries    int
+	DownloadRetryDelay    time.Duration
+	PreallocateFiles      bool
+	MinFreeSpace          int64 // Bytes
 }
 
 // ToRuntimeConfig creates a RuntimeConfig from user Settings
@@ -200,6 +297,26 @@ func (s *Settings) ToRuntimeConfig() *RuntimeConfig {
 		MaxConnectionsPerHost: s.Connections.MaxConnectionsPerHost,
 		MaxGlobalConnections:  s.Connections.MaxGlobalConnections,
 		UserAgent:             s.Connections.UserAgent,
+		SSHKeyFile:            s.Connections.SSHKeyFile,
+		TorrentDownloadLimit:  s.Connections.TorrentDownloadLimit,
+		TorrentUploadLimit:    s.Connections.TorrentUploadLimit,
+		TorrentSeedRatio:      s.Connections.TorrentSeedRatio,
+		StreamQuality:         s.Connections.StreamQuality,
+		S3Endpoint:            s.Connections.S3Endpoint,
+		S3Region:              s.Connections.S3Region,
+		S3PathStyle:           s.Connections.S3PathStyle,
+		OCIPlatform:           s.Connections.OCIPlatform,
+		HTTP3:                 s.Connections.HTTP3,
+		HTTP3Hosts:            splitList(s.Connections.HTTP3Hosts),
+		HTTP3Connections:      s.Connections.HTTP3Connections,
+		HTTP2:                 s.Connections.HTTP2,
+		IPVersion:             s.Connections.IPVersion,
+		DNS:                   s.Connections.DNS,
+		Resolve:               splitList(s.Connections.Resolve),
+		TLSCAFile:             s.Connections.TLSCAFile,
+		TLSClientCert:         s.Connections.TLSClientCert,
+		TLSClientKey:          s.Connections.TLSClientKey,
+		TLSMinVersion:         s.Connections.TLSMinVersion,
 		MinChunkSize:          s.Chunks.MinChunkSize,
 		MaxChunkSize:          s.Chunks.MaxChunkSize,
 		TargetChunkSize:       s.Chunks.TargetChunkSize,
@@ -209,5 +326,20 @@ func (s *Settings) ToRuntimeConfig() *RuntimeConfig {
 		SlowWorkerGracePeriod: s.Performance.SlowWorkerGracePeriod,
 		StallTimeout:          s.Performance.StallTimeout,
 		SpeedEmaAlpha:         s.Performance.SpeedEmaAlpha,
+		MaxDownloadRetries:    s.Performance.MaxDownloadRetries,
+		DownloadRetryDelay:    s.Performance.DownloadRetryDelay,
+		PreallocateFiles:      s.General.PreallocateFiles,
+		MinFreeSpace:          int64(s.General.MinFreeSpace) * MB,
 	}
 }
+
+// splitList splits a comma separated setting into its trimmed, non-empty items
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
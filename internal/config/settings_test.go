@@ -34,6 +34,9 @@ func TestDefaultSettings(t *testing.T) {
 		if settings.General.AutoResume {
 			t.Error("AutoResume should be false by default")
 		}
+		if settings.General.MinFreeSpace != 0 {
+			t.Errorf("MinFreeSpace should be off by default, got: %d", settings.General.MinFreeSpace)
+		}
 	})
 
 	// Verify Connection settings
@@ -321,6 +324,145 @@ func TestToRuntimeConfig(t *testing.T) {
 	if runtime.SpeedEmaAlpha != settings.Performance.SpeedEmaAlpha {
 		t.Error("SpeedEmaAlpha not correctly mapped")
 	}
+	if runtime.MaxDownloadRetries != settings.Performance.MaxDownloadRetries {
+		t.Error("MaxDownloadRetries not correctly mapped")
+	}
+	if runtime.DownloadRetryDelay != settings.Performance.DownloadRetryDelay {
+		t.Error("DownloadRetryDelay not correctly mapped")
+	}
+}
+
+func TestToRuntimeConfig_TorrentSettings(t *testing.T) {
+	settings := DefaultSettings()
+	settings.Connections.TorrentDownloadLimit = 512 * KB
+	settings.Connections.TorrentUploadLimit = 64 * KB
+	settings.Connections.TorrentSeedRatio = 2.0
+
+	runtime := settings.ToRuntimeConfig()
+	if runtime.TorrentDownloadLimit != 512*KB {
+		t.Error("TorrentDownloadLimit not correctly mapped")
+	}
+	if runtime.TorrentUploadLimit != 64*KB {
+		t.Error("TorrentUploadLimit not correctly mapped")
+	}
+	if runtime.TorrentSeedRatio != 2.0 {
+		t.Error("TorrentSeedRatio not correctly mapped")
+	}
+}
+
+func TestToRuntimeConfig_StreamQuality(t *testing.T) {
+	settings := DefaultSettings()
+	if settings.Connections.StreamQuality != "best" {
+		t.Errorf("default StreamQuality = %q, want best", settings.Connections.StreamQuality)
+	}
+
+	settings.Connections.StreamQuality = "1280x720"
+	if runtime := settings.ToRuntimeConfig(); runtime.StreamQuality != "1280x720" {
+		t.Error("StreamQuality not correctly mapped")
+	}
+}
+
+func TestToRuntimeConfig_S3(t *testing.T) {
+	settings := DefaultSettings()
+	if settings.Connections.S3Endpoint != "" || settings.Connections.S3Region != "" || settings.Connections.S3PathStyle {
+		t.Errorf("S3 settings should default to AWS, got %+v", settings.Connections)
+	}
+
+	settings.Connections.S3Endpoint = "http://minio.local:9000"
+	settings.Connections.S3Region = "eu-central-1"
+	settings.Connections.S3PathStyle = true
+	runtime := settings.ToRuntimeConfig()
+	if runtime.S3Endpoint != "http://minio.local:9000" || runtime.S3Region != "eu-central-1" || !runtime.S3PathStyle {
+		t.Errorf("S3 settings not correctly mapped: %+v", runtime)
+	}
+}
+
+func TestToRuntimeConfig_OCIPlatform(t *testing.T) {
+	settings := DefaultSettings()
+	if settings.Connections.OCIPlatform != "" {
+		t.Errorf("OCIPlatform should default to the host platform, got %q", settings.Connections.OCIPlatform)
+	}
+
+	settings.Connections.OCIPlatform = "linux/arm64"
+	if got := settings.ToRuntimeConfig().OCIPlatform; got != "linux/arm64" {
+		t.Errorf("OCIPlatform = %q, want linux/arm64", got)
+	}
+}
+
+func TestToRuntimeConfig_HTTP3(t *testing.T) {
+	settings := DefaultSettings()
+	if settings.Connections.HTTP3 != "off" {
+		t.Errorf("HTTP3 should default to off, got %q", settings.Connections.HTTP3)
+	}
+
+	settings.Connections.HTTP3 = "auto"
+	settings.Connections.HTTP3Hosts = " cdn.example.com,, mirror.example.org "
+	settings.Connections.HTTP3Connections = 2
+	runtime := settings.ToRuntimeConfig()
+	if runtime.HTTP3 != "auto" || runtime.HTTP3Connections != 2 {
+		t.Errorf("HTTP3 = %q, HTTP3Connections = %d", runtime.HTTP3, runtime.HTTP3Connections)
+	}
+	if got := strings.Join(runtime.HTTP3Hosts, "|"); got != "cdn.example.com|mirror.example.org" {
+		t.Errorf("HTTP3Hosts = %q", got)
+	}
+}
+
+func TestToRuntimeConfig_HTTP2(t *testing.T) {
+	settings := DefaultSettings()
+	if settings.Connections.HTTP2 != "off" {
+		t.Errorf("HTTP2 should default to off, got %q", settings.Connections.HTTP2)
+	}
+
+	settings.Connections.HTTP2 = "streams"
+	if got := settings.ToRuntimeConfig().HTTP2; got != "streams" {
+		t.Errorf("HTTP2 = %q, want streams", got)
+	}
+}
+
+func TestToRuntimeConfig_IPVersion(t *testing.T) {
+	settings := DefaultSettings()
+	if settings.Connections.IPVersion != "auto" {
+		t.Errorf("IPVersion should default to auto, got %q", settings.Connections.IPVersion)
+	}
+
+	settings.Connections.IPVersion = "prefer-ipv6"
+	if got := settings.ToRuntimeConfig().IPVersion; got != "prefer-ipv6" {
+		t.Errorf("IPVersion = %q, want prefer-ipv6", got)
+	}
+}
+
+func TestToRuntimeConfig_DNS(t *testing.T) {
+	settings := DefaultSettings()
+	if settings.Connections.DNS != "system" || settings.Connections.Resolve != "" {
+		t.Errorf("DNS should default to system without overrides, got %q, %q", settings.Connections.DNS, settings.Connections.Resolve)
+	}
+
+	settings.Connections.DNS = "https://dns.example/dns-query"
+	settings.Connections.Resolve = "staging.example:443:10.0.0.5, ,cdn.example:*:[2001:db8::1]"
+	runtime := settings.ToRuntimeConfig()
+	if runtime.DNS != "https://dns.example/dns-query" {
+		t.Errorf("DNS = %q", runtime.DNS)
+	}
+	if got := strings.Join(runtime.Resolve, "|"); got != "staging.example:443:10.0.0.5|cdn.example:*:[2001:db8::1]" {
+		t.Errorf("Resolve = %q", got)
+	}
+}
+
+func TestToRuntimeConfig_TLS(t *testing.T) {
+	settings := DefaultSettings()
+	if settings.Connections.TLSCAFile != "" || settings.Connections.TLSMinVersion != "" {
+		t.Errorf("TLS settings should default to empty, got %+v", settings.Connections)
+	}
+
+	settings.Connections.TLSCAFile = "/etc/corp/ca.pem"
+	settings.Connections.TLSClientCert = "/etc/corp/me.pem"
+	settings.Connections.TLSClientKey = "/etc/corp/me-key.pem"
+	settings.Connections.TLSMinVersion = "1.3"
+	runtime := settings.ToRuntimeConfig()
+	if runtime.TLSCAFile != "/etc/corp/ca.pem" || runtime.TLSClientCert != "/etc/corp/me.pem" ||
+		runtime.TLSClientKey != "/etc/corp/me-key.pem" || runtime.TLSMinVersion != "1.3" {
+		t.Errorf("TLS runtime settings = %q, %q, %q, %q", runtime.TLSCAFile, runtime.TLSClientCert, runtime.TLSClientKey, runtime.TLSMinVersion)
+	}
 }
 
 func TestGetSettingsMetadata(t *testing.T) {
@@ -0,0 +1,71 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// TLSHost holds the TLS options for downloads from some hosts. Options that
+// are set replace the global TLS settings for these hosts.
+type TLSHost struct {
+	Hosts      []string `json:"hosts"`                 // Hosts, including their subdomains
+	CAFile     string   `json:"ca_file,omitempty"`     // PEM bundle trusted in addition to the system roots
+	ClientCert string   `json:"client_cert,omitempty"` // PEM client certificate for mutual TLS
+	ClientKey  string   `json:"client_key,omitempty"`  // PEM key of ClientCert, if not in the same file
+	MinVersion string   `json:"min_version,omitempty"` // "1.0", "1.1", "1.2" or "1.3"
+	Pins       []string `json:"pins,omitempty"`        // Base64 SHA-256 of the server's public key, "sha256//" prefix optional
+}
+
+// Matches reports whether the options apply to host
+func (h TLSHost) Matches(host string) bool {
+	host = strings.ToLower(host)
+	for _, name := range h.Hosts {
+		name = strings.ToLower(strings.TrimPrefix(name, "."))
+		if host == name || strings.HasSuffix(host, "."+name) {
+			return true
+		}
+	}
+	return false
+}
+
+// GetTLSHostsPath returns the path to the per-host TLS options.
+func GetTLSHostsPath() string {
+	return filepath.Join(GetSurgeDir(), "tls.json")
+}
+
+// LoadTLSHosts reads the per-host TLS options. Returns an empty list if there
+// are none.
+func LoadTLSHosts() ([]TLSHost, error) {
+	data, err := os.ReadFile(GetTLSHostsPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var hosts []TLSHost
+	if err := json.Unmarshal(data, &hosts); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", GetTLSHostsPath(), err)
+	}
+	for i, h := range hosts {
+		if len(h.Hosts) == 0 {
+			return nil, fmt.Errorf("invalid %s: entry %d has no hosts", GetTLSHostsPath(), i+1)
+		}
+	}
+	return hosts, nil
+}
+
+// LookupTLSHost returns the first entry of hosts that applies to host, or
+// nil if none does.
+func LookupTLSHost(hosts []TLSHost, host string) *TLSHost {
+	for i := range hosts {
+		if hosts[i].Matches(host) {
+			return &hosts[i]
+		}
+	}
+	return nil
+}
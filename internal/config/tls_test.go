@@ -0,0 +1,78 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestTLSHostMatches(t *testing.T) {
+	h := TLSHost{Hosts: []string{"artifacts.corp", ".Internal.Example"}}
+
+	tests := []struct {
+		host string
+		want bool
+	}{
+		{"artifacts.corp", true},
+		{"eu.artifacts.corp", true},
+		{"ARTIFACTS.corp", true},
+		{"repo.internal.example", true},
+		{"notartifacts.corp", false},
+		{"example", false},
+	}
+	for _, tt := range tests {
+		if got := h.Matches(tt.host); got != tt.want {
+			t.Errorf("Matches(%q) = %v, want %v", tt.host, got, tt.want)
+		}
+	}
+
+	hosts := []TLSHost{{Hosts: []string{"a.example"}, CAFile: "a.pem"}, {Hosts: []string{"example"}, CAFile: "any.pem"}}
+	if got := LookupTLSHost(hosts, "x.a.example"); got == nil || got.CAFile != "a.pem" {
+		t.Errorf("LookupTLSHost should return the first match, got %+v", got)
+	}
+	if got := LookupTLSHost(hosts, "other.test"); got != nil {
+		t.Errorf("LookupTLSHost(other.test) = %+v, want nil", got)
+	}
+}
+
+func TestLoadTLSHosts(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("relies on XDG_CONFIG_HOME")
+	}
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+
+	hosts, err := LoadTLSHosts()
+	if err != nil || len(hosts) != 0 {
+		t.Fatalf("LoadTLSHosts without a file = %v, %v; want empty", hosts, err)
+	}
+
+	write := func(content string) {
+		t.Helper()
+		if err := os.MkdirAll(filepath.Dir(GetTLSHostsPath()), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(GetTLSHostsPath(), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write(`[{"hosts":["artifacts.corp"],"ca_file":"/etc/corp/ca.pem","client_cert":"/etc/corp/me.pem","pins":["sha256//AAAA"]}]`)
+	hosts, err = LoadTLSHosts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hosts) != 1 || hosts[0].CAFile != "/etc/corp/ca.pem" || len(hosts[0].Pins) != 1 {
+		t.Errorf("LoadTLSHosts = %+v", hosts)
+	}
+
+	for _, invalid := range []string{
+		`[{"ca_file":"/etc/corp/ca.pem"}]`,
+		`{not json`,
+	} {
+		write(invalid)
+		if _, err := LoadTLSHosts(); err == nil {
+			t.Errorf("LoadTLSHosts(%s) should fail", invalid)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package downloader
+
+import (
+	"sync"
+	"time"
+
+	"github.com/junaid2005p/surge/internal/utils"
+)
+
+// connController is a hill-climbing controller for a download's connection
+// count. It adds a connection and keeps it while aggregate throughput rises;
+// when throughput plateaus it takes the connection back and waits a while
+// before probing again. Failing tasks make it back off.
+type connController struct {
+	throttle  *connThrottle
+	lastBytes int64
+	lastFails int64
+	lastSpeed float64
+	added     bool // The last step added a connection
+	hold      int  // Steps to wait before probing again
+
+	mu        sync.Mutex
+	bestSpeed float64 // Fastest interval so far
+	bestConns int     // Connections allowed during it
+}
+
+func newConnController(throttle *connThrottle, downloaded int64) *connController {
+	return &connController{throttle: throttle, lastBytes: downloaded}
+}
+
+// step takes a throughput sample of the last interval, given the total bytes
+// downloaded so far, and adjusts the connection limit
+func (c *connController) step(downloaded int64, interval time.Duration) {
+	speed := float64(downloaded-c.lastBytes) / interval.Seconds()
+	fails := c.throttle.failures.Load()
+	newFails := fails - c.lastFails
+	c.lastBytes, c.lastFails = downloaded, fails
+	defer func() { c.lastSpeed = speed }()
+
+	c.mu.Lock()
+	if speed > c.bestSpeed {
+		c.bestSpeed, c.bestConns = speed, c.throttle.Limit()
+	}
+	c.mu.Unlock()
+
+	switch {
+	case newFails >= adaptFailureThreshold:
+		c.added = false
+		c.hold = adaptHoldSteps
+		if c.throttle.adjust(-1) {
+			utils.Debug("Adaptive: %d failed tasks, connections -> %d", newFails, c.throttle.Limit())
+		}
+
+	case c.added:
+		// Keep the new connection only if it paid off
+		c.added = false
+		if speed > c.lastSpeed*(1+adaptMinGain) {
+			c.added = c.throttle.adjust(+1)
+		} else {
+			c.throttle.adjust(-1)
+			c.hold = adaptHoldSteps
+			utils.Debug("Adaptive: throughput plateaued at %.0f B/s, connections -> %d", speed, c.throttle.Limit())
+		}
+
+	case c.hold > 0:
+		c.hold--
+
+	default:
+		c.added = c.throttle.adjust(+1)
+	}
+}
+
+// best returns the connection count and throughput of the fastest interval,
+// or zeros if there was none
+func (c *connController) best() (conns int, speed float64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.bestConns, c.bestSpeed
+}
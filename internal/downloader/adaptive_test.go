@@ -0,0 +1,72 @@
+package downloader
+
+import (
+	"testing"
+	"time"
+)
+
+func TestConnController(t *testing.T) {
+	th := newConnThrottle(2, 8, GlobalMax, nil)
+	defer th.release()
+	c := newConnController(th, 0)
+
+	var downloaded int64
+	sample := func(speed int64) {
+		downloaded += speed * int64(adaptInterval/time.Second)
+		c.step(downloaded, adaptInterval)
+	}
+
+	// Probe upwards while throughput improves
+	sample(10 * MB)
+	if got := th.Limit(); got != 3 {
+		t.Fatalf("limit after first probe = %d, want 3", got)
+	}
+	sample(15 * MB)
+	if got := th.Limit(); got != 4 {
+		t.Fatalf("limit after gain = %d, want 4", got)
+	}
+
+	// A plateau takes the last connection back and holds
+	sample(15 * MB)
+	if got := th.Limit(); got != 3 {
+		t.Fatalf("limit after plateau = %d, want 3", got)
+	}
+	for i := 0; i < adaptHoldSteps; i++ {
+		sample(15 * MB)
+	}
+	if got := th.Limit(); got != 3 {
+		t.Fatalf("limit changed while holding: %d", got)
+	}
+	sample(15 * MB)
+	if got := th.Limit(); got != 4 {
+		t.Fatalf("limit after hold = %d, want a new probe to 4", got)
+	}
+
+	// Failing tasks make it back off
+	for i := 0; i < adaptFailureThreshold; i++ {
+		th.failed()
+	}
+	sample(15 * MB)
+	if got := th.Limit(); got != 3 {
+		t.Errorf("limit after failures = %d, want 3", got)
+	}
+}
+
+func TestGetMaxConnections(t *testing.T) {
+	d := NewConcurrentDownloader("test", nil, nil, &RuntimeConfig{MaxConnectionsPerHost: 16, MinChunkSize: 1 * MB})
+
+	tests := []struct {
+		fileSize int64
+		initial  int
+		want     int
+	}{
+		{100 * MB, 4, 16},
+		{5 * MB, 1, 5},
+		{512 * KB, 1, 1},
+	}
+	for _, tt := range tests {
+		if got := d.getMaxConnections(tt.fileSize, tt.initial); got != tt.want {
+			t.Errorf("getMaxConnections(%d, %d) = %d, want %d", tt.fileSize, tt.initial, got, tt.want)
+		}
+	}
+}
@@ -21,6 +21,12 @@ type BenchmarkMetrics struct {
 	ConnectionSum atomic.Int64
 	SampleCount   atomic.Int64
 
+	// Time workers spent reading from the network and the disk writer spent
+	// writing, in nanoseconds
+	NetworkTime atomic.Int64
+	DiskTime    atomic.Int64
+	DiskWrites  atomic.Int64
+
 	// Memory tracking
 	StartMemAlloc uint64
 	PeakMemAlloc  uint64
@@ -70,6 +76,17 @@ func (bm *BenchmarkMetrics) RecordBytes(n int64) {
 	bm.BytesReceived.Add(n)
 }
 
+// RecordNetworkTime adds time a worker spent reading from the network
+func (bm *BenchmarkMetrics) RecordNetworkTime(d time.Duration) {
+	bm.NetworkTime.Add(int64(d))
+}
+
+// RecordDiskWrite adds a write to disk and the time it took
+func (bm *BenchmarkMetrics) RecordDiskWrite(d time.Duration) {
+	bm.DiskTime.Add(int64(d))
+	bm.DiskWrites.Add(1)
+}
+
 // Finish marks the download as complete and captures final stats
 func (bm *BenchmarkMetrics) Finish(totalBytes int64) {
 	bm.EndTime = time.Now()
@@ -106,6 +123,9 @@ func (bm *BenchmarkMetrics) GetResults() BenchmarkResults {
 		MaxConnections: int(bm.ConnectionMax.Load()),
 		AvgConnections: avgConnections,
 		MemoryUsedMB:   float64(bm.PeakMemAlloc-bm.StartMemAlloc) / (1024 * 1024),
+		NetworkTime:    time.Duration(bm.NetworkTime.Load()),
+		DiskTime:       time.Duration(bm.DiskTime.Load()),
+		DiskWrites:     int(bm.DiskWrites.Load()),
 	}
 }
 
@@ -119,6 +139,9 @@ type BenchmarkResults struct {
 	MaxConnections int
 	AvgConnections float64
 	MemoryUsedMB   float64
+	NetworkTime    time.Duration // Summed over workers
+	DiskTime       time.Duration
+	DiskWrites     int
 }
 
 // String returns a formatted summary of the results
@@ -136,7 +159,10 @@ func formatBenchmarkResults(br BenchmarkResults) string {
 		"Retries:        " + formatInt(br.RetryCount) + "\n" +
 		"Max Connections:" + formatInt(br.MaxConnections) + "\n" +
 		"Avg Connections:" + formatFloat(br.AvgConnections, 1) + "\n" +
-		"Memory Used:    " + formatFloat(br.MemoryUsedMB, 2) + " MB\n"
+		"Memory Used:    " + formatFloat(br.MemoryUsedMB, 2) + " MB\n" +
+		"Network Time:   " + br.NetworkTime.Round(time.Millisecond).String() + "\n" +
+		"Disk Time:      " + br.DiskTime.Round(time.Millisecond).String() + "\n" +
+		"Disk Writes:    " + formatInt(br.DiskWrites) + "\n"
 }
 
 func formatFloat(f float64, decimals int) string {
@@ -95,6 +95,22 @@ func TestBenchmarkMetrics_RecordConnections(t *testing.T) {
 	}
 }
 
+func TestBenchmarkMetrics_RecordNetworkAndDiskTime(t *testing.T) {
+	m := NewBenchmarkMetrics()
+
+	m.RecordNetworkTime(300 * time.Millisecond)
+	m.RecordNetworkTime(200 * time.Millisecond)
+	m.RecordDiskWrite(50 * time.Millisecond)
+
+	results := m.GetResults()
+	if results.NetworkTime != 500*time.Millisecond {
+		t.Errorf("NetworkTime = %v, want 500ms", results.NetworkTime)
+	}
+	if results.DiskTime != 50*time.Millisecond || results.DiskWrites != 1 {
+		t.Errorf("DiskTime = %v, DiskWrites = %d; want 50ms, 1", results.DiskTime, results.DiskWrites)
+	}
+}
+
 func TestBenchmarkMetrics_Finish(t *testing.T) {
 	m := NewBenchmarkMetrics()
 
@@ -198,6 +214,7 @@ func TestBenchmarkResults_String(t *testing.T) {
 		"TTFB",
 		"Retries",
 		"Connections",
+		"Disk Time",
 	}
 
 	for _, substr := range expectedSubstrings {
@@ -2,10 +2,9 @@ package downloader
 
 import (
 	"context"
-	"crypto/tls"
+	"errors"
 	"fmt"
 	"io"
-	"net"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -13,6 +12,7 @@ import (
 	"sync/atomic"
 	"time"
 
+	"github.com/junaid2005p/surge/internal/config"
 	"github.com/junaid2005p/surge/internal/utils"
 
 	tea "github.com/charmbracelet/bubbletea"
@@ -36,8 +36,47 @@ type ConcurrentDownloader struct {
 	URL          string // For pause/resume
 	DestPath     string // For pause/resume
 	Runtime      *RuntimeConfig
+
+	// Opener replaces the HTTP range request for non-HTTP backends (e.g. SFTP).
+	// When nil, tasks are fetched with ranged GET requests against the URL.
+	Opener RangeOpener
+
+	// FetchURL, when set, is where ranged GETs are sent instead of the URL
+	// passed to Download (e.g. the http(s) form of a webdav:// URL)
+	FetchURL string
+
+	// Headers are added to every ranged GET, replacing defaults such as the
+	// User-Agent (e.g. headers and cookies from a URL resolver)
+	Headers http.Header
+
+	// ETag from the probe, saved with the state so a replacement URL can be
+	// checked against it
+	ETag string
+
+	// Client, when set, sends the ranged GETs instead of the shared download
+	// client (see newDownloadClient)
+	Client *http.Client
+
+	// Metrics, when set, collects performance measurements of the download
+	Metrics *BenchmarkMetrics
+
+	// HTTP2 is set when the server negotiated HTTP/2 for the probe. With
+	// HTTP2Streams the workers are then streams over a shared connection.
+	HTTP2 bool
+
+	throttle *connThrottle               // Backs off when the server answers 429/503
+	primed   atomic.Pointer[primedRange] // Open probe response, read by the first task
 }
 
+// ErrLinkRejected is returned when the server refuses a range request in a way
+// retrying cannot fix, typically an expired signed URL. Progress is saved so
+// the download can resume, possibly from a replacement URL (see ReplaceURL).
+var ErrLinkRejected = errors.New("link rejected by server")
+
+// RangeOpener opens a reader over the remote byte range [offset, offset+length).
+// The reader must stop returning data once ctx is cancelled.
+type RangeOpener func(ctx context.Context, offset, length int64) (io.ReadCloser, error)
+
 // NewConcurrentDownloader creates a new concurrent downloader with all required parameters
 func NewConcurrentDownloader(id string, progressCh chan<- tea.Msg, state *ProgressState, runtime *RuntimeConfig) *ConcurrentDownloader {
 	return &ConcurrentDownloader{
@@ -62,7 +101,7 @@ type ActiveTask struct {
 	StopAt        int64 // Atomic
 
 	// Health monitoring fields
-	LastActivity int64              // Atomic: Unix nano timestamp of last data received
+	LastActivity int64              // Atomic: Unix nano timestamp of last data received or read started
 	Speed        float64            // EMA-smoothed speed in bytes/sec (protected by mutex)
 	StartTime    time.Time          // When this task started
 	Cancel       context.CancelFunc // Cancel function to abort this task
@@ -137,6 +176,13 @@ func (q *TaskQueue) Close() {
 	q.mu.Unlock()
 }
 
+// Closed reports whether Close has been called
+func (q *TaskQueue) Closed() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.done
+}
+
 func (q *TaskQueue) Len() int {
 	q.mu.Lock()
 	defer q.mu.Unlock()
@@ -225,6 +271,14 @@ func (d *ConcurrentDownloader) getInitialConnections(fileSize int64) int {
 	return recConns
 }
 
+// getMaxConnections returns how many connections the adaptive controller may
+// grow a download to: the per-host limit, but no more than the file has
+// minimum-size chunks
+func (d *ConcurrentDownloader) getMaxConnections(fileSize int64, initial int) int {
+	chunks := fileSize / d.Runtime.GetMinChunkSize()
+	return max(initial, int(min(int64(d.Runtime.GetMaxConnectionsPerHost()), chunks)))
+}
+
 // calculateChunkSize determines optimal chunk size
 func (d *ConcurrentDownloader) calculateChunkSize(fileSize int64, numConns int) int64 {
 	targetChunks := int64(numConns * TasksPerWorker)
@@ -272,41 +326,16 @@ func createTasks(fileSize, chunkSize int64) []Task {
 	return tasks
 }
 
-// newConcurrentClient creates an http.Client tuned for concurrent downloads
-func (d *ConcurrentDownloader) newConcurrentClient(numConns int) *http.Client {
-	// Ensure we have enough connections per host
-	maxConns := d.Runtime.GetMaxConnectionsPerHost()
-	if numConns > maxConns {
-		maxConns = numConns
-	}
-
-	transport := &http.Transport{
-		// Connection pooling
-		MaxIdleConns:        DefaultMaxIdleConns,
-		MaxIdleConnsPerHost: maxConns + 2, // Slightly more than max to handle bursts
-		MaxConnsPerHost:     maxConns,
-
-		// Timeouts to prevent hung connections
-		IdleConnTimeout:       DefaultIdleConnTimeout,
-		TLSHandshakeTimeout:   DefaultTLSHandshakeTimeout,
-		ResponseHeaderTimeout: DefaultResponseHeaderTimeout,
-		ExpectContinueTimeout: DefaultExpectContinueTimeout,
-
-		// Performance tuning
-		DisableCompression: true,  // Files are usually already compressed
-		ForceAttemptHTTP2:  false, // FORCE HTTP/1.1 for multiple TCP connections
-		TLSNextProto:       make(map[string]func(authority string, c *tls.Conn) http.RoundTripper),
-
-		// Dial settings for TCP reliability
-		DialContext: (&net.Dialer{
-			Timeout:   DialTimeout,
-			KeepAlive: KeepAliveDuration,
-		}).DialContext,
-	}
-
-	return &http.Client{
-		Transport: transport,
+// primeTasks splits the first task so that it ends where the open probe
+// response does, letting it be read from that response
+func primeTasks(tasks []Task, primed *primedRange) []Task {
+	if primed == nil || len(tasks) == 0 || tasks[0].Length <= primed.length {
+		return tasks
 	}
+	first := tasks[0]
+	head := Task{Offset: first.Offset, Length: primed.length}
+	rest := Task{Offset: first.Offset + primed.length, Length: first.Length - primed.length}
+	return append([]Task{head, rest}, tasks[1:]...)
 }
 
 // IncompleteSuffix is appended to files while downloading
@@ -321,6 +350,11 @@ func (d *ConcurrentDownloader) Download(ctx context.Context, rawurl, destPath st
 	d.URL = rawurl
 	d.DestPath = destPath
 
+	fetchURL := rawurl
+	if d.FetchURL != "" {
+		fetchURL = d.FetchURL
+	}
+
 	// Working file has .surge suffix until download completes
 	workingPath := destPath + IncompleteSuffix
 
@@ -331,12 +365,42 @@ func (d *ConcurrentDownloader) Download(ctx context.Context, rawurl, destPath st
 		d.State.CancelFunc = cancel
 	}
 
-	// Determine connections and chunk size
+	// Determine connections and chunk size, from what was learned about the
+	// host if possible. Workers are started up to maxConns; the throttle and
+	// the adaptive controller decide how many of them hold a connection
 	numConns := d.getInitialConnections(fileSize)
 	chunkSize := d.calculateChunkSize(fileSize, numConns)
+	if profile := config.LookupHostProfile(profileHost(fetchURL)); profile != nil && d.Opener == nil {
+		numConns, chunkSize = d.applyProfile(profile, fileSize, numConns, chunkSize)
+	}
+	maxConns := d.getMaxConnections(fileSize, numConns)
+	var reportLimit func(int)
+	if d.State != nil {
+		reportLimit = func(n int) { d.State.ConnLimit.Store(int32(n)) }
+	}
+	if d.HTTP2 && d.Opener == nil && d.Runtime.GetHTTP2() == HTTP2Streams {
+		// Workers are streams over one connection, which is all that counts
+		// against the global budget
+		maxConns = min(maxConns, http2StreamWorkers)
+		numConns = min(numConns, maxConns)
+		d.throttle = newStreamThrottle(numConns, maxConns, reportLimit)
+	} else {
+		d.throttle = newConnThrottle(numConns, maxConns, d.Runtime.GetMaxGlobalConnections(), reportLimit)
+	}
+	defer d.throttle.release()
 
-	// Create tuned HTTP client for concurrent downloads
-	client := d.newConcurrentClient(numConns)
+	// Create tuned HTTP client for concurrent downloads (not needed for custom openers)
+	client := d.Client
+	if client == nil && d.Opener == nil {
+		client = newDownloadClient(d.Runtime)
+	}
+	defer func() {
+		if p := d.primed.Swap(nil); p != nil {
+			p.close()
+		}
+	}()
+
+	utils.Debug("Connections already open to the host: %d", hostConnections(fetchURL))
 
 	if verbose {
 		fmt.Printf("File size: %s, connections: %d, chunk size: %s\n",
@@ -366,14 +430,22 @@ func (d *ConcurrentDownloader) Download(ctx context.Context, rawurl, destPath st
 		utils.Debug("Resuming from saved state: %d tasks, %d bytes downloaded", len(tasks), savedState.Downloaded)
 	} else {
 		// Fresh download: preallocate file and create new tasks
-		if err := outFile.Truncate(fileSize); err != nil {
+		if d.Runtime.GetPreallocateFiles() {
+			err = preallocate(outFile, fileSize)
+		} else {
+			err = outFile.Truncate(fileSize)
+		}
+		if err != nil {
 			return fmt.Errorf("failed to preallocate file: %w", err)
 		}
-		tasks = createTasks(fileSize, chunkSize)
+		tasks = primeTasks(createTasks(fileSize, chunkSize), d.primed.Load())
 	}
 	queue := NewTaskQueue()
 	queue.PushMultiple(tasks)
 
+	// Workers hand filled buffers to the writer instead of writing themselves
+	writer := newDiskWriter(outFile, d.Metrics)
+
 	// Start time for stats
 	startTime := time.Now()
 
@@ -420,15 +492,38 @@ func (d *ConcurrentDownloader) Download(ctx context.Context, rawurl, destPath st
 			case <-balancerCtx.Done():
 				return
 			case <-ticker.C:
-				if queue.Len() == 0 && int(queue.IdleWorkers()) == numConns {
+				// Workers held back by the throttle hold no tasks
+				if queue.Len() == 0 && int(queue.IdleWorkers())+d.throttle.Parked() == maxConns {
 					queue.Close()
+					d.throttle.wake()
 					return
 				}
 			}
 		}
 	}()
 
-	// Health monitor: detect slow workers
+	// Adaptive controller: tune the number of connections to the throughput
+	var controller *connController
+	if d.State != nil && maxConns > 1 {
+		controller = newConnController(d.throttle, d.State.Downloaded.Load())
+		go func() {
+			ticker := time.NewTicker(adaptInterval)
+			defer ticker.Stop()
+
+			for {
+				select {
+				case <-balancerCtx.Done():
+					return
+				case <-ticker.C:
+					controller.step(d.State.Downloaded.Load(), adaptInterval)
+				}
+			}
+		}()
+	}
+
+	// Health monitor: restart slow workers. Stalled ones are restarted by
+	// their read deadline (see watchStall).
+	host := profileHost(fetchURL)
 	go func() {
 		ticker := time.NewTicker(healthCheckInterval)
 		defer ticker.Stop()
@@ -438,22 +533,23 @@ func (d *ConcurrentDownloader) Download(ctx context.Context, rawurl, destPath st
 			case <-balancerCtx.Done():
 				return
 			case <-ticker.C:
-				d.checkWorkerHealth()
+				d.checkWorkerHealth(host)
 			}
 		}
 	}()
 
 	// Start workers
 	var wg sync.WaitGroup
-	workerErrors := make(chan error, numConns)
+	workerErrors := make(chan error, maxConns)
 
-	for i := 0; i < numConns; i++ {
+	for i := 0; i < maxConns; i++ {
 		wg.Add(1)
 		go func(workerID int) {
 			defer wg.Done()
-			err := d.worker(downloadCtx, workerID, rawurl, outFile, queue, fileSize, startTime, verbose, client)
+			err := d.worker(downloadCtx, workerID, fetchURL, writer, queue, fileSize, startTime, verbose, client)
 			if err != nil && err != context.Canceled {
 				workerErrors <- err
+				cancel() // Stop the other workers; their progress is saved below
 			}
 		}(i)
 	}
@@ -473,68 +569,30 @@ func (d *ConcurrentDownloader) Download(ctx context.Context, rawurl, destPath st
 		}
 	}
 
+	// All data read must be on disk before progress is saved
+	if err := writer.close(); err != nil {
+		downloadErr = err
+	}
+
 	// Handle pause: save state and exit gracefully
 	if d.State != nil && d.State.IsPaused() {
-		// Collect remaining tasks
-		remainingTasks := queue.DrainRemaining()
-
-		// Also collect active tasks as remaining work
-		d.activeMu.Lock()
-		for _, active := range d.activeTasks {
-			current := atomic.LoadInt64(&active.CurrentOffset)
-			stopAt := atomic.LoadInt64(&active.StopAt)
-			if current < stopAt {
-				remainingTasks = append(remainingTasks, Task{
-					Offset: current,
-					Length: stopAt - current,
-				})
-			}
-		}
-		d.activeMu.Unlock()
-
-		// Calculate Downloaded from remaining tasks (ensures consistency)
-		var remainingBytes int64
-		for _, task := range remainingTasks {
-			remainingBytes += task.Length
-		}
-		computedDownloaded := fileSize - remainingBytes
-
-		// Debug: compare atomic counter vs computed value to verify fix
-		atomicDownloaded := d.State.Downloaded.Load()
-		if atomicDownloaded != computedDownloaded {
-			utils.Debug("PAUSE FIX: Atomic counter=%d, Computed from tasks=%d, Diff=%d bytes",
-				atomicDownloaded, computedDownloaded, atomicDownloaded-computedDownloaded)
-		}
-
-		// Save state for resume (use computed value for consistency)
-		state := &DownloadState{
-			URL:        d.URL,
-			ID:         d.ID,
-			DestPath:   destPath,
-			TotalSize:  fileSize,
-			Downloaded: computedDownloaded, // FIX: Use computed value instead of atomic counter
-			Tasks:      remainingTasks,
-			Filename:   filepath.Base(destPath),
-		}
-		if err := SaveState(d.URL, destPath, state); err != nil {
-			utils.Debug("Failed to save pause state: %v", err)
-		}
-
-		utils.Debug("Download paused, state saved (Downloaded=%d, RemainingTasks=%d, RemainingBytes=%d)",
-			computedDownloaded, len(remainingTasks), remainingBytes)
+		d.saveProgress(queue, destPath, fileSize, writer.Lost(), nil)
 		return nil // Graceful exit, not an error
 	}
 
+	// Handle failure: keep progress so the download can be retried
+	// (unless the download itself was cancelled)
+	if downloadErr != nil && ctx.Err() == nil {
+		d.saveProgress(queue, destPath, fileSize, writer.Lost(), downloadErr)
+		return downloadErr
+	}
+
 	// Handle cancel: context was cancelled but not via Pause() - just exit cleanly
 	// The .surge file remains for cleanup by the TUI (which will delete it)
 	if downloadCtx.Err() == context.Canceled {
 		return nil
 	}
 
-	if downloadErr != nil {
-		return downloadErr
-	}
-
 	// Final sync
 	if err := outFile.Sync(); err != nil {
 		return fmt.Errorf("failed to sync file: %w", err)
@@ -551,22 +609,89 @@ func (d *ConcurrentDownloader) Download(ctx context.Context, rawurl, destPath st
 	// Delete state file on successful completion
 	_ = DeleteState(d.ID, d.URL, destPath)
 
+	// Remember what worked for the next download from this host
+	if d.Opener == nil && fileSize >= minProfileSize {
+		sessionBytes := fileSize
+		if isResume {
+			sessionBytes -= savedState.Downloaded
+		}
+		recordProfile(fetchURL, d.learnedProfile(controller, chunkSize, sessionBytes, time.Since(startTime)))
+	}
+
 	// Note: Download completion notifications are handled by the TUI via DownloadCompleteMsg
 
 	return nil
 }
 
-// worker downloads tasks from the queue
-func (d *ConcurrentDownloader) worker(ctx context.Context, id int, rawurl string, file *os.File, queue *TaskQueue, totalSize int64, startTime time.Time, verbose bool, client *http.Client) error {
-	// Get pooled buffer
-	bufPtr := bufPool.Get().(*[]byte)
-	defer bufPool.Put(bufPtr)
-	buf := *bufPtr
+// saveProgress saves the remaining work of a paused or failed (err != nil)
+// download for resume. lost are ranges that were downloaded but not written.
+func (d *ConcurrentDownloader) saveProgress(queue *TaskQueue, destPath string, fileSize int64, lost []Task, err error) {
+	// Collect remaining tasks
+	remainingTasks := append(queue.DrainRemaining(), lost...)
+
+	// Also collect active tasks as remaining work
+	d.activeMu.Lock()
+	for _, active := range d.activeTasks {
+		current := atomic.LoadInt64(&active.CurrentOffset)
+		stopAt := atomic.LoadInt64(&active.StopAt)
+		if current < stopAt {
+			remainingTasks = append(remainingTasks, Task{
+				Offset: current,
+				Length: stopAt - current,
+			})
+		}
+	}
+	d.activeMu.Unlock()
+
+	// Calculate Downloaded from remaining tasks (ensures consistency)
+	var remainingBytes int64
+	for _, task := range remainingTasks {
+		remainingBytes += task.Length
+	}
+	computedDownloaded := fileSize - remainingBytes
 
+	// Debug: compare atomic counter vs computed value to verify fix
+	if d.State != nil {
+		atomicDownloaded := d.State.Downloaded.Load()
+		if atomicDownloaded != computedDownloaded {
+			utils.Debug("PAUSE FIX: Atomic counter=%d, Computed from tasks=%d, Diff=%d bytes",
+				atomicDownloaded, computedDownloaded, atomicDownloaded-computedDownloaded)
+		}
+	}
+
+	// Save state for resume (use computed value for consistency)
+	state := &DownloadState{
+		URL:        d.URL,
+		ID:         d.ID,
+		DestPath:   destPath,
+		TotalSize:  fileSize,
+		Downloaded: computedDownloaded, // FIX: Use computed value instead of atomic counter
+		Tasks:      remainingTasks,
+		Filename:   filepath.Base(destPath),
+		ETag:       d.ETag,
+	}
+	if err != nil {
+		state.Error = err.Error()
+	}
+	if err := SaveState(d.URL, destPath, state); err != nil {
+		utils.Debug("Failed to save download state: %v", err)
+	}
+
+	utils.Debug("Download stopped, state saved (Downloaded=%d, RemainingTasks=%d, RemainingBytes=%d)",
+		computedDownloaded, len(remainingTasks), remainingBytes)
+}
+
+// worker downloads tasks from the queue
+func (d *ConcurrentDownloader) worker(ctx context.Context, id int, rawurl string, writer *diskWriter, queue *TaskQueue, totalSize int64, startTime time.Time, verbose bool, client *http.Client) error {
 	utils.Debug("Worker %d started", id)
 	defer utils.Debug("Worker %d finished", id)
 
 	for {
+		// Wait while the server is throttling us
+		if err := d.throttle.wait(ctx, id, queue); err != nil {
+			return err
+		}
+
 		// Get next task
 		task, ok := queue.Pop()
 
@@ -579,13 +704,9 @@ func (d *ConcurrentDownloader) worker(ctx context.Context, id int, rawurl string
 			d.State.ActiveWorkers.Add(1)
 		}
 
-		var lastErr error
 		maxRetries := d.Runtime.GetMaxTaskRetries()
-		for attempt := 0; attempt < maxRetries; attempt++ {
-			if attempt > 0 {
-				time.Sleep(time.Duration(1<<attempt) * retryBaseDelay) //Exponential backoff incase of failure
-			}
-
+		cancelled := false
+		lastErr := retryWithBackoff(maxRetries, func() (bool, error) {
 			// Register active task with per-task cancellable context
 			taskCtx, taskCancel := context.WithCancel(ctx)
 			now := time.Now()
@@ -603,7 +724,7 @@ func (d *ConcurrentDownloader) worker(ctx context.Context, id int, rawurl string
 			d.activeMu.Unlock()
 
 			taskStart := time.Now()
-			lastErr = d.downloadTask(taskCtx, rawurl, file, activeTask, buf, verbose, client)
+			lastErr := d.downloadTask(taskCtx, rawurl, writer, activeTask, verbose, client)
 
 			// CRITICAL: Capture external cancellation state BEFORE calling taskCancel()
 			// If we call taskCancel() first, taskCtx.Err() will always be non-nil
@@ -615,11 +736,8 @@ func (d *ConcurrentDownloader) worker(ctx context.Context, id int, rawurl string
 			// Check for PARENT context cancellation (pause/shutdown)
 			// This preserves active task info for pause handler to collect
 			if ctx.Err() != nil {
-				// DON'T delete from activeTasks - pause handler needs it
-				if d.State != nil {
-					d.State.ActiveWorkers.Add(-1)
-				}
-				return ctx.Err()
+				cancelled = true
+				return true, ctx.Err()
 			}
 
 			// Check if TASK context was cancelled by Health Monitor (not by us calling taskCancel)
@@ -645,9 +763,12 @@ func (d *ConcurrentDownloader) worker(ctx context.Context, id int, rawurl string
 				d.activeMu.Lock()
 				delete(d.activeTasks, id)
 				d.activeMu.Unlock()
-				// Clear lastErr so the fallthrough logic doesn't re-queue the original task
-				lastErr = nil
-				break // Exit retry loop, get next task
+				// No error, so the fallthrough logic doesn't re-queue the original task
+				return true, nil // Exit retry loop, get next task
+			}
+
+			if lastErr == nil {
+				d.throttle.succeeded()
 			}
 
 			// Only delete from activeTasks on normal completion (not cancelled)
@@ -663,7 +784,7 @@ func (d *ConcurrentDownloader) worker(ctx context.Context, id int, rawurl string
 					// We were stopped early this is expected success for the partial work
 					// The stolen part is already in the queue
 				}
-				break
+				return true, nil
 			}
 
 			// Resume-on-retry: update task to reflect remaining work
@@ -672,6 +793,31 @@ func (d *ConcurrentDownloader) worker(ctx context.Context, id int, rawurl string
 			if current > task.Offset {
 				task = Task{Offset: current, Length: task.Offset + task.Length - current}
 			}
+
+			// Throttled: hand the task back and wait for the server to recover
+			// instead of spending a retry
+			var throttledErr *ThrottledError
+			if errors.As(lastErr, &throttledErr) {
+				if _, err := d.throttle.throttled(throttledErr); err != nil {
+					return true, err
+				}
+				queue.Push(task)
+				return true, nil
+			}
+
+			// The disk is not going to recover by retrying
+			if errors.Is(lastErr, errDiskWrite) {
+				return true, lastErr
+			}
+			d.throttle.failed()
+			return false, lastErr
+		})
+		if cancelled {
+			// DON'T delete from activeTasks - pause handler needs it
+			if d.State != nil {
+				d.State.ActiveWorkers.Add(-1)
+			}
+			return ctx.Err()
 		}
 
 		// Update active workers
@@ -685,38 +831,93 @@ func (d *ConcurrentDownloader) worker(ctx context.Context, id int, rawurl string
 			// TODO: Could optimize by pushing only remaining part if we track that.
 			queue.Push(task)
 			utils.Debug("task at offset %d failed after %d retries: %v", task.Offset, maxRetries, lastErr)
+
+			// Other tasks would be rejected too; stop the download with progress saved
+			var throttledErr *ThrottledError
+			if errors.Is(lastErr, ErrLinkRejected) || errors.Is(lastErr, errDiskWrite) || errors.As(lastErr, &throttledErr) {
+				return lastErr
+			}
 		}
 	}
 }
 
-// downloadTask downloads a single byte range and writes to file at offset
-func (d *ConcurrentDownloader) downloadTask(ctx context.Context, rawurl string, file *os.File, activeTask *ActiveTask, buf []byte, verbose bool, client *http.Client) error {
+// retryWithBackoff runs attempt until it reports done, at most maxRetries
+// times, waiting exponentially longer before each retry. It returns the
+// error of the last attempt.
+func retryWithBackoff(maxRetries int, attempt func() (done bool, err error)) error {
+	var err error
+	for i := 0; i < maxRetries; i++ {
+		if i > 0 {
+			time.Sleep(time.Duration(1<<i) * retryBaseDelay)
+		}
+		var done bool
+		if done, err = attempt(); done {
+			break
+		}
+	}
+	return err
+}
+
+// openTaskRange opens the byte range for a task, either through the custom
+// Opener or with a ranged HTTP GET
+func (d *ConcurrentDownloader) openTaskRange(ctx context.Context, rawurl string, task Task, client *http.Client) (io.ReadCloser, error) {
+	if d.Opener != nil {
+		return d.Opener(ctx, task.Offset, task.Length)
+	}
+
+	// The first task continues the probe's response; cancelling the task
+	// cancels that request
+	if p := d.primed.Load(); p != nil && task.Offset == 0 && task.Length <= p.length && d.primed.CompareAndSwap(p, nil) {
+		return p.open(ctx), nil
+	}
+
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawurl, nil)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	task := activeTask.Task
-
 	req.Header.Set("User-Agent", d.Runtime.GetUserAgent())
+	applyHeaders(req, d.Headers)
 	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", task.Offset, task.Offset+task.Length-1))
 
 	resp, err := client.Do(req)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	defer resp.Body.Close()
 
-	// Handle rate limiting explicitly
-	if resp.StatusCode == http.StatusTooManyRequests {
-		return fmt.Errorf("rate limited (429)")
+	switch resp.StatusCode {
+	case http.StatusPartialContent, http.StatusOK:
+		return resp.Body, nil
+	case http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusGone:
+		resp.Body.Close()
+		return nil, fmt.Errorf("%w (%d)", ErrLinkRejected, resp.StatusCode)
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		resp.Body.Close()
+		return nil, &ThrottledError{
+			StatusCode: resp.StatusCode,
+			RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+		}
+	default:
+		resp.Body.Close()
+		return nil, fmt.Errorf("unexpected status: %d", resp.StatusCode)
 	}
+}
+
+// downloadTask downloads a single byte range, handing the data to the disk
+// writer buffer by buffer
+func (d *ConcurrentDownloader) downloadTask(ctx context.Context, rawurl string, writer *diskWriter, activeTask *ActiveTask, verbose bool, client *http.Client) error {
+	task := activeTask.Task
+
+	stall := d.watchStall(activeTask, profileHost(rawurl))
+	defer stall.suspend()
 
-	if resp.StatusCode != http.StatusPartialContent && resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("unexpected status: %d", resp.StatusCode)
+	body, err := d.openTaskRange(ctx, rawurl, task, client)
+	if err != nil {
+		return err
 	}
+	defer body.Close()
 
-	// Read and write at offset
+	// Read into buffers at offset
 	offset := task.Offset
 	for {
 		// Check if we should stop
@@ -726,8 +927,8 @@ func (d *ConcurrentDownloader) downloadTask(ctx context.Context, rawurl string,
 			return nil
 		}
 
-		// Calculate how much to read to fill buffer or hit stopAt/EOF
-		// We want to fill buf as much as possible to minimize WriteAt calls
+		// Calculate how much to read to fill buf or hit stopAt/EOF
+		// We want to fill buf as much as possible to minimize writes
 
 		// Limit by remaining length to stopAt
 		remaining := stopAt - offset
@@ -735,6 +936,10 @@ func (d *ConcurrentDownloader) downloadTask(ctx context.Context, rawurl string,
 			return nil
 		}
 
+		// The writer returns the buffer to the pool once it is written
+		bufPtr := bufPool.Get().(*[]byte)
+		buf := *bufPtr
+
 		readSize := int64(len(buf))
 		if readSize > remaining {
 			readSize = remaining
@@ -743,10 +948,17 @@ func (d *ConcurrentDownloader) downloadTask(ctx context.Context, rawurl string,
 		readSoFar := 0
 		var readErr error
 
+		// Restart the stall clock: time spent handing data to the writer
+		// is not the connection's fault
+		readStart := time.Now()
+		atomic.StoreInt64(&activeTask.LastActivity, readStart.UnixNano())
+		stall.extend()
 		for readSoFar < int(readSize) {
-			n, err := resp.Body.Read(buf[readSoFar:readSize])
+			n, err := body.Read(buf[readSoFar:readSize])
 			if n > 0 {
 				readSoFar += n
+				atomic.StoreInt64(&activeTask.LastActivity, time.Now().UnixNano())
+				stall.extend()
 			}
 			if err != nil {
 				readErr = err
@@ -757,6 +969,10 @@ func (d *ConcurrentDownloader) downloadTask(ctx context.Context, rawurl string,
 				break
 			}
 		}
+		if d.Metrics != nil {
+			d.Metrics.RecordNetworkTime(time.Since(readStart))
+			d.Metrics.RecordBytes(int64(readSoFar))
+		}
 
 		if readSoFar > 0 {
 
@@ -766,11 +982,13 @@ func (d *ConcurrentDownloader) downloadTask(ctx context.Context, rawurl string,
 			if offset+int64(readSoFar) > currentStopAt {
 				readSoFar = int(currentStopAt - offset)
 				if readSoFar <= 0 {
+					bufPool.Put(bufPtr)
 					return nil // stolen completely
 				}
 			}
 
-			_, writeErr := file.WriteAt(buf[:readSoFar], offset)
+			stall.suspend()
+			writeErr := writer.write(offset, bufPtr, readSoFar)
 			if writeErr != nil {
 				return fmt.Errorf("write error: %w", writeErr)
 			}
@@ -780,7 +998,6 @@ func (d *ConcurrentDownloader) downloadTask(ctx context.Context, rawurl string,
 			offset += int64(readSoFar)
 			atomic.StoreInt64(&activeTask.CurrentOffset, offset)
 			atomic.AddInt64(&activeTask.WindowBytes, int64(readSoFar))
-			atomic.StoreInt64(&activeTask.LastActivity, now.UnixNano())
 
 			// Update EMA speed using sliding window (2 second window)
 			windowElapsed := now.Sub(activeTask.WindowStart).Seconds()
@@ -813,6 +1030,8 @@ func (d *ConcurrentDownloader) downloadTask(ctx context.Context, rawurl string,
 					d.State.Downloaded.Add(contributed)
 				}
 			}
+		} else {
+			bufPool.Put(bufPtr)
 		}
 
 		if readErr == io.EOF {
@@ -903,78 +1122,61 @@ func (d *ConcurrentDownloader) StealWork(queue *TaskQueue) bool {
 	return true
 }
 
-// checkWorkerHealth detects slow workers and cancels them
-func (d *ConcurrentDownloader) checkWorkerHealth() {
+// checkWorkerHealth restarts the slowest worker if it is far behind the
+// others: below SlowWorkerThreshold times the mean speed and below
+// minAbsoluteSpeed, so fast connections are left alone however uneven they
+// are. The worker requeues the unfinished remainder of its task. At most one
+// worker is restarted per check, and none while the host is cooling down
+// from the last restart (see claimRestart).
+func (d *ConcurrentDownloader) checkWorkerHealth(host string) {
 	d.activeMu.Lock()
 	defer d.activeMu.Unlock()
 
-	if len(d.activeTasks) == 0 {
+	if len(d.activeTasks) < 2 {
 		return
 	}
 
 	now := time.Now()
+	gracePeriod := d.Runtime.GetSlowWorkerGracePeriod()
 
-	// First pass: calculate mean speed
+	// Slow: still receiving, but well below both the mean speed and
+	// minAbsoluteSpeed
 	var totalSpeed float64
 	var speedCount int
-	for _, active := range d.activeTasks {
+	speeds := make(map[int]float64, len(d.activeTasks))
+	for workerID, active := range d.activeTasks {
 		active.SpeedMu.Lock()
-		if active.Speed > 0 {
-			totalSpeed += active.Speed
+		speed := active.Speed
+		active.SpeedMu.Unlock()
+		if speed > 0 {
+			totalSpeed += speed
 			speedCount++
+			speeds[workerID] = speed
 		}
-		active.SpeedMu.Unlock()
 	}
-
-	var meanSpeed float64
-	if speedCount > 0 {
-		meanSpeed = totalSpeed / float64(speedCount)
+	if speedCount < 2 {
+		return // Nothing to compare against
 	}
+	meanSpeed := totalSpeed / float64(speedCount)
+	threshold := d.Runtime.GetSlowWorkerThreshold()
 
-	// Second pass: check for slow workers
-	for workerID, active := range d.activeTasks {
-
-		// timeSinceActivity := now.Sub(lastTime)
-		taskDuration := now.Sub(active.StartTime)
-
+	slowID := -1
+	var slowSpeed float64
+	for workerID, speed := range speeds {
 		// Skip workers that are still in their grace period
-		gracePeriod := d.Runtime.GetSlowWorkerGracePeriod()
-		if taskDuration < gracePeriod {
+		if now.Sub(d.activeTasks[workerID].StartTime) < gracePeriod {
 			continue
 		}
-
-		// It is an invasive function which was causing workers to be killed too vigorously.
-		// Maybe down the line we will add a timeout to kill workers after a worker is killed.
-		// The current implementation achieves better speed without this
-
-		// // Check for stalled worker (no activity for stallTimeout)
-		// stallTimeout := d.Runtime.GetStallTimeout()
-		// lastActivity := time.Unix(0, active.LastActivity)
-		// if now.Sub(lastActivity) > stallTimeout {
-		// 	utils.Debug("Health: Worker %d stalled (no activity for %v), cancelling", workerID, now.Sub(lastActivity))
-		// 	if active.Cancel != nil {
-		// 		active.Cancel()
-		// 	}
-		// 	continue
-		// }
-
-		// Check for slow worker
-		// Only cancel if: below threshold
-		if meanSpeed > 0 {
-			active.SpeedMu.Lock()
-			workerSpeed := active.Speed
-			active.SpeedMu.Unlock()
-
-			threshold := d.Runtime.GetSlowWorkerThreshold()
-			isBelowThreshold := workerSpeed > 0 && workerSpeed < threshold*meanSpeed
-
-			if isBelowThreshold {
-				utils.Debug("Health: Worker %d slow (%.2f KB/s vs mean %.2f KB/s, min %.2f KB/s), cancelling",
-					workerID, workerSpeed/1024, meanSpeed/1024, float64(minAbsoluteSpeed)/1024)
-				if active.Cancel != nil {
-					active.Cancel()
-				}
-			}
+		if speed < threshold*meanSpeed && speed < minAbsoluteSpeed && (slowID < 0 || speed < slowSpeed) {
+			slowID, slowSpeed = workerID, speed
+		}
+	}
+	if slowID >= 0 && claimRestart(host, now) {
+		utils.Debug("Health: Worker %d slow (%.2f KB/s vs mean %.2f KB/s), restarting",
+			slowID, slowSpeed/1024, meanSpeed/1024)
+		d.activeTasks[slowID].Cancel()
+		if d.State != nil {
+			d.State.SlowRestarts.Add(1)
 		}
 	}
 }
@@ -1,6 +1,8 @@
 package downloader
 
 import (
+	"os"
+	"strings"
 	"time"
 
 	tea "github.com/charmbracelet/bubbletea"
@@ -29,7 +31,8 @@ const (
 
 // Connection limits
 const (
-	PerHostMax = 64 // Max concurrent connections per host
+	PerHostMax = 64  // Max concurrent connections per host
+	GlobalMax  = 100 // Max concurrent connections across all downloads
 )
 
 // HTTP Client Tuning
@@ -58,9 +61,11 @@ type DownloadConfig struct {
 	Filename   string
 	Verbose    bool
 	IsResume   bool // True if this is explicitly a resume, not a fresh download
+	Attempt    int  // Automatic retries made so far after failures
 	ProgressCh chan<- tea.Msg
 	State      *ProgressState
 	Runtime    *RuntimeConfig // Dynamic settings from user config
+	Crawl      *CrawlOptions  // Recursively crawl the URL if it is an HTML directory listing
 }
 
 // RuntimeConfig holds dynamic settings that can override defaults
@@ -68,6 +73,27 @@ type RuntimeConfig struct {
 	MaxConnectionsPerHost int
 	MaxGlobalConnections  int
 	UserAgent             string
+	SSHKeyFile            string
+	TorrentDownloadLimit  int     // Bytes/second, 0 = unlimited
+	TorrentUploadLimit    int     // Bytes/second, 0 = unlimited
+	TorrentSeedRatio      float64 // Upload/size ratio to seed to, 0 = stop when complete
+	StreamQuality         string  // HLS/DASH rendition preference ("best", "worst", "720p", "2500k")
+	S3Endpoint            string  // Custom S3-compatible endpoint, empty for AWS
+	S3Region              string
+	S3PathStyle           bool
+	OCIPlatform           string   // Platform picked from OCI image indexes ("linux/arm64")
+	HTTP3                 string   // HTTP/3 mode: HTTP3Off, HTTP3Auto or HTTP3On
+	HTTP3Hosts            []string // Hosts that always try HTTP/3, including their subdomains
+	HTTP3Connections      int      // QUIC connections per host
+	HTTP2                 string   // HTTP/2 mode: HTTP2Off, HTTP2Connections or HTTP2Streams
+	IPVersion             string   // Which addresses of a host to use: IPVersionAuto, IPVersion4, ...
+	DNS                   string   // DNSSystem, a DNS server (host[:port]) or a DNS-over-HTTPS URL
+	Resolve               []string // Static host:port:address overrides, like curl --resolve
+	TLSCAFile             string   // PEM bundle trusted in addition to the system roots
+	TLSClientCert         string   // PEM client certificate for mutual TLS
+	TLSClientKey          string   // PEM key of TLSClientCert, if not in the same file
+	TLSMinVersion         string   // Minimum TLS version: "1.0", "1.1", "1.2" or "1.3"
+	TLSInsecure           bool     // Skip certificate verification
 	MinChunkSize          int64
 	MaxChunkSize          int64
 	TargetChunkSize       int64
@@ -77,6 +103,10 @@ type RuntimeConfig struct {
 	SlowWorkerGracePeriod time.Duration
 	StallTimeout          time.Duration
 	SpeedEmaAlpha         float64
+	MaxDownloadRetries    int           // Automatic retries of a failed download, 0 = none
+	DownloadRetryDelay    time.Duration // Delay before the first automatic retry
+	PreallocateFiles      bool          // Reserve disk space for downloads up front
+	MinFreeSpace          int64         // Bytes of disk space to keep free, 0 = no reserve
 }
 
 // GetUserAgent returns the configured user agent or the default
@@ -87,6 +117,85 @@ func (r *RuntimeConfig) GetUserAgent() string {
 	return r.UserAgent
 }
 
+// GetSSHKeyFile returns the configured SSH private key path, or empty to use the defaults
+func (r *RuntimeConfig) GetSSHKeyFile() string {
+	if r == nil {
+		return ""
+	}
+	return r.SSHKeyFile
+}
+
+// GetTorrentDownloadLimit returns the torrent download limit in bytes/second (0 = unlimited)
+func (r *RuntimeConfig) GetTorrentDownloadLimit() int {
+	if r == nil || r.TorrentDownloadLimit < 0 {
+		return 0
+	}
+	return r.TorrentDownloadLimit
+}
+
+// GetTorrentUploadLimit returns the torrent upload limit in bytes/second (0 = unlimited)
+func (r *RuntimeConfig) GetTorrentUploadLimit() int {
+	if r == nil || r.TorrentUploadLimit < 0 {
+		return 0
+	}
+	return r.TorrentUploadLimit
+}
+
+// GetTorrentSeedRatio returns the seeding ratio target (0 = don't seed after completion)
+func (r *RuntimeConfig) GetTorrentSeedRatio() float64 {
+	if r == nil || r.TorrentSeedRatio < 0 {
+		return 0
+	}
+	return r.TorrentSeedRatio
+}
+
+// GetStreamQuality returns the stream variant preference, defaulting to the best variant
+func (r *RuntimeConfig) GetStreamQuality() string {
+	if r == nil || r.StreamQuality == "" {
+		return "best"
+	}
+	return r.StreamQuality
+}
+
+// GetS3Endpoint returns the configured S3 endpoint, falling back to
+// $AWS_ENDPOINT_URL_S3 / $AWS_ENDPOINT_URL (empty means AWS)
+func (r *RuntimeConfig) GetS3Endpoint() string {
+	if r != nil && r.S3Endpoint != "" {
+		return r.S3Endpoint
+	}
+	if v := os.Getenv("AWS_ENDPOINT_URL_S3"); v != "" {
+		return v
+	}
+	return os.Getenv("AWS_ENDPOINT_URL")
+}
+
+// GetS3Region returns the configured S3 region, falling back to
+// $AWS_REGION / $AWS_DEFAULT_REGION and then us-east-1
+func (r *RuntimeConfig) GetS3Region() string {
+	if r != nil && r.S3Region != "" {
+		return r.S3Region
+	}
+	for _, env := range []string{"AWS_REGION", "AWS_DEFAULT_REGION"} {
+		if v := os.Getenv(env); v != "" {
+			return v
+		}
+	}
+	return "us-east-1"
+}
+
+// GetS3PathStyle reports whether buckets are addressed as endpoint/bucket/key
+func (r *RuntimeConfig) GetS3PathStyle() bool {
+	return r != nil && r.S3PathStyle
+}
+
+// GetOCIPlatform returns the platform to pick from image indexes, defaulting to linux on the host architecture
+func (r *RuntimeConfig) GetOCIPlatform() string {
+	if r == nil || r.OCIPlatform == "" {
+		return defaultOCIPlatform()
+	}
+	return r.OCIPlatform
+}
+
 // GetMaxConnectionsPerHost returns configured value or default
 func (r *RuntimeConfig) GetMaxConnectionsPerHost() int {
 	if r == nil || r.MaxConnectionsPerHost <= 0 {
@@ -95,6 +204,14 @@ func (r *RuntimeConfig) GetMaxConnectionsPerHost() int {
 	return r.MaxConnectionsPerHost
 }
 
+// GetMaxGlobalConnections returns configured value or default
+func (r *RuntimeConfig) GetMaxGlobalConnections() int {
+	if r == nil || r.MaxGlobalConnections <= 0 {
+		return GlobalMax
+	}
+	return r.MaxGlobalConnections
+}
+
 // GetMinChunkSize returns configured value or default
 func (r *RuntimeConfig) GetMinChunkSize() int64 {
 	if r == nil || r.MinChunkSize <= 0 {
@@ -138,6 +255,23 @@ const (
 	stallTimeout        = 5 * time.Second // Restart if no data for x seconds
 	speedEMAAlpha       = 0.3             // EMA smoothing factor
 	minAbsoluteSpeed    = 100 * KB        // Don't cancel workers above this speed
+
+	workerRestartCooldown = 10 * time.Second // Minimum time between worker restarts for a host
+
+	downloadRetryDelay    = 10 * time.Second // Delay before the first automatic download retry
+	maxDownloadRetryDelay = 10 * time.Minute // Cap for the doubling retry delay
+
+	// Throttling (429/503) constants
+	throttleBaseDelay   = 2 * time.Second // Pause after a throttled response without Retry-After (doubles)
+	maxRetryAfter       = 5 * time.Minute // Cap for Retry-After and the doubling pause
+	throttleRampUpTasks = 4               // Tasks to finish before allowing another connection
+	maxThrottleStrikes  = 10              // Throttled responses in a row before giving up
+
+	// Adaptive connection count constants
+	adaptInterval         = 2 * time.Second // Throughput sampling interval
+	adaptMinGain          = 0.05            // Relative throughput gain that justifies another connection
+	adaptHoldSteps        = 5               // Intervals to wait after a plateau before probing again
+	adaptFailureThreshold = 2               // Failed tasks per interval that make the controller back off
 )
 
 // GetMaxTaskRetries returns configured value or default
@@ -179,3 +313,140 @@ func (r *RuntimeConfig) GetSpeedEmaAlpha() float64 {
 	}
 	return r.SpeedEmaAlpha
 }
+
+// GetMaxDownloadRetries returns how often a failed download is retried automatically
+func (r *RuntimeConfig) GetMaxDownloadRetries() int {
+	if r == nil || r.MaxDownloadRetries < 0 {
+		return 0
+	}
+	return r.MaxDownloadRetries
+}
+
+// GetDownloadRetryDelay returns configured value or default
+func (r *RuntimeConfig) GetDownloadRetryDelay() time.Duration {
+	if r == nil || r.DownloadRetryDelay <= 0 {
+		return downloadRetryDelay
+	}
+	return r.DownloadRetryDelay
+}
+
+// GetPreallocateFiles reports whether disk space is reserved for downloads up front
+func (r *RuntimeConfig) GetPreallocateFiles() bool {
+	return r != nil && r.PreallocateFiles
+}
+
+// GetMinFreeSpace returns the bytes of disk space to keep free (0 = no reserve)
+func (r *RuntimeConfig) GetMinFreeSpace() int64 {
+	if r == nil || r.MinFreeSpace < 0 {
+		return 0
+	}
+	return r.MinFreeSpace
+}
+
+// GetHTTP3 returns the HTTP/3 mode, HTTP3Off unless set to a known mode
+func (r *RuntimeConfig) GetHTTP3() string {
+	if r == nil {
+		return HTTP3Off
+	}
+	switch r.HTTP3 {
+	case HTTP3Auto, HTTP3On:
+		return r.HTTP3
+	}
+	return HTTP3Off
+}
+
+// GetHTTP3Hosts returns the hosts that always try HTTP/3
+func (r *RuntimeConfig) GetHTTP3Hosts() []string {
+	if r == nil {
+		return nil
+	}
+	return r.HTTP3Hosts
+}
+
+// GetHTTP3Connections returns the QUIC connections to open per host
+func (r *RuntimeConfig) GetHTTP3Connections() int {
+	if r == nil || r.HTTP3Connections <= 0 {
+		return 1
+	}
+	return min(r.HTTP3Connections, maxHTTP3Connections)
+}
+
+// GetHTTP2 returns the HTTP/2 mode, HTTP2Off unless set to a known mode
+func (r *RuntimeConfig) GetHTTP2() string {
+	if r == nil {
+		return HTTP2Off
+	}
+	switch r.HTTP2 {
+	case HTTP2Connections, HTTP2Streams:
+		return r.HTTP2
+	}
+	return HTTP2Off
+}
+
+// GetIPVersion returns the IP version preference, IPVersionAuto unless set to a known one
+func (r *RuntimeConfig) GetIPVersion() string {
+	if r == nil {
+		return IPVersionAuto
+	}
+	switch r.IPVersion {
+	case IPVersion4, IPVersion6, IPVersionPrefer4, IPVersionPrefer6:
+		return r.IPVersion
+	}
+	return IPVersionAuto
+}
+
+// GetDNS returns the DNS resolver setting, DNSSystem unless set
+func (r *RuntimeConfig) GetDNS() string {
+	if r == nil {
+		return DNSSystem
+	}
+	if dns := strings.TrimSpace(r.DNS); dns != "" {
+		return dns
+	}
+	return DNSSystem
+}
+
+// GetResolve returns the static host:port:address overrides
+func (r *RuntimeConfig) GetResolve() []string {
+	if r == nil {
+		return nil
+	}
+	return r.Resolve
+}
+
+// GetTLSCAFile returns the CA bundle trusted in addition to the system roots
+func (r *RuntimeConfig) GetTLSCAFile() string {
+	if r == nil {
+		return ""
+	}
+	return r.TLSCAFile
+}
+
+// GetTLSClientCert returns the client certificate for mutual TLS
+func (r *RuntimeConfig) GetTLSClientCert() string {
+	if r == nil {
+		return ""
+	}
+	return r.TLSClientCert
+}
+
+// GetTLSClientKey returns the key of the client certificate
+func (r *RuntimeConfig) GetTLSClientKey() string {
+	if r == nil {
+		return ""
+	}
+	return r.TLSClientKey
+}
+
+// GetTLSMinVersion returns the minimum TLS version, empty for Go's default
+func (r *RuntimeConfig) GetTLSMinVersion() string {
+	if r == nil {
+		return ""
+	}
+	return r.TLSMinVersion
+}
+
+// GetTLSInsecure reports whether certificate verification is skipped
+func (r *RuntimeConfig) GetTLSInsecure() bool {
+	return r != nil && r.TLSInsecure
+}
@@ -1,6 +1,7 @@
 package downloader
 
 import (
+	"runtime"
 	"testing"
 	"time"
 )
@@ -295,6 +296,24 @@ func TestRuntimeConfig_GetMaxTaskRetries(t *testing.T) {
 	}
 }
 
+func TestRuntimeConfig_DownloadRetries(t *testing.T) {
+	var nilRuntime *RuntimeConfig
+	if got := nilRuntime.GetMaxDownloadRetries(); got != 0 {
+		t.Errorf("GetMaxDownloadRetries() on nil = %d, want 0", got)
+	}
+	if got := nilRuntime.GetDownloadRetryDelay(); got != downloadRetryDelay {
+		t.Errorf("GetDownloadRetryDelay() on nil = %v, want %v", got, downloadRetryDelay)
+	}
+
+	rc := &RuntimeConfig{MaxDownloadRetries: 4, DownloadRetryDelay: 30 * time.Second}
+	if got := rc.GetMaxDownloadRetries(); got != 4 {
+		t.Errorf("GetMaxDownloadRetries() = %d, want 4", got)
+	}
+	if got := rc.GetDownloadRetryDelay(); got != 30*time.Second {
+		t.Errorf("GetDownloadRetryDelay() = %v, want 30s", got)
+	}
+}
+
 func TestRuntimeConfig_GetSlowWorkerThreshold(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -375,6 +394,120 @@ func TestRuntimeConfig_GetSpeedEmaAlpha(t *testing.T) {
 	}
 }
 
+func TestRuntimeConfig_TorrentLimits(t *testing.T) {
+	tests := []struct {
+		name         string
+		runtime      *RuntimeConfig
+		wantDownload int
+		wantUpload   int
+		wantRatio    float64
+	}{
+		{"nil config", nil, 0, 0, 0},
+		{"custom values", &RuntimeConfig{TorrentDownloadLimit: 512 * KB, TorrentUploadLimit: 64 * KB, TorrentSeedRatio: 1.5}, 512 * KB, 64 * KB, 1.5},
+		{"negative values", &RuntimeConfig{TorrentDownloadLimit: -1, TorrentUploadLimit: -1, TorrentSeedRatio: -1}, 0, 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.runtime.GetTorrentDownloadLimit(); got != tt.wantDownload {
+				t.Errorf("GetTorrentDownloadLimit() = %d, want %d", got, tt.wantDownload)
+			}
+			if got := tt.runtime.GetTorrentUploadLimit(); got != tt.wantUpload {
+				t.Errorf("GetTorrentUploadLimit() = %d, want %d", got, tt.wantUpload)
+			}
+			if got := tt.runtime.GetTorrentSeedRatio(); got != tt.wantRatio {
+				t.Errorf("GetTorrentSeedRatio() = %f, want %f", got, tt.wantRatio)
+			}
+		})
+	}
+}
+
+func TestRuntimeConfig_GetStreamQuality(t *testing.T) {
+	tests := []struct {
+		name     string
+		runtime  *RuntimeConfig
+		expected string
+	}{
+		{"nil config", nil, "best"},
+		{"empty value", &RuntimeConfig{}, "best"},
+		{"custom value", &RuntimeConfig{StreamQuality: "720p"}, "720p"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.runtime.GetStreamQuality(); got != tt.expected {
+				t.Errorf("GetStreamQuality() = %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestRuntimeConfig_GetS3Endpoint(t *testing.T) {
+	tests := []struct {
+		name     string
+		runtime  *RuntimeConfig
+		env      string
+		expected string
+	}{
+		{"nil config", nil, "", ""},
+		{"env fallback", &RuntimeConfig{}, "http://env.local:9000", "http://env.local:9000"},
+		{"custom value wins", &RuntimeConfig{S3Endpoint: "http://minio.local:9000"}, "http://env.local:9000", "http://minio.local:9000"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("AWS_ENDPOINT_URL_S3", "")
+			t.Setenv("AWS_ENDPOINT_URL", tt.env)
+			if got := tt.runtime.GetS3Endpoint(); got != tt.expected {
+				t.Errorf("GetS3Endpoint() = %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestRuntimeConfig_GetS3Region(t *testing.T) {
+	tests := []struct {
+		name     string
+		runtime  *RuntimeConfig
+		env      string
+		expected string
+	}{
+		{"nil config", nil, "", "us-east-1"},
+		{"env fallback", &RuntimeConfig{}, "ap-south-1", "ap-south-1"},
+		{"custom value wins", &RuntimeConfig{S3Region: "eu-west-1"}, "ap-south-1", "eu-west-1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("AWS_REGION", tt.env)
+			t.Setenv("AWS_DEFAULT_REGION", "")
+			if got := tt.runtime.GetS3Region(); got != tt.expected {
+				t.Errorf("GetS3Region() = %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestRuntimeConfig_GetOCIPlatform(t *testing.T) {
+	tests := []struct {
+		name     string
+		runtime  *RuntimeConfig
+		expected string
+	}{
+		{"nil config", nil, "linux/" + runtime.GOARCH},
+		{"empty value", &RuntimeConfig{}, "linux/" + runtime.GOARCH},
+		{"custom value", &RuntimeConfig{OCIPlatform: "linux/arm/v7"}, "linux/arm/v7"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.runtime.GetOCIPlatform(); got != tt.expected {
+				t.Errorf("GetOCIPlatform() = %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
+
 // =============================================================================
 // RuntimeConfig Complete Configuration Test
 // =============================================================================
@@ -0,0 +1,170 @@
+package downloader
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/junaid2005p/surge/internal/messages"
+	"github.com/junaid2005p/surge/internal/utils"
+)
+
+// DefaultCrawlDepth is how many subdirectory levels a recursive crawl follows by default
+const DefaultCrawlDepth = 5
+
+// CrawlOptions turns a download of an HTTP directory listing (Apache, nginx
+// or lighttpd autoindex pages) into a recursive crawl of the files below it
+type CrawlOptions struct {
+	Depth   int      // Subdirectory levels to follow; 0 only queues files of the start directory
+	Include []string // Glob patterns; when set, only matching files are queued
+	Exclude []string // Glob patterns of files to skip
+}
+
+// matches reports whether a file passes the include and exclude filters.
+// Patterns are matched against both the file name and its path relative to
+// the start directory, so "*.iso" and "images/*.iso" both work.
+func (o *CrawlOptions) matches(rel string) bool {
+	match := func(patterns []string) bool {
+		for _, p := range patterns {
+			if ok, _ := path.Match(p, path.Base(rel)); ok {
+				return true
+			}
+			if ok, _ := path.Match(p, rel); ok {
+				return true
+			}
+		}
+		return false
+	}
+	if len(o.Include) > 0 && !match(o.Include) {
+		return false
+	}
+	return !match(o.Exclude)
+}
+
+// listingLinks returns the href targets of every <a> element in an HTML page, resolved against base
+func listingLinks(page []byte, base *url.URL) []*url.URL {
+	var links []*url.URL
+	for _, l := range pageLinks(page, base) {
+		if l.Tag == "a" {
+			links = append(links, l.URL)
+		}
+	}
+	return links
+}
+
+// crawlListing walks the directory listing at rawurl and returns the paths of
+// every file below it that passes the filters. Only links on the same host
+// and below the start directory are followed; sort links (?C=N;O=D) and
+// parent directory links are ignored.
+func crawlListing(ctx context.Context, rawurl string, opts *CrawlOptions, runtime *RuntimeConfig) ([]string, error) {
+	root, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, fmt.Errorf("invalid url: %w", err)
+	}
+	rootPath := collectionPath(root.Path)
+
+	type dir struct {
+		path  string
+		depth int
+	}
+	var files []string
+	seen := map[string]bool{rootPath: true}
+	pending := []dir{{rootPath, 0}}
+
+	for len(pending) > 0 {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		d := pending[0]
+		pending = pending[1:]
+
+		page := *root
+		page.Path, page.RawPath, page.RawQuery, page.Fragment = d.path, "", "", ""
+		body, err := fetchSmall(ctx, page.String(), nil, runtime)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch listing %s: %w", page.String(), err)
+		}
+
+		for _, link := range listingLinks(body, &page) {
+			if link.Scheme != root.Scheme || link.Host != root.Host || link.RawQuery != "" {
+				continue
+			}
+			isDir := strings.HasSuffix(link.Path, "/")
+			p := path.Clean(link.Path)
+			if isDir {
+				p = collectionPath(p)
+			}
+			if seen[p] || !strings.HasPrefix(p, rootPath) {
+				continue
+			}
+			seen[p] = true
+
+			if isDir {
+				if d.depth < opts.Depth {
+					pending = append(pending, dir{p, d.depth + 1})
+				}
+				continue
+			}
+			if !opts.matches(strings.TrimPrefix(p, rootPath)) {
+				continue
+			}
+			files = append(files, p)
+			if len(files) > maxDiscoveredFiles {
+				return nil, fmt.Errorf("directory listing has more than %d files", maxDiscoveredFiles)
+			}
+		}
+	}
+	return files, nil
+}
+
+// alreadyDownloaded reports whether f's target exists locally with the remote size
+func alreadyDownloaded(ctx context.Context, f messages.DiscoveredFile, runtime *RuntimeConfig) bool {
+	u, err := url.Parse(f.URL)
+	if err != nil {
+		return false
+	}
+	info, err := os.Stat(filepath.Join(f.OutputPath, path.Base(u.Path)))
+	if err != nil || !info.Mode().IsRegular() {
+		return false
+	}
+	probe, err := probeServer(ctx, f.URL, "", runtime)
+	return err == nil && probe.FileSize == info.Size()
+}
+
+// queueHTTPCrawl crawls the directory listing at cfg.URL and queues every
+// matching file, mirroring the remote layout under the output path. Files
+// that already exist locally with the same size are skipped.
+func queueHTTPCrawl(ctx context.Context, cfg DownloadConfig) error {
+	rootURL := cfg.URL
+	if u, err := url.Parse(cfg.URL); err == nil {
+		// Relative links on the start page resolve against its directory
+		u.Path, u.RawPath = collectionPath(u.Path), ""
+		rootURL = u.String()
+	}
+
+	paths, err := crawlListing(ctx, rootURL, cfg.Crawl, cfg.Runtime)
+	if err != nil {
+		return err
+	}
+	if len(paths) == 0 {
+		return fmt.Errorf("no matching files found in %s", cfg.URL)
+	}
+	discovered, err := mirrorDiscoveredFiles(rootURL, cfg.OutputPath, paths)
+	if err != nil {
+		return err
+	}
+
+	files := discovered[:0]
+	for _, f := range discovered {
+		if alreadyDownloaded(ctx, f, cfg.Runtime) {
+			utils.Debug("Skipping %s: already downloaded", f.URL)
+			continue
+		}
+		files = append(files, f)
+	}
+	return queueDiscoveredFiles(cfg, files)
+}
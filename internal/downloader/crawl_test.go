@@ -0,0 +1,233 @@
+package downloader
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/junaid2005p/surge/internal/config"
+	"github.com/junaid2005p/surge/internal/messages"
+	"github.com/junaid2005p/surge/internal/testutil"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// startTestAutoindex serves files with generated directory listings. Even
+// directories get an Apache style page (with sort links), odd ones an nginx one.
+func startTestAutoindex(t *testing.T, files map[string][]byte) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p := strings.TrimPrefix(r.URL.Path, "/")
+		if data, ok := files[p]; ok {
+			http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(data))
+			return
+		}
+		if !strings.HasSuffix(r.URL.Path, "/") {
+			http.Redirect(w, r, r.URL.Path+"/", http.StatusMovedPermanently)
+			return
+		}
+
+		entries := map[string]bool{}
+		for name := range files {
+			if rest, ok := strings.CutPrefix(name, p); ok {
+				if dir, _, isDir := strings.Cut(rest, "/"); isDir {
+					entries[dir+"/"] = true
+				} else {
+					entries[rest] = true
+				}
+			}
+		}
+		if len(entries) == 0 {
+			http.NotFound(w, r)
+			return
+		}
+		names := make([]string, 0, len(entries))
+		for name := range entries {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprintf(w, "<html><head><title>Index of %s</title></head><body>\n", r.URL.Path)
+		if strings.Count(r.URL.Path, "/")%2 == 0 {
+			fmt.Fprint(w, `<table><tr><th><a href="?C=N;O=D">Name</a></th><th><a href="?C=S;O=A">Size</a></th></tr>`)
+			fmt.Fprint(w, `<tr><td><a href="/">Parent Directory</a></td></tr>`)
+			for _, name := range names {
+				fmt.Fprintf(w, "<tr><td><a href=\"%s\">%s</a></td></tr>\n", (&url.URL{Path: name}).EscapedPath(), name)
+			}
+			fmt.Fprint(w, "</table>")
+		} else {
+			fmt.Fprint(w, "<pre><a href=\"../\">../</a>\n")
+			for _, name := range names {
+				fmt.Fprintf(w, "<a href=\"%s\">%s</a>  01-Jan-2024 00:00  -\n", (&url.URL{Path: r.URL.Path + name}).EscapedPath(), name)
+			}
+			fmt.Fprint(w, "</pre>")
+		}
+		fmt.Fprint(w, `<a href="https://example.com/elsewhere.iso">mirror</a></body></html>`)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestListingLinks(t *testing.T) {
+	page := []byte(`<html><body><pre>
+<a href="../">../</a>
+<A HREF="sub/">sub/</A>
+<a href="file%20one.iso">file one.iso</a>
+<a href="/abs/path.bin">abs</a>
+<a name="anchor">no href</a>
+<a href="?C=M;O=A">sort</a>
+</pre></body></html>`)
+	base, _ := url.Parse("http://mirror.local/pub/")
+
+	var got []string
+	for _, link := range listingLinks(page, base) {
+		got = append(got, link.String())
+	}
+	want := []string{
+		"http://mirror.local/",
+		"http://mirror.local/pub/sub/",
+		"http://mirror.local/pub/file%20one.iso",
+		"http://mirror.local/abs/path.bin",
+		"http://mirror.local/pub/?C=M;O=A",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("listingLinks() =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestCrawlOptionsMatches(t *testing.T) {
+	tests := []struct {
+		name string
+		opts CrawlOptions
+		rel  string
+		want bool
+	}{
+		{"no filters", CrawlOptions{}, "a/b.iso", true},
+		{"include by name", CrawlOptions{Include: []string{"*.iso"}}, "a/b.iso", true},
+		{"include miss", CrawlOptions{Include: []string{"*.iso"}}, "a/b.txt", false},
+		{"include by path", CrawlOptions{Include: []string{"a/*"}}, "a/b.txt", true},
+		{"exclude by name", CrawlOptions{Exclude: []string{"*.sig"}}, "b.iso.sig", false},
+		{"exclude wins", CrawlOptions{Include: []string{"*"}, Exclude: []string{"b*"}}, "b.iso", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.opts.matches(tt.rel); got != tt.want {
+				t.Errorf("matches(%q) = %v, want %v", tt.rel, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTUIDownload_Crawl(t *testing.T) {
+	if err := config.EnsureDirs(); err != nil {
+		t.Fatalf("Failed to create config dirs: %v", err)
+	}
+	files := map[string][]byte{
+		"pub/distro/README.txt":                []byte("read me"),
+		"pub/distro/disc one.iso":              randomBytes(t, 512*KB),
+		"pub/distro/disc one.iso.sig":          []byte("signature"),
+		"pub/distro/current.iso":               []byte("already here"),
+		"pub/distro/stale.iso":                 []byte("newer remote copy"),
+		"pub/distro/arm/rootfs.iso":            randomBytes(t, 32*KB),
+		"pub/distro/arm/extra/tools.iso":       []byte("depth 2"),
+		"pub/distro/arm/extra/deeper/skip.iso": []byte("depth 3"),
+		"pub/other/outside.iso":                []byte("outside the start directory"),
+	}
+	server := startTestAutoindex(t, files)
+
+	outDir, cleanup, err := testutil.TempDir("surge-crawl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	// Same size is skipped, a different size is downloaded again
+	localRoot := filepath.Join(outDir, "distro")
+	if err := os.MkdirAll(localRoot, 0755); err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(filepath.Join(localRoot, "current.iso"), []byte("already here"), 0644)
+	os.WriteFile(filepath.Join(localRoot, "stale.iso"), []byte("old"), 0644)
+
+	progressCh := make(chan tea.Msg, ProgressChannelBuffer)
+	cfg := DownloadConfig{
+		URL:        server.URL + "/pub/distro",
+		OutputPath: outDir,
+		ID:         "crawl",
+		ProgressCh: progressCh,
+		State:      NewProgressState("crawl", 0),
+		Runtime:    &RuntimeConfig{MaxConnectionsPerHost: 4},
+		Crawl:      &CrawlOptions{Depth: 2, Include: []string{"*.iso"}},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if err := TUIDownload(ctx, cfg); err != nil {
+		t.Fatalf("crawl failed: %v", err)
+	}
+	close(progressCh)
+
+	var discovered []messages.DiscoveredFile
+	for msg := range progressCh {
+		switch m := msg.(type) {
+		case messages.DownloadsDiscoveredMsg:
+			discovered = append(discovered, m.Files...)
+		case messages.DownloadStartedMsg:
+			t.Error("crawl should not start a download of its own")
+		}
+	}
+
+	var got []string
+	for i, f := range discovered {
+		fileCfg := DownloadConfig{
+			URL:        f.URL,
+			OutputPath: f.OutputPath,
+			ID:         fmt.Sprintf("crawl-file-%d", i),
+			State:      NewProgressState("crawl-file", 0),
+			Runtime:    &RuntimeConfig{MaxConnectionsPerHost: 4},
+		}
+		if err := TUIDownload(ctx, fileCfg); err != nil {
+			t.Fatalf("download of %s failed: %v", f.URL, err)
+		}
+		rel, _ := filepath.Rel(outDir, f.OutputPath)
+		got = append(got, filepath.ToSlash(rel))
+	}
+
+	wantFiles := map[string]string{
+		"distro/disc one.iso":        "pub/distro/disc one.iso",
+		"distro/stale(1).iso":        "pub/distro/stale.iso",
+		"distro/arm/rootfs.iso":      "pub/distro/arm/rootfs.iso",
+		"distro/arm/extra/tools.iso": "pub/distro/arm/extra/tools.iso",
+		"distro/current.iso":         "pub/distro/current.iso",
+		"distro/stale.iso":           "",
+	}
+	if len(discovered) != 4 {
+		t.Fatalf("discovered %d files, want 4: %+v (dirs %v)", len(discovered), discovered, got)
+	}
+	for local, remote := range wantFiles {
+		data, err := os.ReadFile(filepath.Join(outDir, filepath.FromSlash(local)))
+		if err != nil {
+			t.Errorf("missing %s: %v", local, err)
+			continue
+		}
+		if remote != "" && !bytes.Equal(data, files[remote]) {
+			t.Errorf("%s content mismatch", local)
+		}
+	}
+	for _, unwanted := range []string{"distro/README.txt", "distro/disc one.iso.sig", "distro/arm/extra/deeper"} {
+		if _, err := os.Stat(filepath.Join(outDir, filepath.FromSlash(unwanted))); err == nil {
+			t.Errorf("%s should not have been downloaded", unwanted)
+		}
+	}
+}
@@ -0,0 +1,679 @@
+package downloader
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/junaid2005p/surge/internal/utils"
+)
+
+// DASHContentType is the MIME type of MPEG-DASH manifests
+const DASHContentType = "application/dash+xml"
+
+// dashKinds are the content types downloaded from a manifest, in output order.
+// The first selected kind is saved at the download's destination; the others
+// get a ".<kind>" suffix next to it.
+var dashKinds = []string{"video", "audio"}
+
+// isDASHSource reports whether a probed URL is a DASH manifest
+func isDASHSource(rawurl, contentType string) bool {
+	mediaType := strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0]))
+	if mediaType == DASHContentType {
+		return true
+	}
+	u, err := url.Parse(rawurl)
+	return err == nil && strings.EqualFold(path.Ext(u.Path), ".mpd")
+}
+
+// MPD elements used for segment addressing (ISO/IEC 23009-1). Unqualified
+// tags match any namespace, so both prefixed and default-namespace manifests parse.
+type mpdManifest struct {
+	Type                      string      `xml:"type,attr"`
+	MediaPresentationDuration string      `xml:"mediaPresentationDuration,attr"`
+	BaseURL                   string      `xml:"BaseURL"`
+	Periods                   []mpdPeriod `xml:"Period"`
+}
+
+type mpdPeriod struct {
+	ID              string              `xml:"id,attr"`
+	Start           string              `xml:"start,attr"`
+	Duration        string              `xml:"duration,attr"`
+	BaseURL         string              `xml:"BaseURL"`
+	SegmentTemplate *mpdSegmentTemplate `xml:"SegmentTemplate"`
+	SegmentList     *mpdSegmentList     `xml:"SegmentList"`
+	SegmentBase     *mpdSegmentBase     `xml:"SegmentBase"`
+	AdaptationSets  []mpdAdaptationSet  `xml:"AdaptationSet"`
+}
+
+type mpdAdaptationSet struct {
+	ContentType       string                 `xml:"contentType,attr"`
+	MimeType          string                 `xml:"mimeType,attr"`
+	BaseURL           string                 `xml:"BaseURL"`
+	ContentProtection []mpdContentProtection `xml:"ContentProtection"`
+	SegmentTemplate   *mpdSegmentTemplate    `xml:"SegmentTemplate"`
+	SegmentList       *mpdSegmentList        `xml:"SegmentList"`
+	SegmentBase       *mpdSegmentBase        `xml:"SegmentBase"`
+	Representations   []mpdRepresentation    `xml:"Representation"`
+}
+
+type mpdRepresentation struct {
+	ID                string                 `xml:"id,attr"`
+	Bandwidth         int64                  `xml:"bandwidth,attr"`
+	Width             int                    `xml:"width,attr"`
+	Height            int                    `xml:"height,attr"`
+	MimeType          string                 `xml:"mimeType,attr"`
+	BaseURL           string                 `xml:"BaseURL"`
+	ContentProtection []mpdContentProtection `xml:"ContentProtection"`
+	SegmentTemplate   *mpdSegmentTemplate    `xml:"SegmentTemplate"`
+	SegmentList       *mpdSegmentList        `xml:"SegmentList"`
+	SegmentBase       *mpdSegmentBase        `xml:"SegmentBase"`
+}
+
+type mpdContentProtection struct {
+	SchemeIDURI string `xml:"schemeIdUri,attr"`
+}
+
+type mpdSegmentTemplate struct {
+	Media           string              `xml:"media,attr"`
+	Initialization  string              `xml:"initialization,attr"`
+	StartNumber     *int64              `xml:"startNumber,attr"`
+	Timescale       *int64              `xml:"timescale,attr"`
+	Duration        *int64              `xml:"duration,attr"`
+	SegmentTimeline *mpdSegmentTimeline `xml:"SegmentTimeline"`
+}
+
+type mpdSegmentTimeline struct {
+	S []mpdTimelineEntry `xml:"S"`
+}
+
+type mpdTimelineEntry struct {
+	T *int64 `xml:"t,attr"`
+	D int64  `xml:"d,attr"`
+	R int64  `xml:"r,attr"`
+}
+
+type mpdSegmentList struct {
+	Initialization *mpdURL         `xml:"Initialization"`
+	SegmentURLs    []mpdSegmentURL `xml:"SegmentURL"`
+}
+
+type mpdSegmentBase struct {
+	IndexRange     string  `xml:"indexRange,attr"`
+	Initialization *mpdURL `xml:"Initialization"`
+}
+
+type mpdURL struct {
+	SourceURL string `xml:"sourceURL,attr"`
+	Range     string `xml:"range,attr"`
+}
+
+type mpdSegmentURL struct {
+	Media      string `xml:"media,attr"`
+	MediaRange string `xml:"mediaRange,attr"`
+}
+
+// parseMPD parses a DASH manifest. Live (dynamic) manifests are rejected:
+// their segment lists keep changing, so there is no fixed file to download.
+func parseMPD(data []byte) (*mpdManifest, error) {
+	var m mpdManifest
+	if err := xml.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("invalid DASH manifest: %w", err)
+	}
+	if m.Type == "dynamic" {
+		return nil, fmt.Errorf("live DASH manifests are not supported")
+	}
+	if len(m.Periods) == 0 {
+		return nil, fmt.Errorf("DASH manifest has no periods")
+	}
+	return &m, nil
+}
+
+// parseISODuration parses the xs:duration subset used by MPDs (e.g. "PT1H2M3.5S", "P1DT2H")
+func parseISODuration(s string) (float64, error) {
+	m := isoDurationRe.FindStringSubmatch(strings.TrimSpace(s))
+	if m == nil || s == "P" || s == "PT" {
+		return 0, fmt.Errorf("invalid duration %q", s)
+	}
+	var secs float64
+	for i, unit := range []float64{86400, 3600, 60, 1} {
+		if m[i+1] != "" {
+			v, _ := strconv.ParseFloat(m[i+1], 64)
+			secs += v * unit
+		}
+	}
+	return secs, nil
+}
+
+var isoDurationRe = regexp.MustCompile(`^P(?:(\d+(?:\.\d+)?)D)?(?:T(?:(\d+(?:\.\d+)?)H)?(?:(\d+(?:\.\d+)?)M)?(?:(\d+(?:\.\d+)?)S)?)?$`)
+
+// periodDurations returns each period's length in seconds (0 if unknown)
+func (m *mpdManifest) periodDurations() []float64 {
+	total, _ := parseISODuration(m.MediaPresentationDuration)
+	starts := make([]float64, len(m.Periods))
+	for i, p := range m.Periods {
+		if v, err := parseISODuration(p.Start); err == nil {
+			starts[i] = v
+		} else if i > 0 {
+			starts[i] = -1 // Follows the previous period
+		}
+	}
+
+	durations := make([]float64, len(m.Periods))
+	for i, p := range m.Periods {
+		if v, err := parseISODuration(p.Duration); err == nil {
+			durations[i] = v
+		}
+		if starts[i] < 0 {
+			starts[i] = starts[i-1] + durations[i-1]
+		}
+	}
+	for i := range m.Periods {
+		if durations[i] > 0 {
+			continue
+		}
+		switch {
+		case i+1 < len(m.Periods) && starts[i+1] > 0:
+			durations[i] = starts[i+1] - starts[i]
+		case i == len(m.Periods)-1 && total > 0:
+			durations[i] = total - starts[i]
+		}
+	}
+	return durations
+}
+
+// mergeTemplate overlays child attributes on parent (inheritance down the MPD hierarchy)
+func mergeTemplate(parent, child *mpdSegmentTemplate) *mpdSegmentTemplate {
+	if parent == nil {
+		return child
+	}
+	if child == nil {
+		return parent
+	}
+	merged := *parent
+	if child.Media != "" {
+		merged.Media = child.Media
+	}
+	if child.Initialization != "" {
+		merged.Initialization = child.Initialization
+	}
+	if child.StartNumber != nil {
+		merged.StartNumber = child.StartNumber
+	}
+	if child.Timescale != nil {
+		merged.Timescale = child.Timescale
+	}
+	if child.Duration != nil {
+		merged.Duration = child.Duration
+	}
+	if child.SegmentTimeline != nil {
+		merged.SegmentTimeline = child.SegmentTimeline
+	}
+	return &merged
+}
+
+var templateIdentifierRe = regexp.MustCompile(`\$(RepresentationID|Number|Time|Bandwidth|)(?:%0(\d+)d)?\$`)
+
+// expandTemplate substitutes $RepresentationID$, $Number$, $Time$ and
+// $Bandwidth$ (with optional %0Nd width) and unescapes $$
+func expandTemplate(tmpl string, rep *mpdRepresentation, number, time int64) string {
+	return templateIdentifierRe.ReplaceAllStringFunc(tmpl, func(match string) string {
+		sub := templateIdentifierRe.FindStringSubmatch(match)
+		var v int64
+		switch sub[1] {
+		case "":
+			return "$"
+		case "RepresentationID":
+			return rep.ID
+		case "Number":
+			v = number
+		case "Time":
+			v = time
+		case "Bandwidth":
+			v = rep.Bandwidth
+		}
+		if sub[2] != "" {
+			width, _ := strconv.Atoi(sub[2])
+			return fmt.Sprintf("%0*d", width, v)
+		}
+		return strconv.FormatInt(v, 10)
+	})
+}
+
+// parseByteRange parses an MPD "first-last" byte range
+func parseByteRange(s string) (offset, length int64, err error) {
+	first, last, ok := strings.Cut(s, "-")
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid byte range %q", s)
+	}
+	start, err1 := strconv.ParseInt(first, 10, 64)
+	end, err2 := strconv.ParseInt(last, 10, 64)
+	if err1 != nil || err2 != nil || end < start {
+		return 0, 0, fmt.Errorf("invalid byte range %q", s)
+	}
+	return start, end - start + 1, nil
+}
+
+// dashRepresentation is a representation with its inherited addressing resolved
+type dashRepresentation struct {
+	rep      *mpdRepresentation
+	kind     string
+	mimeType string
+	base     *url.URL
+	template *mpdSegmentTemplate
+	list     *mpdSegmentList
+	segBase  *mpdSegmentBase
+	drm      bool
+}
+
+// resolveURL resolves ref against parent, ignoring empty refs
+func resolveURL(parent *url.URL, ref string) (*url.URL, error) {
+	ref = strings.TrimSpace(ref)
+	if ref == "" {
+		return parent, nil
+	}
+	u, err := parent.Parse(ref)
+	if err != nil {
+		return nil, fmt.Errorf("invalid BaseURL %q: %w", ref, err)
+	}
+	return u, nil
+}
+
+// periodRepresentations lists the video and audio representations of a period
+func periodRepresentations(base *url.URL, p *mpdPeriod) ([]dashRepresentation, error) {
+	periodBase, err := resolveURL(base, p.BaseURL)
+	if err != nil {
+		return nil, err
+	}
+
+	var reps []dashRepresentation
+	for a := range p.AdaptationSets {
+		as := &p.AdaptationSets[a]
+		setBase, err := resolveURL(periodBase, as.BaseURL)
+		if err != nil {
+			return nil, err
+		}
+		setTemplate := mergeTemplate(p.SegmentTemplate, as.SegmentTemplate)
+
+		for r := range as.Representations {
+			rep := &as.Representations[r]
+			repBase, err := resolveURL(setBase, rep.BaseURL)
+			if err != nil {
+				return nil, err
+			}
+
+			mimeType := rep.MimeType
+			if mimeType == "" {
+				mimeType = as.MimeType
+			}
+			kind := as.ContentType
+			if kind == "" {
+				kind, _, _ = strings.Cut(mimeType, "/")
+			}
+			if kind != "video" && kind != "audio" {
+				continue // Subtitles, thumbnails, ...
+			}
+
+			dr := dashRepresentation{
+				rep:      rep,
+				kind:     kind,
+				mimeType: mimeType,
+				base:     repBase,
+				template: mergeTemplate(setTemplate, rep.SegmentTemplate),
+				list:     firstNonNil(rep.SegmentList, as.SegmentList, p.SegmentList),
+				segBase:  firstNonNil(rep.SegmentBase, as.SegmentBase, p.SegmentBase),
+				drm:      len(as.ContentProtection) > 0 || len(rep.ContentProtection) > 0,
+			}
+			reps = append(reps, dr)
+		}
+	}
+	return reps, nil
+}
+
+func firstNonNil[T any](values ...*T) *T {
+	for _, v := range values {
+		if v != nil {
+			return v
+		}
+	}
+	return nil
+}
+
+// singleFile reports whether the representation is one self-contained file
+// (SegmentBase or a bare BaseURL) rather than a list of segments
+func (r *dashRepresentation) singleFile() bool {
+	return (r.template == nil || r.template.Media == "") && r.list == nil
+}
+
+// segments expands the representation's addressing into downloadable
+// segments. A single file is split into ranged segments of chunkSize if its
+// size is known (size > 0).
+func (r *dashRepresentation) segments(periodDuration float64, size, chunkSize int64) ([]Segment, error) {
+	switch {
+	case r.template != nil && r.template.Media != "":
+		return r.templateSegments(periodDuration)
+	case r.list != nil:
+		return r.listSegments()
+	default:
+		return rangedSegments(r.base.String(), size, chunkSize), nil
+	}
+}
+
+func (r *dashRepresentation) templateSegments(periodDuration float64) ([]Segment, error) {
+	t := r.template
+	timescale := int64(1)
+	if t.Timescale != nil && *t.Timescale > 0 {
+		timescale = *t.Timescale
+	}
+	number := int64(1)
+	if t.StartNumber != nil {
+		number = *t.StartNumber
+	}
+
+	var segs []Segment
+	resolve := func(tmpl string, number, time int64) error {
+		u, err := r.base.Parse(expandTemplate(tmpl, r.rep, number, time))
+		if err != nil {
+			return fmt.Errorf("invalid segment URL: %w", err)
+		}
+		segs = append(segs, Segment{URL: u.String()})
+		return nil
+	}
+
+	if t.Initialization != "" {
+		if err := resolve(t.Initialization, 0, 0); err != nil {
+			return nil, err
+		}
+	}
+
+	periodEnd := int64(periodDuration * float64(timescale))
+	switch {
+	case t.SegmentTimeline != nil:
+		var time int64
+		entries := t.SegmentTimeline.S
+		for i, s := range entries {
+			if s.T != nil {
+				time = *s.T
+			}
+			if s.D <= 0 {
+				return nil, fmt.Errorf("invalid SegmentTimeline duration %d", s.D)
+			}
+
+			repeat := s.R
+			if repeat < 0 {
+				// Repeat until the next entry's start, or the end of the period
+				end := periodEnd
+				if i+1 < len(entries) && entries[i+1].T != nil {
+					end = *entries[i+1].T
+				}
+				if end <= time {
+					return nil, fmt.Errorf("cannot expand open-ended SegmentTimeline without a period duration")
+				}
+				repeat = (end-time+s.D-1)/s.D - 1
+			}
+
+			for n := int64(0); n <= repeat; n++ {
+				if err := resolve(t.Media, number, time); err != nil {
+					return nil, err
+				}
+				number++
+				time += s.D
+			}
+		}
+
+	case t.Duration != nil && *t.Duration > 0:
+		if periodDuration <= 0 {
+			return nil, fmt.Errorf("cannot count segments without a period duration")
+		}
+		count := int64(math.Ceil(periodDuration * float64(timescale) / float64(*t.Duration)))
+		for n := int64(0); n < count; n++ {
+			if err := resolve(t.Media, number+n, n*(*t.Duration)); err != nil {
+				return nil, err
+			}
+		}
+
+	default:
+		return nil, fmt.Errorf("SegmentTemplate for representation %s has neither duration nor timeline", r.rep.ID)
+	}
+	return segs, nil
+}
+
+func (r *dashRepresentation) listSegments() ([]Segment, error) {
+	var segs []Segment
+	add := func(ref, byteRange string) error {
+		u, err := resolveURL(r.base, ref)
+		if err != nil {
+			return err
+		}
+		seg := Segment{URL: u.String()}
+		if byteRange != "" {
+			if seg.Offset, seg.Length, err = parseByteRange(byteRange); err != nil {
+				return err
+			}
+		}
+		segs = append(segs, seg)
+		return nil
+	}
+
+	if init := r.list.Initialization; init != nil {
+		if err := add(init.SourceURL, init.Range); err != nil {
+			return nil, err
+		}
+	}
+	for _, su := range r.list.SegmentURLs {
+		if err := add(su.Media, su.MediaRange); err != nil {
+			return nil, err
+		}
+	}
+	return segs, nil
+}
+
+// dashTrack is one selected output of a manifest
+type dashTrack struct {
+	Kind     string
+	Source   string // "<kind>=<representation id per period>", stable across resumes
+	Ext      string
+	Segments []Segment
+}
+
+// dashStream is a manifest resolved into its selected tracks
+type dashStream struct {
+	ManifestURL   string
+	manifest      *mpdManifest
+	Tracks        []dashTrack
+	EstimatedSize int64 // Sum of file sizes or bandwidth × duration, 0 if unknown
+	headers       *hostHeaders
+}
+
+// prepareDASH fetches the manifest and selects one video and one audio
+// representation per period according to the stream quality setting.
+// headers (e.g. from a resolver) are sent to the host of rawurl.
+func prepareDASH(ctx context.Context, rawurl string, headers http.Header, runtime *RuntimeConfig) (*dashStream, error) {
+	data, err := fetchSmall(ctx, rawurl, headers, runtime)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch manifest: %w", err)
+	}
+	manifest, err := parseMPD(data)
+	if err != nil {
+		return nil, err
+	}
+
+	stream := &dashStream{ManifestURL: rawurl, manifest: manifest, headers: newHostHeaders(rawurl, headers)}
+	if err := stream.selectTracks(ctx, runtime, nil); err != nil {
+		return nil, err
+	}
+	return stream, nil
+}
+
+// selectTracks picks representations by quality. preferred maps a kind to
+// the representation IDs chosen by an earlier (paused) session, per period.
+// Representations that are a single file are probed for their size, so they
+// can be fetched in ranged segments.
+func (s *dashStream) selectTracks(ctx context.Context, runtime *RuntimeConfig, preferred map[string][]string) error {
+	quality, err := parseStreamQuality(runtime.GetStreamQuality())
+	if err != nil {
+		return err
+	}
+
+	base, err := url.Parse(s.ManifestURL)
+	if err != nil {
+		return fmt.Errorf("invalid manifest url: %w", err)
+	}
+	if base, err = resolveURL(base, s.manifest.BaseURL); err != nil {
+		return err
+	}
+
+	durations := s.manifest.periodDurations()
+	tracks := make(map[string]*dashTrack)
+	ids := make(map[string][]string)
+	var estimate float64
+
+	for p := range s.manifest.Periods {
+		reps, err := periodRepresentations(base, &s.manifest.Periods[p])
+		if err != nil {
+			return err
+		}
+
+		for _, kind := range dashKinds {
+			var cands []streamCandidate
+			var candReps []dashRepresentation
+			for _, r := range reps {
+				if r.kind == kind {
+					cands = append(cands, streamCandidate{Bandwidth: r.rep.Bandwidth, Height: r.rep.Height})
+					candReps = append(candReps, r)
+				}
+			}
+			if len(cands) == 0 {
+				continue
+			}
+
+			pick := -1
+			if prev := preferred[kind]; p < len(prev) {
+				for i, r := range candReps {
+					if r.rep.ID == prev[p] {
+						pick = i
+					}
+				}
+			}
+			if pick == -1 {
+				q := quality
+				if kind == "audio" && !q.worst {
+					q = streamQuality{} // Resolution/bandwidth targets describe video
+				}
+				pick = q.pick(cands)
+			}
+
+			r := candReps[pick]
+			if r.drm {
+				return fmt.Errorf("DRM-protected DASH streams are not supported")
+			}
+			var size int64
+			if r.singleFile() {
+				size = probeRepresentationSize(ctx, r.base.String(), s.headers, runtime)
+			}
+			segs, err := r.segments(durations[p], size, runtime.GetTargetChunkSize())
+			if err != nil {
+				return err
+			}
+			utils.Debug("DASH: period %d %s representation %s (%d segments)", p, kind, r.rep.ID, len(segs))
+
+			track := tracks[kind]
+			if track == nil {
+				track = &dashTrack{Kind: kind, Ext: dashExtension(r.mimeType)}
+				tracks[kind] = track
+			}
+			track.Segments = append(track.Segments, segs...)
+			ids[kind] = append(ids[kind], r.rep.ID)
+			if size > 0 {
+				estimate += float64(size)
+			} else {
+				estimate += float64(r.rep.Bandwidth) * durations[p] / 8
+			}
+		}
+	}
+
+	s.Tracks = nil
+	for _, kind := range dashKinds {
+		if track := tracks[kind]; track != nil {
+			track.Source = kind + "=" + strings.Join(ids[kind], ",")
+			s.Tracks = append(s.Tracks, *track)
+		}
+	}
+	if len(s.Tracks) == 0 {
+		return fmt.Errorf("DASH manifest has no video or audio representations")
+	}
+	s.EstimatedSize = int64(estimate)
+	return nil
+}
+
+// probeRepresentationSize returns the size of a single file representation,
+// or 0 if it is unknown or the server does not serve ranges
+func probeRepresentationSize(ctx context.Context, rawurl string, headers *hostHeaders, runtime *RuntimeConfig) int64 {
+	probe, err := probeServerWithHeaders(ctx, rawurl, "", headers.forURL(rawurl), runtime)
+	if err != nil {
+		utils.Debug("DASH: size of %s unknown: %v", rawurl, err)
+		return 0
+	}
+	if !probe.SupportsRange {
+		return 0
+	}
+	return probe.FileSize
+}
+
+// dashExtension maps a representation MIME type to an output extension
+func dashExtension(mimeType string) string {
+	if strings.HasSuffix(mimeType, "/webm") {
+		return ".webm"
+	}
+	return ".mp4"
+}
+
+// outputName derives the primary output filename from the manifest filename
+func (s *dashStream) outputName(manifestName, manifestURL string) string {
+	return streamOutputName(manifestName, manifestURL, s.Tracks[0].Ext)
+}
+
+// trackPath returns where track i is written: the first track at destPath,
+// the others beside it as "<name>.<kind><ext>"
+func (s *dashStream) trackPath(destPath string, i int) string {
+	if i == 0 {
+		return destPath
+	}
+	t := s.Tracks[i]
+	return strings.TrimSuffix(destPath, filepath.Ext(destPath)) + "." + t.Kind + t.Ext
+}
+
+// downloadDASH downloads a prepared DASH stream, one output file per track
+func downloadDASH(ctx context.Context, cfg DownloadConfig, destPath string, stream *dashStream) error {
+	// A resume continues the representations chosen originally
+	if saved, err := LoadState(cfg.URL, destPath); err == nil && len(saved.Streams) > 0 {
+		preferred := make(map[string][]string)
+		for _, sp := range saved.Streams {
+			if kind, ids, ok := strings.Cut(sp.Source, "="); ok {
+				preferred[kind] = strings.Split(ids, ",")
+			}
+		}
+		if err := stream.selectTracks(ctx, cfg.Runtime, preferred); err != nil {
+			return err
+		}
+	}
+
+	tracks := make([]SegmentTrack, len(stream.Tracks))
+	for i, t := range stream.Tracks {
+		tracks[i] = SegmentTrack{Source: t.Source, DestPath: stream.trackPath(destPath, i), Segments: t.Segments}
+	}
+
+	d := NewSegmentDownloader(cfg.ID, cfg.ProgressCh, cfg.State, cfg.Runtime)
+	if stream.headers != nil {
+		d.Authorize = stream.headers.authorize
+	}
+	return d.Download(ctx, cfg.URL, destPath, tracks, stream.EstimatedSize)
+}
@@ -0,0 +1,532 @@
+package downloader
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/junaid2005p/surge/internal/config"
+	"github.com/junaid2005p/surge/internal/testutil"
+)
+
+// testDASHManifest has a 2-rendition video set addressed with a SegmentTimeline
+// and an audio set addressed with a fixed segment duration (12s / 4s = 3 segments)
+const testDASHManifest = `<?xml version="1.0" encoding="UTF-8"?>
+<MPD xmlns="urn:mpeg:dash:schema:mpd:2011" type="static" mediaPresentationDuration="PT12S" minBufferTime="PT2S">
+  <Period id="0">
+    <AdaptationSet contentType="video" mimeType="video/mp4">
+      <SegmentTemplate timescale="1000" initialization="$RepresentationID$/init.mp4" media="$RepresentationID$/seg-$Number%03d$.m4s" startNumber="1">
+        <SegmentTimeline>
+          <S t="0" d="4000" r="1"/>
+          <S d="4000"/>
+        </SegmentTimeline>
+      </SegmentTemplate>
+      <Representation id="v360" bandwidth="500000" width="640" height="360"/>
+      <Representation id="v720" bandwidth="1500000" width="1280" height="720"/>
+    </AdaptationSet>
+    <AdaptationSet contentType="audio" mimeType="audio/mp4" lang="en">
+      <SegmentTemplate timescale="48000" duration="192000" initialization="audio/init.mp4" media="audio/$Number$.m4s"/>
+      <Representation id="a128" bandwidth="128000"/>
+    </AdaptationSet>
+    <AdaptationSet contentType="text" mimeType="text/vtt">
+      <Representation id="subs" bandwidth="100"><BaseURL>subs.vtt</BaseURL></Representation>
+    </AdaptationSet>
+  </Period>
+</MPD>`
+
+// testDASHServer serves testDASHManifest and random segment payloads
+type testDASHServer struct {
+	*httptest.Server
+	files map[string][]byte
+
+	mu       sync.Mutex
+	requests map[string]int
+}
+
+func startTestDASHServer(t *testing.T) *testDASHServer {
+	t.Helper()
+
+	s := &testDASHServer{files: make(map[string][]byte), requests: make(map[string]int)}
+	for _, rep := range []string{"v360", "v720"} {
+		s.files["/show/"+rep+"/init.mp4"] = randomBytes(t, 1*KB)
+		for n := 1; n <= 3; n++ {
+			s.files[fmt.Sprintf("/show/%s/seg-%03d.m4s", rep, n)] = randomBytes(t, 24*KB+n)
+		}
+	}
+	s.files["/show/audio/init.mp4"] = randomBytes(t, 512)
+	for n := 1; n <= 3; n++ {
+		s.files[fmt.Sprintf("/show/audio/%d.m4s", n)] = randomBytes(t, 4*KB+n)
+	}
+
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.requests[r.URL.Path]++
+		s.mu.Unlock()
+
+		if r.URL.Path == "/show/manifest.mpd" {
+			w.Header().Set("Content-Type", DASHContentType)
+			fmt.Fprint(w, testDASHManifest)
+			return
+		}
+		data, ok := s.files[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(data)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// track concatenates the init segment and the numbered media segments of a rendition
+func (s *testDASHServer) track(rep string) []byte {
+	if rep == "audio" {
+		return bytes.Join([][]byte{s.files["/show/audio/init.mp4"], s.files["/show/audio/1.m4s"],
+			s.files["/show/audio/2.m4s"], s.files["/show/audio/3.m4s"]}, nil)
+	}
+	parts := [][]byte{s.files["/show/"+rep+"/init.mp4"]}
+	for n := 1; n <= 3; n++ {
+		parts = append(parts, s.files[fmt.Sprintf("/show/%s/seg-%03d.m4s", rep, n)])
+	}
+	return bytes.Join(parts, nil)
+}
+
+func (s *testDASHServer) requestCount(path string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests[path]
+}
+
+func segmentURLs(segs []Segment) []string {
+	urls := make([]string, len(segs))
+	for i, s := range segs {
+		urls[i] = s.URL
+	}
+	return urls
+}
+
+func TestIsDASHSource(t *testing.T) {
+	tests := []struct {
+		url         string
+		contentType string
+		want        bool
+	}{
+		{"http://example.com/stream", "application/dash+xml", true},
+		{"http://example.com/stream", "application/dash+xml; charset=utf-8", true},
+		{"http://example.com/show/manifest.MPD?sig=1", "application/xml", true},
+		{"http://example.com/show/index.m3u8", "application/vnd.apple.mpegurl", false},
+	}
+
+	for _, tt := range tests {
+		if got := isDASHSource(tt.url, tt.contentType); got != tt.want {
+			t.Errorf("isDASHSource(%q, %q) = %v, want %v", tt.url, tt.contentType, got, tt.want)
+		}
+	}
+}
+
+func TestParseISODuration(t *testing.T) {
+	tests := []struct {
+		in   string
+		want float64
+	}{
+		{"PT12S", 12},
+		{"PT1M30.5S", 90.5},
+		{"PT1H", 3600},
+		{"P1DT2H", 93600},
+		{"PT0S", 0},
+	}
+	for _, tt := range tests {
+		got, err := parseISODuration(tt.in)
+		if err != nil || got != tt.want {
+			t.Errorf("parseISODuration(%q) = %v, %v; want %v", tt.in, got, err, tt.want)
+		}
+	}
+	for _, bad := range []string{"", "12", "P", "PT", "PTXS"} {
+		if _, err := parseISODuration(bad); err == nil {
+			t.Errorf("parseISODuration(%q) should fail", bad)
+		}
+	}
+}
+
+func TestExpandTemplate(t *testing.T) {
+	rep := &mpdRepresentation{ID: "v1", Bandwidth: 800000}
+	tests := []struct {
+		tmpl string
+		want string
+	}{
+		{"$RepresentationID$/$Number$.m4s", "v1/42.m4s"},
+		{"seg-$Number%05d$.m4s", "seg-00042.m4s"},
+		{"$Bandwidth$/t$Time$.m4s", "800000/t9000.m4s"},
+		{"price$$.m4s", "price$.m4s"},
+	}
+	for _, tt := range tests {
+		if got := expandTemplate(tt.tmpl, rep, 42, 9000); got != tt.want {
+			t.Errorf("expandTemplate(%q) = %q, want %q", tt.tmpl, got, tt.want)
+		}
+	}
+}
+
+func TestDASHSegments(t *testing.T) {
+	base, _ := url.Parse("http://cdn.example.com/show/")
+	i64 := func(v int64) *int64 { return &v }
+
+	t.Run("open-ended timeline", func(t *testing.T) {
+		r := dashRepresentation{
+			rep:  &mpdRepresentation{ID: "v"},
+			base: base,
+			template: &mpdSegmentTemplate{
+				Media:           "$Time$.m4s",
+				Timescale:       i64(10),
+				SegmentTimeline: &mpdSegmentTimeline{S: []mpdTimelineEntry{{T: i64(0), D: 20, R: -1}}},
+			},
+		}
+		segs, err := r.segments(10, 0, MB) // 100 units = 5 segments of 20
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []string{"0", "20", "40", "60", "80"}
+		if len(segs) != len(want) {
+			t.Fatalf("got %v", segmentURLs(segs))
+		}
+		for i, w := range want {
+			if segs[i].URL != "http://cdn.example.com/show/"+w+".m4s" {
+				t.Errorf("segment %d = %s, want time %s", i, segs[i].URL, w)
+			}
+		}
+	})
+
+	t.Run("fixed duration rounds up", func(t *testing.T) {
+		r := dashRepresentation{
+			rep:      &mpdRepresentation{ID: "a"},
+			base:     base,
+			template: &mpdSegmentTemplate{Media: "$Number$.m4s", StartNumber: i64(0), Duration: i64(4)},
+		}
+		segs, err := r.segments(10, 0, MB)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.Join(segmentURLs(segs), " "); !strings.HasSuffix(got, "/0.m4s http://cdn.example.com/show/1.m4s http://cdn.example.com/show/2.m4s") {
+			t.Errorf("segments = %s", got)
+		}
+	})
+
+	t.Run("segment list with ranges", func(t *testing.T) {
+		r := dashRepresentation{
+			rep:  &mpdRepresentation{ID: "v"},
+			base: base.JoinPath("video.mp4"),
+			list: &mpdSegmentList{
+				Initialization: &mpdURL{Range: "0-799"},
+				SegmentURLs:    []mpdSegmentURL{{MediaRange: "800-1799"}, {Media: "other.m4s"}},
+			},
+		}
+		segs, err := r.segments(0, 0, MB)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(segs) != 3 {
+			t.Fatalf("got %d segments, want 3", len(segs))
+		}
+		if segs[0].URL != "http://cdn.example.com/show/video.mp4" || segs[0].Offset != 0 || segs[0].Length != 800 {
+			t.Errorf("init = %+v", segs[0])
+		}
+		if segs[1].Offset != 800 || segs[1].Length != 1000 {
+			t.Errorf("segment 1 range = @%d+%d", segs[1].Offset, segs[1].Length)
+		}
+		if segs[2].URL != "http://cdn.example.com/show/other.m4s" || segs[2].Length != 0 {
+			t.Errorf("segment 2 = %+v", segs[2])
+		}
+	})
+
+	t.Run("segment base is split into ranges", func(t *testing.T) {
+		r := dashRepresentation{
+			rep:     &mpdRepresentation{ID: "v"},
+			base:    base.JoinPath("full.mp4"),
+			segBase: &mpdSegmentBase{IndexRange: "800-999"},
+		}
+		if !r.singleFile() {
+			t.Fatal("segment base should be a single file")
+		}
+		segs, err := r.segments(60, 5*MB/2, MB)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(segs) != 3 || segs[2].URL != "http://cdn.example.com/show/full.mp4" || segs[2].Offset != 2*MB || segs[2].Length != MB/2 {
+			t.Errorf("segments = %+v", segs)
+		}
+
+		// Unknown size: one unranged segment
+		segs, err = r.segments(60, 0, MB)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(segs) != 1 || segs[0].Length != 0 {
+			t.Errorf("segments of unknown size = %+v", segs)
+		}
+	})
+
+	t.Run("duration without period length", func(t *testing.T) {
+		r := dashRepresentation{
+			rep:      &mpdRepresentation{ID: "v"},
+			base:     base,
+			template: &mpdSegmentTemplate{Media: "$Number$.m4s", Duration: i64(4)},
+		}
+		if _, err := r.segments(0, 0, MB); err == nil {
+			t.Error("expected error when the period duration is unknown")
+		}
+	})
+}
+
+func TestPeriodDurations(t *testing.T) {
+	m := &mpdManifest{
+		MediaPresentationDuration: "PT100S",
+		Periods: []mpdPeriod{
+			{Start: "PT0S"},
+			{Start: "PT30S", Duration: "PT20S"},
+			{},
+		},
+	}
+	got := m.periodDurations()
+	want := []float64{30, 20, 50}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("period %d duration = %v, want %v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestParseMPD_Rejects(t *testing.T) {
+	for _, doc := range []string{
+		`<MPD type="dynamic"><Period/></MPD>`,
+		`<MPD type="static"></MPD>`,
+		`not xml`,
+	} {
+		if _, err := parseMPD([]byte(doc)); err == nil {
+			t.Errorf("parseMPD(%q) should fail", doc)
+		}
+	}
+}
+
+func TestTUIDownload_DASH(t *testing.T) {
+	if err := config.EnsureDirs(); err != nil {
+		t.Fatalf("Failed to create config dirs: %v", err)
+	}
+	s := startTestDASHServer(t)
+
+	tests := []struct {
+		quality string
+		video   string
+	}{
+		{"best", "v720"},
+		{"360p", "v360"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.quality, func(t *testing.T) {
+			outDir, cleanup, err := testutil.TempDir("surge-dash")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer cleanup()
+
+			state := NewProgressState("dash-"+tt.quality, 0)
+			cfg := DownloadConfig{
+				URL:        s.URL + "/show/manifest.mpd",
+				OutputPath: outDir,
+				ID:         "dash-" + tt.quality,
+				State:      state,
+				Runtime:    &RuntimeConfig{MaxConnectionsPerHost: 4, StreamQuality: tt.quality},
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+
+			if err := TUIDownload(ctx, cfg); err != nil {
+				t.Fatalf("DASH download failed: %v", err)
+			}
+
+			video, err := os.ReadFile(filepath.Join(outDir, "show.mp4"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(video, s.track(tt.video)) {
+				t.Errorf("video output does not match %s segments", tt.video)
+			}
+			audio, err := os.ReadFile(filepath.Join(outDir, "show.audio.mp4"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(audio, s.track("audio")) {
+				t.Error("audio output does not match audio segments")
+			}
+
+			if want := int64(len(video) + len(audio)); state.Downloaded.Load() != want || state.TotalSize != want {
+				t.Errorf("Downloaded=%d TotalSize=%d, want %d", state.Downloaded.Load(), state.TotalSize, want)
+			}
+			if s.requestCount("/show/subs.vtt") != 0 {
+				t.Error("text representations should not be downloaded")
+			}
+		})
+	}
+}
+
+func TestTUIDownload_DASHSegmentBase(t *testing.T) {
+	if err := config.EnsureDirs(); err != nil {
+		t.Fatalf("Failed to create config dirs: %v", err)
+	}
+
+	video := randomBytes(t, 5*MB/2)
+	var mu sync.Mutex
+	var ranges []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/film/manifest.mpd":
+			w.Header().Set("Content-Type", DASHContentType)
+			fmt.Fprint(w, `<?xml version="1.0"?>
+<MPD xmlns="urn:mpeg:dash:schema:mpd:2011" type="static" mediaPresentationDuration="PT60S">
+  <Period>
+    <AdaptationSet contentType="video" mimeType="video/mp4">
+      <Representation id="v" bandwidth="300000">
+        <BaseURL>film.mp4</BaseURL>
+        <SegmentBase indexRange="800-999"/>
+      </Representation>
+    </AdaptationSet>
+  </Period>
+</MPD>`)
+		case "/film/film.mp4":
+			mu.Lock()
+			ranges = append(ranges, r.Header.Get("Range"))
+			mu.Unlock()
+			http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(video))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	outDir, cleanup, err := testutil.TempDir("surge-dash-base")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	state := NewProgressState("dash-base", 0)
+	cfg := DownloadConfig{
+		URL:        server.URL + "/film/manifest.mpd",
+		OutputPath: outDir,
+		ID:         "dash-base",
+		State:      state,
+		Runtime:    &RuntimeConfig{MaxConnectionsPerHost: 4, TargetChunkSize: MB},
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := TUIDownload(ctx, cfg); err != nil {
+		t.Fatalf("DASH download failed: %v", err)
+	}
+
+	got, err := os.ReadFile(filepath.Join(outDir, "film.mp4"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, video) {
+		t.Error("output does not match the representation file")
+	}
+	if state.TotalSize != int64(len(video)) {
+		t.Errorf("TotalSize = %d, want %d", state.TotalSize, len(video))
+	}
+
+	// A size probe, then one request per chunk
+	mu.Lock()
+	defer mu.Unlock()
+	want := []string{"bytes=0-0", "bytes=0-1048575", "bytes=1048576-2097151", "bytes=2097152-2621439"}
+	if len(ranges) != len(want) {
+		t.Fatalf("range requests = %v, want %v", ranges, want)
+	}
+	for _, r := range want {
+		if !slices.Contains(ranges, r) {
+			t.Errorf("range requests = %v, missing %s", ranges, r)
+		}
+	}
+}
+
+func TestTUIDownload_DASHResume(t *testing.T) {
+	if err := config.EnsureDirs(); err != nil {
+		t.Fatalf("Failed to create config dirs: %v", err)
+	}
+	s := startTestDASHServer(t)
+
+	outDir, cleanup, err := testutil.TempDir("surge-dash-resume")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	rawurl := s.URL + "/show/manifest.mpd"
+	destPath := filepath.Join(outDir, "show.mp4")
+
+	// Paused after the 360p init and first segment were written, with a
+	// partially appended second segment that must be discarded
+	video := s.track("v360")
+	written := int64(len(s.files["/show/v360/init.mp4"]) + len(s.files["/show/v360/seg-001.m4s"]))
+	if err := os.WriteFile(destPath+IncompleteSuffix, video[:written+100], 0644); err != nil {
+		t.Fatal(err)
+	}
+	saved := &DownloadState{
+		ID:         "dash-resume",
+		URL:        rawurl,
+		DestPath:   destPath,
+		Downloaded: written,
+		Filename:   "show.mp4",
+		Streams:    []StreamProgress{{Source: "video=v360", SegmentsDone: 2, Written: written}},
+	}
+	if err := SaveState(rawurl, destPath, saved); err != nil {
+		t.Fatal(err)
+	}
+	defer DeleteState("dash-resume", rawurl, destPath)
+
+	// The quality setting now says "best", but the resume keeps v360
+	state := NewProgressState("dash-resume", 0)
+	cfg := DownloadConfig{
+		URL:        rawurl,
+		OutputPath: outDir,
+		DestPath:   destPath,
+		ID:         "dash-resume",
+		IsResume:   true,
+		State:      state,
+		Runtime:    &RuntimeConfig{MaxConnectionsPerHost: 2},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if err := TUIDownload(ctx, cfg); err != nil {
+		t.Fatalf("DASH resume failed: %v", err)
+	}
+
+	got, err := os.ReadFile(destPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, video) {
+		t.Error("resumed video does not match v360 segments")
+	}
+	if s.requestCount("/show/v360/init.mp4") != 0 || s.requestCount("/show/v360/seg-001.m4s") != 0 {
+		t.Error("segments written before the pause were downloaded again")
+	}
+	if s.requestCount("/show/v720/seg-002.m4s") != 0 {
+		t.Error("resume switched to a different representation")
+	}
+	if _, err := LoadState(rawurl, destPath); err == nil {
+		t.Error("state file should be deleted after successful resume")
+	}
+}
@@ -0,0 +1,64 @@
+package downloader
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/junaid2005p/surge/internal/utils"
+)
+
+// diskCheckInterval is how often the worker pool checks the free space of
+// the filesystems running downloads write to
+const diskCheckInterval = 5 * time.Second
+
+// diskLowFloor is the free space below which all downloads pause, even
+// without a MinFreeSpace reserve
+const diskLowFloor = 32 * MB
+
+// freeSpaceFor returns the free space of the filesystem of a path. Tests
+// replace it to simulate a full disk.
+var freeSpaceFor = utils.FreeSpaceFor
+
+// InsufficientSpaceError is returned when the destination filesystem cannot
+// hold a download
+type InsufficientSpaceError struct {
+	Dir    string
+	Needed int64 // Bytes still to be written plus the MinFreeSpace reserve
+	Free   int64
+}
+
+func (e *InsufficientSpaceError) Error() string {
+	return fmt.Sprintf("not enough disk space in %s: %s needed, %s free", e.Dir,
+		utils.ConvertBytesToHumanReadable(e.Needed), utils.ConvertBytesToHumanReadable(e.Free))
+}
+
+// IsDiskSpaceError reports whether err means the disk is (or would become) full
+func IsDiskSpaceError(err error) bool {
+	var spaceErr *InsufficientSpaceError
+	return errors.As(err, &spaceErr) || isDiskFull(err)
+}
+
+// isDiskFull reports whether err is a write that failed because the disk is full
+func isDiskFull(err error) bool {
+	return errors.Is(err, syscall.ENOSPC)
+}
+
+// checkDiskSpace fails unless the filesystem of destPath can take a download
+// of size bytes and still keep reserve bytes free. Space the incomplete file
+// already occupies counts as taken. Passes if the free space is unknown.
+func checkDiskSpace(destPath string, size, reserve int64) error {
+	free, err := freeSpaceFor(destPath)
+	if err != nil {
+		utils.Debug("Free space of %s unknown: %v", destPath, err)
+		return nil
+	}
+
+	needed := max(size-utils.AllocatedBytes(destPath+IncompleteSuffix), 0) + reserve
+	if needed > free {
+		return &InsufficientSpaceError{Dir: filepath.Dir(destPath), Needed: needed, Free: free}
+	}
+	return nil
+}
@@ -0,0 +1,168 @@
+package downloader
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/junaid2005p/surge/internal/config"
+	"github.com/junaid2005p/surge/internal/messages"
+	"github.com/junaid2005p/surge/internal/testutil"
+	"github.com/junaid2005p/surge/internal/utils"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func TestCheckDiskSpace(t *testing.T) {
+	dir := t.TempDir()
+	dest := filepath.Join(dir, "file.bin")
+	if _, err := utils.FreeSpace(dir); err != nil {
+		t.Skipf("free space unknown: %v", err)
+	}
+
+	if err := checkDiskSpace(dest, 1024, 0); err != nil {
+		t.Fatalf("small download rejected: %v", err)
+	}
+
+	err := checkDiskSpace(dest, 1024, 1<<62)
+	var spaceErr *InsufficientSpaceError
+	if !errors.As(err, &spaceErr) {
+		t.Fatalf("expected InsufficientSpaceError, got %v", err)
+	}
+	if spaceErr.Dir != dir || !IsDiskSpaceError(err) {
+		t.Errorf("unexpected error %+v", spaceErr)
+	}
+	if isRetryable(dest, err) {
+		t.Error("disk space errors should not be retried")
+	}
+}
+
+func TestWorkerPool_LowDiskSpaceFloor(t *testing.T) {
+	var free atomic.Int64
+	orig := freeSpaceFor
+	freeSpaceFor = func(string) (int64, error) { return free.Load(), nil }
+	defer func() { freeSpaceFor = orig }()
+
+	// Default settings: no MinFreeSpace reserve
+	state := NewProgressState("floor-test", 0)
+	state.SetDestPath(filepath.Join(t.TempDir(), "file.bin"))
+	p := &WorkerPool{downloads: map[string]*activeDownload{
+		"floor-test": {config: DownloadConfig{ID: "floor-test", State: state, Runtime: &RuntimeConfig{}}},
+	}}
+
+	free.Store(diskLowFloor + MB)
+	if _, _, low := p.lowDiskSpace(); low {
+		t.Error("disk above the floor reported low")
+	}
+	free.Store(diskLowFloor - MB)
+	if dir, got, low := p.lowDiskSpace(); !low || got != diskLowFloor-MB || dir != filepath.Dir(state.DestPath()) {
+		t.Errorf("lowDiskSpace() = %q, %d, %v; want the floor to apply without a reserve", dir, got, low)
+	}
+}
+
+func TestWorkerPool_PausesWhenDiskFills(t *testing.T) {
+	if err := config.EnsureDirs(); err != nil {
+		t.Fatal(err)
+	}
+
+	data := randomBytes(t, 4*MB)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(data))
+	}))
+	defer server.Close()
+
+	// Writes past the first MB fail as if the disk were full, until space is freed
+	var full atomic.Bool
+	full.Store(true)
+	orig := writeFileAt
+	writeFileAt = func(f *os.File, b []byte, off int64) (int, error) {
+		if full.Load() && off+int64(len(b)) > MB {
+			return 0, &os.PathError{Op: "write", Path: f.Name(), Err: syscall.ENOSPC}
+		}
+		return orig(f, b, off)
+	}
+	defer func() { writeFileAt = orig }()
+
+	outDir, cleanup, err := testutil.TempDir("surge-pool-diskfull")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	progressCh := make(chan tea.Msg, 100)
+	pool := NewWorkerPool(progressCh)
+	state := NewProgressState("diskfull-test", 0)
+	pool.Add(DownloadConfig{
+		URL:        server.URL + "/file.bin",
+		OutputPath: outDir,
+		ID:         "diskfull-test",
+		Filename:   "file.bin",
+		State:      state,
+		Runtime:    &RuntimeConfig{},
+	})
+
+	var paused, low bool
+	timeout := time.After(30 * time.Second)
+	for !paused || !low {
+		select {
+		case msg := <-progressCh:
+			switch msg := msg.(type) {
+			case messages.DownloadPausedMsg:
+				paused = msg.DownloadID == "diskfull-test"
+			case messages.DiskSpaceLowMsg:
+				low = msg.Dir == outDir
+			case messages.DownloadErrorMsg:
+				t.Fatalf("full disk failed the download instead of pausing it: %v", msg.Err)
+			}
+		case <-timeout:
+			t.Fatalf("download was not paused (paused %v, disk space message %v)", paused, low)
+		}
+	}
+	if !state.IsPaused() {
+		t.Fatal("state not paused")
+	}
+
+	full.Store(false)
+	pool.Resume("diskfull-test")
+	for !state.Done.Load() {
+		select {
+		case msg := <-progressCh:
+			if msg, ok := msg.(messages.DownloadErrorMsg); ok {
+				t.Fatalf("resume failed: %v", msg.Err)
+			}
+		case <-timeout:
+			t.Fatal("resumed download did not finish")
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+	got, err := os.ReadFile(filepath.Join(outDir, "file.bin"))
+	if err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("content mismatch after resume (err %v)", err)
+	}
+}
+
+func TestPreallocate(t *testing.T) {
+	f, err := os.Create(filepath.Join(t.TempDir(), "file.bin.surge"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if err := preallocate(f, 3*MB); err != nil {
+		t.Fatalf("preallocate failed: %v", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() != 3*MB {
+		t.Errorf("size = %d, want %d", info.Size(), 3*MB)
+	}
+}
@@ -0,0 +1,178 @@
+package downloader
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// diskWriteQueue is how many filled buffers may wait for the disk writer
+	// before workers block
+	diskWriteQueue = 32
+	// maxCoalescedWrite bounds a write merged from adjacent buffers
+	maxCoalescedWrite = 4 * MB
+)
+
+// writeFileAt writes to the output file. Tests replace it to simulate write
+// failures.
+var writeFileAt = (*os.File).WriteAt
+
+// errDiskWrite marks a failed write to the output file. Retrying the task
+// does not help, so it stops the download.
+var errDiskWrite = errors.New("disk write failed")
+
+// writeRequest is a filled buffer waiting to be written at offset
+type writeRequest struct {
+	offset int64
+	buf    *[]byte // From bufPool, returned once written
+	n      int
+}
+
+// diskWriter writes the buffers filled by a download's workers on its own
+// goroutine, so a slow disk does not stall network reads. Buffers that arrive
+// together and are adjacent in the file are merged into one write. Workers
+// block when the queue is full.
+type diskWriter struct {
+	file    *os.File
+	metrics *BenchmarkMetrics // May be nil
+	reqs    chan writeRequest
+	done    chan struct{}
+	scratch []byte // For merging buffers
+
+	mu   sync.Mutex
+	err  error
+	lost []Task // Ranges queued but not written because of err
+}
+
+func newDiskWriter(file *os.File, metrics *BenchmarkMetrics) *diskWriter {
+	w := &diskWriter{
+		file:    file,
+		metrics: metrics,
+		reqs:    make(chan writeRequest, diskWriteQueue),
+		done:    make(chan struct{}),
+	}
+	go w.run()
+	return w
+}
+
+// write queues buf[:n] to be written at offset, taking over buf. Fails
+// without queuing once a write has failed.
+func (w *diskWriter) write(offset int64, buf *[]byte, n int) error {
+	if err := w.Err(); err != nil {
+		bufPool.Put(buf)
+		return err
+	}
+	w.reqs <- writeRequest{offset: offset, buf: buf, n: n}
+	return nil
+}
+
+// close writes everything still queued and stops the writer. No more writes
+// may be queued afterwards.
+func (w *diskWriter) close() error {
+	close(w.reqs)
+	<-w.done
+	return w.Err()
+}
+
+// Err returns the first write error
+func (w *diskWriter) Err() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.err
+}
+
+// Lost returns the ranges that were queued but not written. Their data
+// counts as downloaded, so they must be downloaded again on resume.
+func (w *diskWriter) Lost() []Task {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return append([]Task(nil), w.lost...)
+}
+
+func (w *diskWriter) run() {
+	defer close(w.done)
+
+	var batch []writeRequest
+	for req := range w.reqs {
+		// Take whatever else is waiting, to merge adjacent ranges
+		batch = append(batch[:0], req)
+	more:
+		for len(batch) < diskWriteQueue {
+			select {
+			case req, ok := <-w.reqs:
+				if !ok {
+					break more
+				}
+				batch = append(batch, req)
+			default:
+				break more
+			}
+		}
+		w.writeBatch(batch)
+	}
+}
+
+// writeBatch writes a batch of requests, merging runs of adjacent ones
+func (w *diskWriter) writeBatch(batch []writeRequest) {
+	sort.Slice(batch, func(i, j int) bool { return batch[i].offset < batch[j].offset })
+
+	for i := 0; i < len(batch); {
+		j := i + 1
+		size := batch[i].n
+		for j < len(batch) && batch[j].offset == batch[j-1].offset+int64(batch[j-1].n) && size+batch[j].n <= maxCoalescedWrite {
+			size += batch[j].n
+			j++
+		}
+		w.writeRun(batch[i:j], size)
+		i = j
+	}
+}
+
+// writeRun writes adjacent requests of size bytes in total with one call and
+// returns their buffers to the pool
+func (w *diskWriter) writeRun(run []writeRequest, size int) {
+	defer func() {
+		for _, req := range run {
+			bufPool.Put(req.buf)
+		}
+	}()
+
+	offset := run[0].offset
+	if w.Err() != nil {
+		w.recordLost(offset, size)
+		return
+	}
+
+	data := (*run[0].buf)[:run[0].n]
+	if len(run) > 1 {
+		if cap(w.scratch) < size {
+			w.scratch = make([]byte, 0, maxCoalescedWrite)
+		}
+		data = w.scratch[:0]
+		for _, req := range run {
+			data = append(data, (*req.buf)[:req.n]...)
+		}
+	}
+
+	start := time.Now()
+	_, err := writeFileAt(w.file, data, offset)
+	if w.metrics != nil {
+		w.metrics.RecordDiskWrite(time.Since(start))
+	}
+	if err != nil {
+		w.mu.Lock()
+		w.err = fmt.Errorf("%w: %w", errDiskWrite, err)
+		w.mu.Unlock()
+		w.recordLost(offset, size)
+	}
+}
+
+func (w *diskWriter) recordLost(offset int64, size int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.lost = append(w.lost, Task{Offset: offset, Length: int64(size)})
+}
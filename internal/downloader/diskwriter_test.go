@@ -0,0 +1,125 @@
+package downloader
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// queuedWriter returns a writer whose goroutine is not started yet, so
+// queued buffers are all taken as one batch
+func queuedWriter(file *os.File, metrics *BenchmarkMetrics) *diskWriter {
+	return &diskWriter{
+		file:    file,
+		metrics: metrics,
+		reqs:    make(chan writeRequest, diskWriteQueue),
+		done:    make(chan struct{}),
+	}
+}
+
+func filledBuffer(b byte, n int) *[]byte {
+	bufPtr := bufPool.Get().(*[]byte)
+	for i := range (*bufPtr)[:n] {
+		(*bufPtr)[i] = b
+	}
+	return bufPtr
+}
+
+func TestDiskWriter_CoalescesAdjacentBuffers(t *testing.T) {
+	file, err := os.Create(filepath.Join(t.TempDir(), "out.bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	metrics := NewBenchmarkMetrics()
+	w := queuedWriter(file, metrics)
+
+	// Three adjacent buffers out of order, and one after a gap
+	const n = 1000
+	for _, i := range []int{1, 0, 2, 4} {
+		if err := w.write(int64(i*n), filledBuffer(byte('a'+i), n), n); err != nil {
+			t.Fatal(err)
+		}
+	}
+	go w.run()
+	if err := w.close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	if got := metrics.DiskWrites.Load(); got != 2 {
+		t.Errorf("disk writes = %d, want 2", got)
+	}
+	got, _ := os.ReadFile(file.Name())
+	want := append(bytes.Repeat([]byte("a"), n), bytes.Repeat([]byte("b"), n)...)
+	want = append(want, bytes.Repeat([]byte("c"), n)...)
+	want = append(want, make([]byte, n)...)
+	want = append(want, bytes.Repeat([]byte("e"), n)...)
+	if !bytes.Equal(got, want) {
+		t.Error("file content does not match the queued buffers")
+	}
+}
+
+func TestDiskWriter_FailedWrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.bin")
+	if err := os.WriteFile(path, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.Open(path) // Read-only: every write fails
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	w := queuedWriter(file, nil)
+	w.write(0, filledBuffer('x', 100), 100)
+	w.write(500, filledBuffer('y', 100), 100)
+	go w.run()
+	if err := w.close(); !errors.Is(err, errDiskWrite) {
+		t.Fatalf("close error = %v, want errDiskWrite", err)
+	}
+
+	// Both ranges were read but not written, the second after the first failed
+	lost := w.Lost()
+	if len(lost) != 2 || lost[0] != (Task{0, 100}) || lost[1] != (Task{500, 100}) {
+		t.Errorf("lost ranges = %v", lost)
+	}
+	if err := w.write(600, filledBuffer('z', 10), 10); !errors.Is(err, errDiskWrite) {
+		t.Errorf("write after a failure = %v, want errDiskWrite", err)
+	}
+}
+
+func TestConcurrentDownloader_RecordsMetrics(t *testing.T) {
+	data := randomBytes(t, 8*MB)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(data))
+	}))
+	defer server.Close()
+
+	destPath := filepath.Join(t.TempDir(), "metrics.bin")
+	d := NewConcurrentDownloader("metrics-id", nil, nil, &RuntimeConfig{})
+	d.Metrics = NewBenchmarkMetrics()
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := d.Download(ctx, server.URL, destPath, int64(len(data)), false); err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+	d.Metrics.Finish(int64(len(data)))
+
+	if got, _ := os.ReadFile(destPath); !bytes.Equal(got, data) {
+		t.Fatal("content mismatch")
+	}
+	results := d.Metrics.GetResults()
+	if d.Metrics.BytesReceived.Load() != int64(len(data)) {
+		t.Errorf("bytes received = %d, want %d", d.Metrics.BytesReceived.Load(), len(data))
+	}
+	if results.DiskWrites == 0 || results.DiskWrites > len(data)/WorkerBuffer || results.NetworkTime <= 0 {
+		t.Errorf("disk writes = %d, network time = %v", results.DiskWrites, results.NetworkTime)
+	}
+}
@@ -0,0 +1,312 @@
+package downloader
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/junaid2005p/surge/internal/config"
+	"github.com/junaid2005p/surge/internal/utils"
+)
+
+// DNSSystem selects the system resolver (RuntimeConfig.DNS). Otherwise DNS
+// is a DNS server (host[:port]) or a DNS-over-HTTPS endpoint (https:// URL).
+const DNSSystem = "system"
+
+// dohMaxResponse bounds a DNS-over-HTTPS response, the largest DNS message
+const dohMaxResponse = 65535
+
+// dnsResolver resolves the hosts of download connections through the system
+// resolver, a DNS server or a DNS-over-HTTPS endpoint. Static overrides (like
+// curl --resolve) take precedence.
+type dnsResolver struct {
+	lookup    func(ctx context.Context, host string) ([]net.IPAddr, error)
+	overrides map[string][]net.IPAddr // By host:port, lower case; port "*" matches any
+}
+
+// systemDNS is used unless DNS or overrides are configured
+var systemDNS = &dnsResolver{
+	lookup: func(ctx context.Context, host string) ([]net.IPAddr, error) {
+		return lookupIPAddr(ctx, host)
+	},
+}
+
+// dnsResolverKey identifies a shared resolver
+type dnsResolverKey struct {
+	dns       string
+	overrides string
+	tls       tlsOptions // Of the DNS-over-HTTPS endpoint
+}
+
+var (
+	dnsResolversMu sync.Mutex
+	dnsResolvers   = make(map[dnsResolverKey]*dnsResolver)
+)
+
+// dnsResolverFor returns the resolver for the DNS setting and overrides,
+// creating it on first use. dohTLS are the TLS options of the connections to
+// a DNS-over-HTTPS endpoint (see dohTLSOptions). Downloads with the same
+// settings share it, and with it their transports.
+func dnsResolverFor(dns string, overrides []string, dohTLS tlsOptions) *dnsResolver {
+	if dns == DNSSystem && len(overrides) == 0 {
+		return systemDNS
+	}
+	key := dnsResolverKey{dns: dns, overrides: strings.Join(overrides, ","), tls: dohTLS}
+
+	dnsResolversMu.Lock()
+	defer dnsResolversMu.Unlock()
+	r, ok := dnsResolvers[key]
+	if !ok {
+		r = newDNSResolver(dns, overrides, dohTLS)
+		dnsResolvers[key] = r
+	}
+	return r
+}
+
+// isDoH reports whether the DNS setting is a DNS-over-HTTPS endpoint
+func isDoH(dns string) bool {
+	return strings.HasPrefix(strings.ToLower(dns), "https://")
+}
+
+// dohTLSOptions returns the TLS options for connections to the
+// DNS-over-HTTPS endpoint dns: the global ones with the endpoint host's
+// per-host options applied. They are zero if dns is not an endpoint.
+func dohTLSOptions(dns string, global tlsOptions, hosts []config.TLSHost) tlsOptions {
+	if !isDoH(dns) {
+		return tlsOptions{}
+	}
+	u, err := url.Parse(dns)
+	if err != nil {
+		return global
+	}
+	return global.forHost(hosts, u.Hostname())
+}
+
+func newDNSResolver(dns string, overrides []string, dohTLS tlsOptions) *dnsResolver {
+	r := &dnsResolver{lookup: systemDNS.lookup, overrides: parseOverrides(overrides)}
+	switch {
+	case dns == DNSSystem:
+	case isDoH(dns):
+		r.lookup = newDoHResolver(dns, dohTLS).LookupIPAddr
+	default:
+		r.lookup = newServerResolver(dnsServerAddr(dns)).LookupIPAddr
+	}
+	return r
+}
+
+// lookupHost returns the addresses of host for connections to port
+func (r *dnsResolver) lookupHost(ctx context.Context, host, port string) ([]net.IPAddr, error) {
+	host = strings.ToLower(host)
+	if addrs, ok := r.overrides[net.JoinHostPort(host, port)]; ok {
+		return addrs, nil
+	}
+	if addrs, ok := r.overrides[net.JoinHostPort(host, "*")]; ok {
+		return addrs, nil
+	}
+	return r.lookup(ctx, host)
+}
+
+// resolveAddr replaces the host of addr (host:port) with its first address.
+// IP literals are returned as they are.
+func (r *dnsResolver) resolveAddr(ctx context.Context, addr string) (string, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", err
+	}
+	if _, err := netip.ParseAddr(host); err == nil {
+		return addr, nil
+	}
+	addrs, err := r.lookupHost(ctx, host, port)
+	if err != nil {
+		return "", err
+	}
+	if len(addrs) == 0 {
+		return "", &net.AddrError{Err: "no address", Addr: host}
+	}
+	return net.JoinHostPort(addrs[0].IP.String(), port), nil
+}
+
+// parseOverrides parses host:port:address entries. Several entries for the
+// same host and port add addresses. Invalid entries are skipped.
+func parseOverrides(entries []string) map[string][]net.IPAddr {
+	if len(entries) == 0 {
+		return nil
+	}
+	overrides := make(map[string][]net.IPAddr)
+	for _, entry := range entries {
+		hostport, addr, err := parseOverride(entry)
+		if err != nil {
+			utils.Debug("Ignoring resolve override %q: %v", entry, err)
+			continue
+		}
+		overrides[hostport] = append(overrides[hostport], net.IPAddr{IP: addr.AsSlice()})
+	}
+	return overrides
+}
+
+// parseOverride parses one host:port:address entry, with IPv6 addresses
+// optionally in brackets
+func parseOverride(entry string) (string, netip.Addr, error) {
+	parts := strings.SplitN(entry, ":", 3)
+	if len(parts) != 3 || parts[0] == "" || parts[1] == "" {
+		return "", netip.Addr{}, errors.New("want host:port:address")
+	}
+	addr, err := netip.ParseAddr(strings.TrimSuffix(strings.TrimPrefix(parts[2], "["), "]"))
+	if err != nil {
+		return "", netip.Addr{}, err
+	}
+	return net.JoinHostPort(strings.ToLower(parts[0]), parts[1]), addr.Unmap(), nil
+}
+
+// dnsServerAddr adds the DNS port to a server given without one
+func dnsServerAddr(server string) string {
+	if _, _, err := net.SplitHostPort(server); err == nil {
+		return server
+	}
+	return net.JoinHostPort(strings.Trim(server, "[]"), "53")
+}
+
+// newServerResolver returns a resolver that sends all queries to server
+func newServerResolver(server string) *net.Resolver {
+	dialer := &net.Dialer{Timeout: DialTimeout}
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			return dialer.DialContext(ctx, network, server)
+		},
+	}
+}
+
+// newDoHResolver returns a resolver that sends all queries to a
+// DNS-over-HTTPS endpoint, connecting with the TLS options opts. The
+// endpoint's own host is resolved by the system resolver.
+func newDoHResolver(endpoint string, opts tlsOptions) *net.Resolver {
+	tlsConfig, err := tlsConfigFor(opts)
+	if err != nil {
+		err = fmt.Errorf("DNS-over-HTTPS endpoint TLS options: %w", err)
+		return &net.Resolver{
+			PreferGo: true,
+			Dial: func(context.Context, string, string) (net.Conn, error) {
+				return nil, err
+			},
+		}
+	}
+	client := &http.Client{
+		Transport: &http.Transport{
+			Proxy:               http.ProxyFromEnvironment,
+			TLSClientConfig:     tlsConfig.Clone(),
+			TLSHandshakeTimeout: DefaultTLSHandshakeTimeout,
+			IdleConnTimeout:     DefaultIdleConnTimeout,
+			ForceAttemptHTTP2:   true,
+		},
+	}
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return &dohConn{ctx: ctx, client: client, endpoint: endpoint}, nil
+		},
+	}
+}
+
+// dohConn carries the queries of the Go resolver to a DNS-over-HTTPS
+// endpoint (RFC 8484), one POST per query. It is not a net.PacketConn, so the
+// resolver frames messages as over TCP, with a two byte length prefix.
+type dohConn struct {
+	ctx      context.Context
+	client   *http.Client
+	endpoint string
+
+	mu       sync.Mutex
+	deadline time.Time
+	query    []byte       // Written but not yet sent
+	answer   bytes.Reader // Framed answers not yet read
+}
+
+func (c *dohConn) Write(b []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.query = append(c.query, b...)
+	return len(b), nil
+}
+
+func (c *dohConn) Read(b []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.answer.Len() == 0 {
+		if err := c.exchange(); err != nil {
+			return 0, err
+		}
+	}
+	return c.answer.Read(b)
+}
+
+// exchange sends the query written so far and queues its framed answer
+func (c *dohConn) exchange() error {
+	if len(c.query) < 2 {
+		return io.EOF
+	}
+	n := int(binary.BigEndian.Uint16(c.query))
+	if len(c.query) < 2+n {
+		return io.ErrUnexpectedEOF
+	}
+	query := c.query[2 : 2+n]
+	c.query = c.query[2+n:]
+
+	ctx := c.ctx
+	if !c.deadline.IsZero() {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, c.deadline)
+		defer cancel()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint, bytes.NewReader(query))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/dns-message")
+	req.Header.Set("Accept", "application/dns-message")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("DNS-over-HTTPS query failed: %s", resp.Status)
+	}
+	answer, err := io.ReadAll(io.LimitReader(resp.Body, dohMaxResponse))
+	if err != nil {
+		return err
+	}
+
+	framed := binary.BigEndian.AppendUint16(make([]byte, 0, 2+len(answer)), uint16(len(answer)))
+	c.answer.Reset(append(framed, answer...))
+	return nil
+}
+
+func (c *dohConn) Close() error                     { return nil }
+func (c *dohConn) LocalAddr() net.Addr              { return dohAddr{} }
+func (c *dohConn) RemoteAddr() net.Addr             { return dohAddr{} }
+func (c *dohConn) SetReadDeadline(time.Time) error  { return nil }
+func (c *dohConn) SetWriteDeadline(time.Time) error { return nil }
+
+func (c *dohConn) SetDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.deadline = t
+	return nil
+}
+
+type dohAddr struct{}
+
+func (dohAddr) Network() string { return "doh" }
+func (dohAddr) String() string  { return "doh" }
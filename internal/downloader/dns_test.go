@@ -0,0 +1,242 @@
+package downloader
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/junaid2005p/surge/internal/config"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// dnsAnswer answers a DNS query with the IPv4 addresses in hosts (by name,
+// with the trailing dot). Other names do not exist.
+func dnsAnswer(t *testing.T, query []byte, hosts map[string]string) []byte {
+	var msg dnsmessage.Message
+	if err := msg.Unpack(query); err != nil {
+		t.Errorf("bad query: %v", err)
+		return nil
+	}
+	resp := dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: msg.ID, Response: true, RecursionAvailable: true, RCode: dnsmessage.RCodeNameError},
+		Questions: msg.Questions,
+	}
+	for _, q := range msg.Questions {
+		ip, ok := hosts[q.Name.String()]
+		if !ok {
+			continue
+		}
+		resp.RCode = dnsmessage.RCodeSuccess
+		if q.Type == dnsmessage.TypeA {
+			resp.Answers = append(resp.Answers, dnsmessage.Resource{
+				Header: dnsmessage.ResourceHeader{Name: q.Name, Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET, TTL: 60},
+				Body:   &dnsmessage.AResource{A: [4]byte(net.ParseIP(ip).To4())},
+			})
+		}
+	}
+	packed, err := resp.Pack()
+	if err != nil {
+		t.Errorf("pack answer: %v", err)
+	}
+	return packed
+}
+
+func TestDNSResolverOverrides(t *testing.T) {
+	errLookup := errors.New("looked up")
+	old := lookupIPAddr
+	lookupIPAddr = func(ctx context.Context, host string) ([]net.IPAddr, error) { return nil, errLookup }
+	defer func() { lookupIPAddr = old }()
+
+	r := newDNSResolver(DNSSystem, []string{
+		"Staging.Example:443:10.0.0.5",
+		"staging.example:443:[2001:db8::5]",
+		"any.example:*:10.0.0.6",
+		"missing-address:443",
+		"bad.example:443:not-an-ip",
+	}, tlsOptions{})
+
+	tests := []struct {
+		host, port string
+		want       string
+	}{
+		{"staging.example", "443", "[10.0.0.5 2001:db8::5]"},
+		{"STAGING.example", "443", "[10.0.0.5 2001:db8::5]"},
+		{"any.example", "8080", "[10.0.0.6]"},
+	}
+	for _, tt := range tests {
+		addrs, err := r.lookupHost(context.Background(), tt.host, tt.port)
+		if err != nil {
+			t.Errorf("lookupHost(%s, %s): %v", tt.host, tt.port, err)
+			continue
+		}
+		var ips []string
+		for _, a := range addrs {
+			ips = append(ips, a.IP.String())
+		}
+		if got := fmt.Sprint(ips); got != tt.want {
+			t.Errorf("lookupHost(%s, %s) = %s, want %s", tt.host, tt.port, got, tt.want)
+		}
+	}
+
+	// Other ports and invalid entries go to DNS
+	for _, hostport := range [][2]string{{"staging.example", "80"}, {"bad.example", "443"}} {
+		if _, err := r.lookupHost(context.Background(), hostport[0], hostport[1]); !errors.Is(err, errLookup) {
+			t.Errorf("lookupHost(%s, %s) error = %v, want a DNS lookup", hostport[0], hostport[1], err)
+		}
+	}
+
+	if got, err := r.resolveAddr(context.Background(), "staging.example:443"); err != nil || got != "10.0.0.5:443" {
+		t.Errorf("resolveAddr = %q, %v", got, err)
+	}
+	if got, err := r.resolveAddr(context.Background(), "[::1]:443"); err != nil || got != "[::1]:443" {
+		t.Errorf("resolveAddr of an IP literal = %q, %v", got, err)
+	}
+}
+
+func TestDNSResolverFor(t *testing.T) {
+	if dnsResolverFor(DNSSystem, nil, tlsOptions{}) != systemDNS {
+		t.Error("system DNS without overrides should use the system resolver")
+	}
+	a := dnsResolverFor("192.0.2.53", []string{"x.example:443:10.0.0.1"}, tlsOptions{})
+	if a != dnsResolverFor("192.0.2.53", []string{"x.example:443:10.0.0.1"}, tlsOptions{}) {
+		t.Error("same settings should share a resolver")
+	}
+	if a == dnsResolverFor("192.0.2.53", nil, tlsOptions{}) {
+		t.Error("different overrides should not share a resolver")
+	}
+	doh := dnsResolverFor("https://dns.example/dns-query", nil, tlsOptions{})
+	if doh == dnsResolverFor("https://dns.example/dns-query", nil, tlsOptions{caFile: "ca.pem"}) {
+		t.Error("different endpoint TLS options should not share a resolver")
+	}
+}
+
+func TestDoHTLSOptions(t *testing.T) {
+	global := tlsOptions{caFile: "global.pem", minVersion: "1.2"}
+	hosts := []config.TLSHost{{Hosts: []string{"dns.corp"}, CAFile: "corp.pem"}}
+	if got := dohTLSOptions("https://dns.corp/dns-query", global, hosts); got != (tlsOptions{caFile: "corp.pem", minVersion: "1.2"}) {
+		t.Errorf("endpoint options = %+v", got)
+	}
+	if got := dohTLSOptions("https://dns.example/dns-query", global, hosts); got != global {
+		t.Errorf("options without a per-host entry = %+v", got)
+	}
+	if got := dohTLSOptions("1.1.1.1", global, hosts); got != (tlsOptions{}) {
+		t.Errorf("options for a plain DNS server = %+v", got)
+	}
+}
+
+func TestDNSServerAddr(t *testing.T) {
+	for server, want := range map[string]string{
+		"1.1.1.1":        "1.1.1.1:53",
+		"10.0.0.2:5353":  "10.0.0.2:5353",
+		"2001:db8::53":   "[2001:db8::53]:53",
+		"[2001:db8::53]": "[2001:db8::53]:53",
+		"dns.internal":   "dns.internal:53",
+	} {
+		if got := dnsServerAddr(server); got != want {
+			t.Errorf("dnsServerAddr(%q) = %q, want %q", server, got, want)
+		}
+	}
+}
+
+func TestDNSResolverServer(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			n, addr, err := pc.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			pc.WriteTo(dnsAnswer(t, buf[:n], map[string]string{"staging.test.": "127.0.0.7"}), addr)
+		}
+	}()
+
+	r := newDNSResolver(pc.LocalAddr().String(), nil, tlsOptions{})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	addrs, err := r.lookupHost(ctx, "staging.test", "443")
+	if err != nil {
+		t.Fatalf("lookup failed: %v", err)
+	}
+	if len(addrs) != 1 || addrs[0].IP.String() != "127.0.0.7" {
+		t.Errorf("addrs = %v, want [127.0.0.7]", addrs)
+	}
+}
+
+func TestDNSResolverDoH(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/dns-message" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		query, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/dns-message")
+		w.Write(dnsAnswer(t, query, map[string]string{"staging.test.": "127.0.0.8"}))
+	}))
+	defer server.Close()
+
+	// The endpoint is trusted through the TLS options only
+	caFile := writePEM(t, t.TempDir(), "ca.pem", "CERTIFICATE", server.Certificate().Raw)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if _, err := newDNSResolver(server.URL+"/dns-query", nil, tlsOptions{}).lookupHost(ctx, "staging.test", "443"); err == nil {
+		t.Error("lookup through an untrusted endpoint should fail")
+	}
+
+	r := newDNSResolver(server.URL+"/dns-query", nil, tlsOptions{caFile: caFile})
+	addrs, err := r.lookupHost(ctx, "staging.test", "443")
+	if err != nil {
+		t.Fatalf("lookup failed: %v", err)
+	}
+	if len(addrs) != 1 || addrs[0].IP.String() != "127.0.0.8" {
+		t.Errorf("addrs = %v, want [127.0.0.8]", addrs)
+	}
+
+	if _, err := r.lookupHost(ctx, "missing.test", "443"); err == nil {
+		t.Error("lookup of a missing name should fail")
+	}
+}
+
+func TestDownloadWithResolveOverride(t *testing.T) {
+	data := bytes.Repeat([]byte("resolve"), 300*1024)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(data))
+	}))
+	defer server.Close()
+	u, _ := url.Parse(server.URL)
+
+	outDir := t.TempDir()
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	err := TUIDownload(ctx, DownloadConfig{
+		URL:        "http://staging.invalid:" + u.Port() + "/resolve.bin",
+		OutputPath: outDir,
+		ID:         "resolve",
+		Filename:   "resolve.bin",
+		Runtime: &RuntimeConfig{
+			MaxConnectionsPerHost: 4, MinChunkSize: MB, MaxChunkSize: MB,
+			Resolve: []string{"staging.invalid:" + u.Port() + ":127.0.0.1"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("download failed: %v", err)
+	}
+	if got, err := os.ReadFile(filepath.Join(outDir, "resolve.bin")); err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("content mismatch (err %v)", err)
+	}
+}
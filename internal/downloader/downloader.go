@@ -22,12 +22,15 @@ type SingleDownloader struct {
 	ID           string         // Download ID
 	State        *ProgressState // Shared state for TUI polling
 	Runtime      *RuntimeConfig
+	Headers      http.Header // Extra request headers (e.g. from a URL resolver)
+
+	primed *primedRange // Open probe response over the whole file, saved instead of a new request
 }
 
 // NewSingleDownloader creates a new single-threaded downloader with all required parameters
 func NewSingleDownloader(id string, progressCh chan<- tea.Msg, state *ProgressState, runtime *RuntimeConfig) *SingleDownloader {
 	return &SingleDownloader{
-		Client:       &http.Client{Timeout: 0},
+		Client:       newDownloadClient(runtime),
 		ProgressChan: progressCh,
 		ID:           id,
 		State:        state,
@@ -39,22 +42,11 @@ func NewSingleDownloader(id string, progressCh chan<- tea.Msg, state *ProgressSt
 // This is used for servers that don't support Range requests.
 // If interrupted, the download cannot be resumed and must restart from the beginning.
 func (d *SingleDownloader) Download(ctx context.Context, rawurl, destPath string, fileSize int64, filename string, verbose bool) error {
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawurl, nil)
-	if err != nil {
-		return err
-	}
-
-	req.Header.Set("User-Agent", d.Runtime.GetUserAgent())
-
-	resp, err := d.Client.Do(req)
+	body, err := d.open(ctx, rawurl)
 	if err != nil {
 		return err
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
-	}
+	defer body.Close()
 
 	// Use .surge extension for incomplete file
 	workingPath := destPath + IncompleteSuffix
@@ -87,7 +79,7 @@ func (d *SingleDownloader) Download(ctx context.Context, rawurl, destPath string
 		default:
 		}
 
-		nr, readErr := resp.Body.Read(buf)
+		nr, readErr := body.Read(buf)
 		if nr > 0 {
 			nw, writeErr := outFile.Write(buf[0:nr])
 			if nw > 0 {
@@ -143,6 +135,34 @@ func (d *SingleDownloader) Download(ctx context.Context, rawurl, destPath string
 	return nil
 }
 
+// open returns the body of the file, continuing the probe's response if
+// there is one
+func (d *SingleDownloader) open(ctx context.Context, rawurl string) (io.ReadCloser, error) {
+	if p := d.primed; p != nil {
+		d.primed = nil
+		return p.open(ctx), nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawurl, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("User-Agent", d.Runtime.GetUserAgent())
+	applyHeaders(req, d.Headers)
+
+	resp, err := d.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+	return resp.Body, nil
+}
+
 // copyFile copies a file from src to dst (fallback when rename fails)
 func copyFile(src, dst string) error {
 	in, err := os.Open(src)
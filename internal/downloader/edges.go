@@ -0,0 +1,285 @@
+package downloader
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/junaid2005p/surge/internal/utils"
+)
+
+// IP version preferences (RuntimeConfig.IPVersion)
+const (
+	IPVersionAuto    = "auto"        // Both, in the resolver's order
+	IPVersion4       = "ipv4"        // IPv4 addresses only
+	IPVersion6       = "ipv6"        // IPv6 addresses only
+	IPVersionPrefer4 = "prefer-ipv4" // Both, IPv4 first
+	IPVersionPrefer6 = "prefer-ipv6" // Both, IPv6 first
+)
+
+const (
+	edgeResolveTTL   = 5 * time.Minute  // How long resolved addresses are used before resolving again
+	edgeFailBackoff  = 30 * time.Second // How long an address that failed to connect is skipped
+	edgeSampleWindow = time.Second      // Minimum time between throughput samples of a connection
+	edgeIdleGap      = time.Second / 2  // A read blocked this long waited for a request, not for data
+	edgeSpeedAlpha   = 0.3              // EMA smoothing of per-address throughput
+)
+
+// lookupIPAddr is the system resolver (see systemDNS); tests replace it
+var lookupIPAddr = net.DefaultResolver.LookupIPAddr
+
+// edge is one resolved address of a host and what was measured about it
+type edge struct {
+	addr        netip.Addr
+	open        atomic.Int32 // Connections currently open
+	speed       float64      // EMA of the throughput of its connections in bytes/s, 0 until measured
+	failedUntil time.Time    // Not dialed before this after a failed connect
+}
+
+// edgeSet holds the addresses of one host[:port]. New connections go to the
+// address with the best expected throughput per connection, so workers are
+// spread over the edges and drift toward the fastest ones.
+type edgeSet struct {
+	mu       sync.Mutex
+	edges    []*edge
+	version  string // IP version preference the edges were filtered with
+	resolved time.Time
+}
+
+// edgeSetKey identifies the addresses of a host as resolved by one resolver
+type edgeSetKey struct {
+	dns      *dnsResolver
+	hostport string
+}
+
+var (
+	edgeSetsMu sync.Mutex
+	edgeSets   = make(map[edgeSetKey]*edgeSet)
+)
+
+func edgeSetFor(r *dnsResolver, hostport string) *edgeSet {
+	edgeSetsMu.Lock()
+	defer edgeSetsMu.Unlock()
+	key := edgeSetKey{dns: r, hostport: hostport}
+	s, ok := edgeSets[key]
+	if !ok {
+		s = &edgeSet{}
+		edgeSets[key] = s
+	}
+	return s
+}
+
+// dialEdge connects to addr (host:port), choosing among all addresses r
+// resolves the host to. IP literals are dialed directly.
+func dialEdge(ctx context.Context, dialer *net.Dialer, r *dnsResolver, network, addr, version string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := netip.ParseAddr(host); err == nil {
+		return dialer.DialContext(ctx, network, addr)
+	}
+
+	set := edgeSetFor(r, addr)
+	if err := set.refresh(ctx, r, host, port, version, time.Now()); err != nil {
+		return nil, err
+	}
+
+	// Try the edges from the best on, until one connects
+	var lastErr error
+	tried := make(map[netip.Addr]bool)
+	for {
+		e := set.pick(time.Now(), tried)
+		if e == nil {
+			break
+		}
+		tried[e.addr] = true
+
+		conn, err := dialer.DialContext(ctx, network, net.JoinHostPort(e.addr.String(), port))
+		if err == nil {
+			return newEdgeConn(conn, set, e), nil
+		}
+		lastErr = err
+		if ctx.Err() != nil {
+			return nil, err
+		}
+		set.failed(e, time.Now())
+		utils.Debug("Edge %s of %s failed: %v", e.addr, host, err)
+	}
+	if lastErr == nil {
+		lastErr = &net.AddrError{Err: "no usable address", Addr: host}
+	}
+	return nil, lastErr
+}
+
+// refresh resolves the host again once the addresses are older than
+// edgeResolveTTL or were filtered for another IP version, keeping the
+// measurements of addresses that remain
+func (s *edgeSet) refresh(ctx context.Context, r *dnsResolver, host, port, version string, now time.Time) error {
+	s.mu.Lock()
+	fresh := len(s.edges) > 0 && s.version == version && now.Sub(s.resolved) < edgeResolveTTL
+	s.mu.Unlock()
+	if fresh {
+		return nil
+	}
+
+	ipAddrs, err := r.lookupHost(ctx, host, port)
+	if err != nil {
+		return err
+	}
+	addrs := filterAddrs(ipAddrs, version)
+	if len(addrs) == 0 {
+		return &net.AddrError{Err: "no " + version + " address", Addr: host}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	known := make(map[netip.Addr]*edge, len(s.edges))
+	for _, e := range s.edges {
+		known[e.addr] = e
+	}
+	s.edges = s.edges[:0]
+	for _, addr := range addrs {
+		e := known[addr]
+		if e == nil {
+			e = &edge{addr: addr}
+		}
+		s.edges = append(s.edges, e)
+	}
+	s.version = version
+	s.resolved = now
+	if len(addrs) > 1 {
+		utils.Debug("Spreading connections to %s over %d addresses", host, len(addrs))
+	}
+	return nil
+}
+
+// filterAddrs keeps the addresses of the preferred IP version, in the order
+// they should be tried when nothing is known about them
+func filterAddrs(ipAddrs []net.IPAddr, version string) []netip.Addr {
+	var addrs []netip.Addr
+	for _, ip := range ipAddrs {
+		addr, ok := netip.AddrFromSlice(ip.IP)
+		if !ok {
+			continue
+		}
+		addr = addr.Unmap()
+		if (version == IPVersion4 && !addr.Is4()) || (version == IPVersion6 && !addr.Is6()) {
+			continue
+		}
+		addrs = append(addrs, addr)
+	}
+	switch version {
+	case IPVersionPrefer4:
+		sort.SliceStable(addrs, func(i, j int) bool { return addrs[i].Is4() && !addrs[j].Is4() })
+	case IPVersionPrefer6:
+		sort.SliceStable(addrs, func(i, j int) bool { return addrs[i].Is6() && !addrs[j].Is6() })
+	}
+	return addrs
+}
+
+// pick returns the edge to open the next connection to, skipping tried and
+// recently failed edges. Edges not measured yet come first, least used first,
+// so every edge gets tried. After that an edge scores its throughput shared
+// by one more connection than it has open. Ties go to the earlier edge.
+func (s *edgeSet) pick(now time.Time, tried map[netip.Addr]bool) *edge {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var unmeasured, best *edge
+	var bestScore float64
+	for _, e := range s.edges {
+		if tried[e.addr] || now.Before(e.failedUntil) {
+			continue
+		}
+		if e.speed == 0 {
+			if unmeasured == nil || e.open.Load() < unmeasured.open.Load() {
+				unmeasured = e
+			}
+			continue
+		}
+		if score := e.speed / float64(e.open.Load()+1); best == nil || score > bestScore {
+			best, bestScore = e, score
+		}
+	}
+	if unmeasured != nil {
+		return unmeasured
+	}
+	if best == nil {
+		// All edges failed recently: try them again rather than not at all
+		for _, e := range s.edges {
+			if !tried[e.addr] {
+				return e
+			}
+		}
+	}
+	return best
+}
+
+func (s *edgeSet) failed(e *edge, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e.failedUntil = now.Add(edgeFailBackoff)
+}
+
+// record adds a throughput sample of one of e's connections
+func (s *edgeSet) record(e *edge, speed float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e.speed == 0 {
+		e.speed = speed
+	} else {
+		e.speed = (1-edgeSpeedAlpha)*e.speed + edgeSpeedAlpha*speed
+	}
+}
+
+// edgeConn measures the throughput of a connection for its edge
+type edgeConn struct {
+	net.Conn
+	set  *edgeSet
+	edge *edge
+	once sync.Once
+
+	mu          sync.Mutex
+	sampleStart time.Time // Start of the current sample, zero before the first read
+	sampleBytes int64
+}
+
+func newEdgeConn(conn net.Conn, set *edgeSet, e *edge) *edgeConn {
+	e.open.Add(1)
+	return &edgeConn{Conn: conn, set: set, edge: e}
+}
+
+func (c *edgeConn) Read(b []byte) (int, error) {
+	start := time.Now()
+	n, err := c.Conn.Read(b)
+	now := time.Now()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err != nil {
+		c.sampleStart, c.sampleBytes = time.Time{}, 0
+		return n, err
+	}
+	if c.sampleStart.IsZero() || now.Sub(start) >= edgeIdleGap {
+		// Measure from the first data after the connection was idle, so
+		// connecting and waiting for requests do not count
+		c.sampleStart, c.sampleBytes = now, 0
+		return n, err
+	}
+	c.sampleBytes += int64(n)
+	if elapsed := now.Sub(c.sampleStart); elapsed >= edgeSampleWindow {
+		c.set.record(c.edge, float64(c.sampleBytes)/elapsed.Seconds())
+		c.sampleStart, c.sampleBytes = now, 0
+	}
+	return n, err
+}
+
+func (c *edgeConn) Close() error {
+	c.once.Do(func() { c.edge.open.Add(-1) })
+	return c.Conn.Close()
+}
@@ -0,0 +1,128 @@
+package downloader
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFilterAddrs(t *testing.T) {
+	ips := []net.IPAddr{
+		{IP: net.ParseIP("2001:db8::1")},
+		{IP: net.ParseIP("192.0.2.1")},
+		{IP: net.ParseIP("2001:db8::2")},
+		{IP: net.ParseIP("192.0.2.2")},
+	}
+	tests := []struct {
+		version string
+		want    string
+	}{
+		{IPVersionAuto, "[2001:db8::1 192.0.2.1 2001:db8::2 192.0.2.2]"},
+		{IPVersion4, "[192.0.2.1 192.0.2.2]"},
+		{IPVersion6, "[2001:db8::1 2001:db8::2]"},
+		{IPVersionPrefer4, "[192.0.2.1 192.0.2.2 2001:db8::1 2001:db8::2]"},
+		{IPVersionPrefer6, "[2001:db8::1 2001:db8::2 192.0.2.1 192.0.2.2]"},
+	}
+	for _, tt := range tests {
+		if got := fmt.Sprint(filterAddrs(ips, tt.version)); got != tt.want {
+			t.Errorf("filterAddrs(%s) = %s, want %s", tt.version, got, tt.want)
+		}
+	}
+}
+
+func TestEdgeSet_Pick(t *testing.T) {
+	a := &edge{addr: netip.MustParseAddr("192.0.2.1")}
+	b := &edge{addr: netip.MustParseAddr("192.0.2.2")}
+	set := &edgeSet{edges: []*edge{a, b}}
+	now := time.Now()
+
+	// Unmeasured edges are spread over first
+	a.open.Store(1)
+	if got := set.pick(now, nil); got != b {
+		t.Errorf("picked %s, want the unused edge %s", got.addr, b.addr)
+	}
+
+	// Then connections drift to the edge with the best share of throughput
+	set.record(a, 10*MB)
+	set.record(b, 2*MB)
+	a.open.Store(3)
+	b.open.Store(0)
+	if got := set.pick(now, nil); got != a {
+		t.Errorf("picked %s, want the fast edge %s (10 MB/s over 4 beats 2 MB/s)", got.addr, a.addr)
+	}
+	a.open.Store(5)
+	if got := set.pick(now, nil); got != b {
+		t.Errorf("picked %s, want %s once the fast edge is crowded", got.addr, b.addr)
+	}
+
+	// Failed edges are skipped for a while
+	set.failed(b, now)
+	if got := set.pick(now, nil); got != a {
+		t.Errorf("picked %s, want %s while %s is backed off", got.addr, a.addr, b.addr)
+	}
+	if got := set.pick(now, map[netip.Addr]bool{a.addr: true}); got != b {
+		t.Error("should fall back to a failed edge when nothing else is left")
+	}
+}
+
+func TestDialEdge_SpreadsAcrossAddresses(t *testing.T) {
+	first, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := first.Addr().(*net.TCPAddr).Port
+	second, err := net.Listen("tcp", "127.0.0.2:"+strconv.Itoa(port))
+	if err != nil {
+		first.Close()
+		t.Skipf("second loopback address unavailable: %v", err)
+	}
+
+	data := randomBytes(t, 16*MB)
+	var hits [2]atomic.Int32
+	for i, ln := range []net.Listener{first, second} {
+		server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			hits[i].Add(1)
+			http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(data))
+		})}
+		go server.Serve(ln)
+		defer server.Close()
+	}
+
+	old := lookupIPAddr
+	lookupIPAddr = func(ctx context.Context, host string) ([]net.IPAddr, error) {
+		if host != "edges.test" {
+			return old(ctx, host)
+		}
+		return []net.IPAddr{{IP: net.ParseIP("127.0.0.1")}, {IP: net.ParseIP("127.0.0.2")}}, nil
+	}
+	defer func() { lookupIPAddr = old }()
+
+	outDir := t.TempDir()
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	err = TUIDownload(ctx, DownloadConfig{
+		URL:        "http://edges.test:" + strconv.Itoa(port) + "/edges.bin",
+		OutputPath: outDir,
+		ID:         "edges",
+		Filename:   "edges.bin",
+		Runtime:    &RuntimeConfig{MaxConnectionsPerHost: 4, MinChunkSize: MB, MaxChunkSize: MB},
+	})
+	if err != nil {
+		t.Fatalf("download failed: %v", err)
+	}
+	if got, err := os.ReadFile(filepath.Join(outDir, "edges.bin")); err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("content mismatch (err %v)", err)
+	}
+	if hits[0].Load() == 0 || hits[1].Load() == 0 {
+		t.Errorf("requests per address = %d, %d; want both addresses used", hits[0].Load(), hits[1].Load())
+	}
+}
@@ -0,0 +1,223 @@
+package downloader
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"mime"
+	"net/url"
+	"path"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// Link categories assigned by the link grabber
+const (
+	LinkCategoryVideo    = "video"
+	LinkCategoryAudio    = "audio"
+	LinkCategoryImage    = "image"
+	LinkCategoryArchive  = "archive"
+	LinkCategoryDocument = "document"
+	LinkCategoryProgram  = "program"
+	LinkCategoryWeb      = "web" // Pages, scripts and stylesheets
+	LinkCategoryOther    = "other"
+
+	// Pseudo categories for filtering
+	LinkCategoryFiles = "files" // Everything except web
+	LinkCategoryAll   = "all"
+)
+
+// LinkCategories lists the categories a grabbed link can be filtered by, default first
+var LinkCategories = []string{
+	LinkCategoryFiles, LinkCategoryVideo, LinkCategoryAudio, LinkCategoryImage,
+	LinkCategoryArchive, LinkCategoryDocument, LinkCategoryProgram, LinkCategoryOther,
+	LinkCategoryWeb, LinkCategoryAll,
+}
+
+// linkExtensions maps file extensions (without the dot) to link categories.
+// Consulted before the MIME table, which lacks most media types on minimal systems.
+var linkExtensions = map[string]string{
+	"mp4": LinkCategoryVideo, "mkv": LinkCategoryVideo, "webm": LinkCategoryVideo, "avi": LinkCategoryVideo,
+	"mov": LinkCategoryVideo, "m4v": LinkCategoryVideo, "ts": LinkCategoryVideo, "m3u8": LinkCategoryVideo,
+	"mpd": LinkCategoryVideo, "flv": LinkCategoryVideo, "wmv": LinkCategoryVideo,
+
+	"mp3": LinkCategoryAudio, "flac": LinkCategoryAudio, "ogg": LinkCategoryAudio, "opus": LinkCategoryAudio,
+	"m4a": LinkCategoryAudio, "wav": LinkCategoryAudio, "aac": LinkCategoryAudio,
+
+	"zip": LinkCategoryArchive, "tar": LinkCategoryArchive, "gz": LinkCategoryArchive, "tgz": LinkCategoryArchive,
+	"bz2": LinkCategoryArchive, "xz": LinkCategoryArchive, "zst": LinkCategoryArchive, "7z": LinkCategoryArchive,
+	"rar": LinkCategoryArchive, "iso": LinkCategoryArchive, "img": LinkCategoryArchive, "dmg": LinkCategoryArchive,
+	"torrent": LinkCategoryArchive,
+
+	"pdf": LinkCategoryDocument, "epub": LinkCategoryDocument, "doc": LinkCategoryDocument, "docx": LinkCategoryDocument,
+	"xls": LinkCategoryDocument, "xlsx": LinkCategoryDocument, "ppt": LinkCategoryDocument, "pptx": LinkCategoryDocument,
+	"odt": LinkCategoryDocument, "ods": LinkCategoryDocument, "txt": LinkCategoryDocument, "csv": LinkCategoryDocument,
+
+	"exe": LinkCategoryProgram, "msi": LinkCategoryProgram, "deb": LinkCategoryProgram, "rpm": LinkCategoryProgram,
+	"apk": LinkCategoryProgram, "appimage": LinkCategoryProgram, "pkg": LinkCategoryProgram, "jar": LinkCategoryProgram,
+	"bin": LinkCategoryProgram,
+
+	"html": LinkCategoryWeb, "htm": LinkCategoryWeb, "php": LinkCategoryWeb, "asp": LinkCategoryWeb,
+	"aspx": LinkCategoryWeb, "jsp": LinkCategoryWeb, "js": LinkCategoryWeb, "css": LinkCategoryWeb,
+}
+
+// GrabbedLink is a link found on a web page by the link grabber
+type GrabbedLink struct {
+	URL      string
+	Name     string // Last path segment of the URL
+	Category string
+}
+
+// Matches reports whether the link passes a filter. Filters containing glob
+// characters are matched against the link name (case-insensitively); other
+// filters match any part of the name or URL.
+func (l GrabbedLink) Matches(filter string) bool {
+	filter = strings.ToLower(strings.TrimSpace(filter))
+	if filter == "" {
+		return true
+	}
+	if strings.ContainsAny(filter, "*?[") {
+		ok, _ := path.Match(filter, strings.ToLower(l.Name))
+		return ok
+	}
+	return strings.Contains(strings.ToLower(l.Name), filter) || strings.Contains(strings.ToLower(l.URL), filter)
+}
+
+// InCategory reports whether the link belongs to category, which may also be
+// one of the pseudo categories LinkCategoryFiles and LinkCategoryAll
+func (l GrabbedLink) InCategory(category string) bool {
+	switch category {
+	case LinkCategoryAll, "":
+		return true
+	case LinkCategoryFiles:
+		return l.Category != LinkCategoryWeb
+	default:
+		return l.Category == category
+	}
+}
+
+// classifyLink picks a category from the file extension, falling back to the
+// MIME type advertised by the element (type="...") or registered for the extension
+func classifyLink(name, mimeType string) string {
+	ext := strings.ToLower(strings.TrimPrefix(path.Ext(name), "."))
+	if c, ok := linkExtensions[ext]; ok {
+		return c
+	}
+	if mimeType == "" && ext != "" {
+		mimeType = mime.TypeByExtension("." + ext)
+	}
+	mimeType, _, _ = strings.Cut(mimeType, ";")
+	switch {
+	case strings.HasPrefix(mimeType, "video/"), mimeType == "application/vnd.apple.mpegurl", mimeType == "application/dash+xml":
+		return LinkCategoryVideo
+	case strings.HasPrefix(mimeType, "audio/"):
+		return LinkCategoryAudio
+	case strings.HasPrefix(mimeType, "image/"):
+		return LinkCategoryImage
+	case mimeType == "application/pdf":
+		return LinkCategoryDocument
+	case mimeType == "text/html", mimeType == "text/css", strings.HasSuffix(mimeType, "javascript"):
+		return LinkCategoryWeb
+	case mimeType != "":
+		return LinkCategoryOther
+	}
+	if ext == "" {
+		return LinkCategoryWeb
+	}
+	return LinkCategoryOther
+}
+
+// pageLink is an href or src target found in an HTML page
+type pageLink struct {
+	Tag  string
+	URL  *url.URL
+	Type string // MIME type from the element's type attribute
+}
+
+// pageLinks returns the href and src targets of every element in an HTML
+// page, resolved against base (or the page's own <base href>)
+func pageLinks(page []byte, base *url.URL) []pageLink {
+	var links []pageLink
+	z := html.NewTokenizer(bytes.NewReader(page))
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			return links
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := z.TagName()
+			if !hasAttr {
+				continue
+			}
+			tag := string(name)
+			var targets []string
+			var mimeType string
+			for {
+				key, val, more := z.TagAttr()
+				switch string(key) {
+				case "href", "src":
+					targets = append(targets, strings.TrimSpace(string(val)))
+				case "type":
+					mimeType = strings.ToLower(string(val))
+				}
+				if !more {
+					break
+				}
+			}
+			for _, target := range targets {
+				ref, err := url.Parse(target)
+				if err != nil {
+					continue
+				}
+				if tag == "base" {
+					base = base.ResolveReference(ref)
+					continue
+				}
+				links = append(links, pageLink{Tag: tag, URL: base.ResolveReference(ref), Type: mimeType})
+			}
+		}
+	}
+}
+
+// GrabLinks fetches the HTML page at pageURL and returns the http(s) links
+// it contains, de-duplicated and in page order. The page itself and
+// fragment-only links are left out.
+func GrabLinks(ctx context.Context, pageURL string, runtime *RuntimeConfig) ([]GrabbedLink, error) {
+	base, err := url.Parse(pageURL)
+	if err != nil || (base.Scheme != "http" && base.Scheme != "https") {
+		return nil, fmt.Errorf("invalid page url: %s", pageURL)
+	}
+	body, err := fetchSmall(ctx, pageURL, nil, runtime)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch page: %w", err)
+	}
+
+	page := *base
+	page.Fragment = ""
+	seen := map[string]bool{page.String(): true}
+
+	var links []GrabbedLink
+	for _, l := range pageLinks(body, base) {
+		if l.URL.Scheme != "http" && l.URL.Scheme != "https" {
+			continue // mailto:, javascript:, data: ...
+		}
+		l.URL.Fragment = ""
+		u := l.URL.String()
+		if seen[u] {
+			continue
+		}
+		seen[u] = true
+
+		link := GrabbedLink{URL: u, Name: path.Base(l.URL.Path)}
+		if link.Name == "/" || link.Name == "." {
+			link.Name, link.Category = l.URL.Host, LinkCategoryWeb
+		} else {
+			link.Category = classifyLink(link.Name, l.Type)
+		}
+		links = append(links, link)
+		if len(links) >= maxDiscoveredFiles {
+			break
+		}
+	}
+	return links, nil
+}
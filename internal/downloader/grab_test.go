@@ -0,0 +1,113 @@
+package downloader
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestClassifyLink(t *testing.T) {
+	tests := []struct {
+		name     string
+		mimeType string
+		want     string
+	}{
+		{"movie.MKV", "", LinkCategoryVideo},
+		{"song.flac", "", LinkCategoryAudio},
+		{"photo.png", "", LinkCategoryImage},
+		{"ubuntu-24.04.iso", "", LinkCategoryArchive},
+		{"src.tar.gz", "", LinkCategoryArchive},
+		{"manual.pdf", "", LinkCategoryDocument},
+		{"setup.exe", "", LinkCategoryProgram},
+		{"index.html", "", LinkCategoryWeb},
+		{"download", "", LinkCategoryWeb},
+		{"download", "video/mp4", LinkCategoryVideo},
+		{"stream", "audio/ogg; codecs=opus", LinkCategoryAudio},
+		{"data.unknownext", "", LinkCategoryOther},
+	}
+	for _, tt := range tests {
+		if got := classifyLink(tt.name, tt.mimeType); got != tt.want {
+			t.Errorf("classifyLink(%q, %q) = %q, want %q", tt.name, tt.mimeType, got, tt.want)
+		}
+	}
+}
+
+func TestGrabbedLinkFilters(t *testing.T) {
+	iso := GrabbedLink{URL: "https://mirror.local/pub/Ubuntu-24.04.ISO", Name: "Ubuntu-24.04.ISO", Category: LinkCategoryArchive}
+	page := GrabbedLink{URL: "https://mirror.local/about.html", Name: "about.html", Category: LinkCategoryWeb}
+
+	tests := []struct {
+		name string
+		got  bool
+		want bool
+	}{
+		{"empty filter", iso.Matches(""), true},
+		{"glob is case-insensitive", iso.Matches("*.iso"), true},
+		{"glob matches the name only", iso.Matches("*mirror*"), false},
+		{"substring matches the URL", iso.Matches("pub/"), true},
+		{"substring miss", iso.Matches("debian"), false},
+		{"files excludes web", page.InCategory(LinkCategoryFiles), false},
+		{"files includes archives", iso.InCategory(LinkCategoryFiles), true},
+		{"all includes web", page.InCategory(LinkCategoryAll), true},
+		{"exact category", iso.InCategory(LinkCategoryVideo), false},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, tt.got, tt.want)
+		}
+	}
+}
+
+func TestGrabLinks(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, `<html><head>
+<link rel="stylesheet" href="/static/site.css">
+<script src="/static/app.js"></script>
+</head><body>
+<a href="#top">top</a>
+<a href="files/ubuntu.iso">Ubuntu</a>
+<a href="files/ubuntu.iso#sha">same file again</a>
+<a href="mailto:admin@example.com">mail</a>
+<a href="javascript:void(0)">js</a>
+<img src="//cdn.example.com/img/logo.png">
+<video><source src="media/clip" type="video/webm"></video>
+<a href="https://other.example.com/docs/guide.pdf">guide</a>
+<a href="/">home</a>
+</body></html>`)
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	links, err := GrabLinks(ctx, server.URL+"/downloads/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []GrabbedLink{
+		{server.URL + "/static/site.css", "site.css", LinkCategoryWeb},
+		{server.URL + "/static/app.js", "app.js", LinkCategoryWeb},
+		{server.URL + "/downloads/files/ubuntu.iso", "ubuntu.iso", LinkCategoryArchive},
+		{"http://cdn.example.com/img/logo.png", "logo.png", LinkCategoryImage},
+		{server.URL + "/downloads/media/clip", "clip", LinkCategoryVideo},
+		{"https://other.example.com/docs/guide.pdf", "guide.pdf", LinkCategoryDocument},
+		{server.URL + "/", server.Listener.Addr().String(), LinkCategoryWeb},
+	}
+	if len(links) != len(want) {
+		t.Fatalf("GrabLinks returned %d links, want %d: %+v", len(links), len(want), links)
+	}
+	for i := range want {
+		if links[i] != want[i] {
+			t.Errorf("link %d = %+v, want %+v", i, links[i], want[i])
+		}
+	}
+
+	if _, err := GrabLinks(ctx, "ftp://example.com/", nil); err == nil {
+		t.Error("GrabLinks should reject non-http pages")
+	}
+}
@@ -0,0 +1,490 @@
+package downloader
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/junaid2005p/surge/internal/utils"
+)
+
+// hlsContentTypes are the playlist MIME types from RFC 8216 plus the legacy
+// ones servers still send
+var hlsContentTypes = []string{
+	"application/vnd.apple.mpegurl",
+	"application/x-mpegurl",
+	"audio/mpegurl",
+	"audio/x-mpegurl",
+}
+
+// maxPlaylistSize bounds playlist and key responses
+const maxPlaylistSize = 10 * MB
+
+// isHLSSource reports whether a probed URL is an HLS playlist, by content type
+// or, for servers that label playlists text/plain, by the .m3u8 extension
+func isHLSSource(rawurl, contentType string) bool {
+	mediaType := strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0]))
+	for _, ct := range hlsContentTypes {
+		if mediaType == ct {
+			return true
+		}
+	}
+	u, err := url.Parse(rawurl)
+	return err == nil && strings.EqualFold(path.Ext(u.Path), ".m3u8")
+}
+
+// hlsVariant is one EXT-X-STREAM-INF entry of a master playlist
+type hlsVariant struct {
+	URL       string
+	Bandwidth int64
+	Width     int
+	Height    int
+}
+
+// hlsKey is the EXT-X-KEY in effect for a segment
+type hlsKey struct {
+	Method string
+	URI    string
+	IV     []byte // nil means the IV is the segment's media sequence number
+}
+
+// hlsSegment is one media segment of a media playlist
+type hlsSegment struct {
+	URL      string
+	Duration float64
+	Offset   int64
+	Length   int64 // EXT-X-BYTERANGE length, 0 for the whole resource
+	Sequence int64
+	Key      *hlsKey
+	Map      *hlsSegment // EXT-X-MAP initialisation section, nil for MPEG-TS
+}
+
+// hlsPlaylist is a parsed master or media playlist
+type hlsPlaylist struct {
+	Variants []hlsVariant // Master playlists only
+	Segments []hlsSegment // Media playlists only
+	Ended    bool         // EXT-X-ENDLIST seen
+}
+
+// parseHLSPlaylist parses an m3u8 playlist, resolving URIs against base
+func parseHLSPlaylist(r io.Reader, base *url.URL) (*hlsPlaylist, error) {
+	pl := &hlsPlaylist{}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*KB), maxPlaylistSize)
+
+	var (
+		sawHeader  bool
+		variant    *hlsVariant
+		duration   float64
+		byteRange  string
+		sequence   int64
+		key        *hlsKey
+		initMap    *hlsSegment
+		lastURL    string
+		lastEnd    int64
+		resolveErr error
+	)
+
+	resolve := func(ref string) string {
+		u, err := base.Parse(ref)
+		if err != nil {
+			resolveErr = fmt.Errorf("invalid playlist URI %q: %w", ref, err)
+			return ""
+		}
+		return u.String()
+	}
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if !sawHeader {
+			if line != "#EXTM3U" {
+				return nil, fmt.Errorf("not an HLS playlist (missing #EXTM3U)")
+			}
+			sawHeader = true
+			continue
+		}
+
+		tag, value, _ := strings.Cut(line, ":")
+		switch {
+		case tag == "#EXT-X-STREAM-INF":
+			attrs := parseHLSAttributes(value)
+			variant = &hlsVariant{}
+			variant.Bandwidth, _ = strconv.ParseInt(attrs["BANDWIDTH"], 10, 64)
+			if w, h, ok := strings.Cut(attrs["RESOLUTION"], "x"); ok {
+				variant.Width, _ = strconv.Atoi(w)
+				variant.Height, _ = strconv.Atoi(h)
+			}
+
+		case tag == "#EXT-X-MEDIA-SEQUENCE":
+			sequence, _ = strconv.ParseInt(value, 10, 64)
+
+		case tag == "#EXTINF":
+			durStr, _, _ := strings.Cut(value, ",")
+			duration, _ = strconv.ParseFloat(durStr, 64)
+
+		case tag == "#EXT-X-BYTERANGE":
+			byteRange = value
+
+		case tag == "#EXT-X-KEY":
+			attrs := parseHLSAttributes(value)
+			method := attrs["METHOD"]
+			if method == "" || method == "NONE" {
+				key = nil
+				continue
+			}
+			key = &hlsKey{Method: method, URI: resolve(attrs["URI"])}
+			if iv := attrs["IV"]; iv != "" {
+				b, err := hex.DecodeString(strings.TrimPrefix(strings.TrimPrefix(iv, "0x"), "0X"))
+				if err != nil || len(b) != aes.BlockSize {
+					return nil, fmt.Errorf("invalid EXT-X-KEY IV %q", iv)
+				}
+				key.IV = b
+			}
+
+		case tag == "#EXT-X-MAP":
+			attrs := parseHLSAttributes(value)
+			initMap = &hlsSegment{URL: resolve(attrs["URI"])}
+			if br := attrs["BYTERANGE"]; br != "" {
+				initMap.Length, initMap.Offset = parseHLSByteRange(br, 0)
+			}
+
+		case tag == "#EXT-X-ENDLIST":
+			pl.Ended = true
+
+		case strings.HasPrefix(line, "#"):
+			// Comments and tags that don't affect what is downloaded
+
+		case variant != nil:
+			variant.URL = resolve(line)
+			pl.Variants = append(pl.Variants, *variant)
+			variant = nil
+
+		default:
+			seg := hlsSegment{
+				URL:      resolve(line),
+				Duration: duration,
+				Sequence: sequence,
+				Key:      key,
+				Map:      initMap,
+			}
+			if byteRange != "" {
+				// Without an explicit offset the range follows the previous one
+				prevEnd := int64(0)
+				if seg.URL == lastURL {
+					prevEnd = lastEnd
+				}
+				seg.Length, seg.Offset = parseHLSByteRange(byteRange, prevEnd)
+				lastEnd = seg.Offset + seg.Length
+			}
+			lastURL = seg.URL
+			pl.Segments = append(pl.Segments, seg)
+
+			sequence++
+			duration = 0
+			byteRange = ""
+		}
+
+		if resolveErr != nil {
+			return nil, resolveErr
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read playlist: %w", err)
+	}
+	if !sawHeader {
+		return nil, fmt.Errorf("not an HLS playlist (missing #EXTM3U)")
+	}
+	return pl, nil
+}
+
+// parseHLSAttributes parses an attribute list (KEY=VALUE,KEY="quoted,value")
+func parseHLSAttributes(s string) map[string]string {
+	attrs := make(map[string]string)
+	for s != "" {
+		name, rest, ok := strings.Cut(s, "=")
+		if !ok {
+			break
+		}
+		name = strings.TrimSpace(name)
+
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.IndexByte(rest[1:], '"')
+			if end == -1 {
+				value, s = rest[1:], ""
+			} else {
+				value, s = rest[1:end+1], rest[end+2:]
+			}
+			s = strings.TrimPrefix(s, ",")
+		} else {
+			value, s, _ = strings.Cut(rest, ",")
+		}
+		attrs[strings.ToUpper(name)] = value
+	}
+	return attrs
+}
+
+// parseHLSByteRange parses "<length>[@<offset>]", defaulting the offset to prevEnd
+func parseHLSByteRange(s string, prevEnd int64) (length, offset int64) {
+	lenStr, offStr, hasOffset := strings.Cut(s, "@")
+	length, _ = strconv.ParseInt(lenStr, 10, 64)
+	offset = prevEnd
+	if hasOffset {
+		offset, _ = strconv.ParseInt(offStr, 10, 64)
+	}
+	return length, offset
+}
+
+// hlsStream is a media playlist resolved into downloadable segments
+type hlsStream struct {
+	PlaylistURL   string
+	Segments      []Segment
+	EstimatedSize int64 // 0 if the playlist gives no way to tell
+	Fragmented    bool  // fMP4 segments (EXT-X-MAP) rather than MPEG-TS
+	headers       *hostHeaders
+}
+
+// prepareHLS fetches the playlist at rawurl, picks a variant according to the
+// stream quality setting if it is a master playlist, and resolves the media
+// playlist into segments. headers (e.g. from a resolver) are sent to the host
+// of rawurl.
+func prepareHLS(ctx context.Context, rawurl string, headers http.Header, runtime *RuntimeConfig) (*hlsStream, error) {
+	hostHeaders := newHostHeaders(rawurl, headers)
+	quality, err := parseStreamQuality(runtime.GetStreamQuality())
+	if err != nil {
+		return nil, err
+	}
+
+	pl, err := fetchHLSPlaylist(ctx, rawurl, hostHeaders, runtime)
+	if err != nil {
+		return nil, err
+	}
+
+	playlistURL := rawurl
+	var bandwidth int64
+	if len(pl.Variants) > 0 {
+		cands := make([]streamCandidate, len(pl.Variants))
+		for i, v := range pl.Variants {
+			cands[i] = streamCandidate{Bandwidth: v.Bandwidth, Height: v.Height}
+		}
+		v := pl.Variants[quality.pick(cands)]
+		utils.Debug("HLS: selected variant %s (bandwidth %d, %dx%d)", v.URL, v.Bandwidth, v.Width, v.Height)
+
+		playlistURL, bandwidth = v.URL, v.Bandwidth
+		if pl, err = fetchHLSPlaylist(ctx, playlistURL, hostHeaders, runtime); err != nil {
+			return nil, err
+		}
+		if len(pl.Variants) > 0 {
+			return nil, fmt.Errorf("variant %s is itself a master playlist", playlistURL)
+		}
+	}
+
+	return newHLSStream(playlistURL, pl, bandwidth, hostHeaders, runtime)
+}
+
+// loadHLSMediaPlaylist resolves a known media playlist (used when resuming)
+func loadHLSMediaPlaylist(ctx context.Context, playlistURL string, headers *hostHeaders, runtime *RuntimeConfig) (*hlsStream, error) {
+	pl, err := fetchHLSPlaylist(ctx, playlistURL, headers, runtime)
+	if err != nil {
+		return nil, err
+	}
+	if len(pl.Variants) > 0 {
+		return nil, fmt.Errorf("%s is not a media playlist", playlistURL)
+	}
+	return newHLSStream(playlistURL, pl, 0, headers, runtime)
+}
+
+// newHLSStream converts parsed segments into downloader segments, inserting
+// the initialisation section wherever it changes
+func newHLSStream(playlistURL string, pl *hlsPlaylist, bandwidth int64, headers *hostHeaders, runtime *RuntimeConfig) (*hlsStream, error) {
+	if len(pl.Segments) == 0 {
+		return nil, fmt.Errorf("playlist %s has no segments", playlistURL)
+	}
+	if !pl.Ended {
+		// Live/event playlist: archive what is published right now
+		utils.Debug("HLS: playlist has no EXT-X-ENDLIST, downloading %d published segments", len(pl.Segments))
+	}
+
+	keys := &hlsKeyCache{runtime: runtime, headers: headers, keys: make(map[string][]byte)}
+	stream := &hlsStream{PlaylistURL: playlistURL, headers: headers}
+
+	var (
+		lastMap    *hlsSegment
+		duration   float64
+		rangeBytes int64
+		allRanged  = true
+	)
+	for _, s := range pl.Segments {
+		if s.Map != nil && s.Map != lastMap {
+			stream.Segments = append(stream.Segments, Segment{URL: s.Map.URL, Offset: s.Map.Offset, Length: s.Map.Length})
+			stream.Fragmented = true
+			lastMap = s.Map
+		}
+
+		seg := Segment{URL: s.URL, Offset: s.Offset, Length: s.Length}
+		if s.Key != nil {
+			if s.Key.Method != "AES-128" {
+				return nil, fmt.Errorf("unsupported HLS encryption method %s", s.Key.Method)
+			}
+			seg.Decrypt = keys.decrypter(s.Key, s.Sequence)
+		}
+		stream.Segments = append(stream.Segments, seg)
+
+		duration += s.Duration
+		rangeBytes += s.Length
+		allRanged = allRanged && s.Length > 0
+	}
+
+	switch {
+	case allRanged:
+		stream.EstimatedSize = rangeBytes
+	case bandwidth > 0:
+		stream.EstimatedSize = int64(float64(bandwidth) * duration / 8)
+	}
+	return stream, nil
+}
+
+// outputName derives the output filename from the playlist filename
+func (s *hlsStream) outputName(playlistName, playlistURL string) string {
+	ext := ".ts"
+	if s.Fragmented {
+		ext = ".mp4"
+	}
+
+	return streamOutputName(playlistName, playlistURL, ext)
+}
+
+// fetchHLSPlaylist downloads and parses a playlist
+func fetchHLSPlaylist(ctx context.Context, rawurl string, headers *hostHeaders, runtime *RuntimeConfig) (*hlsPlaylist, error) {
+	base, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, fmt.Errorf("invalid playlist url: %w", err)
+	}
+	body, err := fetchSmall(ctx, rawurl, headers.forURL(rawurl), runtime)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch playlist: %w", err)
+	}
+	return parseHLSPlaylist(bytes.NewReader(body), base)
+}
+
+// fetchSmall GETs a small resource such as a playlist or key, with extra
+// request headers
+func fetchSmall(ctx context.Context, rawurl string, headers http.Header, runtime *RuntimeConfig) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawurl, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", runtime.GetUserAgent())
+	applyHeaders(req, headers)
+
+	resp, err := probeClient(runtime).Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status: %d", resp.StatusCode)
+	}
+	return io.ReadAll(&limitedReader{r: resp.Body, n: maxPlaylistSize})
+}
+
+// hlsKeyCache fetches each AES-128 key once per download
+type hlsKeyCache struct {
+	runtime *RuntimeConfig
+	headers *hostHeaders
+	mu      sync.Mutex
+	keys    map[string][]byte
+}
+
+func (c *hlsKeyCache) get(ctx context.Context, uri string) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if key, ok := c.keys[uri]; ok {
+		return key, nil
+	}
+	key, err := fetchSmall(ctx, uri, c.headers.forURL(uri), c.runtime)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch key: %w", err)
+	}
+	if len(key) != aes.BlockSize {
+		return nil, fmt.Errorf("invalid AES-128 key length %d", len(key))
+	}
+	c.keys[uri] = key
+	return key, nil
+}
+
+// decrypter returns a Segment.Decrypt func for a segment encrypted with key
+func (c *hlsKeyCache) decrypter(key *hlsKey, sequence int64) func(context.Context, []byte) ([]byte, error) {
+	iv := key.IV
+	if iv == nil {
+		iv = make([]byte, aes.BlockSize)
+		binary.BigEndian.PutUint64(iv[8:], uint64(sequence))
+	}
+	return func(ctx context.Context, data []byte) ([]byte, error) {
+		k, err := c.get(ctx, key.URI)
+		if err != nil {
+			return nil, err
+		}
+		return decryptAES128(data, k, iv)
+	}
+}
+
+// decryptAES128 decrypts an AES-128-CBC segment and strips its PKCS#7 padding
+func decryptAES128(data, key, iv []byte) ([]byte, error) {
+	if len(data) == 0 || len(data)%aes.BlockSize != 0 {
+		return nil, fmt.Errorf("encrypted segment length %d is not a multiple of the block size", len(data))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]byte, len(data))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(out, data)
+
+	pad := int(out[len(out)-1])
+	if pad == 0 || pad > aes.BlockSize || pad > len(out) {
+		return nil, fmt.Errorf("invalid segment padding")
+	}
+	for _, b := range out[len(out)-pad:] {
+		if int(b) != pad {
+			return nil, fmt.Errorf("invalid segment padding")
+		}
+	}
+	return out[:len(out)-pad], nil
+}
+
+// downloadHLS downloads a prepared HLS stream into destPath
+func downloadHLS(ctx context.Context, cfg DownloadConfig, destPath string, stream *hlsStream) error {
+	// A resume continues the variant chosen originally, even if the quality setting changed
+	if saved, err := LoadState(cfg.URL, destPath); err == nil && len(saved.Streams) == 1 && saved.Streams[0].Source != stream.PlaylistURL {
+		utils.Debug("HLS: resuming saved variant %s", saved.Streams[0].Source)
+		if stream, err = loadHLSMediaPlaylist(ctx, saved.Streams[0].Source, stream.headers, cfg.Runtime); err != nil {
+			return err
+		}
+	}
+
+	d := NewSegmentDownloader(cfg.ID, cfg.ProgressCh, cfg.State, cfg.Runtime)
+	if stream.headers != nil {
+		d.Authorize = stream.headers.authorize
+	}
+	track := SegmentTrack{Source: stream.PlaylistURL, DestPath: destPath, Segments: stream.Segments}
+	return d.Download(ctx, cfg.URL, destPath, []SegmentTrack{track}, stream.EstimatedSize)
+}
@@ -0,0 +1,473 @@
+package downloader
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/junaid2005p/surge/internal/config"
+	"github.com/junaid2005p/surge/internal/testutil"
+)
+
+// testPackager serves a VOD stream with a 360p clear variant and a 720p
+// AES-128 encrypted variant, like a local packager would
+type testPackager struct {
+	*httptest.Server
+	key      []byte
+	low      [][]byte // Plaintext segments of the 360p variant
+	high     [][]byte // Plaintext segments of the 720p variant
+	gateFrom int      // Segments at or after this index block until release is closed
+	release  chan struct{}
+}
+
+func startTestPackager(t *testing.T, segments int) *testPackager {
+	t.Helper()
+
+	p := &testPackager{key: randomBytes(t, 16), gateFrom: -1, release: make(chan struct{})}
+	for i := 0; i < segments; i++ {
+		p.low = append(p.low, randomBytes(t, 8*KB+i))
+		p.high = append(p.high, randomBytes(t, 32*KB+i))
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/vod/master.m3u8", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
+		fmt.Fprint(w, "#EXTM3U\n",
+			"#EXT-X-STREAM-INF:BANDWIDTH=400000,RESOLUTION=640x360,CODECS=\"avc1.4d401e,mp4a.40.2\"\n",
+			"low/index.m3u8\n",
+			"#EXT-X-STREAM-INF:BANDWIDTH=1200000,RESOLUTION=1280x720,CODECS=\"avc1.4d401f,mp4a.40.2\"\n",
+			"high/index.m3u8\n")
+	})
+	mux.HandleFunc("/vod/low/index.m3u8", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
+		fmt.Fprint(w, "#EXTM3U\n#EXT-X-TARGETDURATION:4\n")
+		for i := range p.low {
+			fmt.Fprintf(w, "#EXTINF:4.0,\nseg%d.ts\n", i)
+		}
+		fmt.Fprint(w, "#EXT-X-ENDLIST\n")
+	})
+	mux.HandleFunc("/vod/high/index.m3u8", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
+		fmt.Fprint(w, "#EXTM3U\n#EXT-X-TARGETDURATION:4\n#EXT-X-MEDIA-SEQUENCE:7\n",
+			"#EXT-X-KEY:METHOD=AES-128,URI=\"../key.bin\"\n")
+		for i := range p.high {
+			fmt.Fprintf(w, "#EXTINF:4.0,\nseg%d.ts\n", i)
+		}
+		fmt.Fprint(w, "#EXT-X-ENDLIST\n")
+	})
+	mux.HandleFunc("/vod/key.bin", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(p.key)
+	})
+	mux.HandleFunc("/vod/", func(w http.ResponseWriter, r *http.Request) {
+		var idx int
+		if _, err := fmt.Sscanf(filepath.Base(r.URL.Path), "seg%d.ts", &idx); err != nil {
+			http.NotFound(w, r)
+			return
+		}
+
+		if p.gateFrom >= 0 && idx >= p.gateFrom {
+			select {
+			case <-p.release:
+			case <-r.Context().Done():
+				return
+			}
+		}
+
+		w.Header().Set("Content-Type", "video/mp2t")
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/vod/low/") && idx < len(p.low):
+			w.Write(p.low[idx])
+		case strings.HasPrefix(r.URL.Path, "/vod/high/") && idx < len(p.high):
+			// IV is the media sequence number (7 + index)
+			iv := make([]byte, aes.BlockSize)
+			iv[15] = byte(7 + idx)
+			w.Write(encryptAES128(t, p.high[idx], p.key, iv))
+		default:
+			http.NotFound(w, r)
+		}
+	})
+
+	p.Server = httptest.NewServer(mux)
+	t.Cleanup(p.Close)
+	return p
+}
+
+func randomBytes(t *testing.T, n int) []byte {
+	t.Helper()
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func encryptAES128(t *testing.T, plain, key, iv []byte) []byte {
+	t.Helper()
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pad := aes.BlockSize - len(plain)%aes.BlockSize
+	padded := append(append([]byte{}, plain...), bytes.Repeat([]byte{byte(pad)}, pad)...)
+	out := make([]byte, len(padded))
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(out, padded)
+	return out
+}
+
+func TestIsHLSSource(t *testing.T) {
+	tests := []struct {
+		url         string
+		contentType string
+		want        bool
+	}{
+		{"http://example.com/live", "application/vnd.apple.mpegurl", true},
+		{"http://example.com/live", "application/x-mpegURL; charset=utf-8", true},
+		{"http://example.com/stream/index.m3u8?token=abc", "text/plain", true},
+		{"http://example.com/video.mp4", "video/mp4", false},
+		{"http://example.com/list.m3u", "text/plain", false},
+	}
+
+	for _, tt := range tests {
+		if got := isHLSSource(tt.url, tt.contentType); got != tt.want {
+			t.Errorf("isHLSSource(%q, %q) = %v, want %v", tt.url, tt.contentType, got, tt.want)
+		}
+	}
+}
+
+func TestParseHLSPlaylist_Master(t *testing.T) {
+	base, _ := url.Parse("http://example.com/vod/master.m3u8")
+	playlist := `#EXTM3U
+#EXT-X-VERSION:3
+#EXT-X-STREAM-INF:BANDWIDTH=800000,RESOLUTION=640x360,CODECS="avc1.4d401e,mp4a.40.2"
+360p/index.m3u8
+#EXT-X-STREAM-INF:BANDWIDTH=5000000,RESOLUTION=1920x1080
+http://cdn.example.com/1080p/index.m3u8
+`
+	pl, err := parseHLSPlaylist(strings.NewReader(playlist), base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pl.Variants) != 2 || len(pl.Segments) != 0 {
+		t.Fatalf("got %d variants, %d segments; want 2, 0", len(pl.Variants), len(pl.Segments))
+	}
+
+	want := []hlsVariant{
+		{URL: "http://example.com/vod/360p/index.m3u8", Bandwidth: 800000, Width: 640, Height: 360},
+		{URL: "http://cdn.example.com/1080p/index.m3u8", Bandwidth: 5000000, Width: 1920, Height: 1080},
+	}
+	for i, v := range want {
+		if pl.Variants[i] != v {
+			t.Errorf("variant %d = %+v, want %+v", i, pl.Variants[i], v)
+		}
+	}
+}
+
+func TestParseHLSPlaylist_Media(t *testing.T) {
+	base, _ := url.Parse("http://example.com/vod/720p/index.m3u8")
+	playlist := `#EXTM3U
+#EXT-X-TARGETDURATION:6
+#EXT-X-MEDIA-SEQUENCE:100
+#EXT-X-MAP:URI="init.mp4",BYTERANGE="720@0"
+#EXT-X-KEY:METHOD=AES-128,URI="https://keys.example.com/k1",IV=0x000102030405060708090a0b0c0d0e0f
+#EXTINF:6.0,
+#EXT-X-BYTERANGE:1000@720
+media.mp4
+#EXTINF:5.5,
+#EXT-X-BYTERANGE:2000
+media.mp4
+#EXT-X-KEY:METHOD=NONE
+#EXTINF:4.0,
+seg3.m4s
+#EXT-X-ENDLIST
+`
+	pl, err := parseHLSPlaylist(strings.NewReader(playlist), base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !pl.Ended {
+		t.Error("Ended = false, want true")
+	}
+	if len(pl.Segments) != 3 {
+		t.Fatalf("got %d segments, want 3", len(pl.Segments))
+	}
+
+	s0, s1, s2 := pl.Segments[0], pl.Segments[1], pl.Segments[2]
+	if s0.URL != "http://example.com/vod/720p/media.mp4" || s0.Offset != 720 || s0.Length != 1000 {
+		t.Errorf("segment 0 = %s @%d+%d", s0.URL, s0.Offset, s0.Length)
+	}
+	if s1.Offset != 1720 || s1.Length != 2000 {
+		t.Errorf("segment 1 range = @%d+%d, want @1720+2000 (continues previous range)", s1.Offset, s1.Length)
+	}
+	if s0.Sequence != 100 || s2.Sequence != 102 {
+		t.Errorf("sequences = %d, %d; want 100, 102", s0.Sequence, s2.Sequence)
+	}
+	if s0.Key == nil || s0.Key.URI != "https://keys.example.com/k1" || len(s0.Key.IV) != 16 || s0.Key.IV[15] != 0x0f {
+		t.Errorf("segment 0 key = %+v", s0.Key)
+	}
+	if s2.Key != nil {
+		t.Errorf("segment 2 key = %+v, want nil after METHOD=NONE", s2.Key)
+	}
+	if s0.Map == nil || s0.Map.URL != "http://example.com/vod/720p/init.mp4" || s0.Map.Length != 720 {
+		t.Errorf("segment 0 map = %+v", s0.Map)
+	}
+	if s0.Duration != 6.0 || s1.Duration != 5.5 {
+		t.Errorf("durations = %v, %v", s0.Duration, s1.Duration)
+	}
+}
+
+func TestParseHLSPlaylist_Invalid(t *testing.T) {
+	base, _ := url.Parse("http://example.com/")
+	for _, body := range []string{"", "<html></html>", "#EXTINF:1,\nseg.ts\n"} {
+		if _, err := parseHLSPlaylist(strings.NewReader(body), base); err == nil {
+			t.Errorf("parseHLSPlaylist(%q) should fail", body)
+		}
+	}
+}
+
+func TestParseHLSAttributes(t *testing.T) {
+	attrs := parseHLSAttributes(`METHOD=AES-128,URI="key?a=1,b=2",IV=0x01,keyformat="identity"`)
+	want := map[string]string{"METHOD": "AES-128", "URI": "key?a=1,b=2", "IV": "0x01", "KEYFORMAT": "identity"}
+	for k, v := range want {
+		if attrs[k] != v {
+			t.Errorf("attrs[%s] = %q, want %q", k, attrs[k], v)
+		}
+	}
+}
+
+func TestStreamQuality(t *testing.T) {
+	cands := []streamCandidate{
+		{Bandwidth: 800000, Height: 360},
+		{Bandwidth: 2500000, Height: 720},
+		{Bandwidth: 3000000, Height: 720},
+		{Bandwidth: 6000000, Height: 1080},
+	}
+
+	tests := []struct {
+		quality string
+		want    int
+	}{
+		{"", 3},
+		{"best", 3},
+		{"WORST", 0},
+		{"720p", 2},
+		{"1280x720", 2},
+		{"900p", 2},
+		{"240p", 0},
+		{"2500k", 1},
+		{"2.9m", 1},
+		{"100k", 0},
+		{"10000000", 3},
+	}
+
+	for _, tt := range tests {
+		q, err := parseStreamQuality(tt.quality)
+		if err != nil {
+			t.Errorf("parseStreamQuality(%q) failed: %v", tt.quality, err)
+			continue
+		}
+		if got := q.pick(cands); got != tt.want {
+			t.Errorf("quality %q picked %d, want %d", tt.quality, got, tt.want)
+		}
+	}
+
+	for _, bad := range []string{"high", "p", "0k", "abcx"} {
+		if _, err := parseStreamQuality(bad); err == nil {
+			t.Errorf("parseStreamQuality(%q) should fail", bad)
+		}
+	}
+}
+
+func TestDecryptAES128(t *testing.T) {
+	key := randomBytes(t, 16)
+	iv := randomBytes(t, 16)
+
+	for _, size := range []int{0, 1, 15, 16, 17, 4096} {
+		plain := randomBytes(t, size)
+		got, err := decryptAES128(encryptAES128(t, plain, key, iv), key, iv)
+		if err != nil {
+			t.Fatalf("size %d: %v", size, err)
+		}
+		if !bytes.Equal(got, plain) {
+			t.Errorf("size %d: decrypted data mismatch", size)
+		}
+	}
+
+	if _, err := decryptAES128(randomBytes(t, 15), key, iv); err == nil {
+		t.Error("expected error for partial block")
+	}
+	if _, err := decryptAES128(encryptAES128(t, []byte("data"), key, iv), randomBytes(t, 16), iv); err == nil {
+		t.Error("expected padding error with the wrong key")
+	}
+}
+
+func TestHLSOutputName(t *testing.T) {
+	tests := []struct {
+		stream   hlsStream
+		name     string
+		url      string
+		expected string
+	}{
+		{hlsStream{}, "show.m3u8", "http://h/show.m3u8", "show.ts"},
+		{hlsStream{}, "master.m3u8", "http://h/streams/big_buck_bunny/master.m3u8", "big_buck_bunny.ts"},
+		{hlsStream{Fragmented: true}, "index.m3u8", "http://h/index.m3u8", "index.mp4"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.stream.outputName(tt.name, tt.url); got != tt.expected {
+			t.Errorf("outputName(%q, %q) = %q, want %q", tt.name, tt.url, got, tt.expected)
+		}
+	}
+}
+
+func TestTUIDownload_HLS(t *testing.T) {
+	if err := config.EnsureDirs(); err != nil {
+		t.Fatalf("Failed to create config dirs: %v", err)
+	}
+	p := startTestPackager(t, 6)
+
+	tests := []struct {
+		quality string
+		want    [][]byte
+	}{
+		{"best", p.high},
+		{"360p", p.low},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.quality, func(t *testing.T) {
+			outDir, cleanup, err := testutil.TempDir("surge-hls")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer cleanup()
+
+			state := NewProgressState("hls-"+tt.quality, 0)
+			cfg := DownloadConfig{
+				URL:        p.URL + "/vod/master.m3u8",
+				OutputPath: outDir,
+				ID:         "hls-" + tt.quality,
+				State:      state,
+				Runtime:    &RuntimeConfig{MaxConnectionsPerHost: 4, StreamQuality: tt.quality},
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+
+			if err := TUIDownload(ctx, cfg); err != nil {
+				t.Fatalf("HLS download failed: %v", err)
+			}
+
+			got, err := os.ReadFile(filepath.Join(outDir, "vod.ts"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := bytes.Join(tt.want, nil); !bytes.Equal(got, want) {
+				t.Errorf("output is %d bytes, want %d bytes of concatenated segments", len(got), len(want))
+			}
+			if _, err := os.Stat(filepath.Join(outDir, "vod.ts"+IncompleteSuffix+".parts")); !os.IsNotExist(err) {
+				t.Error("segment directory should be removed after completion")
+			}
+			if state.TotalSize != int64(len(got)) {
+				t.Errorf("TotalSize = %d, want final size %d", state.TotalSize, len(got))
+			}
+		})
+	}
+}
+
+func TestTUIDownload_HLSPauseResume(t *testing.T) {
+	if err := config.EnsureDirs(); err != nil {
+		t.Fatalf("Failed to create config dirs: %v", err)
+	}
+	p := startTestPackager(t, 8)
+	p.gateFrom = 3
+
+	outDir, cleanup, err := testutil.TempDir("surge-hls-resume")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	rawurl := p.URL + "/vod/master.m3u8"
+	runtime := &RuntimeConfig{MaxConnectionsPerHost: 2}
+	state := NewProgressState("hls-resume", 0)
+	cfg := DownloadConfig{
+		URL:        rawurl,
+		OutputPath: outDir,
+		ID:         "hls-resume",
+		State:      state,
+		Runtime:    runtime,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	errCh := make(chan error, 1)
+	go func() { errCh <- TUIDownload(ctx, cfg) }()
+
+	// Segments 0-2 complete, the rest block in the handler
+	firstThree := int64(len(p.high[0]) + len(p.high[1]) + len(p.high[2]))
+	deadline := time.Now().Add(10 * time.Second)
+	for state.Downloaded.Load() < firstThree {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for first segments (downloaded %d)", state.Downloaded.Load())
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	time.Sleep(100 * time.Millisecond) // Let the writer append them
+	state.Pause()
+
+	if err := <-errCh; err != nil {
+		t.Fatalf("paused download returned error: %v", err)
+	}
+
+	destPath := filepath.Join(outDir, "vod.ts")
+	saved, err := LoadState(rawurl, destPath)
+	if err != nil {
+		t.Fatalf("pause state not saved: %v", err)
+	}
+	defer DeleteState("hls-resume", rawurl, destPath)
+	if len(saved.Streams) != 1 {
+		t.Fatalf("saved %d streams, want 1", len(saved.Streams))
+	}
+	if sp := saved.Streams[0]; sp.SegmentsDone != 3 || sp.Written != firstThree || saved.Downloaded != firstThree {
+		t.Errorf("saved SegmentsDone=%d Written=%d Downloaded=%d, want 3 and %d", sp.SegmentsDone, sp.Written, saved.Downloaded, firstThree)
+	}
+	if !strings.HasSuffix(saved.Streams[0].Source, "/vod/high/index.m3u8") {
+		t.Errorf("saved Source = %q, want the selected variant", saved.Streams[0].Source)
+	}
+
+	// Resume with a different quality setting: the saved variant must be kept
+	close(p.release)
+	runtime.StreamQuality = "worst"
+	resumeState := NewProgressState("hls-resume", saved.TotalSize)
+	resumeState.Downloaded.Store(saved.Downloaded)
+	cfg.State = resumeState
+	cfg.IsResume = true
+	cfg.DestPath = destPath
+
+	if err := TUIDownload(ctx, cfg); err != nil {
+		t.Fatalf("resume failed: %v", err)
+	}
+
+	got, err := os.ReadFile(destPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := bytes.Join(p.high, nil); !bytes.Equal(got, want) {
+		t.Errorf("resumed output is %d bytes, want %d", len(got), len(want))
+	}
+	if _, err := LoadState(rawurl, destPath); err == nil {
+		t.Error("state file should be deleted after successful resume")
+	}
+}
@@ -0,0 +1,77 @@
+package downloader
+
+import (
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+)
+
+// HTTP/2 modes (RuntimeConfig.HTTP2)
+const (
+	HTTP2Off         = "off"         // HTTP/1.1 only, a TCP connection per request
+	HTTP2Connections = "connections" // HTTP/2, still a TCP connection per concurrent request
+	HTTP2Streams     = "streams"     // HTTP/2, concurrent requests share connections as streams
+)
+
+// http2StreamWorkers caps the workers of a download running as streams over
+// one HTTP/2 connection: they share its congestion window, so more streams
+// add overhead rather than throughput
+const http2StreamWorkers = 8
+
+// spreadTransport sends the concurrent requests to a host over separate
+// transports, each holding one HTTP/2 connection, so every worker gets a TCP
+// connection of its own. Requests go to the transport with the fewest in
+// flight.
+type spreadTransport struct {
+	key      transportKey // Of slot 0
+	inflight []atomic.Int32
+}
+
+var spreadTransports = make(map[transportKey]*spreadTransport) // Guarded by transportsMu
+
+// spreadTransportFor returns the spreadTransport for key, creating it on
+// first use. Its slot transports are created as they are needed.
+func spreadTransportFor(key transportKey) *spreadTransport {
+	transportsMu.Lock()
+	defer transportsMu.Unlock()
+	s, ok := spreadTransports[key]
+	if !ok {
+		s = &spreadTransport{key: key, inflight: make([]atomic.Int32, max(key.maxConns, 1))}
+		spreadTransports[key] = s
+	}
+	return s
+}
+
+func (s *spreadTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	slot := 0
+	for i := range s.inflight {
+		if s.inflight[i].Load() < s.inflight[slot].Load() {
+			slot = i
+		}
+	}
+	s.inflight[slot].Add(1)
+	done := func() { s.inflight[slot].Add(-1) }
+
+	key := s.key
+	key.slot = slot
+	resp, err := sharedTransport(key).RoundTrip(req)
+	if err != nil {
+		done()
+		return nil, err
+	}
+	resp.Body = &releaseBody{ReadCloser: resp.Body, release: done}
+	return resp, nil
+}
+
+// releaseBody calls release once when closed
+type releaseBody struct {
+	io.ReadCloser
+	release func()
+	once    sync.Once
+}
+
+func (b *releaseBody) Close() error {
+	b.once.Do(b.release)
+	return b.ReadCloser.Close()
+}
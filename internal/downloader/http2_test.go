@@ -0,0 +1,138 @@
+package downloader
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newHTTP2Server starts a TLS server that negotiates HTTP/2 and counts the TCP
+// connections made to it
+func newHTTP2Server(t *testing.T, handler http.Handler) (*httptest.Server, *atomic.Int32) {
+	server := httptest.NewUnstartedServer(handler)
+	var dials atomic.Int32
+	server.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			dials.Add(1)
+		}
+	}
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	trustServer(t, server)
+	return server, &dials
+}
+
+// concurrentGets sends a first request, as the probe would, then n requests
+// at once, and returns the HTTP versions of the responses and the number of
+// TCP connections used. The server holds the responses until all concurrent
+// requests have arrived.
+func concurrentGets(t *testing.T, n int, mode string) (protos []int, conns int) {
+	var arrived sync.WaitGroup
+	var warm atomic.Bool
+	server, dials := newHTTP2Server(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if warm.Load() {
+			arrived.Done()
+			arrived.Wait()
+		}
+		w.Write([]byte("ok"))
+	}))
+
+	client := newDownloadClient(&RuntimeConfig{MaxConnectionsPerHost: 8, HTTP2: mode})
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	warm.Store(true)
+	arrived.Add(n)
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := client.Get(server.URL)
+			if err != nil {
+				t.Error(err)
+				arrived.Done()
+				return
+			}
+			resp.Body.Close()
+			mu.Lock()
+			protos = append(protos, resp.ProtoMajor)
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	return protos, int(dials.Load())
+}
+
+func TestHTTP2Modes(t *testing.T) {
+	tests := []struct {
+		mode  string
+		proto int
+		conns int
+	}{
+		{HTTP2Off, 1, 4},
+		{HTTP2Connections, 2, 4},
+		{HTTP2Streams, 2, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			protos, conns := concurrentGets(t, 4, tt.mode)
+			for _, p := range protos {
+				if p != tt.proto {
+					t.Errorf("response over HTTP/%d, want HTTP/%d", p, tt.proto)
+				}
+			}
+			if conns != tt.conns {
+				t.Errorf("%d TCP connections for 4 concurrent requests, want %d", conns, tt.conns)
+			}
+		})
+	}
+}
+
+func TestHTTP2Streams_Download(t *testing.T) {
+	data := randomBytes(t, 8*MB)
+	var maxStreams, streams atomic.Int32
+	server, dials := newHTTP2Server(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := streams.Add(1)
+		defer streams.Add(-1)
+		for cur := maxStreams.Load(); n > cur && !maxStreams.CompareAndSwap(cur, n); cur = maxStreams.Load() {
+		}
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(data))
+	}))
+
+	outDir := t.TempDir()
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	err := TUIDownload(ctx, DownloadConfig{
+		URL:        server.URL + "/streams.bin",
+		OutputPath: outDir,
+		ID:         "streams",
+		Filename:   "streams.bin",
+		Runtime:    &RuntimeConfig{HTTP2: HTTP2Streams, MinChunkSize: 256 * KB, MaxChunkSize: 512 * KB},
+	})
+	if err != nil {
+		t.Fatalf("download failed: %v", err)
+	}
+	if got, err := os.ReadFile(filepath.Join(outDir, "streams.bin")); err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("content mismatch (err %v)", err)
+	}
+	if n := dials.Load(); n != 1 {
+		t.Errorf("opened %d TCP connections, want 1 shared by all streams", n)
+	}
+	if n := maxStreams.Load(); n > http2StreamWorkers {
+		t.Errorf("%d concurrent streams, want at most %d", n, http2StreamWorkers)
+	}
+}
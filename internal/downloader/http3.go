@@ -0,0 +1,262 @@
+package downloader
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+
+	"github.com/junaid2005p/surge/internal/utils"
+)
+
+// HTTP/3 modes (RuntimeConfig.HTTP3)
+const (
+	HTTP3Off  = "off"  // Only for the hosts listed in HTTP3Hosts
+	HTTP3Auto = "auto" // Also for hosts that advertise HTTP/3 with Alt-Svc
+	HTTP3On   = "on"   // For every https host
+)
+
+const (
+	maxHTTP3Connections = 8                // Cap for HTTP3Connections
+	http3Backoff        = 10 * time.Minute // How long a host stays on TCP after HTTP/3 failed
+	defaultAltSvcMaxAge = 24 * time.Hour   // Alt-Svc lifetime when the header gives none
+)
+
+// altSvcEndpoint is an HTTP/3 endpoint a host advertised with Alt-Svc
+type altSvcEndpoint struct {
+	addr    string // host:port to dial
+	expires time.Time
+}
+
+// http3Hosts is what was learned about the HTTP/3 support of hosts. Keys are
+// host[:port], lower case, as in transportKey.
+var http3Hosts = struct {
+	sync.Mutex
+	altSvc map[string]altSvcEndpoint
+	failed map[string]time.Time // When HTTP/3 last failed
+}{
+	altSvc: make(map[string]altSvcEndpoint),
+	failed: make(map[string]time.Time),
+}
+
+// http3Transport spreads the requests to one host over a few QUIC
+// connections. Each http3.Transport keeps one connection per host, on which
+// concurrent range requests run as streams.
+type http3Transport struct {
+	conns []*http3.Transport
+	next  atomic.Uint32
+}
+
+// http3Key identifies the downloads that can share QUIC connections
+type http3Key struct {
+	host  string // host[:port] of the URL, lower case
+	addr  string // host:port dialed
+	conns int
+	dns   *dnsResolver
+	tls   tlsOptions
+}
+
+var (
+	http3TransportsMu sync.Mutex
+	http3Transports   = make(map[http3Key]*http3Transport)
+)
+
+// http3TransportFor returns the shared HTTP/3 transport for the host of u,
+// dialing addr, creating it on first use
+func http3TransportFor(u *url.URL, addr string, conns int, r *dnsResolver, tlsOpts tlsOptions) *http3Transport {
+	key := http3Key{host: strings.ToLower(u.Host), addr: addr, conns: conns, dns: r, tls: tlsOpts}
+
+	http3TransportsMu.Lock()
+	defer http3TransportsMu.Unlock()
+	t, ok := http3Transports[key]
+	if !ok {
+		t = newHTTP3Transport(addr, conns, r, tlsOpts)
+		http3Transports[key] = t
+	}
+	return t
+}
+
+func newHTTP3Transport(addr string, conns int, r *dnsResolver, tlsOpts tlsOptions) *http3Transport {
+	t := &http3Transport{}
+	tlsConf, _ := tlsConfigFor(tlsOpts) // Checked by pooledTransport
+	for range conns {
+		t.conns = append(t.conns, &http3.Transport{
+			TLSClientConfig:    tlsConf.Clone(),
+			DisableCompression: true, // Files are usually already compressed
+			QUICConfig: &quic.Config{
+				HandshakeIdleTimeout: DialTimeout,
+				MaxIdleTimeout:       DefaultIdleConnTimeout,
+				KeepAlivePeriod:      KeepAliveDuration,
+			},
+			// Dial the advertised endpoint, which may differ from the URL's
+			Dial: func(ctx context.Context, _ string, tlsConf *tls.Config, conf *quic.Config) (*quic.Conn, error) {
+				ipAddr, err := r.resolveAddr(ctx, addr)
+				if err != nil {
+					return nil, err
+				}
+				return quic.DialAddrEarly(ctx, ipAddr, tlsConf, conf)
+			},
+		})
+	}
+	return t
+}
+
+func (t *http3Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	conn := t.conns[int(t.next.Add(1)-1)%len(t.conns)]
+	return conn.RoundTrip(req)
+}
+
+// http3Endpoint returns the address to send a request for u to over HTTP/3,
+// or false to use TCP
+func (p pooledTransport) http3Endpoint(u *url.URL, now time.Time) (string, bool) {
+	if u.Scheme != "https" {
+		return "", false
+	}
+	host := strings.ToLower(u.Host)
+
+	http3Hosts.Lock()
+	defer http3Hosts.Unlock()
+	if failed, ok := http3Hosts.failed[host]; ok {
+		if now.Sub(failed) < http3Backoff {
+			return "", false
+		}
+		delete(http3Hosts.failed, host)
+	}
+
+	alt, advertised := http3Hosts.altSvc[host]
+	if advertised && !now.Before(alt.expires) {
+		delete(http3Hosts.altSvc, host)
+		advertised = false
+	}
+	if advertised && p.http3 != HTTP3Off {
+		return alt.addr, true
+	}
+	if p.http3 == HTTP3On || matchesHost(u.Hostname(), p.http3Hosts) {
+		if advertised {
+			return alt.addr, true
+		}
+		return hostWithPort(u), true
+	}
+	return "", false
+}
+
+// http3Failed keeps the host of u on TCP for a while
+func http3Failed(u *url.URL, now time.Time) {
+	http3Hosts.Lock()
+	defer http3Hosts.Unlock()
+	http3Hosts.failed[strings.ToLower(u.Host)] = now
+}
+
+// recordAltSvc remembers the HTTP/3 endpoint advertised in an Alt-Svc header
+// of a response from u
+func recordAltSvc(u *url.URL, header string, now time.Time) {
+	if header == "" || u.Scheme != "https" {
+		return
+	}
+	host := strings.ToLower(u.Host)
+	addr, maxAge, clear := parseAltSvc(header, u.Hostname())
+
+	http3Hosts.Lock()
+	defer http3Hosts.Unlock()
+	switch {
+	case clear:
+		delete(http3Hosts.altSvc, host)
+	case addr != "":
+		http3Hosts.altSvc[host] = altSvcEndpoint{addr: addr, expires: now.Add(maxAge)}
+	}
+}
+
+// parseAltSvc returns the h3 endpoint of an Alt-Svc header (RFC 7838) as
+// host:port, with hostname filled in when the header gives only a port.
+// clear is true for "Alt-Svc: clear".
+func parseAltSvc(header, hostname string) (addr string, maxAge time.Duration, clear bool) {
+	if strings.TrimSpace(header) == "clear" {
+		return "", 0, true
+	}
+	for _, entry := range strings.Split(header, ",") {
+		params := strings.Split(entry, ";")
+		proto, authority, ok := strings.Cut(strings.TrimSpace(params[0]), "=")
+		if !ok || proto != "h3" {
+			continue
+		}
+		authority = strings.Trim(authority, `"`)
+		altHost, port, err := net.SplitHostPort(authority)
+		if err != nil || port == "" {
+			continue
+		}
+		if altHost == "" {
+			altHost = hostname
+		}
+
+		maxAge = defaultAltSvcMaxAge
+		for _, param := range params[1:] {
+			if name, value, ok := strings.Cut(strings.TrimSpace(param), "="); ok && name == "ma" {
+				if secs, err := strconv.Atoi(strings.Trim(value, `"`)); err == nil && secs >= 0 {
+					maxAge = time.Duration(secs) * time.Second
+				}
+			}
+		}
+		return net.JoinHostPort(altHost, port), maxAge, false
+	}
+	return "", 0, false
+}
+
+// matchesHost reports whether hostname is one of hosts or a subdomain of one
+func matchesHost(hostname string, hosts []string) bool {
+	hostname = strings.ToLower(hostname)
+	for _, h := range hosts {
+		h = strings.ToLower(strings.TrimPrefix(h, "."))
+		if hostname == h || strings.HasSuffix(hostname, "."+h) {
+			return true
+		}
+	}
+	return false
+}
+
+// hostWithPort returns the host:port of u, with the scheme's default port
+func hostWithPort(u *url.URL) string {
+	if u.Port() != "" {
+		return u.Host
+	}
+	if u.Scheme == "http" {
+		return net.JoinHostPort(u.Hostname(), "80")
+	}
+	return net.JoinHostPort(u.Hostname(), "443")
+}
+
+// roundTripHTTP3 sends req over HTTP/3 to addr, resolved by r. On failure
+// the host is put back on TCP for http3Backoff; returns false if the request
+// should then be sent over TCP.
+func roundTripHTTP3(req *http.Request, addr string, conns int, r *dnsResolver, tlsOpts tlsOptions) (*http.Response, bool, error) {
+	resp, err := http3TransportFor(req.URL, addr, conns, r, tlsOpts).RoundTrip(req)
+	if err == nil {
+		return resp, true, nil
+	}
+	if req.Context().Err() != nil {
+		return nil, true, err
+	}
+	utils.Debug("HTTP/3 to %s failed, falling back to TCP: %v", req.URL.Host, err)
+	http3Failed(req.URL, time.Now())
+	return nil, false, nil
+}
+
+// closeIdleHTTP3Connections closes the idle QUIC connections of all HTTP/3
+// transports
+func closeIdleHTTP3Connections() {
+	http3TransportsMu.Lock()
+	defer http3TransportsMu.Unlock()
+	for _, t := range http3Transports {
+		for _, conn := range t.conns {
+			conn.CloseIdleConnections()
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package downloader
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+)
+
+func TestParseAltSvc(t *testing.T) {
+	tests := []struct {
+		header string
+		addr   string
+		maxAge time.Duration
+		clear  bool
+	}{
+		{`h3=":443"; ma=3600`, "cdn.example:443", time.Hour, false},
+		{`h2=":443", h3="alt.example:8443"`, "alt.example:8443", defaultAltSvcMaxAge, false},
+		{`h3-29=":443"; ma=60`, "", 0, false},
+		{`clear`, "", 0, true},
+		{`h3`, "", 0, false},
+	}
+	for _, tt := range tests {
+		addr, maxAge, clear := parseAltSvc(tt.header, "cdn.example")
+		if addr != tt.addr || maxAge != tt.maxAge || clear != tt.clear {
+			t.Errorf("parseAltSvc(%q) = %q, %v, %v; want %q, %v, %v",
+				tt.header, addr, maxAge, clear, tt.addr, tt.maxAge, tt.clear)
+		}
+	}
+}
+
+func TestHTTP3Endpoint(t *testing.T) {
+	now := time.Now()
+	listed, _ := url.Parse("https://dl.listed.example/file.bin")
+	advertised, _ := url.Parse("https://advertised.example/file.bin")
+	plain, _ := url.Parse("http://advertised.example/file.bin")
+	recordAltSvc(advertised, `h3=":8443"`, now)
+
+	off := pooledTransport{http3: HTTP3Off, http3Hosts: []string{"listed.example"}}
+	if addr, ok := off.http3Endpoint(listed, now); !ok || addr != "dl.listed.example:443" {
+		t.Errorf("listed host: got %q, %v", addr, ok)
+	}
+	if _, ok := off.http3Endpoint(advertised, now); ok {
+		t.Error("off mode should ignore Alt-Svc")
+	}
+
+	auto := pooledTransport{http3: HTTP3Auto}
+	if addr, ok := auto.http3Endpoint(advertised, now); !ok || addr != "advertised.example:8443" {
+		t.Errorf("advertised host: got %q, %v", addr, ok)
+	}
+	if _, ok := auto.http3Endpoint(plain, now); ok {
+		t.Error("http URLs should stay on TCP")
+	}
+	if _, ok := auto.http3Endpoint(advertised, now.Add(defaultAltSvcMaxAge)); ok {
+		t.Error("expired Alt-Svc should not be used")
+	}
+
+	on := pooledTransport{http3: HTTP3On}
+	http3Failed(listed, now)
+	if _, ok := on.http3Endpoint(listed, now.Add(time.Minute)); ok {
+		t.Error("host should stay on TCP after HTTP/3 failed")
+	}
+	if _, ok := on.http3Endpoint(listed, now.Add(http3Backoff)); !ok {
+		t.Error("HTTP/3 should be tried again after the backoff")
+	}
+}
+
+// trustServer makes download connections trust the certificate of server
+func trustServer(t *testing.T, server *httptest.Server) {
+	pool := x509.NewCertPool()
+	pool.AddCert(server.Certificate())
+	old := downloadTLSConfig
+	downloadTLSConfig = &tls.Config{RootCAs: pool}
+	t.Cleanup(func() { downloadTLSConfig = old })
+}
+
+// newAltSvcServer starts a TLS server for data that advertises altPort as its
+// HTTP/3 endpoint
+func newAltSvcServer(t *testing.T, handler http.Handler, altPort func() int) *httptest.Server {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Alt-Svc", fmt.Sprintf(`h3=":%d"; ma=60`, altPort()))
+		handler.ServeHTTP(w, r)
+	}))
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	trustServer(t, server)
+	return server
+}
+
+func TestHTTP3_DownloadOverAltSvc(t *testing.T) {
+	data := randomBytes(t, 4*MB)
+	var h3Requests atomic.Int32
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor == 3 {
+			h3Requests.Add(1)
+		}
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(data))
+	})
+
+	udp, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("UDP unavailable: %v", err)
+	}
+	server := newAltSvcServer(t, handler, func() int { return udp.LocalAddr().(*net.UDPAddr).Port })
+	h3Server := &http3.Server{
+		Handler:   handler,
+		TLSConfig: http3.ConfigureTLSConfig(&tls.Config{Certificates: server.TLS.Certificates}),
+	}
+	go h3Server.Serve(udp)
+	defer h3Server.Close()
+
+	outDir := t.TempDir()
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	err = TUIDownload(ctx, DownloadConfig{
+		URL:        server.URL + "/h3.bin",
+		OutputPath: outDir,
+		ID:         "h3",
+		Filename:   "h3.bin",
+		Runtime:    &RuntimeConfig{HTTP3: HTTP3Auto, HTTP3Connections: 2, MinChunkSize: 512 * KB},
+	})
+	if err != nil {
+		t.Fatalf("download failed: %v", err)
+	}
+	if got, err := os.ReadFile(filepath.Join(outDir, "h3.bin")); err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("content mismatch (err %v)", err)
+	}
+	if h3Requests.Load() == 0 {
+		t.Error("no range request was sent over HTTP/3")
+	}
+}
+
+func TestHTTP3_FallsBackToTCP(t *testing.T) {
+	data := randomBytes(t, 256*KB)
+
+	// A QUIC endpoint that fails every HTTP/3 handshake
+	var broken *quic.Listener
+	server := newAltSvcServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(data))
+	}), func() int { return broken.Addr().(*net.UDPAddr).Port })
+	broken, err := quic.ListenAddr("127.0.0.1:0", &tls.Config{
+		Certificates: server.TLS.Certificates,
+		NextProtos:   []string{"not-h3"},
+	}, nil)
+	if err != nil {
+		t.Skipf("UDP unavailable: %v", err)
+	}
+	defer broken.Close()
+
+	client := newDownloadClient(&RuntimeConfig{HTTP3: HTTP3Auto})
+	for i := 0; i < 2; i++ {
+		resp, err := client.Get(server.URL + "/file.bin")
+		if err != nil {
+			t.Fatalf("request %d failed: %v", i, err)
+		}
+		resp.Body.Close()
+		if resp.ProtoMajor == 3 {
+			t.Fatalf("request %d went over HTTP/3", i)
+		}
+	}
+
+	u, _ := url.Parse(server.URL)
+	if _, ok := (pooledTransport{http3: HTTP3Auto}).http3Endpoint(u, time.Now()); ok {
+		t.Error("host should be kept on TCP after the failed handshake")
+	}
+}
@@ -5,11 +5,14 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"os"
+	"path"
 	"path/filepath"
 	"strconv"
 	"strings"
 
+	"github.com/junaid2005p/surge/internal/config"
 	"github.com/junaid2005p/surge/internal/messages"
 	"github.com/junaid2005p/surge/internal/utils"
 	"time"
@@ -17,7 +20,14 @@ import (
 	tea "github.com/charmbracelet/bubbletea"
 )
 
-var probeClient = &http.Client{Timeout: ProbeTimeout}
+// probeClient returns a client for probes and other small requests
+// (manifests, listings, tokens). It connects like the downloads of runtime,
+// sharing their pooled connections.
+func probeClient(runtime *RuntimeConfig) *http.Client {
+	client := newDownloadClient(runtime)
+	client.Timeout = ProbeTimeout
+	return client
+}
 
 var ua = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) " +
 	"AppleWebKit/537.36 (KHTML, like Gecko) " +
@@ -29,13 +39,87 @@ type ProbeResult struct {
 	SupportsRange bool
 	Filename      string
 	ContentType   string
+	ETag          string
+	IsCollection  bool // WebDAV collection, S3 prefix or directory listing: expands into one download per file
+	ProtoMajor    int  // HTTP version the server answered with (1, 2 or 3), 0 if not HTTP
+
+	first *primedRange // Open probe response, see probeForDownload
+}
+
+// primedRange is the still open body of a probe response, holding the first
+// length bytes of the file (the whole file if length < 0)
+type primedRange struct {
+	length int64
+	body   io.ReadCloser
+	cancel context.CancelFunc // Cancels the probe request
+}
+
+// close discards the response
+func (p *primedRange) close() {
+	p.body.Close()
+	p.cancel()
+}
+
+// open returns the body for a reader running under ctx: cancelling ctx aborts
+// the probe request, and closing the body releases it
+func (p *primedRange) open(ctx context.Context) io.ReadCloser {
+	return &primedBody{primedRange: p, stop: context.AfterFunc(ctx, p.cancel)}
+}
+
+type primedBody struct {
+	*primedRange
+	stop func() bool
+}
+
+func (b *primedBody) Read(buf []byte) (int, error) { return b.body.Read(buf) }
+
+func (b *primedBody) Close() error {
+	b.stop()
+	b.close()
+	return nil
+}
+
+// takeFirst hands the open probe response over to the caller, or returns nil
+// if there is none
+func (p *ProbeResult) takeFirst() *primedRange {
+	first := p.first
+	p.first = nil
+	return first
+}
+
+// discardFirst closes the open probe response, if any
+func (p *ProbeResult) discardFirst() {
+	if p == nil || p.first == nil {
+		return
+	}
+	p.takeFirst().close()
 }
 
 // probeServer sends GET with Range: bytes=0-0 to determine server capabilities
-func probeServer(ctx context.Context, rawurl string, filenameHint string) (*ProbeResult, error) {
+func probeServer(ctx context.Context, rawurl string, filenameHint string, runtime *RuntimeConfig) (*ProbeResult, error) {
+	return probeServerWithHeaders(ctx, rawurl, filenameHint, nil, runtime)
+}
+
+// probeServerWithHeaders is probeServer with extra request headers
+func probeServerWithHeaders(ctx context.Context, rawurl string, filenameHint string, headers http.Header, runtime *RuntimeConfig) (*ProbeResult, error) {
+	return probeHTTP(ctx, probeClient(runtime), rawurl, filenameHint, headers, 1, false)
+}
+
+// probeForDownload probes a URL that is about to be downloaded with client.
+// It asks for the first firstBytes bytes instead of one and keeps the response
+// open in result.first, so the first chunk (or a small file as a whole) needs
+// no request of its own.
+func probeForDownload(ctx context.Context, client *http.Client, rawurl string, filenameHint string, headers http.Header, firstBytes int64) (*ProbeResult, error) {
+	return probeHTTP(ctx, client, rawurl, filenameHint, headers, firstBytes, true)
+}
+
+// probeHTTP requests the first firstBytes bytes of rawurl to determine server
+// capabilities. The response is drained unless keep is set.
+func probeHTTP(ctx context.Context, client *http.Client, rawurl string, filenameHint string, headers http.Header, firstBytes int64, keep bool) (*ProbeResult, error) {
 	utils.Debug("Probing server: %s", rawurl)
 
 	var resp *http.Response
+	var cancel context.CancelFunc
 	var err error
 
 	// Retry logic for probe request
@@ -45,36 +129,47 @@ func probeServer(ctx context.Context, rawurl string, filenameHint string) (*Prob
 			utils.Debug("Retrying probe... attempt %d", i+1)
 		}
 
-		probeCtx, cancel := context.WithTimeout(ctx, ProbeTimeout)
-		defer cancel()
+		// The timeout covers the response headers only, the body may be kept
+		var probeCtx context.Context
+		probeCtx, cancel = context.WithCancel(ctx)
+		timer := time.AfterFunc(ProbeTimeout, cancel)
 
 		req, reqErr := http.NewRequestWithContext(probeCtx, http.MethodGet, rawurl, nil)
 		if reqErr != nil {
+			timer.Stop()
+			cancel()
 			err = fmt.Errorf("failed to create probe request: %w", reqErr)
 			break // Fatal error, don't retry
 		}
 
-		req.Header.Set("Range", "bytes=0-0")
+		req.Header.Set("Range", fmt.Sprintf("bytes=0-%d", firstBytes-1))
 		req.Header.Set("User-Agent", ua)
+		applyHeaders(req, headers)
 
-		resp, err = probeClient.Do(req)
+		resp, err = client.Do(req)
+		timer.Stop()
 		if err == nil {
 			break // Success
 		}
+		cancel()
 	}
 
 	if err != nil {
 		return nil, fmt.Errorf("probe request failed after retries: %w", err)
 	}
 
+	kept := false
 	defer func() {
-		io.Copy(io.Discard, resp.Body) // Drain any remaining data
-		resp.Body.Close()
+		if !kept {
+			io.Copy(io.Discard, resp.Body) // Drain any remaining data
+			resp.Body.Close()
+			cancel()
+		}
 	}()
 
 	utils.Debug("Probe response status: %d", resp.StatusCode)
 
-	result := &ProbeResult{}
+	result := &ProbeResult{ProtoMajor: resp.ProtoMajor}
 
 	// Determine range support and file size based on status code
 	switch resp.StatusCode {
@@ -102,12 +197,17 @@ func probeServer(ctx context.Context, rawurl string, filenameHint string) (*Prob
 		}
 		utils.Debug("Range NOT supported (got 200), file size: %d", result.FileSize)
 
+	case http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusGone:
+		// Not worth retrying as is; see ErrLinkRejected
+		return nil, fmt.Errorf("%w (%d)", ErrLinkRejected, resp.StatusCode)
+
 	default:
 		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
 	}
 
 	// Determine filename using strengthened logic
-	name, _, err := utils.DetermineFilename(rawurl, resp, false)
+	// (it reads ahead into the body, the returned reader puts those bytes back)
+	name, body, err := utils.DetermineFilename(rawurl, resp, false)
 	if err != nil {
 		utils.Debug("Error determining filename: %v", err)
 		name = "download.bin"
@@ -120,6 +220,21 @@ func probeServer(ctx context.Context, rawurl string, filenameHint string) (*Prob
 	}
 
 	result.ContentType = resp.Header.Get("Content-Type")
+	result.ETag = resp.Header.Get("ETag")
+
+	if keep && body != nil {
+		length := int64(-1) // A 200 response holds the whole file
+		if result.SupportsRange {
+			length = probedLength(resp.Header.Get("Content-Range"))
+		}
+		if length != 0 {
+			result.first = &primedRange{length: length, body: struct {
+				io.Reader
+				io.Closer
+			}{body, resp.Body}, cancel: cancel}
+			kept = true
+		}
+	}
 
 	utils.Debug("Probe complete - filename: %s, size: %d, range: %v",
 		result.Filename, result.FileSize, result.SupportsRange)
@@ -127,6 +242,21 @@ func probeServer(ctx context.Context, rawurl string, filenameHint string) (*Prob
 	return result, nil
 }
 
+// probedLength returns how many bytes from the start of the file a 206
+// response to the probe holds, or 0 if it does not start at the beginning
+func probedLength(contentRange string) int64 {
+	spec, ok := strings.CutPrefix(contentRange, "bytes 0-")
+	if !ok {
+		return 0
+	}
+	end, _, _ := strings.Cut(spec, "/")
+	n, err := strconv.ParseInt(end, 10, 64)
+	if err != nil {
+		return 0
+	}
+	return n + 1
+}
+
 // uniqueFilePath returns a unique file path by appending (1), (2), etc. if the file exists
 func uniqueFilePath(path string) string {
 	// Check if file exists (both final and incomplete)
@@ -170,15 +300,182 @@ func uniqueFilePath(path string) string {
 	return path
 }
 
+// maxDiscoveredFiles caps how many files a single folder, collection or prefix may expand into
+const maxDiscoveredFiles = 10000
+
+// queueDiscoveredFiles hands the files a download expanded into back to the
+// caller (via ProgressCh), which queues each one as its own download
+func queueDiscoveredFiles(cfg DownloadConfig, files []messages.DiscoveredFile) error {
+	if cfg.ProgressCh == nil {
+		return fmt.Errorf("cannot expand %s: no download queue", cfg.URL)
+	}
+	utils.Debug("%s expanded into %d files", cfg.URL, len(files))
+
+	cfg.ProgressCh <- messages.DownloadsDiscoveredMsg{
+		DownloadID: cfg.ID,
+		Source:     cfg.URL,
+		Files:      files,
+	}
+	return nil
+}
+
+// mirrorDiscoveredFiles maps file paths below the directory of rootURL to
+// downloads that recreate the remote layout under outputPath/<directory name>/.
+// File URLs keep the scheme, host and credentials of rootURL.
+func mirrorDiscoveredFiles(rootURL, outputPath string, filePaths []string) ([]messages.DiscoveredFile, error) {
+	u, err := url.Parse(rootURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid url: %w", err)
+	}
+	rootPath := collectionPath(u.Path)
+
+	rootName := path.Base(strings.TrimSuffix(rootPath, "/"))
+	if rootName == "" || rootName == "/" || rootName == "." {
+		rootName = u.Hostname()
+	}
+	localRoot := filepath.Join(outputPath, rootName)
+
+	discovered := make([]messages.DiscoveredFile, 0, len(filePaths))
+	for _, p := range filePaths {
+		rel := strings.TrimPrefix(p, rootPath)
+		if rel == "" || rel == p {
+			continue
+		}
+
+		fileURL := *u
+		fileURL.Path, fileURL.RawPath, fileURL.RawQuery, fileURL.Fragment = p, "", "", ""
+
+		discovered = append(discovered, messages.DiscoveredFile{
+			URL:        fileURL.String(),
+			OutputPath: filepath.Join(localRoot, filepath.FromSlash(path.Dir(rel))),
+		})
+	}
+	return discovered, nil
+}
+
 // TUIDownload is the main entry point for TUI downloads
 func TUIDownload(ctx context.Context, cfg DownloadConfig) error {
 
-	// Probe server once to get all metadata
-	probe, err := probeServer(ctx, cfg.URL, cfg.Filename)
+	// Torrents resolve their own metadata (from peers or the .torrent file)
+	if IsTorrentSource(cfg.URL) {
+		utils.Debug("Using torrent downloader")
+		return downloadTorrent(ctx, cfg)
+	}
+
+	// Landing pages handled by a resolver plugin are fetched from the direct
+	// URL it returns, while progress and resume state stay keyed by cfg.URL
+	fetchURL := cfg.URL
+	var fetchHeaders http.Header
+	filenameHint := cfg.Filename
+	resolved, err := resolveSource(ctx, cfg.URL)
+	if err != nil {
+		return err
+	}
+	if len(resolved) > 1 {
+		utils.Debug("Resolver returned %d files", len(resolved))
+		return queueResolvedFiles(cfg, resolved)
+	}
+	if len(resolved) == 1 {
+		fetchURL, fetchHeaders = resolved[0].URL, resolved[0].header()
+		if filenameHint == "" {
+			filenameHint = resolved[0].Filename
+		}
+		utils.Debug("Resolved %s to %s", cfg.URL, fetchURL)
+	}
+
+	// Probe server once to get all metadata. Plain HTTP downloads are probed
+	// with the client they will use, and a fresh one keeps the probe response
+	// as its first chunk
+	var probe *ProbeResult
+	var oci *ociImage
+	var client *http.Client
+	probeURL := func(rawurl, hint string, headers http.Header) (*ProbeResult, error) {
+		if cfg.IsResume {
+			// Resumed tasks don't start at the probe's range, so the response
+			// would only hold a connection
+			return probeHTTP(ctx, client, rawurl, hint, headers, 1, false)
+		}
+		return probeForDownload(ctx, client, rawurl, hint, headers, cfg.Runtime.GetMinChunkSize())
+	}
+	switch {
+	case isSFTPURL(cfg.URL):
+		probe, err = probeSFTP(ctx, cfg.URL, cfg.Filename, cfg.Runtime)
+	case isWebDAVURL(cfg.URL):
+		probe, err = probeWebDAV(ctx, cfg.URL, cfg.Filename, cfg.Runtime)
+	case isS3URL(cfg.URL):
+		probe, err = probeS3(ctx, cfg.URL, cfg.Filename, cfg.Runtime)
+	case isOCIURL(cfg.URL):
+		// Registry images resolve to a set of blobs saved as an OCI image layout directory
+		if oci, err = prepareOCI(ctx, cfg.URL, cfg.Runtime); err == nil {
+			probe = &ProbeResult{Filename: oci.outputName(), FileSize: oci.TotalSize}
+		}
+	case resolved != nil:
+		client = newDownloadClient(cfg.Runtime)
+		probe, err = probeURL(fetchURL, filenameHint, fetchHeaders)
+	default:
+		client = newDownloadClient(cfg.Runtime)
+		probe, err = probeURL(cfg.URL, cfg.Filename, nil)
+		switch {
+		case err == nil && cfg.Crawl != nil && strings.HasPrefix(probe.ContentType, "text/html"):
+			// Directory listing to crawl
+			probe.IsCollection = true
+		case err != nil || strings.HasPrefix(probe.ContentType, "text/html"):
+			// WebDAV collections usually refuse GET or answer with an HTML index
+			if isWebDAVCollection(ctx, cfg.URL, cfg.Runtime) {
+				probe.discardFirst()
+				probe, err = &ProbeResult{IsCollection: true}, nil
+			}
+		}
+	}
 	if err != nil {
 		utils.Debug("Probe failed: %v", err)
 		return err
 	}
+	defer probe.discardFirst() // Unless a downloader took it
+
+	if probe.IsCollection {
+		switch {
+		case isS3URL(cfg.URL):
+			utils.Debug("Expanding S3 prefix")
+			return queueS3Prefix(ctx, cfg)
+		case cfg.Crawl != nil && !isWebDAVURL(cfg.URL):
+			utils.Debug("Crawling directory listing")
+			return queueHTTPCrawl(ctx, cfg)
+		}
+		utils.Debug("Expanding WebDAV collection")
+		return queueWebDAVCollection(ctx, cfg)
+	}
+
+	// .torrent served from a URL without the extension (e.g. download.php?id=1)
+	if probe.ContentType == TorrentContentType {
+		utils.Debug("Using torrent downloader (content type %s)", probe.ContentType)
+		return downloadTorrent(ctx, cfg)
+	}
+
+	// HLS playlists and DASH manifests expand into segment lists; the output is named after the stream
+	var hls *hlsStream
+	var dash *dashStream
+	switch {
+	case isSFTPURL(cfg.URL), isWebDAVURL(cfg.URL), isS3URL(cfg.URL), isOCIURL(cfg.URL):
+	case isHLSSource(fetchURL, probe.ContentType):
+		utils.Debug("Detected HLS playlist (content type %s)", probe.ContentType)
+		if hls, err = prepareHLS(ctx, fetchURL, fetchHeaders, cfg.Runtime); err != nil {
+			return err
+		}
+		if cfg.Filename == "" {
+			probe.Filename = hls.outputName(probe.Filename, fetchURL)
+		}
+		probe.FileSize = hls.EstimatedSize
+	case isDASHSource(fetchURL, probe.ContentType):
+		utils.Debug("Detected DASH manifest (content type %s)", probe.ContentType)
+		if dash, err = prepareDASH(ctx, fetchURL, fetchHeaders, cfg.Runtime); err != nil {
+			return err
+		}
+		if cfg.Filename == "" {
+			probe.Filename = dash.outputName(probe.Filename, fetchURL)
+		}
+		probe.FileSize = dash.EstimatedSize
+	}
 
 	// Start download timer (exclude probing time)
 	start := time.Now()
@@ -211,7 +508,8 @@ func TUIDownload(ctx context.Context, cfg DownloadConfig) error {
 		// Resume: use the provided destination path for state lookup
 		savedState, _ = LoadState(cfg.URL, cfg.DestPath)
 	}
-	isResume := cfg.IsResume && savedState != nil && len(savedState.Tasks) > 0 && savedState.DestPath != ""
+	isResume := cfg.IsResume && savedState != nil && savedState.DestPath != "" &&
+		(len(savedState.Tasks) > 0 || len(savedState.Streams) > 0)
 
 	if isResume {
 		// Resume: use saved destination path directly (don't generate new unique name)
@@ -224,6 +522,11 @@ func TUIDownload(ctx context.Context, cfg DownloadConfig) error {
 	finalFilename := filepath.Base(destPath)
 	utils.Debug("Destination path: %s", destPath)
 
+	// Fail now rather than when the disk fills up partway through
+	if err := checkDiskSpace(destPath, probe.FileSize, cfg.Runtime.GetMinFreeSpace()); err != nil {
+		return err
+	}
+
 	// Send download started message
 	if cfg.ProgressCh != nil {
 		cfg.ProgressCh <- messages.DownloadStartedMsg{
@@ -238,19 +541,77 @@ func TUIDownload(ctx context.Context, cfg DownloadConfig) error {
 	// Update shared state
 	if cfg.State != nil {
 		cfg.State.SetTotalSize(probe.FileSize)
+		cfg.State.SetDestPath(destPath)
+	}
+
+	// Choose downloader based on URL scheme and probe results
+	if isSFTPURL(cfg.URL) {
+		utils.Debug("Using SFTP downloader")
+		return downloadSFTP(ctx, cfg, destPath, probe.FileSize)
+	}
+
+	if isS3URL(cfg.URL) {
+		utils.Debug("Using S3 downloader")
+		return downloadS3(ctx, cfg, destPath, probe.FileSize)
+	}
+
+	if isWebDAVURL(cfg.URL) {
+		utils.Debug("Using WebDAV downloader")
+		return downloadWebDAV(ctx, cfg, destPath, probe)
+	}
+
+	if oci != nil {
+		utils.Debug("Using OCI blob downloader")
+		return downloadOCI(ctx, cfg, destPath, oci)
+	}
+
+	if hls != nil {
+		utils.Debug("Using HLS segment downloader")
+		return downloadHLS(ctx, cfg, destPath, hls)
+	}
+
+	if dash != nil {
+		utils.Debug("Using DASH segment downloader")
+		return downloadDASH(ctx, cfg, destPath, dash)
 	}
 
-	// Choose downloader based on probe results
 	if probe.SupportsRange && probe.FileSize > 0 {
 		utils.Debug("Using concurrent downloader")
 		d := NewConcurrentDownloader(cfg.ID, cfg.ProgressCh, cfg.State, cfg.Runtime)
+		if fetchURL != cfg.URL {
+			d.FetchURL = fetchURL
+		}
+		d.Headers = fetchHeaders
+		d.ETag = probe.ETag
+		d.HTTP2 = probe.ProtoMajor == 2
+		d.Client = client
+		d.primed.Store(probe.takeFirst())
 		return d.Download(ctx, cfg.URL, destPath, probe.FileSize, cfg.Verbose)
 	}
 
 	// Fallback to single-threaded downloader
 	utils.Debug("Using single-threaded downloader")
 	d := NewSingleDownloader(cfg.ID, cfg.ProgressCh, cfg.State, cfg.Runtime)
-	return d.Download(ctx, cfg.URL, destPath, probe.FileSize, probe.Filename, cfg.Verbose)
+	d.Headers = fetchHeaders
+	if client != nil {
+		d.Client = client
+	}
+	if !probe.SupportsRange {
+		d.primed = probe.takeFirst()
+	}
+	if err := d.Download(ctx, fetchURL, destPath, probe.FileSize, probe.Filename, cfg.Verbose); err != nil {
+		return err
+	}
+	// Remember that this host serves whole files only. A ranged download of
+	// unknown size teaches nothing.
+	paused := cfg.State != nil && cfg.State.IsPaused()
+	if !probe.SupportsRange && probe.FileSize >= minProfileSize && ctx.Err() == nil && !paused {
+		recordProfile(fetchURL, config.HostProfile{
+			Connections: 1,
+			Throughput:  float64(probe.FileSize) / time.Since(start).Seconds(),
+		})
+	}
+	return nil
 }
 
 // Download is the CLI entry point (non-TUI) - convenience wrapper
@@ -1,9 +1,19 @@
 package downloader
 
 import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
+	"time"
+
+	"github.com/junaid2005p/surge/internal/config"
 )
 
 func TestUniqueFilePath(t *testing.T) {
@@ -86,3 +96,164 @@ func TestUniqueFilePath(t *testing.T) {
 		})
 	}
 }
+
+func TestProbedLength(t *testing.T) {
+	tests := map[string]int64{
+		"bytes 0-2097151/10485760": 2 * MB,
+		"bytes 0-99/100":           100,
+		"bytes 0-0/*":              1,
+		"bytes 10-99/100":          0,
+		"":                         0,
+	}
+	for header, want := range tests {
+		if got := probedLength(header); got != want {
+			t.Errorf("probedLength(%q) = %d, want %d", header, got, want)
+		}
+	}
+}
+
+func TestPrimeTasks(t *testing.T) {
+	tasks := createTasks(20*MB, 8*MB)
+	primed := primeTasks(tasks, &primedRange{length: 2 * MB})
+	want := []Task{{0, 2 * MB}, {2 * MB, 6 * MB}, {8 * MB, 8 * MB}, {16 * MB, 4 * MB}}
+	if len(primed) != len(want) {
+		t.Fatalf("primeTasks = %v, want %v", primed, want)
+	}
+	for i := range want {
+		if primed[i] != want[i] {
+			t.Errorf("task %d = %v, want %v", i, primed[i], want[i])
+		}
+	}
+
+	// A first task the probe response covers is left alone
+	if got := primeTasks(createTasks(1*MB, 2*MB), &primedRange{length: 1 * MB}); len(got) != 1 {
+		t.Errorf("small file tasks = %v", got)
+	}
+}
+
+func TestTUIDownload_ReusesProbeResponse(t *testing.T) {
+	tests := []struct {
+		name      string
+		size      int
+		noRange   bool
+		wantFirst int // Requests for the start of the file, the probe included
+	}{
+		{"small file", 512 * KB, false, 1},
+		{"large file", 6 * MB, false, 1},
+		{"no range support", 1 * MB, true, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := randomBytes(t, tt.size)
+			var mu sync.Mutex
+			var ranges []string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				ranges = append(ranges, r.Header.Get("Range"))
+				mu.Unlock()
+				if tt.noRange {
+					w.Write(data)
+					return
+				}
+				http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(data))
+			}))
+			defer server.Close()
+
+			outDir := t.TempDir()
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+			err := TUIDownload(ctx, DownloadConfig{
+				URL:        server.URL + "/file.bin",
+				OutputPath: outDir,
+				ID:         "probe-reuse",
+				Filename:   "file.bin",
+				Runtime:    &RuntimeConfig{},
+			})
+			if err != nil {
+				t.Fatalf("TUIDownload failed: %v", err)
+			}
+
+			got, err := os.ReadFile(filepath.Join(outDir, "file.bin"))
+			if err != nil || !bytes.Equal(got, data) {
+				t.Fatalf("content mismatch (err %v)", err)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			first := 0
+			for _, r := range ranges {
+				if r == "" || strings.HasPrefix(r, "bytes=0-") {
+					first++
+				}
+			}
+			if first != tt.wantFirst {
+				t.Errorf("requests for the start of the file = %d (%v), want %d", first, ranges, tt.wantFirst)
+			}
+		})
+	}
+}
+
+func TestTUIDownload_ResumeReleasesProbeConnection(t *testing.T) {
+	if err := config.EnsureDirs(); err != nil {
+		t.Fatalf("Failed to create config dirs: %v", err)
+	}
+	size := int64(4 * MB)
+	data := randomBytes(t, int(size))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Range") == "bytes=0-0" {
+			// Some servers answer a short range with more than was asked for
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes 0-%d/%d", size-1, size))
+			w.WriteHeader(http.StatusPartialContent)
+			w.Write(data)
+			return
+		}
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(data))
+	}))
+	defer server.Close()
+
+	outDir := t.TempDir()
+	destPath := filepath.Join(outDir, "resume.bin")
+	rawurl := server.URL + "/resume.bin"
+
+	// First half downloaded, second half remaining
+	half := size / 2
+	partial := make([]byte, size)
+	copy(partial, data[:half])
+	if err := os.WriteFile(destPath+IncompleteSuffix, partial, 0644); err != nil {
+		t.Fatal(err)
+	}
+	saved := &DownloadState{
+		ID:         "probe-resume",
+		URL:        rawurl,
+		DestPath:   destPath,
+		TotalSize:  size,
+		Downloaded: half,
+		Tasks:      []Task{{Offset: half, Length: size - half}},
+		Filename:   "resume.bin",
+	}
+	if err := SaveState(rawurl, destPath, saved); err != nil {
+		t.Fatal(err)
+	}
+	defer DeleteState("probe-resume", rawurl, destPath)
+
+	// With one connection allowed, a probe response left open would block
+	// every worker
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+	err := TUIDownload(ctx, DownloadConfig{
+		URL:        rawurl,
+		OutputPath: outDir,
+		DestPath:   destPath,
+		ID:         "probe-resume",
+		Filename:   "resume.bin",
+		IsResume:   true,
+		State:      NewProgressState("probe-resume", size),
+		Runtime:    &RuntimeConfig{MaxConnectionsPerHost: 1},
+	})
+	if err != nil {
+		t.Fatalf("resume failed: %v", err)
+	}
+	if got, err := os.ReadFile(destPath); err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("content mismatch (err %v)", err)
+	}
+}
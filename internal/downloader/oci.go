@@ -0,0 +1,562 @@
+package downloader
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/junaid2005p/surge/internal/config"
+	"github.com/junaid2005p/surge/internal/utils"
+)
+
+// OCIScheme is the URL scheme for registry images and artifacts (oci://registry/repo:tag)
+const OCIScheme = "oci"
+
+// OCI and Docker manifest media types
+const (
+	ociIndexMediaType    = "application/vnd.oci.image.index.v1+json"
+	ociManifestMediaType = "application/vnd.oci.image.manifest.v1+json"
+	dockerListMediaType  = "application/vnd.docker.distribution.manifest.list.v2+json"
+	dockerV2MediaType    = "application/vnd.docker.distribution.manifest.v2+json"
+)
+
+// ociRefNameAnnotation records the tag of a manifest in index.json
+const ociRefNameAnnotation = "org.opencontainers.image.ref.name"
+
+// Docker Hub is addressed as docker.io but served from registry-1.docker.io
+const (
+	dockerHubHost     = "docker.io"
+	dockerHubRegistry = "registry-1.docker.io"
+)
+
+// defaultTokenLifetime applies when a token response has no expires_in (per the distribution spec)
+const defaultTokenLifetime = 60 * time.Second
+
+// isOCIURL reports whether rawurl uses the oci:// scheme
+func isOCIURL(rawurl string) bool {
+	u, err := url.Parse(rawurl)
+	return err == nil && strings.EqualFold(u.Scheme, OCIScheme)
+}
+
+// ociReference is a parsed oci://registry/repo[:tag][@digest]
+type ociReference struct {
+	Host   string // Registry host as written (docker.io, ghcr.io, localhost:5000)
+	Repo   string
+	Tag    string
+	Digest string // sha256:... when pinned
+}
+
+// parseOCIReference parses an oci:// URL. The tag defaults to "latest"; Docker
+// Hub names without a namespace get "library/".
+func parseOCIReference(rawurl string) (ociReference, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return ociReference{}, fmt.Errorf("invalid oci reference: %w", err)
+	}
+	ref := ociReference{Host: u.Host}
+	name := strings.Trim(u.Path, "/")
+	if ref.Host == "" || name == "" {
+		return ociReference{}, fmt.Errorf("oci reference must be oci://registry/repository[:tag]: %s", rawurl)
+	}
+
+	if i := strings.Index(name, "@"); i != -1 {
+		ref.Digest = name[i+1:]
+		name = name[:i]
+		if !strings.HasPrefix(ref.Digest, "sha256:") {
+			return ociReference{}, fmt.Errorf("unsupported digest %q (only sha256 is supported)", ref.Digest)
+		}
+	}
+	if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		ref.Tag = name[i+1:]
+		name = name[:i]
+	}
+	if ref.Tag == "" && ref.Digest == "" {
+		ref.Tag = "latest"
+	}
+	if strings.EqualFold(ref.Host, dockerHubHost) && !strings.Contains(name, "/") {
+		name = "library/" + name
+	}
+	ref.Repo = name
+	return ref, nil
+}
+
+// reference returns the tag or digest to request the manifest by
+func (r ociReference) reference() string {
+	if r.Digest != "" {
+		return r.Digest
+	}
+	return r.Tag
+}
+
+// registryURL returns the base URL of the registry API. Loopback registries
+// are spoken to over plain HTTP, like the docker CLI does.
+func (r ociReference) registryURL() *url.URL {
+	host := r.Host
+	if strings.EqualFold(host, dockerHubHost) {
+		host = dockerHubRegistry
+	}
+	scheme := "https"
+	hostname := host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		hostname = h
+	}
+	if hostname == "localhost" || net.ParseIP(hostname).IsLoopback() {
+		scheme = "http"
+	}
+	return &url.URL{Scheme: scheme, Host: host}
+}
+
+// ociDescriptor points at a blob or manifest
+type ociDescriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	Platform    *ociPlatform      `json:"platform,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+type ociPlatform struct {
+	OS           string `json:"os"`
+	Architecture string `json:"architecture"`
+	Variant      string `json:"variant,omitempty"`
+}
+
+func (p *ociPlatform) String() string {
+	s := p.OS + "/" + p.Architecture
+	if p.Variant != "" {
+		s += "/" + p.Variant
+	}
+	return s
+}
+
+// ociManifest covers image manifests and indexes (OCI and Docker v2)
+type ociManifest struct {
+	SchemaVersion int             `json:"schemaVersion"`
+	MediaType     string          `json:"mediaType,omitempty"`
+	Config        *ociDescriptor  `json:"config,omitempty"`
+	Layers        []ociDescriptor `json:"layers,omitempty"`
+	Manifests     []ociDescriptor `json:"manifests,omitempty"`
+}
+
+// ociRegistry talks to one repository, handling basic and bearer token auth
+type ociRegistry struct {
+	ref       ociReference
+	base      *url.URL
+	client    *http.Client
+	userAgent string
+	cred      *config.Credential
+
+	mu        sync.Mutex
+	realm     string // Token endpoint from the Bearer challenge, empty for basic auth
+	service   string
+	scope     string
+	token     string
+	expiry    time.Time
+	basicAuth bool
+}
+
+func newOCIRegistry(ref ociReference, runtime *RuntimeConfig, client *http.Client) *ociRegistry {
+	base := ref.registryURL()
+	return &ociRegistry{
+		ref:       ref,
+		base:      base,
+		client:    client,
+		userAgent: runtime.GetUserAgent(),
+		cred:      config.LookupCredential(base.Host, ref.Host),
+	}
+}
+
+// endpoint returns the API URL for kind ("manifests" or "blobs") and reference
+func (r *ociRegistry) endpoint(kind, reference string) string {
+	u := *r.base
+	u.Path = "/v2/" + r.ref.Repo + "/" + kind + "/" + reference
+	return u.String()
+}
+
+// authorize adds the current credentials to req, refreshing an expired token
+func (r *ociRegistry) authorize(req *http.Request) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.realm != "" {
+		if r.token == "" || time.Now().After(r.expiry) {
+			if err := r.fetchToken(req.Context()); err != nil {
+				return err
+			}
+		}
+		req.Header.Set("Authorization", "Bearer "+r.token)
+	} else if r.basicAuth && r.cred != nil {
+		req.SetBasicAuth(r.cred.Username, r.cred.Password)
+	}
+	return nil
+}
+
+// challenge records the auth scheme a 401 response asks for
+func (r *ociRegistry) challenge(resp *http.Response) error {
+	header := resp.Header.Get("WWW-Authenticate")
+	scheme, params, _ := strings.Cut(header, " ")
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	switch strings.ToLower(scheme) {
+	case "bearer":
+		// Same key="value" list syntax as HLS attributes
+		attrs := parseHLSAttributes(params)
+		if attrs["REALM"] == "" {
+			return fmt.Errorf("registry sent a bearer challenge without a realm")
+		}
+		r.realm, r.service, r.scope = attrs["REALM"], attrs["SERVICE"], attrs["SCOPE"]
+		if r.scope == "" {
+			r.scope = "repository:" + r.ref.Repo + ":pull"
+		}
+		r.token = ""
+	case "basic":
+		if r.cred == nil {
+			return fmt.Errorf("registry %s requires credentials (surge credentials set %s)", r.ref.Host, r.base.Host)
+		}
+		r.basicAuth = true
+	default:
+		return fmt.Errorf("unsupported registry auth challenge %q", header)
+	}
+	return nil
+}
+
+// fetchToken runs the token flow against the challenge realm. Must hold r.mu.
+func (r *ociRegistry) fetchToken(ctx context.Context) error {
+	u, err := url.Parse(r.realm)
+	if err != nil {
+		return fmt.Errorf("invalid token realm %q: %w", r.realm, err)
+	}
+	q := u.Query()
+	if r.service != "" {
+		q.Set("service", r.service)
+	}
+	q.Set("scope", r.scope)
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", r.userAgent)
+	if r.cred != nil {
+		req.SetBasicAuth(r.cred.Username, r.cred.Password)
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("registry token request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("registry token request: unexpected status code: %d", resp.StatusCode)
+	}
+
+	var body struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(&limitedReader{r: resp.Body, n: 1 * MB}).Decode(&body); err != nil {
+		return fmt.Errorf("invalid registry token response: %w", err)
+	}
+	r.token = body.Token
+	if r.token == "" {
+		r.token = body.AccessToken
+	}
+	if r.token == "" {
+		return fmt.Errorf("registry token response has no token")
+	}
+
+	lifetime := defaultTokenLifetime
+	if body.ExpiresIn > 0 {
+		lifetime = time.Duration(body.ExpiresIn) * time.Second
+	}
+	// Refresh a little early so long blob downloads never send a stale token
+	r.expiry = time.Now().Add(lifetime * 9 / 10)
+	return nil
+}
+
+// get sends an authorized GET, answering one auth challenge if the registry sends one
+func (r *ociRegistry) get(ctx context.Context, rawurl string, accept []string) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawurl, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("User-Agent", r.userAgent)
+		for _, a := range accept {
+			req.Header.Add("Accept", a)
+		}
+		if err := r.authorize(req); err != nil {
+			return nil, err
+		}
+
+		resp, err := r.client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusUnauthorized || attempt > 0 {
+			return resp, nil
+		}
+		resp.Body.Close()
+		if err := r.challenge(resp); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// fetchManifest downloads a manifest by tag or digest and verifies its digest
+func (r *ociRegistry) fetchManifest(ctx context.Context, reference string) ([]byte, ociDescriptor, error) {
+	accept := []string{ociIndexMediaType, ociManifestMediaType, dockerListMediaType, dockerV2MediaType}
+	resp, err := r.get(ctx, r.endpoint("manifests", reference), accept)
+	if err != nil {
+		return nil, ociDescriptor{}, fmt.Errorf("failed to fetch manifest %s: %w", reference, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, ociDescriptor{}, fmt.Errorf("manifest %s:%s: unexpected status code: %d", r.ref.Repo, reference, resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(&limitedReader{r: resp.Body, n: 4 * MB})
+	if err != nil {
+		return nil, ociDescriptor{}, fmt.Errorf("failed to read manifest: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	mediaType, _, _ := strings.Cut(resp.Header.Get("Content-Type"), ";")
+	desc := ociDescriptor{
+		MediaType: strings.TrimSpace(mediaType),
+		Digest:    "sha256:" + hex.EncodeToString(sum[:]),
+		Size:      int64(len(data)),
+	}
+
+	// Digests given by us or the registry must match what was served
+	for _, want := range []string{reference, resp.Header.Get("Docker-Content-Digest")} {
+		if strings.HasPrefix(want, "sha256:") && !strings.EqualFold(want, desc.Digest) {
+			return nil, ociDescriptor{}, fmt.Errorf("manifest digest mismatch: got %s, want %s", desc.Digest, want)
+		}
+	}
+	return data, desc, nil
+}
+
+// ociImage is a resolved image manifest and the blobs it references
+type ociImage struct {
+	ref          ociReference
+	registry     *ociRegistry
+	manifest     []byte
+	manifestDesc ociDescriptor
+	Blobs        []ociDescriptor // Config first, then layers (deduplicated)
+	TotalSize    int64
+}
+
+// prepareOCI resolves the reference to a single image manifest, picking the
+// configured platform from image indexes
+func prepareOCI(ctx context.Context, rawurl string, runtime *RuntimeConfig) (*ociImage, error) {
+	ref, err := parseOCIReference(rawurl)
+	if err != nil {
+		return nil, err
+	}
+	registry := newOCIRegistry(ref, runtime, probeClient(runtime))
+
+	data, desc, err := registry.fetchManifest(ctx, ref.reference())
+	if err != nil {
+		return nil, err
+	}
+
+	var m ociManifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("invalid manifest: %w", err)
+	}
+	if m.MediaType == "" {
+		m.MediaType = desc.MediaType
+	}
+
+	if len(m.Manifests) > 0 || isOCIIndex(m.MediaType) {
+		chosen, err := selectOCIPlatform(m.Manifests, runtime.GetOCIPlatform())
+		if err != nil {
+			return nil, err
+		}
+		utils.Debug("OCI index: using %s manifest %s", platformName(chosen.Platform), chosen.Digest)
+		if data, desc, err = registry.fetchManifest(ctx, chosen.Digest); err != nil {
+			return nil, err
+		}
+		m = ociManifest{}
+		if err := json.Unmarshal(data, &m); err != nil {
+			return nil, fmt.Errorf("invalid manifest: %w", err)
+		}
+		desc.Platform = chosen.Platform
+	}
+
+	if m.SchemaVersion != 2 || m.Config == nil {
+		return nil, fmt.Errorf("unsupported manifest (schema version %d)", m.SchemaVersion)
+	}
+	if m.MediaType != "" {
+		desc.MediaType = m.MediaType
+	}
+	if desc.MediaType == "" || strings.HasPrefix(desc.MediaType, "text/plain") {
+		desc.MediaType = ociManifestMediaType
+	}
+
+	img := &ociImage{ref: ref, registry: registry, manifest: data, manifestDesc: desc}
+	seen := make(map[string]bool)
+	for _, blob := range append([]ociDescriptor{*m.Config}, m.Layers...) {
+		if !strings.HasPrefix(blob.Digest, "sha256:") {
+			return nil, fmt.Errorf("unsupported blob digest %q", blob.Digest)
+		}
+		if seen[blob.Digest] {
+			continue
+		}
+		seen[blob.Digest] = true
+		img.Blobs = append(img.Blobs, blob)
+		img.TotalSize += blob.Size
+	}
+	return img, nil
+}
+
+func isOCIIndex(mediaType string) bool {
+	return mediaType == ociIndexMediaType || mediaType == dockerListMediaType
+}
+
+func platformName(p *ociPlatform) string {
+	if p == nil {
+		return "unspecified"
+	}
+	return p.String()
+}
+
+// selectOCIPlatform picks the index entry for platform ("os/arch[/variant]").
+// Indexes without platform information (e.g. artifacts) use their first entry.
+func selectOCIPlatform(manifests []ociDescriptor, platform string) (ociDescriptor, error) {
+	if len(manifests) == 0 {
+		return ociDescriptor{}, fmt.Errorf("image index has no manifests")
+	}
+	parts := strings.Split(platform, "/")
+	if len(parts) < 2 {
+		return ociDescriptor{}, fmt.Errorf("invalid platform %q (want os/arch[/variant])", platform)
+	}
+
+	var available []string
+	for _, m := range manifests {
+		p := m.Platform
+		if p == nil {
+			continue
+		}
+		if p.OS == "unknown" { // Attestation manifests
+			continue
+		}
+		available = append(available, p.String())
+		if p.OS == parts[0] && p.Architecture == parts[1] &&
+			(len(parts) < 3 || p.Variant == parts[2]) {
+			return m, nil
+		}
+	}
+	if len(available) == 0 {
+		return manifests[0], nil
+	}
+	return ociDescriptor{}, fmt.Errorf("no manifest for platform %s (available: %s)", platform, strings.Join(available, ", "))
+}
+
+// outputName names the image layout directory after the repository and tag (or digest)
+func (img *ociImage) outputName() string {
+	name := path.Base(img.ref.Repo)
+	if img.ref.Digest != "" {
+		short := strings.TrimPrefix(img.ref.Digest, "sha256:")
+		return name + "-" + short[:min(12, len(short))]
+	}
+	return name + "-" + img.ref.Tag
+}
+
+// blobPath is where an OCI image layout stores the blob with digest
+func blobPath(layoutDir, digest string) string {
+	algo, hexDigest, _ := strings.Cut(digest, ":")
+	return filepath.Join(layoutDir, "blobs", algo, hexDigest)
+}
+
+// blobTracks splits every blob into ranged segments of the target chunk size
+func (img *ociImage) blobTracks(layoutDir string, chunkSize int64) []SegmentTrack {
+	tracks := make([]SegmentTrack, 0, len(img.Blobs))
+	for _, blob := range img.Blobs {
+		blobURL := img.registry.endpoint("blobs", blob.Digest)
+		tracks = append(tracks, SegmentTrack{
+			Source:   blob.Digest,
+			DestPath: blobPath(layoutDir, blob.Digest),
+			Segments: rangedSegments(blobURL, blob.Size, chunkSize),
+			SHA256:   strings.TrimPrefix(blob.Digest, "sha256:"),
+		})
+	}
+	return tracks
+}
+
+// downloadOCI fetches every blob of the image in parallel into an OCI image
+// layout at destPath, then writes the manifest, index.json and oci-layout
+func downloadOCI(ctx context.Context, cfg DownloadConfig, destPath string, img *ociImage) error {
+	if err := os.MkdirAll(filepath.Join(destPath, "blobs", "sha256"), 0755); err != nil {
+		return fmt.Errorf("failed to create image layout: %w", err)
+	}
+
+	d := NewSegmentDownloader(cfg.ID, cfg.ProgressCh, cfg.State, cfg.Runtime)
+	d.Authorize = img.registry.authorize
+	d.SizeKnown = true
+	tracks := img.blobTracks(destPath, cfg.Runtime.GetTargetChunkSize())
+	if err := d.Download(ctx, cfg.URL, destPath, tracks, img.TotalSize); err != nil {
+		return err
+	}
+	if cfg.State != nil && cfg.State.IsPaused() {
+		return nil
+	}
+	for _, t := range tracks {
+		if _, err := os.Stat(t.DestPath); err != nil {
+			return nil // Cancelled before completion
+		}
+	}
+
+	return img.writeLayout(destPath)
+}
+
+// writeLayout stores the manifest blob and the index.json / oci-layout files
+func (img *ociImage) writeLayout(layoutDir string) error {
+	if err := os.WriteFile(blobPath(layoutDir, img.manifestDesc.Digest), img.manifest, 0644); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+
+	desc := img.manifestDesc
+	if img.ref.Tag != "" {
+		desc.Annotations = map[string]string{ociRefNameAnnotation: img.ref.Tag}
+	}
+	index, err := json.MarshalIndent(ociManifest{
+		SchemaVersion: 2,
+		MediaType:     ociIndexMediaType,
+		Manifests:     []ociDescriptor{desc},
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(layoutDir, "index.json"), index, 0644); err != nil {
+		return fmt.Errorf("failed to write index.json: %w", err)
+	}
+
+	layout := []byte(`{"imageLayoutVersion":"1.0.0"}`)
+	if err := os.WriteFile(filepath.Join(layoutDir, "oci-layout"), layout, 0644); err != nil {
+		return fmt.Errorf("failed to write oci-layout: %w", err)
+	}
+	return nil
+}
+
+// defaultOCIPlatform is the platform picked from image indexes when none is configured
+func defaultOCIPlatform() string {
+	return "linux/" + runtime.GOARCH
+}
@@ -0,0 +1,347 @@
+package downloader
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/junaid2005p/surge/internal/config"
+	"github.com/junaid2005p/surge/internal/testutil"
+)
+
+func sha256Digest(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// testRegistry serves one repository behind the registry token flow. The tag
+// "v1" is a multi-platform index (linux/amd64, linux/arm64 and an attestation).
+type testRegistry struct {
+	*httptest.Server
+	repo      string
+	blobs     map[string][]byte // digest -> content
+	manifests map[string][]byte // digest or tag -> manifest
+	types     map[string]string // digest or tag -> media type
+	corrupt   string            // Digest served with wrong content
+	tokens    atomic.Int32      // Tokens issued
+	ranged    atomic.Int32      // Ranged blob requests served
+	layers    map[string][][]byte
+}
+
+func startTestRegistry(t *testing.T) *testRegistry {
+	t.Helper()
+	r := &testRegistry{
+		repo:      "models/llama",
+		blobs:     make(map[string][]byte),
+		manifests: make(map[string][]byte),
+		types:     make(map[string]string),
+		layers:    make(map[string][][]byte),
+	}
+
+	var index ociManifest
+	index.SchemaVersion = 2
+	index.MediaType = ociIndexMediaType
+	for _, arch := range []string{"amd64", "arm64"} {
+		config := []byte(fmt.Sprintf(`{"architecture":%q,"os":"linux"}`, arch))
+		layers := [][]byte{randomBytes(t, 700*KB), randomBytes(t, 64*KB), []byte("shared layer")}
+		r.layers[arch] = layers
+
+		m := ociManifest{SchemaVersion: 2, MediaType: ociManifestMediaType}
+		m.Config = r.addBlob("application/vnd.oci.image.config.v1+json", config)
+		for _, l := range layers {
+			m.Layers = append(m.Layers, *r.addBlob("application/vnd.oci.image.layer.v1.tar", l))
+		}
+		desc := r.addManifest(ociManifestMediaType, m)
+		desc.Platform = &ociPlatform{OS: "linux", Architecture: arch}
+		index.Manifests = append(index.Manifests, desc)
+	}
+	attestation := r.addManifest(ociManifestMediaType, ociManifest{SchemaVersion: 2, MediaType: ociManifestMediaType,
+		Config: r.addBlob("application/vnd.in-toto+json", []byte("{}"))})
+	attestation.Platform = &ociPlatform{OS: "unknown", Architecture: "unknown"}
+	index.Manifests = append(index.Manifests, attestation)
+
+	data, _ := json.Marshal(index)
+	r.manifests["v1"], r.types["v1"] = data, ociIndexMediaType
+
+	r.Server = httptest.NewServer(http.HandlerFunc(r.handle))
+	t.Cleanup(r.Close)
+	return r
+}
+
+func (r *testRegistry) addBlob(mediaType string, data []byte) *ociDescriptor {
+	d := sha256Digest(data)
+	r.blobs[d] = data
+	return &ociDescriptor{MediaType: mediaType, Digest: d, Size: int64(len(data))}
+}
+
+func (r *testRegistry) addManifest(mediaType string, m ociManifest) ociDescriptor {
+	data, _ := json.Marshal(m)
+	d := sha256Digest(data)
+	r.manifests[d], r.types[d] = data, mediaType
+	return ociDescriptor{MediaType: mediaType, Digest: d, Size: int64(len(data))}
+}
+
+// url returns the oci:// reference for tag (or @digest)
+func (r *testRegistry) url(reference string) string {
+	sep := ":"
+	if strings.HasPrefix(reference, "sha256:") {
+		sep = "@"
+	}
+	return "oci://" + strings.TrimPrefix(r.URL, "http://") + "/" + r.repo + sep + reference
+}
+
+func (r *testRegistry) handle(w http.ResponseWriter, req *http.Request) {
+	if req.URL.Path == "/token" {
+		if req.URL.Query().Get("scope") != "repository:"+r.repo+":pull" {
+			http.Error(w, "bad scope", http.StatusBadRequest)
+			return
+		}
+		n := r.tokens.Add(1)
+		json.NewEncoder(w).Encode(map[string]any{"token": fmt.Sprintf("tok-%d", n), "expires_in": 300})
+		return
+	}
+
+	if !strings.HasPrefix(req.Header.Get("Authorization"), "Bearer tok-") {
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="test-registry",scope="repository:%s:pull"`, r.URL, r.repo))
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	prefix := "/v2/" + r.repo + "/"
+	kind, reference, _ := strings.Cut(strings.TrimPrefix(req.URL.Path, prefix), "/")
+	switch kind {
+	case "manifests":
+		data, ok := r.manifests[reference]
+		if !ok {
+			http.NotFound(w, req)
+			return
+		}
+		w.Header().Set("Content-Type", r.types[reference])
+		w.Header().Set("Docker-Content-Digest", sha256Digest(data))
+		w.Write(data)
+	case "blobs":
+		data, ok := r.blobs[reference]
+		if !ok {
+			http.NotFound(w, req)
+			return
+		}
+		if reference == r.corrupt {
+			data = bytes.Repeat([]byte{'x'}, len(data))
+		}
+		if req.Header.Get("Range") != "" {
+			r.ranged.Add(1)
+		}
+		http.ServeContent(w, req, "", time.Time{}, bytes.NewReader(data))
+	default:
+		http.NotFound(w, req)
+	}
+}
+
+func TestParseOCIReference(t *testing.T) {
+	digest := "sha256:" + strings.Repeat("ab", 32)
+	tests := []struct {
+		url     string
+		want    ociReference
+		wantErr bool
+	}{
+		{"oci://ghcr.io/org/model:v1", ociReference{Host: "ghcr.io", Repo: "org/model", Tag: "v1"}, false},
+		{"oci://localhost:5000/model", ociReference{Host: "localhost:5000", Repo: "model", Tag: "latest"}, false},
+		{"oci://docker.io/ubuntu:24.04", ociReference{Host: "docker.io", Repo: "library/ubuntu", Tag: "24.04"}, false},
+		{"oci://ghcr.io/org/model@" + digest, ociReference{Host: "ghcr.io", Repo: "org/model", Digest: digest}, false},
+		{"oci://ghcr.io/org/model:v1@" + digest, ociReference{Host: "ghcr.io", Repo: "org/model", Tag: "v1", Digest: digest}, false},
+		{"oci://ghcr.io/org/model@md5:abc", ociReference{}, true},
+		{"oci://ghcr.io", ociReference{}, true},
+	}
+	for _, tt := range tests {
+		got, err := parseOCIReference(tt.url)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseOCIReference(%q) error = %v, wantErr %v", tt.url, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseOCIReference(%q) = %+v, want %+v", tt.url, got, tt.want)
+		}
+	}
+}
+
+func TestOCIRegistryURL(t *testing.T) {
+	tests := []struct {
+		host string
+		want string
+	}{
+		{"docker.io", "https://registry-1.docker.io"},
+		{"ghcr.io", "https://ghcr.io"},
+		{"localhost:5000", "http://localhost:5000"},
+		{"127.0.0.1:5000", "http://127.0.0.1:5000"},
+		{"registry.local:5000", "https://registry.local:5000"},
+	}
+	for _, tt := range tests {
+		if got := (ociReference{Host: tt.host}).registryURL().String(); got != tt.want {
+			t.Errorf("registryURL(%q) = %q, want %q", tt.host, got, tt.want)
+		}
+	}
+}
+
+func TestSelectOCIPlatform(t *testing.T) {
+	manifests := []ociDescriptor{
+		{Digest: "amd64", Platform: &ociPlatform{OS: "linux", Architecture: "amd64"}},
+		{Digest: "armv7", Platform: &ociPlatform{OS: "linux", Architecture: "arm", Variant: "v7"}},
+		{Digest: "arm64", Platform: &ociPlatform{OS: "linux", Architecture: "arm64", Variant: "v8"}},
+		{Digest: "att", Platform: &ociPlatform{OS: "unknown", Architecture: "unknown"}},
+	}
+	tests := []struct {
+		platform string
+		want     string
+		wantErr  bool
+	}{
+		{"linux/amd64", "amd64", false},
+		{"linux/arm64", "arm64", false},
+		{"linux/arm/v7", "armv7", false},
+		{"linux/arm/v6", "", true},
+		{"windows/amd64", "", true},
+		{"amd64", "", true},
+	}
+	for _, tt := range tests {
+		got, err := selectOCIPlatform(manifests, tt.platform)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("selectOCIPlatform(%q) error = %v, wantErr %v", tt.platform, err, tt.wantErr)
+			continue
+		}
+		if got.Digest != tt.want {
+			t.Errorf("selectOCIPlatform(%q) = %s, want %s", tt.platform, got.Digest, tt.want)
+		}
+	}
+
+	// Artifact indexes carry no platform: take the first entry
+	if got, err := selectOCIPlatform([]ociDescriptor{{Digest: "a"}, {Digest: "b"}}, "linux/amd64"); err != nil || got.Digest != "a" {
+		t.Errorf("platformless index = %s, %v; want a", got.Digest, err)
+	}
+}
+
+func TestTUIDownload_OCI(t *testing.T) {
+	if err := config.EnsureDirs(); err != nil {
+		t.Fatalf("Failed to create config dirs: %v", err)
+	}
+	reg := startTestRegistry(t)
+
+	outDir, cleanup, err := testutil.TempDir("surge-oci")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	state := NewProgressState("oci", 0)
+	cfg := DownloadConfig{
+		URL:        reg.url("v1"),
+		OutputPath: outDir,
+		ID:         "oci",
+		State:      state,
+		Runtime:    &RuntimeConfig{MaxConnectionsPerHost: 4, TargetChunkSize: 128 * KB, OCIPlatform: "linux/arm64"},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if err := TUIDownload(ctx, cfg); err != nil {
+		t.Fatalf("OCI download failed: %v", err)
+	}
+
+	layout := filepath.Join(outDir, "llama-v1")
+	if data, err := os.ReadFile(filepath.Join(layout, "oci-layout")); err != nil || !strings.Contains(string(data), `"1.0.0"`) {
+		t.Errorf("oci-layout = %q, %v", data, err)
+	}
+
+	var index ociManifest
+	data, err := os.ReadFile(filepath.Join(layout, "index.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, &index); err != nil {
+		t.Fatal(err)
+	}
+	if len(index.Manifests) != 1 {
+		t.Fatalf("index.json has %d manifests, want 1", len(index.Manifests))
+	}
+	desc := index.Manifests[0]
+	if desc.Annotations[ociRefNameAnnotation] != "v1" || desc.Platform == nil || desc.Platform.Architecture != "arm64" {
+		t.Errorf("index.json manifest = %+v", desc)
+	}
+
+	// Every blob reachable from the manifest is present and matches its digest
+	manifestData, err := os.ReadFile(blobPath(layout, desc.Digest))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m ociManifest
+	if err := json.Unmarshal(manifestData, &m); err != nil {
+		t.Fatal(err)
+	}
+	for i, blob := range append([]ociDescriptor{*m.Config}, m.Layers...) {
+		got, err := os.ReadFile(blobPath(layout, blob.Digest))
+		if err != nil {
+			t.Errorf("blob %d: %v", i, err)
+			continue
+		}
+		if sha256Digest(got) != blob.Digest {
+			t.Errorf("blob %d does not match its digest", i)
+		}
+		if i > 0 && !bytes.Equal(got, reg.layers["arm64"][i-1]) {
+			t.Errorf("layer %d is not the arm64 layer", i-1)
+		}
+	}
+
+	if n := reg.ranged.Load(); n < 6 {
+		t.Errorf("served %d ranged blob requests, want the 700KB layer split into chunks", n)
+	}
+	if n := reg.tokens.Load(); n != 1 {
+		t.Errorf("issued %d tokens, want 1 reused for all requests", n)
+	}
+	var wantTotal int64
+	for _, blob := range append([]ociDescriptor{*m.Config}, m.Layers...) {
+		wantTotal += blob.Size
+	}
+	if state.TotalSize != wantTotal {
+		t.Errorf("TotalSize = %d, want %d", state.TotalSize, wantTotal)
+	}
+	entries, _ := os.ReadDir(filepath.Join(layout, "blobs", "sha256"))
+	for _, e := range entries {
+		if strings.Contains(e.Name(), IncompleteSuffix) {
+			t.Errorf("leftover working file %s", e.Name())
+		}
+	}
+}
+
+func TestTUIDownload_OCIDigestMismatch(t *testing.T) {
+	if err := config.EnsureDirs(); err != nil {
+		t.Fatalf("Failed to create config dirs: %v", err)
+	}
+	reg := startTestRegistry(t)
+	reg.corrupt = sha256Digest(reg.layers["amd64"][1])
+
+	cfg := DownloadConfig{
+		URL:        reg.url("v1"),
+		OutputPath: t.TempDir(),
+		ID:         "oci-corrupt",
+		State:      NewProgressState("oci-corrupt", 0),
+		Runtime:    &RuntimeConfig{MaxConnectionsPerHost: 4, OCIPlatform: "linux/amd64"},
+	}
+
+	err := TUIDownload(context.Background(), cfg)
+	if err == nil || !strings.Contains(err.Error(), "sha256 mismatch") {
+		t.Fatalf("expected sha256 mismatch, got %v", err)
+	}
+	if _, err := os.Stat(blobPath(filepath.Join(cfg.OutputPath, "llama-v1"), reg.corrupt)); !os.IsNotExist(err) {
+		t.Error("corrupt blob should not be moved into the layout")
+	}
+}
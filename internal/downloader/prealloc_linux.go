@@ -0,0 +1,21 @@
+//go:build linux
+
+package downloader
+
+import (
+	"errors"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// preallocate sets file to size bytes and reserves the disk space for them,
+// so a full disk fails here rather than partway through the download.
+// Filesystems without fallocate get a sparse file instead.
+func preallocate(file *os.File, size int64) error {
+	err := unix.Fallocate(int(file.Fd()), 0, 0, size)
+	if errors.Is(err, unix.EOPNOTSUPP) {
+		return file.Truncate(size)
+	}
+	return err
+}
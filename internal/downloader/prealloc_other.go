@@ -0,0 +1,11 @@
+//go:build !linux
+
+package downloader
+
+import "os"
+
+// preallocate sets file to size bytes. There is no portable way to reserve
+// the disk space, so the file may be sparse.
+func preallocate(file *os.File, size int64) error {
+	return file.Truncate(size)
+}
@@ -0,0 +1,71 @@
+package downloader
+
+import (
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/junaid2005p/surge/internal/config"
+	"github.com/junaid2005p/surge/internal/utils"
+)
+
+// minProfileSize is the smallest download worth learning a host profile from;
+// smaller ones finish before the connection count matters
+const minProfileSize = 16 * MB
+
+// profileHost returns the host a download's profile is kept under
+func profileHost(rawurl string) string {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Host)
+}
+
+// applyProfile starts a download from what was learned about its host instead
+// of the size-based heuristics, within the configured limits. A host whose
+// last download was served without ranges keeps the heuristics: whatever it
+// learned before may no longer fit.
+func (d *ConcurrentDownloader) applyProfile(profile *config.HostProfile, fileSize int64, numConns int, chunkSize int64) (int, int64) {
+	if !profile.SupportsRange {
+		utils.Debug("Learned profile for %s has no range support, using defaults", profile.Host)
+		return numConns, chunkSize
+	}
+	if profile.Connections > 0 {
+		chunks := max(fileSize/d.Runtime.GetMinChunkSize(), 1)
+		numConns = int(min(int64(profile.Connections), int64(d.Runtime.GetMaxConnectionsPerHost()), chunks))
+	}
+	if profile.ChunkSize > 0 {
+		chunkSize = min(max(profile.ChunkSize, d.Runtime.GetMinChunkSize()), d.Runtime.GetMaxChunkSize())
+		chunkSize = max((chunkSize/AlignSize)*AlignSize, AlignSize)
+	}
+	utils.Debug("Using learned profile for %s: %d connections, chunk size %d", profile.Host, numConns, chunkSize)
+	return numConns, chunkSize
+}
+
+// recordProfile saves what a finished download learned about its host
+func recordProfile(rawurl string, p config.HostProfile) {
+	if p.Host = profileHost(rawurl); p.Host == "" {
+		return
+	}
+	if err := config.RecordHostProfile(p); err != nil {
+		utils.Debug("Failed to save host profile: %v", err)
+	}
+}
+
+// learnedProfile builds the host profile of a completed concurrent download:
+// the connection count of its fastest interval, or the final count and the
+// average speed if the adaptive controller never sampled
+func (d *ConcurrentDownloader) learnedProfile(controller *connController, chunkSize, downloaded int64, elapsed time.Duration) config.HostProfile {
+	p := config.HostProfile{ChunkSize: chunkSize, SupportsRange: true}
+	if controller != nil {
+		p.Connections, p.Throughput = controller.best()
+	}
+	if p.Connections == 0 {
+		p.Connections = d.throttle.Limit()
+		if elapsed > 0 {
+			p.Throughput = float64(downloaded) / elapsed.Seconds()
+		}
+	}
+	return p
+}
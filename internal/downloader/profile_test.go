@@ -0,0 +1,90 @@
+package downloader
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/junaid2005p/surge/internal/config"
+)
+
+func TestProfileHost(t *testing.T) {
+	tests := map[string]string{
+		"https://CDN.Example.com/file.iso": "cdn.example.com",
+		"http://127.0.0.1:8080/a":          "127.0.0.1:8080",
+		"://bad":                           "",
+	}
+	for rawurl, want := range tests {
+		if got := profileHost(rawurl); got != want {
+			t.Errorf("profileHost(%q) = %q, want %q", rawurl, got, want)
+		}
+	}
+}
+
+func TestApplyProfile(t *testing.T) {
+	d := NewConcurrentDownloader("test", nil, nil, &RuntimeConfig{
+		MaxConnectionsPerHost: 16,
+		MinChunkSize:          1 * MB,
+		MaxChunkSize:          16 * MB,
+	})
+
+	tests := []struct {
+		name      string
+		profile   config.HostProfile
+		fileSize  int64
+		wantConns int
+		wantChunk int64
+	}{
+		{"learned values", config.HostProfile{Connections: 12, ChunkSize: 4 * MB, SupportsRange: true}, 1 * GB, 12, 4 * MB},
+		{"per-host limit", config.HostProfile{Connections: 40, SupportsRange: true}, 1 * GB, 16, 2 * MB},
+		{"small file", config.HostProfile{Connections: 12, SupportsRange: true}, 3 * MB, 3, 2 * MB},
+		{"chunk clamped", config.HostProfile{Connections: 4, ChunkSize: 64 * MB, SupportsRange: true}, 1 * GB, 4, 16 * MB},
+		{"no range support", config.HostProfile{Connections: 1, ChunkSize: 8 * MB}, 1 * GB, 4, 2 * MB},
+	}
+	for _, tt := range tests {
+		conns, chunk := d.applyProfile(&tt.profile, tt.fileSize, 4, 2*MB)
+		if conns != tt.wantConns || chunk != tt.wantChunk {
+			t.Errorf("%s: applyProfile = %d, %d; want %d, %d", tt.name, conns, chunk, tt.wantConns, tt.wantChunk)
+		}
+	}
+}
+
+func TestConcurrentDownloader_LearnsHostProfile(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("relies on XDG_CONFIG_HOME")
+	}
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	if err := config.EnsureDirs(); err != nil {
+		t.Fatal(err)
+	}
+
+	data := randomBytes(t, int(minProfileSize))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(data))
+	}))
+	defer server.Close()
+
+	destPath := filepath.Join(t.TempDir(), "learned.bin")
+	d := NewConcurrentDownloader("profile-id", nil, NewProgressState("profile-id", int64(len(data))), &RuntimeConfig{MaxConnectionsPerHost: 4})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := d.Download(ctx, server.URL, destPath, int64(len(data)), false); err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+
+	host := strings.TrimPrefix(server.URL, "http://")
+	p := config.LookupHostProfile(host)
+	if p == nil {
+		t.Fatal("no profile learned for the host")
+	}
+	if !p.SupportsRange || p.Connections < 1 || p.Connections > 4 || p.ChunkSize == 0 || p.Throughput <= 0 {
+		t.Errorf("learned profile = %+v", p)
+	}
+}
@@ -13,13 +13,18 @@ type ProgressState struct {
 	TotalSize     int64
 	StartTime     time.Time
 	ActiveWorkers atomic.Int32
+	ConnLimit     atomic.Int32 // Connections the download may currently use (adaptive)
+	Peers         atomic.Int32 // Connected peers (torrent downloads only)
+	Stalls        atomic.Int32 // Workers restarted because their connection stopped delivering data
+	SlowRestarts  atomic.Int32 // Workers restarted for being far slower than the others
 	Done          atomic.Bool
 	Error         atomic.Pointer[error]
 	Paused        atomic.Bool
 	CancelFunc    context.CancelFunc
 
 	SessionStartBytes int64      // SessionStartBytes tracks how many bytes were already downloaded when the current session started
-	mu                sync.Mutex // Protects TotalSize, StartTime, SessionStartBytes
+	destPath          string     // Where the download is saved, once known
+	mu                sync.Mutex // Protects TotalSize, StartTime, SessionStartBytes, destPath
 }
 
 func NewProgressState(id string, totalSize int64) *ProgressState {
@@ -38,6 +43,28 @@ func (ps *ProgressState) SetTotalSize(size int64) {
 	ps.StartTime = time.Now()
 }
 
+// UpdateTotalSize revises the total mid-download (e.g. a stream's size estimate)
+// without restarting the session speed measurement
+func (ps *ProgressState) UpdateTotalSize(size int64) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	ps.TotalSize = size
+}
+
+// SetDestPath records where the download is saved (used to resume on retry)
+func (ps *ProgressState) SetDestPath(path string) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	ps.destPath = path
+}
+
+// DestPath returns where the download is saved, or empty if not known yet
+func (ps *ProgressState) DestPath() string {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	return ps.destPath
+}
+
 func (ps *ProgressState) SetError(err error) {
 	ps.Error.Store(&err)
 }
@@ -2,8 +2,13 @@ package downloader
 
 import (
 	"context"
+	"errors"
 	"github.com/junaid2005p/surge/internal/messages"
+	"github.com/junaid2005p/surge/internal/utils"
+	"math/rand/v2"
+	"path/filepath"
 	"sync"
+	"time"
 
 	tea "github.com/charmbracelet/bubbletea"
 )
@@ -16,10 +21,18 @@ type activeDownload struct {
 	cancel context.CancelFunc
 }
 
+// pendingRetry is a failed download waiting for its automatic retry
+type pendingRetry struct {
+	config DownloadConfig
+	timer  *time.Timer
+}
+
 type WorkerPool struct {
 	taskChan   chan DownloadConfig
 	progressCh chan<- tea.Msg
 	downloads  map[string]*activeDownload // Track active downloads for pause/resume
+	retries    map[string]*pendingRetry   // Failed downloads waiting for an automatic retry
+	failed     map[string]DownloadConfig  // Failed downloads kept for a manual Retry
 	mu         sync.RWMutex
 	wg         sync.WaitGroup //We use this to wait for all active downloads to pause before exiting the program
 }
@@ -29,23 +42,154 @@ func NewWorkerPool(progressCh chan<- tea.Msg) *WorkerPool {
 		taskChan:   make(chan DownloadConfig, 100), //We make it buffered to avoid blocking add
 		progressCh: progressCh,
 		downloads:  make(map[string]*activeDownload),
+		retries:    make(map[string]*pendingRetry),
+		failed:     make(map[string]DownloadConfig),
 	}
 	for i := 0; i < maxDownloads; i++ {
 		go pool.worker()
 	}
+	go pool.watchDiskSpace()
 	return pool
 }
 
 func (p *WorkerPool) Add(cfg DownloadConfig) {
+	p.mu.Lock()
+	delete(p.failed, cfg.ID)
+	p.mu.Unlock()
 	p.taskChan <- cfg
 }
 
+// Retry re-queues a download that failed after its automatic retries, resuming
+// from its saved progress. Returns false if the pool has no such download.
+func (p *WorkerPool) Retry(downloadID string) bool {
+	p.mu.Lock()
+	cfg, exists := p.failed[downloadID]
+	p.mu.Unlock()
+
+	if !exists {
+		return false
+	}
+	if cfg.State != nil {
+		cfg.State.Error.Store(nil)
+	}
+	p.Add(cfg)
+	return true
+}
+
+// retryConfig returns cfg set up to resume from the progress saved when it failed
+func retryConfig(cfg DownloadConfig) DownloadConfig {
+	if cfg.State != nil {
+		if destPath := cfg.State.DestPath(); destPath != "" {
+			cfg.IsResume = true
+			cfg.DestPath = destPath
+		}
+	}
+	return cfg
+}
+
+// isRetryable reports whether retrying a download of rawurl that failed with
+// err may help. Rejected links need a new URL first (see ReplaceURL), unless
+// a resolver plugin matches rawurl: a retry runs it again for a fresh link. A
+// full disk needs space to be freed.
+func isRetryable(rawurl string, err error) bool {
+	if errors.Is(err, ErrLinkRejected) {
+		r, _ := matchResolver(rawurl)
+		return r != nil
+	}
+	return !errors.Is(err, context.Canceled) && !IsDiskSpaceError(err)
+}
+
+// retryBackoff returns the wait before automatic retry number attempt+1:
+// base doubled for each earlier attempt, capped, with up to half of it as jitter
+func retryBackoff(base time.Duration, attempt int) time.Duration {
+	d := base
+	for i := 0; i < attempt && d < maxDownloadRetryDelay; i++ {
+		d *= 2
+	}
+	d = min(d, maxDownloadRetryDelay)
+	return d/2 + rand.N(d/2+1)
+}
+
+// fail handles a download that stopped with an error. Its progress has been
+// saved by the downloader, so it is retried automatically while the retry
+// policy allows; otherwise it is reported as failed and kept for Retry.
+func (p *WorkerPool) fail(cfg DownloadConfig, err error) {
+	next := retryConfig(cfg)
+
+	if maxAttempts := cfg.Runtime.GetMaxDownloadRetries(); cfg.Attempt < maxAttempts && isRetryable(cfg.URL, err) {
+		next.Attempt++
+		delay := retryBackoff(cfg.Runtime.GetDownloadRetryDelay(), cfg.Attempt)
+		utils.Debug("Download %s failed (%v), retry %d/%d in %v", cfg.ID, err, next.Attempt, maxAttempts, delay)
+
+		p.mu.Lock()
+		p.retries[cfg.ID] = &pendingRetry{config: next, timer: time.AfterFunc(delay, func() {
+			p.mu.Lock()
+			_, pending := p.retries[cfg.ID]
+			delete(p.retries, cfg.ID)
+			p.mu.Unlock()
+			if pending { // Not paused or cancelled meanwhile
+				p.Add(next)
+			}
+		})}
+		p.mu.Unlock()
+
+		if p.progressCh != nil {
+			p.progressCh <- messages.DownloadRetryMsg{
+				DownloadID:  cfg.ID,
+				Attempt:     next.Attempt,
+				MaxAttempts: maxAttempts,
+				Delay:       delay,
+				Err:         err,
+			}
+		}
+		return
+	}
+
+	next.Attempt = 0
+	p.mu.Lock()
+	p.failed[cfg.ID] = next
+	p.mu.Unlock()
+
+	if cfg.State != nil {
+		cfg.State.SetError(err)
+	}
+	if p.progressCh != nil {
+		p.progressCh <- messages.DownloadErrorMsg{DownloadID: cfg.ID, Err: err}
+	}
+}
+
+// stopRetry cancels a pending automatic retry, returning it if there was one
+func (p *WorkerPool) stopRetry(downloadID string) *pendingRetry {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	r, exists := p.retries[downloadID]
+	if !exists {
+		return nil
+	}
+	r.timer.Stop()
+	delete(p.retries, downloadID)
+	return r
+}
+
 // Pause pauses a specific download by ID
 func (p *WorkerPool) Pause(downloadID string) {
 	p.mu.RLock()
 	ad, exists := p.downloads[downloadID]
 	p.mu.RUnlock()
 
+	// A download waiting to be retried is paused by dropping the retry;
+	// its progress is already saved
+	if !exists {
+		if r := p.stopRetry(downloadID); r != nil {
+			// Keep it tracked like other paused downloads so Resume finds it
+			ad, exists = &activeDownload{config: r.config}, true
+			p.mu.Lock()
+			p.downloads[downloadID] = ad
+			p.mu.Unlock()
+		}
+	}
+
 	if !exists || ad == nil {
 		return
 	}
@@ -78,6 +222,9 @@ func (p *WorkerPool) PauseAll() {
 			ids = append(ids, id)
 		}
 	}
+	for id := range p.retries {
+		ids = append(ids, id)
+	}
 	p.mu.RUnlock()
 
 	for _, id := range ids {
@@ -87,14 +234,23 @@ func (p *WorkerPool) PauseAll() {
 
 // Cancel cancels and removes a download by ID
 func (p *WorkerPool) Cancel(downloadID string) {
+	StopSeeding(downloadID)
+
 	p.mu.Lock()
 	ad, exists := p.downloads[downloadID]
 	if exists {
 		delete(p.downloads, downloadID)
 	}
+	delete(p.failed, downloadID)
 	p.mu.Unlock()
 
-	if !exists || ad == nil {
+	if !exists {
+		if r := p.stopRetry(downloadID); r != nil && r.config.State != nil {
+			r.config.State.Done.Store(true)
+		}
+		return
+	}
+	if ad == nil {
 		return
 	}
 
@@ -155,17 +311,17 @@ func (p *WorkerPool) worker() {
 		// Check if this was a pause (not an error)
 		isPaused := cfg.State != nil && cfg.State.IsPaused()
 
-		if err != nil && !isPaused {
-			if cfg.State != nil {
-				cfg.State.SetError(err)
-			}
-			if p.progressCh != nil {
-				p.progressCh <- messages.DownloadErrorMsg{DownloadID: cfg.ID, Err: err}
-			}
-			// Clean up errored download from tracking (don't save to .surge)
+		if err != nil && !isPaused && isDiskFull(err) {
+			// The disk filled up mid-transfer; its progress is saved
+			p.pauseForDiskSpace(cfg)
+
+		} else if err != nil && !isPaused {
+			// Clean up errored download from tracking; its progress is saved
+			// so it can be retried
 			p.mu.Lock()
 			delete(p.downloads, cfg.ID)
 			p.mu.Unlock()
+			p.fail(cfg, err)
 
 		} else if !isPaused {
 			// Only mark as done if not paused
@@ -184,8 +340,67 @@ func (p *WorkerPool) worker() {
 	}
 }
 
+// watchDiskSpace pauses all downloads when a disk they write to runs low, so
+// they stop with their progress saved instead of failing
+func (p *WorkerPool) watchDiskSpace() {
+	ticker := time.NewTicker(diskCheckInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		dir, free, low := p.lowDiskSpace()
+		if !low {
+			continue
+		}
+		utils.Debug("Disk space low in %s (%d bytes free), pausing all downloads", dir, free)
+		p.PauseAll()
+		if p.progressCh != nil {
+			p.progressCh <- messages.DiskSpaceLowMsg{Dir: dir, Free: free}
+		}
+	}
+}
+
+// pauseForDiskSpace pauses a download that stopped because its disk is full,
+// and all other downloads with it. It resumes from its saved progress.
+func (p *WorkerPool) pauseForDiskSpace(cfg DownloadConfig) {
+	p.mu.Lock()
+	p.downloads[cfg.ID] = &activeDownload{config: retryConfig(cfg)}
+	p.mu.Unlock()
+
+	utils.Debug("Disk full while writing %s, pausing all downloads", cfg.ID)
+	p.Pause(cfg.ID)
+	p.PauseAll()
+
+	if p.progressCh != nil && cfg.State != nil {
+		dir := filepath.Dir(cfg.State.DestPath())
+		free, _ := freeSpaceFor(cfg.State.DestPath())
+		p.progressCh <- messages.DiskSpaceLowMsg{Dir: dir, Free: free}
+	}
+}
+
+// lowDiskSpace finds a running download whose disk has less than its
+// MinFreeSpace (at least diskLowFloor) free, returning the destination
+// directory and the free space
+func (p *WorkerPool) lowDiskSpace() (string, int64, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	for _, ad := range p.downloads {
+		state := ad.config.State
+		if state == nil || state.IsPaused() || state.Done.Load() || state.DestPath() == "" {
+			continue
+		}
+		reserve := max(ad.config.Runtime.GetMinFreeSpace(), diskLowFloor)
+		if free, err := freeSpaceFor(state.DestPath()); err == nil && free < reserve {
+			return filepath.Dir(state.DestPath()), free, true
+		}
+	}
+	return "", 0, false
+}
+
 // GracefulShutdown pauses all downloads and waits for them to save state
 func (p *WorkerPool) GracefulShutdown() {
 	p.PauseAll()
 	p.wg.Wait() // Blocks until all workers call Done()
+	CloseTorrentClient()
+	closeIdleConnections()
 }
@@ -1,7 +1,24 @@
 package downloader
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	"github.com/junaid2005p/surge/internal/config"
+	"github.com/junaid2005p/surge/internal/messages"
+	"github.com/junaid2005p/surge/internal/testutil"
+
+	tea "github.com/charmbracelet/bubbletea"
 )
 
 func TestNewTaskQueue(t *testing.T) {
@@ -146,3 +163,143 @@ func TestTask_Struct(t *testing.T) {
 		t.Errorf("Length = %d, want 500", task.Length)
 	}
 }
+
+func TestRetryBackoff(t *testing.T) {
+	base := 10 * time.Second
+	for attempt, want := range []time.Duration{10 * time.Second, 20 * time.Second, 40 * time.Second} {
+		for i := 0; i < 20; i++ {
+			got := retryBackoff(base, attempt)
+			if got < want/2 || got > want {
+				t.Fatalf("retryBackoff(%v, %d) = %v, want within [%v, %v]", base, attempt, got, want/2, want)
+			}
+		}
+	}
+	if got := retryBackoff(base, 30); got > maxDownloadRetryDelay {
+		t.Errorf("retryBackoff not capped: %v", got)
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	startResolverFixture(t)
+
+	rejected := fmt.Errorf("%w (403)", ErrLinkRejected)
+	tests := []struct {
+		name   string
+		rawurl string
+		err    error
+		want   bool
+	}{
+		{"server error", "https://files.example/a.bin", errors.New("unexpected status: 500"), true},
+		{"rejected link", "https://files.example/a.bin", rejected, false},
+		{"rejected resolved link", "https://video.example/watch?v=1", rejected, true},
+		{"rejected resolved item", "https://video.example/playlist?list=1#surge-item=1", rejected, true},
+		{"cancelled", "https://video.example/watch?v=1", context.Canceled, false},
+		{"disk full", "https://files.example/a.bin", &InsufficientSpaceError{}, false},
+	}
+	for _, tt := range tests {
+		if got := isRetryable(tt.rawurl, tt.err); got != tt.want {
+			t.Errorf("%s: isRetryable = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestWorkerPool_RetriesFailedDownload(t *testing.T) {
+	if err := config.EnsureDirs(); err != nil {
+		t.Fatal(err)
+	}
+
+	data := randomBytes(t, 2*MB)
+	var requests atomic.Int32
+	// The first two probes fail with a server error, the third succeeds
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.Header.Get("Range"), "bytes=0-") && requests.Add(1) <= 2 {
+			http.Error(w, "unavailable", http.StatusInternalServerError)
+			return
+		}
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(data))
+	}))
+	defer server.Close()
+
+	outDir, cleanup, err := testutil.TempDir("surge-pool-retry")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	progressCh := make(chan tea.Msg, 100)
+	pool := NewWorkerPool(progressCh)
+	state := NewProgressState("retry-test", 0)
+	pool.Add(DownloadConfig{
+		URL:        server.URL + "/file.bin",
+		OutputPath: outDir,
+		ID:         "retry-test",
+		Filename:   "file.bin",
+		State:      state,
+		Runtime:    &RuntimeConfig{MaxDownloadRetries: 2, DownloadRetryDelay: 20 * time.Millisecond},
+	})
+
+	var retries []messages.DownloadRetryMsg
+	timeout := time.After(30 * time.Second)
+	for !state.Done.Load() {
+		select {
+		case msg := <-progressCh:
+			switch msg := msg.(type) {
+			case messages.DownloadRetryMsg:
+				retries = append(retries, msg)
+			case messages.DownloadErrorMsg:
+				t.Fatalf("download failed despite retries: %v", msg.Err)
+			}
+		case <-timeout:
+			t.Fatal("download did not finish")
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+
+	if len(retries) != 2 || retries[0].Attempt != 1 || retries[1].Attempt != 2 || retries[1].MaxAttempts != 2 {
+		t.Errorf("retry messages = %+v, want attempts 1 and 2 of 2", retries)
+	}
+	got, err := os.ReadFile(filepath.Join(outDir, "file.bin"))
+	if err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("content mismatch after retries (err %v)", err)
+	}
+}
+
+func TestWorkerPool_KeepsFailedDownloadForRetry(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+
+	outDir, cleanup, err := testutil.TempDir("surge-pool-failed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	progressCh := make(chan tea.Msg, 100)
+	pool := NewWorkerPool(progressCh)
+	state := NewProgressState("failed-test", 0)
+	pool.Add(DownloadConfig{
+		URL:        server.URL + "/missing.bin",
+		OutputPath: outDir,
+		ID:         "failed-test",
+		State:      state,
+		Runtime:    &RuntimeConfig{MaxDownloadRetries: 3, DownloadRetryDelay: time.Millisecond},
+	})
+
+	select {
+	case msg := <-progressCh:
+		if _, ok := msg.(messages.DownloadErrorMsg); !ok {
+			t.Fatalf("got %T, want DownloadErrorMsg without automatic retries", msg)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("download did not fail")
+	}
+	if state.GetError() == nil {
+		t.Error("state error not set")
+	}
+	if pool.Retry("unknown") {
+		t.Error("Retry of an unknown download should return false")
+	}
+	if !pool.Retry("failed-test") || state.GetError() != nil {
+		t.Error("Retry should re-queue the failed download and clear its error")
+	}
+}
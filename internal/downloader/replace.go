@@ -0,0 +1,135 @@
+package downloader
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+
+	"github.com/junaid2005p/surge/internal/utils"
+)
+
+// replaceSampleSize is how much already-downloaded data is compared against
+// a replacement URL
+const replaceSampleSize = 64 * KB
+
+// ReplaceURL moves the saved progress of a paused or failed download from
+// oldURL to newURL, after checking that newURL serves the same file: the same
+// size, the same ETag when both were reported, and the same bytes in a sample
+// of the data downloaded so far. Resuming the download from newURL then
+// continues where it stopped.
+func ReplaceURL(ctx context.Context, oldURL, newURL, destPath string, runtime *RuntimeConfig) error {
+	if newURL == oldURL {
+		return errors.New("the new URL is the same as the current one")
+	}
+	if u, err := url.Parse(newURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid URL: %q", newURL)
+	}
+
+	state, err := LoadState(oldURL, destPath)
+	if err != nil || len(state.Tasks) == 0 {
+		return errors.New("no saved progress to move to the new URL")
+	}
+
+	probe, err := probeServer(ctx, newURL, "", runtime)
+	if err != nil {
+		return err
+	}
+	if !probe.SupportsRange {
+		return errors.New("the new URL does not support resuming")
+	}
+	if probe.FileSize != state.TotalSize {
+		return fmt.Errorf("the new URL serves a different file (%s instead of %s)",
+			utils.ConvertBytesToHumanReadable(probe.FileSize), utils.ConvertBytesToHumanReadable(state.TotalSize))
+	}
+	if state.ETag != "" && probe.ETag != "" && state.ETag != probe.ETag {
+		return fmt.Errorf("the new URL serves a different file (ETag %s instead of %s)", probe.ETag, state.ETag)
+	}
+	if err := verifySample(ctx, newURL, destPath, state, runtime); err != nil {
+		return err
+	}
+
+	// Re-key the state: it is stored under a hash of URL and destination
+	state.URL = newURL
+	if probe.ETag != "" {
+		state.ETag = probe.ETag
+	}
+	if err := SaveState(newURL, destPath, state); err != nil {
+		return err
+	}
+	if err := os.Remove(getStatePath(oldURL, destPath)); err != nil && !os.IsNotExist(err) {
+		utils.Debug("Failed to remove old state file: %v", err)
+	}
+	utils.Debug("Replaced URL of %s: %s -> %s", destPath, oldURL, newURL)
+	return nil
+}
+
+// downloadedRange returns the first byte range already written for state,
+// i.e. the first gap between its remaining tasks. length is 0 if nothing has
+// been written yet.
+func downloadedRange(state *DownloadState) (offset, length int64) {
+	tasks := append([]Task(nil), state.Tasks...)
+	sort.Slice(tasks, func(i, j int) bool { return tasks[i].Offset < tasks[j].Offset })
+
+	var pos int64
+	for _, t := range tasks {
+		if t.Offset > pos {
+			return pos, t.Offset - pos
+		}
+		pos = max(pos, t.Offset+t.Length)
+	}
+	if pos < state.TotalSize {
+		return pos, state.TotalSize - pos
+	}
+	return 0, 0
+}
+
+// verifySample compares a sample of the partial file against the same range
+// fetched from rawurl
+func verifySample(ctx context.Context, rawurl, destPath string, state *DownloadState, runtime *RuntimeConfig) error {
+	offset, length := downloadedRange(state)
+	if length == 0 {
+		return nil // Nothing downloaded yet, nothing to compare
+	}
+	length = min(length, replaceSampleSize)
+
+	f, err := os.Open(destPath + IncompleteSuffix)
+	if err != nil {
+		return fmt.Errorf("partial file missing: %w", err)
+	}
+	defer f.Close()
+	local := make([]byte, length)
+	if _, err := f.ReadAt(local, offset); err != nil {
+		return fmt.Errorf("failed to read partial file: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawurl, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", runtime.GetUserAgent())
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", offset, offset+length-1))
+
+	resp, err := probeClient(runtime).Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusPartialContent {
+		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+	remote := make([]byte, length)
+	if _, err := io.ReadFull(resp.Body, remote); err != nil {
+		return fmt.Errorf("failed to read sample: %w", err)
+	}
+
+	if !bytes.Equal(local, remote) {
+		return errors.New("the new URL serves different content than the data downloaded so far")
+	}
+	return nil
+}
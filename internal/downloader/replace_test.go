@@ -0,0 +1,146 @@
+package downloader
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/junaid2005p/surge/internal/config"
+	"github.com/junaid2005p/surge/internal/testutil"
+)
+
+func TestDownloadedRange(t *testing.T) {
+	tests := []struct {
+		name       string
+		tasks      []Task
+		wantOffset int64
+		wantLength int64
+	}{
+		{"nothing written", []Task{{0, 50}, {50, 50}}, 0, 0},
+		{"head written", []Task{{70, 30}, {40, 20}}, 0, 40},
+		{"gap between tasks", []Task{{0, 10}, {30, 70}}, 10, 20},
+		{"tail written", []Task{{0, 60}}, 60, 40},
+		{"overlapping tasks", []Task{{0, 40}, {20, 30}, {80, 20}}, 50, 30},
+	}
+	for _, tt := range tests {
+		offset, length := downloadedRange(&DownloadState{TotalSize: 100, Tasks: tt.tasks})
+		if offset != tt.wantOffset || length != tt.wantLength {
+			t.Errorf("%s: downloadedRange = %d, %d; want %d, %d", tt.name, offset, length, tt.wantOffset, tt.wantLength)
+		}
+	}
+}
+
+func TestReplaceURL(t *testing.T) {
+	if err := config.EnsureDirs(); err != nil {
+		t.Fatal(err)
+	}
+
+	data := randomBytes(t, 4*MB)
+	other := randomBytes(t, 4*MB)
+	half := int64(len(data) / 2)
+
+	// Links to /file expire halfway through; /other has the same size but different content
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		content := data
+		switch r.URL.Path {
+		case "/file":
+			if r.URL.Query().Get("sig") == "old" {
+				var start int64
+				if spec, ok := strings.CutPrefix(r.Header.Get("Range"), "bytes="); ok {
+					start, _ = strconv.ParseInt(strings.Split(spec, "-")[0], 10, 64)
+				}
+				if start >= half {
+					time.Sleep(300 * time.Millisecond) // Let the first half finish
+					http.Error(w, "signature expired", http.StatusForbidden)
+					return
+				}
+			}
+			w.Header().Set("ETag", `"v1"`)
+		case "/retagged":
+			w.Header().Set("ETag", `"v2"`)
+		case "/other":
+			content = other
+		case "/short":
+			content = data[:half]
+		default:
+			http.NotFound(w, r)
+			return
+		}
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	outDir, cleanup, err := testutil.TempDir("surge-replace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	oldURL := server.URL + "/file?sig=old"
+	runtime := &RuntimeConfig{MaxConnectionsPerHost: 4, MaxTaskRetries: 1}
+	cfg := DownloadConfig{
+		URL:        oldURL,
+		OutputPath: outDir,
+		ID:         "replace-test",
+		Filename:   "file.bin",
+		State:      NewProgressState("replace-test", 0),
+		Runtime:    runtime,
+	}
+	err = TUIDownload(ctx, cfg)
+	if !errors.Is(err, ErrLinkRejected) {
+		t.Fatalf("TUIDownload error = %v, want ErrLinkRejected", err)
+	}
+
+	destPath := filepath.Join(outDir, "file.bin")
+	state, err := LoadState(oldURL, destPath)
+	if err != nil {
+		t.Fatalf("progress not saved after the link was rejected: %v", err)
+	}
+	defer DeleteState(cfg.ID, server.URL+"/file?sig=new", destPath)
+	if state.Downloaded == 0 || state.ETag != `"v1"` {
+		t.Fatalf("saved state: downloaded %d, etag %q", state.Downloaded, state.ETag)
+	}
+
+	for _, bad := range []string{"/short", "/retagged", "/other", "/missing"} {
+		if err := ReplaceURL(ctx, oldURL, server.URL+bad, destPath, runtime); err == nil {
+			t.Errorf("ReplaceURL to %s should fail", bad)
+		}
+	}
+	if err := ReplaceURL(ctx, oldURL, oldURL, destPath, runtime); err == nil {
+		t.Error("ReplaceURL to the same URL should fail")
+	}
+
+	newURL := server.URL + "/file?sig=new"
+	if err := ReplaceURL(ctx, oldURL, newURL, destPath, runtime); err != nil {
+		t.Fatalf("ReplaceURL failed: %v", err)
+	}
+	if _, err := LoadState(oldURL, destPath); err == nil {
+		t.Error("state for the old URL should be removed")
+	}
+	moved, err := LoadState(newURL, destPath)
+	if err != nil || moved.URL != newURL || moved.Downloaded != state.Downloaded {
+		t.Fatalf("state for the new URL = %+v, %v", moved, err)
+	}
+
+	// Resume from the new URL with the existing progress
+	cfg.URL, cfg.DestPath, cfg.IsResume = newURL, destPath, true
+	cfg.State = NewProgressState("replace-test", 0)
+	if err := TUIDownload(ctx, cfg); err != nil {
+		t.Fatalf("resume from the new URL failed: %v", err)
+	}
+	got, err := os.ReadFile(destPath)
+	if err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("content mismatch after resume (err %v)", err)
+	}
+}
@@ -0,0 +1,224 @@
+package downloader
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/junaid2005p/surge/internal/config"
+	"github.com/junaid2005p/surge/internal/messages"
+	"github.com/junaid2005p/surge/internal/utils"
+)
+
+// defaultResolverTimeout bounds how long a resolver plugin may run
+const defaultResolverTimeout = 60 * time.Second
+
+// resolverItemPrefix starts the URL fragment that picks one file of a
+// multi-file resolver result. Fragments are never sent to servers, so the
+// URL still resolves, while each file gets its own resume state.
+const resolverItemPrefix = "surge-item="
+
+// resolverOutput is the JSON a resolver plugin prints on stdout
+type resolverOutput struct {
+	Files []resolvedFile `json:"files"`
+}
+
+// resolvedFile is one direct download returned by a resolver plugin
+type resolvedFile struct {
+	URL      string            `json:"url"`
+	Filename string            `json:"filename,omitempty"`
+	Headers  map[string]string `json:"headers,omitempty"`
+	Cookies  map[string]string `json:"cookies,omitempty"`
+}
+
+// header returns the request headers for the file, cookies included
+func (f resolvedFile) header() http.Header {
+	h := make(http.Header)
+	for k, v := range f.Headers {
+		h.Set(k, v)
+	}
+	if len(f.Cookies) > 0 {
+		names := make([]string, 0, len(f.Cookies))
+		for name := range f.Cookies {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		cookies := make([]string, len(names))
+		for i, name := range names {
+			cookies[i] = (&http.Cookie{Name: name, Value: f.Cookies[name]}).String()
+		}
+		h.Set("Cookie", strings.Join(cookies, "; "))
+	}
+	return h
+}
+
+// hostHeaders are resolver headers for the requests a stream makes to the
+// host of its playlist or manifest. They often carry credentials, so requests
+// to other hosts it points to go without them. A nil *hostHeaders adds none.
+type hostHeaders struct {
+	host    string
+	headers http.Header
+}
+
+// newHostHeaders returns the headers for requests to the host of rawurl, or
+// nil if there are none
+func newHostHeaders(rawurl string, headers http.Header) *hostHeaders {
+	u, err := url.Parse(rawurl)
+	if err != nil || len(headers) == 0 {
+		return nil
+	}
+	return &hostHeaders{host: u.Host, headers: headers}
+}
+
+// forURL returns the headers to send with a request for rawurl
+func (h *hostHeaders) forURL(rawurl string) http.Header {
+	if h == nil {
+		return nil
+	}
+	if u, err := url.Parse(rawurl); err != nil || !strings.EqualFold(u.Host, h.host) {
+		return nil
+	}
+	return h.headers
+}
+
+// authorize adds the headers to req; see SegmentDownloader.Authorize
+func (h *hostHeaders) authorize(req *http.Request) error {
+	applyHeaders(req, h.forURL(req.URL.String()))
+	return nil
+}
+
+// applyHeaders sets headers on req, replacing any existing values
+func applyHeaders(req *http.Request, headers http.Header) {
+	for k, v := range headers {
+		req.Header[k] = v
+	}
+}
+
+// resolverItemURL returns rawurl pointing at file i of its resolver result
+func resolverItemURL(rawurl string, i int) string {
+	base, _ := splitResolverItem(rawurl)
+	return base + "#" + resolverItemPrefix + strconv.Itoa(i)
+}
+
+// splitResolverItem separates the file index added by resolverItemURL from
+// rawurl. The index is -1 if rawurl names no particular file.
+func splitResolverItem(rawurl string) (string, int) {
+	base, fragment, ok := strings.Cut(rawurl, "#"+resolverItemPrefix)
+	if !ok {
+		return rawurl, -1
+	}
+	i, err := strconv.Atoi(fragment)
+	if err != nil || i < 0 {
+		return rawurl, -1
+	}
+	return base, i
+}
+
+// runResolver runs a resolver plugin on rawurl and parses its output
+func runResolver(ctx context.Context, r config.Resolver, rawurl string) ([]resolvedFile, error) {
+	timeout := defaultResolverTimeout
+	if r.Timeout > 0 {
+		timeout = time.Duration(r.Timeout) * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	name := r.Name
+	if name == "" {
+		name = r.Command
+	}
+	utils.Debug("Resolving %s with %s", rawurl, name)
+
+	out, err := exec.CommandContext(ctx, r.Command, append(r.Args, rawurl)...).Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			if msg := strings.TrimSpace(string(exitErr.Stderr)); msg != "" {
+				lines := strings.Split(msg, "\n")
+				err = fmt.Errorf("%w: %s", err, lines[len(lines)-1])
+			}
+		}
+		return nil, fmt.Errorf("resolver %s failed: %w", name, err)
+	}
+
+	var result resolverOutput
+	if err := json.Unmarshal(out, &result); err != nil {
+		return nil, fmt.Errorf("resolver %s returned invalid JSON: %w", name, err)
+	}
+	if len(result.Files) == 0 {
+		return nil, fmt.Errorf("resolver %s returned no files for %s", name, rawurl)
+	}
+	for _, f := range result.Files {
+		u, err := url.Parse(f.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("resolver %s returned an invalid url: %q", name, f.URL)
+		}
+	}
+	return result.Files, nil
+}
+
+// resolveSource runs the first configured resolver plugin matching rawurl and
+// returns the direct downloads it found, or nil if no resolver matches. If
+// rawurl names one file of a multi-file result, only that file is returned.
+// Resolvers run on every start and resume, so expired direct URLs are replaced.
+func resolveSource(ctx context.Context, rawurl string) ([]resolvedFile, error) {
+	base, item := splitResolverItem(rawurl)
+	r, err := matchResolver(base)
+	if r == nil || err != nil {
+		return nil, err
+	}
+
+	files, err := runResolver(ctx, *r, base)
+	if err != nil {
+		return nil, err
+	}
+	if item < 0 {
+		return files, nil
+	}
+	if item >= len(files) {
+		return nil, fmt.Errorf("resolver result for %s no longer has file %d", base, item+1)
+	}
+	return files[item : item+1], nil
+}
+
+// matchResolver returns the first configured resolver plugin matching
+// rawurl, or nil if there is none
+func matchResolver(rawurl string) (*config.Resolver, error) {
+	base, _ := splitResolverItem(rawurl)
+	if u, err := url.Parse(base); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, nil
+	}
+
+	resolvers, err := config.LoadResolvers()
+	if err != nil {
+		return nil, err
+	}
+	for i := range resolvers {
+		if resolvers[i].Matches(base) {
+			return &resolvers[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// queueResolvedFiles queues each file of a multi-file resolver result as its
+// own download. The queued URLs stay resolvable (see resolverItemURL).
+func queueResolvedFiles(cfg DownloadConfig, files []resolvedFile) error {
+	if len(files) > maxDiscoveredFiles {
+		return fmt.Errorf("resolver returned more than %d files", maxDiscoveredFiles)
+	}
+	discovered := make([]messages.DiscoveredFile, len(files))
+	for i := range files {
+		discovered[i] = messages.DiscoveredFile{URL: resolverItemURL(cfg.URL, i), OutputPath: cfg.OutputPath}
+	}
+	return queueDiscoveredFiles(cfg, discovered)
+}
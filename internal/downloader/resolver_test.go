@@ -0,0 +1,285 @@
+package downloader
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/junaid2005p/surge/internal/config"
+	"github.com/junaid2005p/surge/internal/messages"
+	"github.com/junaid2005p/surge/internal/testutil"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// resolverFixture is a media server whose links expire every time the
+// resolver script runs, plus the script itself configured for video.example
+type resolverFixture struct {
+	server *httptest.Server
+	files  map[string][]byte
+	count  string // File where the script counts its runs; the count is the only valid token
+}
+
+// runs returns how often the resolver script has run
+func (f *resolverFixture) runs() int {
+	data, _ := os.ReadFile(f.count)
+	n, _ := strconv.Atoi(strings.TrimSpace(string(data)))
+	return n
+}
+
+func startResolverFixture(t *testing.T) *resolverFixture {
+	t.Helper()
+	if runtime.GOOS != "linux" {
+		t.Skip("relies on XDG_CONFIG_HOME and a shell script resolver")
+	}
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	if err := config.EnsureDirs(); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	f := &resolverFixture{count: filepath.Join(dir, "count"), files: map[string][]byte{
+		"a.bin": randomBytes(t, 2*MB),
+		"b.bin": randomBytes(t, 48*KB),
+	}}
+	for i := 0; i < 3; i++ {
+		f.files[fmt.Sprintf("seg%d.ts", i)] = randomBytes(t, 16*KB)
+	}
+	f.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Referer") != "https://video.example/" || !strings.Contains(r.Header.Get("Cookie"), "session=abc") {
+			http.Error(w, "missing headers", http.StatusForbidden)
+			return
+		}
+		if r.URL.Query().Get("token") != strconv.Itoa(f.runs()) {
+			http.Error(w, "link expired", http.StatusForbidden)
+			return
+		}
+		if r.URL.Path == "/media/show.m3u8" {
+			// Segments carry the token too, and need the same headers
+			w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
+			fmt.Fprint(w, "#EXTM3U\n#EXT-X-TARGETDURATION:4\n")
+			for i := 0; i < 3; i++ {
+				fmt.Fprintf(w, "#EXTINF:4,\nseg%d.ts?token=%s\n", i, r.URL.Query().Get("token"))
+			}
+			fmt.Fprint(w, "#EXT-X-ENDLIST\n")
+			return
+		}
+		data, ok := f.files[strings.TrimPrefix(r.URL.Path, "/media/")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(data))
+	}))
+	t.Cleanup(f.server.Close)
+
+	// The script bumps a counter (the token) and prints one or two files
+	script := filepath.Join(dir, "resolve.sh")
+	entry := `{"url":"%s/media/%%s?token='"$n"'","filename":"%%s","headers":{"Referer":"https://video.example/"},"cookies":{"session":"abc"}}`
+	entry = fmt.Sprintf(entry, f.server.URL)
+	body := fmt.Sprintf(`#!/bin/sh
+count="%s"
+n=$(cat "$count" 2>/dev/null || echo 0)
+n=$((n + 1))
+echo $n > "$count"
+case "$1" in
+*unavailable*) echo "resolving..." >&2; echo "ERROR: video unavailable" >&2; exit 1 ;;
+*playlist*) printf '{"files":[%s,%s]}' a.bin first.bin b.bin second.bin ;;
+*stream*) printf '{"files":[%s]}' show.m3u8 show.ts ;;
+*) printf '{"files":[%s]}' a.bin video.bin ;;
+esac
+`, f.count, entry, entry, entry, entry)
+	if err := os.WriteFile(script, []byte(body), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	resolvers := fmt.Sprintf(`[{"name":"test","command":%q,"hosts":["video.example"]}]`, script)
+	if err := os.WriteFile(config.GetResolversPath(), []byte(resolvers), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func TestResolverItemURL(t *testing.T) {
+	u := resolverItemURL("https://video.example/list?id=1", 3)
+	if u != "https://video.example/list?id=1#surge-item=3" {
+		t.Errorf("resolverItemURL = %q", u)
+	}
+	if base, i := splitResolverItem(u); base != "https://video.example/list?id=1" || i != 3 {
+		t.Errorf("splitResolverItem(%q) = %q, %d", u, base, i)
+	}
+	if again := resolverItemURL(u, 4); again != "https://video.example/list?id=1#surge-item=4" {
+		t.Errorf("resolverItemURL on an item URL = %q", again)
+	}
+	if base, i := splitResolverItem("https://a.example/page#section"); base != "https://a.example/page#section" || i != -1 {
+		t.Errorf("splitResolverItem without item = %q, %d", base, i)
+	}
+}
+
+func TestResolvedFileHeader(t *testing.T) {
+	f := resolvedFile{
+		Headers: map[string]string{"referer": "https://video.example/", "User-Agent": "yt-dlp"},
+		Cookies: map[string]string{"b": "2", "a": "1"},
+	}
+	h := f.header()
+	if h.Get("Referer") != "https://video.example/" || h.Get("User-Agent") != "yt-dlp" {
+		t.Errorf("headers = %v", h)
+	}
+	if got := h.Get("Cookie"); got != "a=1; b=2" {
+		t.Errorf("Cookie = %q, want %q", got, "a=1; b=2")
+	}
+}
+
+func TestTUIDownload_Resolver(t *testing.T) {
+	f := startResolverFixture(t)
+
+	outDir, cleanup, err := testutil.TempDir("surge-resolver")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	// Single file: downloaded from the direct URL under the suggested name
+	progressCh := make(chan tea.Msg, ProgressChannelBuffer)
+	cfg := DownloadConfig{
+		URL:        "https://video.example/watch?v=1",
+		OutputPath: outDir,
+		ID:         "resolved",
+		ProgressCh: progressCh,
+		State:      NewProgressState("resolved", 0),
+		Runtime:    &RuntimeConfig{MaxConnectionsPerHost: 4},
+	}
+	if err := TUIDownload(ctx, cfg); err != nil {
+		t.Fatalf("resolved download failed: %v", err)
+	}
+	close(progressCh)
+	for msg := range progressCh {
+		if m, ok := msg.(messages.DownloadStartedMsg); ok && m.URL != cfg.URL {
+			t.Errorf("progress should be reported for the landing page URL, got %q", m.URL)
+		}
+	}
+	data, err := os.ReadFile(filepath.Join(outDir, "video.bin"))
+	if err != nil || !bytes.Equal(data, f.files["a.bin"]) {
+		t.Fatalf("video.bin content mismatch (err %v)", err)
+	}
+
+	// Multiple files: each is queued under an item URL that resolves again
+	progressCh = make(chan tea.Msg, ProgressChannelBuffer)
+	cfg.URL, cfg.ID, cfg.ProgressCh = "https://www.video.example/playlist?list=1", "playlist", progressCh
+	if err := TUIDownload(ctx, cfg); err != nil {
+		t.Fatalf("resolving playlist failed: %v", err)
+	}
+	close(progressCh)
+	var discovered []messages.DiscoveredFile
+	for msg := range progressCh {
+		if m, ok := msg.(messages.DownloadsDiscoveredMsg); ok {
+			discovered = append(discovered, m.Files...)
+		}
+	}
+	if len(discovered) != 2 || discovered[1].URL != cfg.URL+"#surge-item=1" {
+		t.Fatalf("discovered = %+v", discovered)
+	}
+
+	runsBefore := f.runs()
+	for i, d := range discovered {
+		fileCfg := DownloadConfig{
+			URL:        d.URL,
+			OutputPath: d.OutputPath,
+			ID:         fmt.Sprintf("item-%d", i),
+			State:      NewProgressState("item", 0),
+			Runtime:    &RuntimeConfig{MaxConnectionsPerHost: 4},
+		}
+		if err := TUIDownload(ctx, fileCfg); err != nil {
+			t.Fatalf("download of %s failed: %v", d.URL, err)
+		}
+	}
+	if runs := f.runs() - runsBefore; runs != 2 {
+		t.Errorf("resolver ran %d times for the queued items, want 2", runs)
+	}
+	for name, want := range map[string][]byte{"first.bin": f.files["a.bin"], "second.bin": f.files["b.bin"]} {
+		data, err := os.ReadFile(filepath.Join(outDir, name))
+		if err != nil || !bytes.Equal(data, want) {
+			t.Errorf("%s content mismatch (err %v)", name, err)
+		}
+	}
+}
+
+func TestTUIDownload_ResolverHLS(t *testing.T) {
+	f := startResolverFixture(t)
+
+	outDir, cleanup, err := testutil.TempDir("surge-resolver-hls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	// The playlist and every segment need the resolver's cookie and Referer
+	cfg := DownloadConfig{
+		URL:        "https://video.example/stream?v=1",
+		OutputPath: outDir,
+		ID:         "resolved-hls",
+		State:      NewProgressState("resolved-hls", 0),
+		Runtime:    &RuntimeConfig{MaxConnectionsPerHost: 2},
+	}
+	if err := TUIDownload(ctx, cfg); err != nil {
+		t.Fatalf("resolved HLS download failed: %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(outDir, "show.ts"))
+	want := bytes.Join([][]byte{f.files["seg0.ts"], f.files["seg1.ts"], f.files["seg2.ts"]}, nil)
+	if err != nil || !bytes.Equal(data, want) {
+		t.Fatalf("show.ts content mismatch (err %v)", err)
+	}
+}
+
+func TestHostHeaders(t *testing.T) {
+	h := newHostHeaders("https://cdn.example.com/show.m3u8", http.Header{"Cookie": {"session=abc"}})
+	if got := h.forURL("https://CDN.example.com/seg1.ts"); got.Get("Cookie") != "session=abc" {
+		t.Errorf("same host headers = %v", got)
+	}
+	if got := h.forURL("https://ads.example.net/seg1.ts"); got != nil {
+		t.Errorf("headers sent to another host: %v", got)
+	}
+	if newHostHeaders("https://cdn.example.com/show.m3u8", nil) != nil {
+		t.Error("no headers should give a nil *hostHeaders")
+	}
+	var none *hostHeaders
+	if none.forURL("https://cdn.example.com/a") != nil {
+		t.Error("nil *hostHeaders should add no headers")
+	}
+}
+
+func TestTUIDownload_ResolverError(t *testing.T) {
+	startResolverFixture(t)
+
+	outDir, cleanup, err := testutil.TempDir("surge-resolver")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	cfg := DownloadConfig{
+		URL:        "https://video.example/watch?v=unavailable",
+		OutputPath: outDir,
+		ID:         "unavailable",
+		State:      NewProgressState("unavailable", 0),
+	}
+	err = TUIDownload(context.Background(), cfg)
+	if err == nil || !strings.Contains(err.Error(), "ERROR: video unavailable") {
+		t.Errorf("TUIDownload error = %v, want the resolver's last stderr line", err)
+	}
+}
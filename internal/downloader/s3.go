@@ -0,0 +1,528 @@
+package downloader
+
+import (
+	"bufio"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/junaid2005p/surge/internal/config"
+	"github.com/junaid2005p/surge/internal/messages"
+	"github.com/junaid2005p/surge/internal/utils"
+)
+
+// S3Scheme is the URL scheme handled by the S3 backend (s3://bucket/key)
+const S3Scheme = "s3"
+
+// s3CredentialHost is the credential store entry used when no entry matches the endpoint host
+const s3CredentialHost = "s3"
+
+// emptyPayloadHash is the SHA-256 of an empty body, sent with every (bodyless) S3 request
+const emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// isS3URL reports whether rawurl uses the s3:// scheme
+func isS3URL(rawurl string) bool {
+	u, err := url.Parse(rawurl)
+	return err == nil && strings.EqualFold(u.Scheme, S3Scheme)
+}
+
+// parseS3URL splits s3://bucket/key into bucket and key
+func parseS3URL(rawurl string) (bucket, key string, err error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid s3 url: %w", err)
+	}
+	if u.Host == "" {
+		return "", "", fmt.Errorf("s3 url has no bucket: %s", rawurl)
+	}
+	return u.Host, strings.TrimPrefix(u.Path, "/"), nil
+}
+
+// s3ObjectURL builds the s3:// URL of an object
+func s3ObjectURL(bucket, key string) string {
+	u := url.URL{Scheme: S3Scheme, Host: bucket, Path: "/" + key}
+	return u.String()
+}
+
+// s3Credentials are the AWS keys used to sign requests. The zero value sends unsigned requests.
+type s3Credentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+}
+
+func (c s3Credentials) anonymous() bool {
+	return c.AccessKeyID == "" || c.SecretAccessKey == ""
+}
+
+// loadS3Credentials looks for credentials in the environment, then the shared
+// AWS credentials file, then the Surge credential store (by endpoint host, then "s3")
+func loadS3Credentials(endpointHost string) s3Credentials {
+	env := s3Credentials{
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}
+	if !env.anonymous() {
+		return env
+	}
+
+	if shared, err := loadSharedS3Credentials(); err == nil && !shared.anonymous() {
+		return shared
+	} else if err != nil && !os.IsNotExist(err) {
+		utils.Debug("Reading shared AWS credentials: %v", err)
+	}
+
+	if c := config.LookupCredential(endpointHost, s3CredentialHost); c != nil {
+		return s3Credentials{AccessKeyID: c.Username, SecretAccessKey: c.Password, SessionToken: c.Token}
+	}
+
+	utils.Debug("No S3 credentials found, sending unsigned requests")
+	return s3Credentials{}
+}
+
+// loadSharedS3Credentials reads the $AWS_PROFILE (or default) profile from
+// $AWS_SHARED_CREDENTIALS_FILE or ~/.aws/credentials
+func loadSharedS3Credentials() (s3Credentials, error) {
+	file := os.Getenv("AWS_SHARED_CREDENTIALS_FILE")
+	if file == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return s3Credentials{}, err
+		}
+		file = filepath.Join(home, ".aws", "credentials")
+	}
+	profile := os.Getenv("AWS_PROFILE")
+	if profile == "" {
+		profile = "default"
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return s3Credentials{}, err
+	}
+	defer f.Close()
+
+	var creds s3Credentials
+	section := ""
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			continue
+		}
+		if section != profile {
+			continue
+		}
+		name, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "aws_access_key_id":
+			creds.AccessKeyID = value
+		case "aws_secret_access_key":
+			creds.SecretAccessKey = value
+		case "aws_session_token":
+			creds.SessionToken = value
+		}
+	}
+	return creds, scanner.Err()
+}
+
+// s3Client sends signed requests to an S3-compatible endpoint
+type s3Client struct {
+	endpoint  *url.URL // Scheme and host of the service, without the bucket
+	aws       bool     // Default AWS endpoint (virtual-hosted buckets unless path-style is forced)
+	region    string
+	pathStyle bool
+	creds     s3Credentials
+	userAgent string
+	http      *http.Client
+}
+
+// newS3Client configures a client from the runtime settings; httpClient is used for all requests
+func newS3Client(runtime *RuntimeConfig, httpClient *http.Client) (*s3Client, error) {
+	c := &s3Client{
+		region:    runtime.GetS3Region(),
+		pathStyle: runtime.GetS3PathStyle(),
+		userAgent: runtime.GetUserAgent(),
+		http:      httpClient,
+	}
+
+	if endpoint := runtime.GetS3Endpoint(); endpoint != "" {
+		if !strings.Contains(endpoint, "://") {
+			endpoint = "https://" + endpoint
+		}
+		u, err := url.Parse(endpoint)
+		if err != nil || u.Host == "" {
+			return nil, fmt.Errorf("invalid s3 endpoint %q", endpoint)
+		}
+		c.endpoint = &url.URL{Scheme: u.Scheme, Host: u.Host}
+	} else {
+		c.endpoint = &url.URL{Scheme: "https", Host: "s3." + c.region + ".amazonaws.com"}
+		c.aws = true
+	}
+
+	c.creds = loadS3Credentials(c.endpoint.Host)
+	return c, nil
+}
+
+// requestURL addresses key in bucket, path-style or virtual-hosted
+func (c *s3Client) requestURL(bucket, key string, query url.Values) *url.URL {
+	u := *c.endpoint
+	// Dotted bucket names don't match the endpoint's wildcard certificate
+	if c.pathStyle || !c.aws || strings.Contains(bucket, ".") {
+		u.Path = "/" + bucket + "/" + key
+	} else {
+		u.Host = bucket + "." + u.Host
+		u.Path = "/" + key
+	}
+	u.RawPath = s3Escape(u.Path, false)
+	u.RawQuery = s3CanonicalQuery(query)
+	return &u
+}
+
+// newRequest creates an unsigned request for key in bucket
+func (c *s3Client) newRequest(ctx context.Context, method, bucket, key string, query url.Values) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.requestURL(bucket, key, query).String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", c.userAgent)
+	return req, nil
+}
+
+// do signs req (freshly, so retried and ranged requests each get their own signature) and sends it
+func (c *s3Client) do(req *http.Request) (*http.Response, error) {
+	if !c.creds.anonymous() {
+		signS3Request(req, c.creds, c.region, time.Now())
+	}
+	return c.http.Do(req)
+}
+
+// s3Error is the XML error body returned by S3
+type s3Error struct {
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+// s3ResponseError describes a failed S3 response, using the error body when there is one
+func s3ResponseError(op string, resp *http.Response) error {
+	var e s3Error
+	if resp.Body != nil && xml.NewDecoder(io.LimitReader(resp.Body, 64*KB)).Decode(&e) == nil && e.Code != "" {
+		return fmt.Errorf("s3 %s: %s (%d): %s", op, e.Code, resp.StatusCode, e.Message)
+	}
+	return fmt.Errorf("s3 %s: unexpected status code: %d", op, resp.StatusCode)
+}
+
+// signS3Request adds AWS Signature Version 4 headers to req. The host, range
+// and x-amz-* headers are signed; the body is assumed to be empty.
+func signS3Request(req *http.Request, creds s3Credentials, region string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", emptyPayloadHash)
+	if creds.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.SessionToken)
+	}
+
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	headers := map[string]string{"host": host}
+	for name, values := range req.Header {
+		lower := strings.ToLower(name)
+		if lower == "range" || strings.HasPrefix(lower, "x-amz-") {
+			headers[lower] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		s3CanonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		emptyPayloadHash,
+	}, "\n")
+
+	scope := date + "/" + region + "/s3/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+creds.SecretAccessKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		creds.AccessKeyID, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// s3Escape percent-encodes everything but RFC 3986 unreserved characters
+// (and '/', unless encodeSlash is set), as SigV4 requires
+func s3Escape(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if ('A' <= c && c <= 'Z') || ('a' <= c && c <= 'z') || ('0' <= c && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~' || (c == '/' && !encodeSlash) {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// s3CanonicalQuery encodes query sorted by key and value
+func s3CanonicalQuery(query url.Values) string {
+	pairs := make([]string, 0, len(query))
+	for k, values := range query {
+		for _, v := range values {
+			pairs = append(pairs, s3Escape(k, true)+"="+s3Escape(v, true))
+		}
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, "&")
+}
+
+// probeS3 reads the object's size with a HEAD request. Prefixes (keys that
+// are empty, end in '/' or only exist as a "folder") are reported with IsCollection set.
+func probeS3(ctx context.Context, rawurl, filenameHint string, runtime *RuntimeConfig) (*ProbeResult, error) {
+	bucket, key, err := parseS3URL(rawurl)
+	if err != nil {
+		return nil, err
+	}
+	if key == "" || strings.HasSuffix(key, "/") {
+		return &ProbeResult{IsCollection: true}, nil
+	}
+
+	client, err := newS3Client(runtime, probeClient(runtime))
+	if err != nil {
+		return nil, err
+	}
+
+	probeCtx, cancel := context.WithTimeout(ctx, ProbeTimeout)
+	defer cancel()
+
+	req, err := client.newRequest(probeCtx, http.MethodHead, bucket, key, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create s3 request: %w", err)
+	}
+	resp, err := client.do(req)
+	if err != nil {
+		return nil, fmt.Errorf("s3 HEAD %s failed: %w", rawurl, err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		// s3://bucket/dir without the trailing slash
+		if keys, err := listS3Objects(ctx, client, bucket, key+"/", 1); err == nil && len(keys) > 0 {
+			return &ProbeResult{IsCollection: true}, nil
+		}
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("s3 HEAD %s: unexpected status code: %d", rawurl, resp.StatusCode)
+	}
+
+	result := &ProbeResult{
+		SupportsRange: true,
+		ContentType:   resp.Header.Get("Content-Type"),
+		Filename:      filenameHint,
+	}
+	result.FileSize, _ = strconv.ParseInt(resp.Header.Get("Content-Length"), 10, 64)
+	if result.Filename == "" {
+		result.Filename = path.Base(key)
+	}
+
+	utils.Debug("S3 probe complete - filename: %s, size: %d", result.Filename, result.FileSize)
+	return result, nil
+}
+
+// s3ListResult is the body of a ListObjectsV2 response
+type s3ListResult struct {
+	Contents []struct {
+		Key  string `xml:"Key"`
+		Size int64  `xml:"Size"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+// listS3Objects returns the keys of all objects under prefix (ListObjectsV2), up to limit
+func listS3Objects(ctx context.Context, client *s3Client, bucket, prefix string, limit int) ([]string, error) {
+	var keys []string
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}}
+		if prefix != "" {
+			query.Set("prefix", prefix)
+		}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+
+		req, err := client.newRequest(ctx, http.MethodGet, bucket, "", query)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create s3 request: %w", err)
+		}
+		resp, err := client.do(req)
+		if err != nil {
+			return nil, fmt.Errorf("s3 list %s/%s failed: %w", bucket, prefix, err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			err := s3ResponseError("list "+bucket+"/"+prefix, resp)
+			resp.Body.Close()
+			return nil, err
+		}
+
+		var page s3ListResult
+		err = xml.NewDecoder(&limitedReader{r: resp.Body, n: maxPlaylistSize}).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("invalid s3 list response: %w", err)
+		}
+
+		for _, obj := range page.Contents {
+			if strings.HasSuffix(obj.Key, "/") { // Folder placeholder
+				continue
+			}
+			keys = append(keys, obj.Key)
+			if len(keys) >= limit {
+				return keys, nil
+			}
+		}
+
+		if !page.IsTruncated || page.NextContinuationToken == "" {
+			return keys, nil
+		}
+		token = page.NextContinuationToken
+	}
+}
+
+// s3DiscoveredFiles maps keys under prefix to downloads that recreate the
+// layout under outputPath/<last prefix component or bucket>/
+func s3DiscoveredFiles(bucket, prefix, outputPath string, keys []string) []messages.DiscoveredFile {
+	rootName := path.Base(strings.TrimSuffix(prefix, "/"))
+	if prefix == "" || rootName == "." || rootName == "/" {
+		rootName = bucket
+	}
+	localRoot := filepath.Join(outputPath, rootName)
+
+	files := make([]messages.DiscoveredFile, 0, len(keys))
+	for _, key := range keys {
+		// Clean against a virtual root so ".." in a key can't escape localRoot
+		rel := path.Clean("/" + strings.TrimPrefix(key, prefix))
+		files = append(files, messages.DiscoveredFile{
+			URL:        s3ObjectURL(bucket, key),
+			OutputPath: filepath.Join(localRoot, filepath.FromSlash(path.Dir(rel))),
+		})
+	}
+	return files
+}
+
+// queueS3Prefix lists every object under the prefix and queues each as its own download
+func queueS3Prefix(ctx context.Context, cfg DownloadConfig) error {
+	bucket, prefix, err := parseS3URL(cfg.URL)
+	if err != nil {
+		return err
+	}
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+
+	client, err := newS3Client(cfg.Runtime, probeClient(cfg.Runtime))
+	if err != nil {
+		return err
+	}
+	keys, err := listS3Objects(ctx, client, bucket, prefix, maxDiscoveredFiles+1)
+	if err != nil {
+		return err
+	}
+	if len(keys) == 0 {
+		return fmt.Errorf("no objects under %s", cfg.URL)
+	}
+	if len(keys) > maxDiscoveredFiles {
+		return fmt.Errorf("s3 prefix has more than %d objects", maxDiscoveredFiles)
+	}
+
+	return queueDiscoveredFiles(cfg, s3DiscoveredFiles(bucket, prefix, cfg.OutputPath, keys))
+}
+
+// downloadS3 downloads an object with ranged GETs, each signed on its own
+func downloadS3(ctx context.Context, cfg DownloadConfig, destPath string, fileSize int64) error {
+	bucket, key, err := parseS3URL(cfg.URL)
+	if err != nil {
+		return err
+	}
+
+	if fileSize == 0 {
+		return os.WriteFile(destPath, nil, 0644)
+	}
+
+	client, err := newS3Client(cfg.Runtime, newDownloadClient(cfg.Runtime))
+	if err != nil {
+		return err
+	}
+
+	d := NewConcurrentDownloader(cfg.ID, cfg.ProgressCh, cfg.State, cfg.Runtime)
+	d.Opener = func(ctx context.Context, offset, length int64) (io.ReadCloser, error) {
+		req, err := client.newRequest(ctx, http.MethodGet, bucket, key, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", offset, offset+length-1))
+
+		resp, err := client.do(req)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusPartialContent {
+			err := s3ResponseError("GET "+cfg.URL, resp)
+			resp.Body.Close()
+			return nil, err
+		}
+		return resp.Body, nil
+	}
+	return d.Download(ctx, cfg.URL, destPath, fileSize, cfg.Verbose)
+}
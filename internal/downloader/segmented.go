@@ -0,0 +1,663 @@
+package downloader
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/junaid2005p/surge/internal/utils"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// maxSegmentWorkers caps concurrent segment requests. Segments are small, so
+// beyond this extra connections mostly add load on the origin.
+const maxSegmentWorkers = 8
+
+// Segment is one separately fetched piece of a segmented stream (HLS, DASH)
+// or of a large blob (OCI layers)
+type Segment struct {
+	URL    string
+	Offset int64 // Start of the byte range within URL
+	Length int64 // Byte range length, 0 fetches the whole resource
+
+	// Decrypt transforms the fetched bytes before they are written (nil for clear segments)
+	Decrypt func(ctx context.Context, data []byte) ([]byte, error)
+}
+
+// rangedSegments splits a resource of size bytes into ranged segments of
+// chunkSize, or returns it as one segment if its size is unknown
+func rangedSegments(rawurl string, size, chunkSize int64) []Segment {
+	if size <= 0 {
+		return []Segment{{URL: rawurl}}
+	}
+	segs := make([]Segment, 0, (size+chunkSize-1)/chunkSize)
+	for off := int64(0); off < size; off += chunkSize {
+		segs = append(segs, Segment{URL: rawurl, Offset: off, Length: min(chunkSize, size-off)})
+	}
+	return segs
+}
+
+// SegmentTrack is one output file assembled, in order, from a list of segments
+type SegmentTrack struct {
+	Source   string // Identifies the rendition across pause/resume (playlist URL, representation ID)
+	DestPath string
+	Segments []Segment
+	SHA256   string // Expected hex digest of the assembled file, checked before it is moved into place
+}
+
+// SegmentDownloader fetches the segments of one or more tracks concurrently
+// and joins each track into its own output file
+type SegmentDownloader struct {
+	ProgressChan chan<- tea.Msg // Channel for events (start/complete/error)
+	ID           string         // Download ID
+	State        *ProgressState // Shared state for TUI polling
+	Runtime      *RuntimeConfig
+
+	// Authorize, when set, adds credentials to every segment request (e.g. a registry bearer token)
+	Authorize func(req *http.Request) error
+
+	// SizeKnown marks the size passed to Download as exact, so it is not re-estimated from fetched segments
+	SizeKnown bool
+}
+
+// NewSegmentDownloader creates a new segment downloader with all required parameters
+func NewSegmentDownloader(id string, progressCh chan<- tea.Msg, state *ProgressState, runtime *RuntimeConfig) *SegmentDownloader {
+	return &SegmentDownloader{
+		ID:           id,
+		ProgressChan: progressCh,
+		State:        state,
+		Runtime:      runtime,
+	}
+}
+
+// segmentJob addresses one segment of one track
+type segmentJob struct {
+	track int
+	index int
+}
+
+// trackWriter appends a track's finished segments to its working file. Finished
+// segments land in a parts directory next to the working file and are appended
+// as soon as every earlier segment of the track is present.
+type trackWriter struct {
+	track    *SegmentTrack
+	file     *os.File
+	partsDir string
+	next     int           // Next segment to append
+	written  int64         // Bytes appended so far
+	ready    map[int]int64 // Fetched but not yet appended segments and their sizes
+}
+
+// appendReady appends the contiguous run of fetched segments starting at next
+func (w *trackWriter) appendReady() error {
+	for {
+		size, ok := w.ready[w.next]
+		if !ok {
+			return nil
+		}
+		if err := appendSegmentPart(w.file, segmentPartPath(w.partsDir, w.next)); err != nil {
+			return err
+		}
+		delete(w.ready, w.next)
+		w.written += size
+		w.next++
+	}
+}
+
+func (w *trackWriter) done() bool {
+	return w.next == len(w.track.Segments)
+}
+
+// Download fetches all tracks. destPath keys the saved state; the progress of
+// every track is stored in it, so a resume continues each rendition where it stopped.
+func (d *SegmentDownloader) Download(ctx context.Context, rawurl, destPath string, tracks []SegmentTrack, estimatedSize int64) error {
+	utils.Debug("SegmentDownloader.Download: %s -> %s (%d tracks)", rawurl, destPath, len(tracks))
+
+	// Create cancellable context for pause support
+	downloadCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	if d.State != nil {
+		d.State.CancelFunc = cancel
+	}
+
+	saved := make(map[string]StreamProgress)
+	if state, err := LoadState(rawurl, destPath); err == nil {
+		for _, sp := range state.Streams {
+			saved[sp.Source] = sp
+		}
+	}
+
+	var (
+		writers      []*trackWriter
+		pending      []segmentJob
+		totalCount   int
+		fetchedCount int
+		fetchedBytes int64
+	)
+	for t := range tracks {
+		track := &tracks[t]
+		if len(track.Segments) == 0 {
+			return fmt.Errorf("stream %s has no segments", track.Source)
+		}
+
+		w, err := openTrackWriter(track, saved[track.Source])
+		if err != nil {
+			return err
+		}
+		defer w.file.Close()
+		writers = append(writers, w)
+
+		// Segments finished before a pause but not yet appended are reused
+		fetchedBytes += w.written
+		for i := w.next; i < len(track.Segments); i++ {
+			if info, err := os.Stat(segmentPartPath(w.partsDir, i)); err == nil {
+				w.ready[i] = info.Size()
+				fetchedBytes += info.Size()
+				continue
+			}
+			pending = append(pending, segmentJob{track: t, index: i})
+		}
+		totalCount += len(track.Segments)
+		fetchedCount += w.next + len(w.ready)
+	}
+
+	if d.State != nil {
+		d.State.Downloaded.Store(fetchedBytes)
+	}
+
+	numWorkers := min(d.Runtime.GetMaxConnectionsPerHost(), maxSegmentWorkers, max(len(pending), 1))
+	client := newDownloadClient(d.Runtime)
+
+	jobs := make(chan segmentJob)
+	doneCh := make(chan segmentJob, len(pending))
+	errCh := make(chan error, numWorkers)
+
+	go func() {
+		defer close(jobs)
+		for _, job := range pending {
+			select {
+			case jobs <- job:
+			case <-downloadCtx.Done():
+				return
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < numWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := d.worker(downloadCtx, client, jobs, writers, doneCh); err != nil && err != context.Canceled {
+				errCh <- err
+			}
+		}()
+	}
+
+	// Append segments in order as they complete
+	var downloadErr error
+	remaining := len(writers)
+appendLoop:
+	for {
+		remaining = 0
+		for _, w := range writers {
+			if err := w.appendReady(); err != nil {
+				downloadErr = err
+				break appendLoop
+			}
+			if !w.done() {
+				remaining++
+			}
+		}
+		if remaining == 0 {
+			break
+		}
+
+		select {
+		case job := <-doneCh:
+			w := writers[job.track]
+			if info, err := os.Stat(segmentPartPath(w.partsDir, job.index)); err == nil {
+				w.ready[job.index] = info.Size()
+				fetchedCount++
+				fetchedBytes += info.Size()
+				d.updateEstimate(fetchedBytes, fetchedCount, totalCount, estimatedSize)
+			}
+		case downloadErr = <-errCh:
+			break appendLoop
+		case <-downloadCtx.Done():
+			break appendLoop
+		}
+	}
+
+	cancel()
+	wg.Wait()
+
+	// Handle pause or failure: save state so the stream can resume
+	paused := d.State != nil && d.State.IsPaused()
+	if paused || (downloadErr != nil && ctx.Err() == nil) {
+		state := &DownloadState{
+			URL:       rawurl,
+			ID:        d.ID,
+			DestPath:  destPath,
+			TotalSize: d.currentTotal(estimatedSize),
+			Filename:  filepath.Base(destPath),
+		}
+		for _, w := range writers {
+			state.Downloaded += w.written
+			state.Streams = append(state.Streams, StreamProgress{
+				Source:       w.track.Source,
+				SegmentsDone: w.next,
+				Written:      w.written,
+			})
+		}
+		if downloadErr != nil && !paused {
+			state.Error = downloadErr.Error()
+		}
+		if err := SaveState(rawurl, destPath, state); err != nil {
+			utils.Debug("Failed to save stream state: %v", err)
+		}
+		utils.Debug("Stream stopped (%d/%d tracks incomplete)", remaining, len(writers))
+		if paused {
+			return nil
+		}
+		return downloadErr
+	}
+
+	// Cancelled without pause: the TUI cleans up the working file
+	if remaining > 0 {
+		return nil
+	}
+
+	var total int64
+	for _, w := range writers {
+		if err := w.finish(); err != nil {
+			return err
+		}
+		total += w.written
+	}
+
+	// The size is only estimated until the last segment arrives
+	if d.State != nil {
+		d.State.UpdateTotalSize(total)
+		d.State.Downloaded.Store(total)
+	}
+
+	_ = DeleteState(d.ID, rawurl, destPath)
+	return nil
+}
+
+// openTrackWriter opens a track's working file, truncated to the last segment
+// boundary recorded in saved (if saved belongs to this rendition)
+func openTrackWriter(track *SegmentTrack, saved StreamProgress) (*trackWriter, error) {
+	workingPath := track.DestPath + IncompleteSuffix
+	w := &trackWriter{
+		track:    track,
+		partsDir: workingPath + ".parts",
+		ready:    make(map[int]int64),
+	}
+
+	if saved.Source == track.Source && saved.SegmentsDone > 0 && saved.SegmentsDone <= len(track.Segments) {
+		w.next = saved.SegmentsDone
+		w.written = saved.Written
+		utils.Debug("Resuming %s at segment %d (%d bytes written)", track.Source, w.next, w.written)
+	}
+
+	file, err := os.OpenFile(workingPath, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create file: %w", err)
+	}
+	w.file = file
+
+	// Drop anything appended after the saved segment boundary
+	if err := file.Truncate(w.written); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to truncate file: %w", err)
+	}
+	if _, err := file.Seek(w.written, io.SeekStart); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to seek file: %w", err)
+	}
+	if err := os.MkdirAll(w.partsDir, 0755); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to create segment directory: %w", err)
+	}
+	return w, nil
+}
+
+// finish verifies a completed track (if it has a digest) and moves it to its final name
+func (w *trackWriter) finish() error {
+	if err := w.file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync file: %w", err)
+	}
+
+	if w.track.SHA256 != "" {
+		if _, err := w.file.Seek(0, io.SeekStart); err != nil {
+			return fmt.Errorf("failed to seek file: %w", err)
+		}
+		h := sha256.New()
+		if _, err := io.Copy(h, w.file); err != nil {
+			return fmt.Errorf("failed to hash file: %w", err)
+		}
+		if got := hex.EncodeToString(h.Sum(nil)); !strings.EqualFold(got, w.track.SHA256) {
+			w.file.Close()
+			_ = os.Remove(w.track.DestPath + IncompleteSuffix)
+			_ = os.RemoveAll(w.partsDir)
+			return fmt.Errorf("%s: sha256 mismatch (got %s, want %s)", w.track.Source, got, w.track.SHA256)
+		}
+	}
+	w.file.Close()
+
+	if err := os.Rename(w.track.DestPath+IncompleteSuffix, w.track.DestPath); err != nil {
+		return fmt.Errorf("failed to rename completed file: %w", err)
+	}
+	_ = os.RemoveAll(w.partsDir)
+	return nil
+}
+
+// worker fetches segments from jobs until it is closed or ctx is cancelled
+func (d *SegmentDownloader) worker(ctx context.Context, client *http.Client, jobs <-chan segmentJob, writers []*trackWriter, doneCh chan<- segmentJob) error {
+	for job := range jobs {
+		w := writers[job.track]
+		seg := w.track.Segments[job.index]
+
+		if d.State != nil {
+			d.State.ActiveWorkers.Add(1)
+		}
+
+		maxRetries := d.Runtime.GetMaxTaskRetries()
+		attempt := 0
+		lastErr := retryWithBackoff(maxRetries, func() (bool, error) {
+			attempt++
+			err := d.fetchSegment(ctx, client, seg, segmentPartPath(w.partsDir, job.index))
+			if err != nil && ctx.Err() == nil {
+				utils.Debug("Segment %d of %s attempt %d failed: %v", job.index, w.track.Source, attempt, err)
+			}
+			return err == nil || ctx.Err() != nil, err
+		})
+
+		if d.State != nil {
+			d.State.ActiveWorkers.Add(-1)
+		}
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if lastErr != nil {
+			return fmt.Errorf("segment %d failed after %d retries: %w", job.index, maxRetries, lastErr)
+		}
+		doneCh <- job
+	}
+	return nil
+}
+
+// fetchSegment downloads (and decrypts) one segment into partPath. The part is
+// written under a temporary name so that an existing part is always complete.
+func (d *SegmentDownloader) fetchSegment(ctx context.Context, client *http.Client, seg Segment, partPath string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, seg.URL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", d.Runtime.GetUserAgent())
+	if d.Authorize != nil {
+		if err := d.Authorize(req); err != nil {
+			return err
+		}
+	}
+	if seg.Length > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", seg.Offset, seg.Offset+seg.Length-1))
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var body io.Reader = resp.Body
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+	case http.StatusOK:
+		// Server ignored the Range header: cut the sub-range out of the full body
+		if seg.Length > 0 {
+			if _, err := io.CopyN(io.Discard, resp.Body, seg.Offset); err != nil {
+				return err
+			}
+			body = io.LimitReader(resp.Body, seg.Length)
+		}
+	default:
+		return fmt.Errorf("unexpected status: %d", resp.StatusCode)
+	}
+
+	// Count bytes as they arrive so speed reflects in-flight segments
+	counter := &stateCountingReader{r: body, state: d.State}
+	data, err := io.ReadAll(counter)
+	if err != nil {
+		counter.rollback()
+		return err
+	}
+
+	if seg.Decrypt != nil {
+		if data, err = seg.Decrypt(ctx, data); err != nil {
+			counter.rollback()
+			return err
+		}
+	}
+
+	tmpPath := partPath + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		counter.rollback()
+		return fmt.Errorf("failed to write segment: %w", err)
+	}
+	return os.Rename(tmpPath, partPath)
+}
+
+// updateEstimate extrapolates the total size from the average fetched segment.
+// When the playlist gives no sizes this makes progress follow the segment count.
+func (d *SegmentDownloader) updateEstimate(fetchedBytes int64, fetchedCount, total int, initial int64) {
+	if d.State == nil || fetchedCount == 0 || d.SizeKnown {
+		return
+	}
+	// Until a tenth of the stream is in, trust the playlist's estimate
+	if initial > 0 && fetchedCount*10 < total {
+		return
+	}
+	d.State.UpdateTotalSize(fetchedBytes * int64(total) / int64(fetchedCount))
+}
+
+func (d *SegmentDownloader) currentTotal(fallback int64) int64 {
+	if d.State == nil {
+		return fallback
+	}
+	_, total, _, _, _ := d.State.GetProgress()
+	return total
+}
+
+func segmentPartPath(partsDir string, index int) string {
+	return filepath.Join(partsDir, strconv.Itoa(index))
+}
+
+// appendSegmentPart copies a finished part onto the end of out and removes it
+func appendSegmentPart(out *os.File, partPath string) error {
+	part, err := os.Open(partPath)
+	if err != nil {
+		return fmt.Errorf("failed to open segment: %w", err)
+	}
+	defer part.Close()
+
+	if _, err := io.Copy(out, part); err != nil {
+		return fmt.Errorf("failed to append segment: %w", err)
+	}
+	part.Close()
+	return os.Remove(partPath)
+}
+
+// stateCountingReader adds bytes read to the shared progress counter
+type stateCountingReader struct {
+	r     io.Reader
+	state *ProgressState
+	n     int64
+}
+
+func (c *stateCountingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	if n > 0 {
+		c.n += int64(n)
+		if c.state != nil {
+			c.state.Downloaded.Add(int64(n))
+		}
+	}
+	return n, err
+}
+
+// rollback removes the bytes counted by a failed attempt
+func (c *stateCountingReader) rollback() {
+	if c.state != nil {
+		c.state.Downloaded.Add(-c.n)
+	}
+	c.n = 0
+}
+
+// genericPlaylistNames are replaced by the parent directory name when naming output
+var genericPlaylistNames = []string{"index", "master", "playlist", "prog_index", "main", "stream", "manifest"}
+
+// streamOutputName swaps the playlist/manifest extension for ext. Generic names
+// such as ".../big_buck_bunny/master.m3u8" are named after their directory instead.
+func streamOutputName(playlistName, playlistURL, ext string) string {
+	name := strings.TrimSuffix(playlistName, path.Ext(playlistName))
+	for _, generic := range genericPlaylistNames {
+		if !strings.EqualFold(name, generic) {
+			continue
+		}
+		if u, err := url.Parse(playlistURL); err == nil {
+			if dir := path.Base(path.Dir(u.Path)); dir != "/" && dir != "." && dir != "" {
+				name = dir
+			}
+		}
+		break
+	}
+	return name + ext
+}
+
+// ================== Stream Quality Selection ==================
+
+// streamQuality is a parsed stream quality setting
+type streamQuality struct {
+	worst     bool
+	height    int   // Preferred vertical resolution (e.g. 720)
+	bandwidth int64 // Bandwidth cap in bits/second
+}
+
+// parseStreamQuality parses "best", "worst", a resolution ("720p", "1280x720")
+// or a bandwidth cap ("2500k", "5m", "800000")
+func parseStreamQuality(setting string) (streamQuality, error) {
+	s := strings.ToLower(strings.TrimSpace(setting))
+	switch {
+	case s == "" || s == "best":
+		return streamQuality{}, nil
+	case s == "worst":
+		return streamQuality{worst: true}, nil
+	case strings.HasSuffix(s, "p"):
+		if h, err := strconv.Atoi(strings.TrimSuffix(s, "p")); err == nil && h > 0 {
+			return streamQuality{height: h}, nil
+		}
+	case strings.Contains(s, "x"):
+		if _, hs, ok := strings.Cut(s, "x"); ok {
+			if h, err := strconv.Atoi(hs); err == nil && h > 0 {
+				return streamQuality{height: h}, nil
+			}
+		}
+	default:
+		mult := 1.0
+		switch {
+		case strings.HasSuffix(s, "k"):
+			mult, s = 1e3, strings.TrimSuffix(s, "k")
+		case strings.HasSuffix(s, "m"):
+			mult, s = 1e6, strings.TrimSuffix(s, "m")
+		}
+		if v, err := strconv.ParseFloat(s, 64); err == nil && v > 0 {
+			return streamQuality{bandwidth: int64(v * mult)}, nil
+		}
+	}
+	return streamQuality{}, fmt.Errorf("invalid stream quality %q", setting)
+}
+
+// streamCandidate describes one rendition for quality selection
+type streamCandidate struct {
+	Bandwidth int64
+	Height    int // 0 if unknown (e.g. audio-only)
+}
+
+// pick returns the index of the candidate that best matches q.
+// Resolutions pick the tallest rendition not above the target (the shortest
+// if all are above); bandwidth caps pick the fastest rendition under the cap
+// (the slowest if none are).
+func (q streamQuality) pick(cands []streamCandidate) int {
+	better := func(a, b streamCandidate) bool {
+		if a.Bandwidth != b.Bandwidth {
+			return a.Bandwidth > b.Bandwidth
+		}
+		return a.Height > b.Height
+	}
+
+	best := -1
+	switch {
+	case q.worst:
+		for i, c := range cands {
+			if best == -1 || better(cands[best], c) {
+				best = i
+			}
+		}
+		return best
+
+	case q.height > 0:
+		for i, c := range cands {
+			if c.Height == 0 || c.Height > q.height {
+				continue
+			}
+			if best == -1 || c.Height > cands[best].Height ||
+				(c.Height == cands[best].Height && better(c, cands[best])) {
+				best = i
+			}
+		}
+		if best != -1 {
+			return best
+		}
+		for i, c := range cands {
+			if c.Height > 0 && (best == -1 || c.Height < cands[best].Height) {
+				best = i
+			}
+		}
+		if best != -1 {
+			return best
+		}
+
+	case q.bandwidth > 0:
+		for i, c := range cands {
+			if c.Bandwidth <= q.bandwidth && (best == -1 || better(c, cands[best])) {
+				best = i
+			}
+		}
+		if best != -1 {
+			return best
+		}
+		return streamQuality{worst: true}.pick(cands)
+	}
+
+	for i, c := range cands {
+		if best == -1 || better(c, cands[best]) {
+			best = i
+		}
+	}
+	return best
+}
@@ -0,0 +1,226 @@
+package downloader
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/junaid2005p/surge/internal/config"
+)
+
+// testSegmentServer serves numbered segments at /seg/<n>. Requests for
+// segments from gateFrom on block until release is closed.
+type testSegmentServer struct {
+	*httptest.Server
+	segments [][]byte
+	gateFrom int
+	release  chan struct{}
+
+	mu       sync.Mutex
+	requests map[int]int
+}
+
+func startTestSegmentServer(t *testing.T, count, size int) *testSegmentServer {
+	s := &testSegmentServer{gateFrom: count, release: make(chan struct{}), requests: make(map[int]int)}
+	for i := 0; i < count; i++ {
+		s.segments = append(s.segments, randomBytes(t, size))
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/seg/"))
+		if err != nil || n < 0 || n >= len(s.segments) {
+			http.NotFound(w, r)
+			return
+		}
+		s.mu.Lock()
+		s.requests[n]++
+		s.mu.Unlock()
+		if n >= s.gateFrom {
+			select {
+			case <-s.release:
+			case <-r.Context().Done():
+				return
+			}
+		}
+		w.Write(s.segments[n])
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *testSegmentServer) track(destPath string) SegmentTrack {
+	track := SegmentTrack{Source: s.URL + "/playlist", DestPath: destPath}
+	for i := range s.segments {
+		track.Segments = append(track.Segments, Segment{URL: fmt.Sprintf("%s/seg/%d", s.URL, i)})
+	}
+	return track
+}
+
+func (s *testSegmentServer) requestCount(n int) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests[n]
+}
+
+func TestSegmentDownloader_PauseResume(t *testing.T) {
+	if err := config.EnsureDirs(); err != nil {
+		t.Fatalf("Failed to create config dirs: %v", err)
+	}
+	s := startTestSegmentServer(t, 6, 16*KB)
+	s.gateFrom = 3
+
+	destPath := filepath.Join(t.TempDir(), "stream.ts")
+	rawurl := s.URL + "/playlist"
+	runtime := &RuntimeConfig{MaxConnectionsPerHost: 2}
+	defer DeleteState("segments-resume", rawurl, destPath)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	state := NewProgressState("segments-resume", 0)
+	d := NewSegmentDownloader("segments-resume", nil, state, runtime)
+	errCh := make(chan error, 1)
+	go func() { errCh <- d.Download(ctx, rawurl, destPath, []SegmentTrack{s.track(destPath)}, 0) }()
+
+	// Segments 0-2 complete, the rest block in the handler
+	firstThree := int64(3 * 16 * KB)
+	deadline := time.Now().Add(10 * time.Second)
+	for state.Downloaded.Load() < firstThree {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for first segments (downloaded %d)", state.Downloaded.Load())
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	time.Sleep(100 * time.Millisecond) // Let the writer append them
+	state.Pause()
+
+	if err := <-errCh; err != nil {
+		t.Fatalf("paused download returned error: %v", err)
+	}
+	saved, err := LoadState(rawurl, destPath)
+	if err != nil {
+		t.Fatalf("pause state not saved: %v", err)
+	}
+	if len(saved.Streams) != 1 || saved.Streams[0].SegmentsDone != 3 || saved.Streams[0].Written != firstThree {
+		t.Fatalf("saved streams = %+v, want 3 segments and %d bytes", saved.Streams, firstThree)
+	}
+
+	close(s.release)
+	resumeState := NewProgressState("segments-resume", saved.TotalSize)
+	d = NewSegmentDownloader("segments-resume", nil, resumeState, runtime)
+	if err := d.Download(ctx, rawurl, destPath, []SegmentTrack{s.track(destPath)}, 0); err != nil {
+		t.Fatalf("resume failed: %v", err)
+	}
+
+	got, err := os.ReadFile(destPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, bytes.Join(s.segments, nil)) {
+		t.Errorf("resumed output is %d bytes, want %d", len(got), 6*16*KB)
+	}
+	for i := 0; i < 3; i++ {
+		if n := s.requestCount(i); n != 1 {
+			t.Errorf("segment %d fetched %d times, want once", i, n)
+		}
+	}
+	if _, err := LoadState(rawurl, destPath); err == nil {
+		t.Error("state should be deleted after the stream completes")
+	}
+	if _, err := os.Stat(destPath + IncompleteSuffix + ".parts"); !os.IsNotExist(err) {
+		t.Errorf("parts directory should be removed, stat err = %v", err)
+	}
+}
+
+func TestSegmentDownloader_ReusesParts(t *testing.T) {
+	if err := config.EnsureDirs(); err != nil {
+		t.Fatalf("Failed to create config dirs: %v", err)
+	}
+	s := startTestSegmentServer(t, 5, 8*KB)
+	destPath := filepath.Join(t.TempDir(), "stream.ts")
+	rawurl := s.URL + "/playlist"
+	defer DeleteState("segments-parts", rawurl, destPath)
+
+	// Segments fetched before an interruption but never appended
+	partsDir := destPath + IncompleteSuffix + ".parts"
+	if err := os.MkdirAll(partsDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, i := range []int{1, 3} {
+		if err := os.WriteFile(segmentPartPath(partsDir, i), s.segments[i], 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	state := NewProgressState("segments-parts", 0)
+	d := NewSegmentDownloader("segments-parts", nil, state, &RuntimeConfig{})
+	if err := d.Download(ctx, rawurl, destPath, []SegmentTrack{s.track(destPath)}, 0); err != nil {
+		t.Fatalf("download failed: %v", err)
+	}
+
+	got, err := os.ReadFile(destPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, bytes.Join(s.segments, nil)) {
+		t.Errorf("output is %d bytes, want %d", len(got), 5*8*KB)
+	}
+	for i := range s.segments {
+		want := 1
+		if i == 1 || i == 3 {
+			want = 0
+		}
+		if n := s.requestCount(i); n != want {
+			t.Errorf("segment %d fetched %d times, want %d", i, n, want)
+		}
+	}
+	if n := state.Downloaded.Load(); n != 5*8*KB {
+		t.Errorf("Downloaded = %d, want %d", n, 5*8*KB)
+	}
+}
+
+func TestSegmentDownloader_RetriesFailedSegment(t *testing.T) {
+	if err := config.EnsureDirs(); err != nil {
+		t.Fatalf("Failed to create config dirs: %v", err)
+	}
+	data := randomBytes(t, 8*KB)
+	var mu sync.Mutex
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests++
+		n := requests
+		mu.Unlock()
+		if n == 1 {
+			http.Error(w, "try again", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write(data)
+	}))
+	defer server.Close()
+
+	destPath := filepath.Join(t.TempDir(), "single.ts")
+	track := SegmentTrack{Source: server.URL, DestPath: destPath, Segments: []Segment{{URL: server.URL + "/seg"}}}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	d := NewSegmentDownloader("segments-retry", nil, nil, &RuntimeConfig{})
+	if err := d.Download(ctx, server.URL, destPath, []SegmentTrack{track}, 0); err != nil {
+		t.Fatalf("download failed: %v", err)
+	}
+	if got, err := os.ReadFile(destPath); err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("content mismatch (err %v)", err)
+	}
+	if requests != 2 {
+		t.Errorf("requests = %d, want a failed attempt and a retry", requests)
+	}
+}
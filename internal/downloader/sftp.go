@@ -0,0 +1,343 @@
+package downloader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"os/user"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+
+	"github.com/junaid2005p/surge/internal/utils"
+)
+
+// SFTPScheme is the URL scheme handled by the SFTP backend
+const SFTPScheme = "sftp"
+
+const defaultSFTPPort = "22"
+
+// defaultSSHKeyFiles are tried (in order) when no key file is configured
+var defaultSSHKeyFiles = []string{"id_ed25519", "id_ecdsa", "id_rsa"}
+
+// isSFTPURL reports whether rawurl uses the sftp:// scheme
+func isSFTPURL(rawurl string) bool {
+	u, err := url.Parse(rawurl)
+	return err == nil && strings.EqualFold(u.Scheme, SFTPScheme)
+}
+
+// sftpSession holds an SSH connection and the SFTP file opened for download.
+// A single session serves all workers: pkg/sftp pipelines concurrent reads
+// at different offsets over the same connection.
+type sftpSession struct {
+	conn   *ssh.Client
+	client *sftp.Client
+	file   *sftp.File
+	path   string
+	agent  net.Conn // SSH agent connection, nil without an agent
+	once   sync.Once
+}
+
+// dialSFTP connects to the host in rawurl and opens the remote file for reading
+func dialSFTP(ctx context.Context, rawurl string, runtime *RuntimeConfig) (*sftpSession, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sftp url: %w", err)
+	}
+	if u.Path == "" || strings.HasSuffix(u.Path, "/") {
+		return nil, fmt.Errorf("sftp url must point to a file: %s", rawurl)
+	}
+
+	username := u.User.Username()
+	if username == "" {
+		username = currentUsername()
+	}
+	password, _ := u.User.Password()
+
+	port := u.Port()
+	if port == "" {
+		port = defaultSFTPPort
+	}
+	addr := net.JoinHostPort(u.Hostname(), port)
+
+	hostKeyCallback, err := sftpHostKeyCallback()
+	if err != nil {
+		return nil, err
+	}
+
+	auth, agentConn := sftpAuthMethods(password, runtime.GetSSHKeyFile())
+	closeAgent := func() {
+		if agentConn != nil {
+			agentConn.Close()
+		}
+	}
+	sshConfig := &ssh.ClientConfig{
+		User:            username,
+		Auth:            auth,
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         DialTimeout,
+	}
+
+	dialer := &net.Dialer{Timeout: DialTimeout, KeepAlive: KeepAliveDuration}
+	netConn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		closeAgent()
+		return nil, fmt.Errorf("failed to connect to %s: %w", addr, err)
+	}
+
+	// ClientConfig.Timeout only covers ssh.Dial: bound the handshake and
+	// opening the file here, and give up on them when ctx ends
+	netConn.SetDeadline(time.Now().Add(DialTimeout))
+	stop := context.AfterFunc(ctx, func() { netConn.Close() })
+	defer stop()
+
+	sshConn, chans, reqs, err := ssh.NewClientConn(netConn, addr, sshConfig)
+	if err != nil {
+		netConn.Close()
+		closeAgent()
+		var keyErr *knownhosts.KeyError
+		if errors.As(err, &keyErr) {
+			return nil, hostKeyError(addr, keyErr)
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, fmt.Errorf("ssh handshake with %s failed: %w", addr, err)
+	}
+	conn := ssh.NewClient(sshConn, chans, reqs)
+
+	client, err := sftp.NewClient(conn, sftp.UseConcurrentReads(true))
+	if err != nil {
+		conn.Close()
+		closeAgent()
+		return nil, fmt.Errorf("failed to start sftp subsystem: %w", err)
+	}
+
+	remotePath := u.Path
+	file, err := client.Open(remotePath)
+	if err != nil {
+		client.Close()
+		conn.Close()
+		closeAgent()
+		return nil, fmt.Errorf("failed to open %s: %w", remotePath, err)
+	}
+
+	netConn.SetDeadline(time.Time{})
+	return &sftpSession{conn: conn, client: client, file: file, path: remotePath, agent: agentConn}, nil
+}
+
+// Close releases the remote file, the SFTP subsystem, the SSH connection and
+// the agent connection. It may be called more than once.
+func (s *sftpSession) Close() error {
+	var err error
+	s.once.Do(func() {
+		// Closing the connection first fails reads blocked on it, which would
+		// otherwise hold up closing the file
+		err = s.conn.Close()
+		s.file.Close()
+		s.client.Close()
+		if s.agent != nil {
+			s.agent.Close()
+		}
+	})
+	return err
+}
+
+// openRange implements RangeOpener on top of concurrent ReadAt requests
+func (s *sftpSession) openRange(ctx context.Context, offset, length int64) (io.ReadCloser, error) {
+	return &contextReader{ctx: ctx, r: io.NewSectionReader(s.file, offset, length)}, nil
+}
+
+// contextReader gives readers that don't take a context the same
+// pause/health-cancel behaviour as HTTP bodies. Reads run on their own
+// goroutine into a private buffer, so a read blocked on a hung connection is
+// abandoned when the context ends. The abandoned read returns once the
+// session is closed.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+	buf []byte
+}
+
+type readResult struct {
+	n   int
+	err error
+}
+
+func (c *contextReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	if cap(c.buf) < len(p) {
+		c.buf = make([]byte, len(p))
+	}
+	buf := c.buf[:len(p)]
+
+	done := make(chan readResult, 1)
+	go func() {
+		n, err := c.r.Read(buf)
+		done <- readResult{n, err}
+	}()
+	select {
+	case res := <-done:
+		copy(p, buf[:res.n])
+		return res.n, res.err
+	case <-c.ctx.Done():
+		c.buf = nil // Still owned by the abandoned read
+		return 0, c.ctx.Err()
+	}
+}
+
+func (c *contextReader) Close() error { return nil }
+
+// sftpAuthMethods builds the auth chain: SSH agent, then key files, then
+// password. The agent connection, if any, must be closed by the caller.
+func sftpAuthMethods(password, keyFile string) ([]ssh.AuthMethod, net.Conn) {
+	var methods []ssh.AuthMethod
+	var agentConn net.Conn
+
+	if sock := os.Getenv("SSH_AUTH_SOCK"); sock != "" {
+		if conn, err := net.Dial("unix", sock); err == nil {
+			agentConn = conn
+			methods = append(methods, ssh.PublicKeysCallback(agent.NewClient(conn).Signers))
+		} else {
+			utils.Debug("SFTP: ssh agent unavailable: %v", err)
+		}
+	}
+
+	if signers := loadSSHSigners(keyFile, password); len(signers) > 0 {
+		methods = append(methods, ssh.PublicKeys(signers...))
+	}
+
+	if password != "" {
+		methods = append(methods, ssh.Password(password))
+	}
+
+	return methods, agentConn
+}
+
+// loadSSHSigners loads the configured key file, or the default ~/.ssh keys.
+// Encrypted keys are unlocked with the URL password when one is given.
+func loadSSHSigners(keyFile, passphrase string) []ssh.Signer {
+	var paths []string
+	if keyFile != "" {
+		paths = []string{keyFile}
+	} else if home, err := os.UserHomeDir(); err == nil {
+		for _, name := range defaultSSHKeyFiles {
+			paths = append(paths, filepath.Join(home, ".ssh", name))
+		}
+	}
+
+	var signers []ssh.Signer
+	for _, p := range paths {
+		data, err := os.ReadFile(p)
+		if err != nil {
+			continue
+		}
+
+		signer, err := ssh.ParsePrivateKey(data)
+		var missing *ssh.PassphraseMissingError
+		if errors.As(err, &missing) && passphrase != "" {
+			signer, err = ssh.ParsePrivateKeyWithPassphrase(data, []byte(passphrase))
+		}
+		if err != nil {
+			utils.Debug("SFTP: skipping key %s: %v", p, err)
+			continue
+		}
+		signers = append(signers, signer)
+	}
+	return signers
+}
+
+// sftpHostKeyCallback verifies hosts against ~/.ssh/known_hosts. Without a
+// readable known_hosts file nothing can be verified, so connecting fails.
+func sftpHostKeyCallback() (ssh.HostKeyCallback, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, fmt.Errorf("cannot verify sftp host keys: %w", err)
+	}
+	path := filepath.Join(home, ".ssh", "known_hosts")
+	cb, err := knownhosts.New(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot verify sftp host keys without %s (connect once with ssh to add the host): %w", path, err)
+	}
+	return cb, nil
+}
+
+// hostKeyError explains a host key that known_hosts does not vouch for
+func hostKeyError(addr string, err *knownhosts.KeyError) error {
+	if len(err.Want) == 0 {
+		return fmt.Errorf("host key of %s is not in known_hosts (connect once with ssh to verify and add it): %w", addr, err)
+	}
+	return fmt.Errorf("host key of %s does not match known_hosts, the connection may be intercepted: %w", addr, err)
+}
+
+func currentUsername() string {
+	if u, err := user.Current(); err == nil && u.Username != "" {
+		// Windows returns DOMAIN\user
+		if i := strings.LastIndex(u.Username, `\`); i != -1 {
+			return u.Username[i+1:]
+		}
+		return u.Username
+	}
+	return os.Getenv("USER")
+}
+
+// probeSFTP stats the remote file to determine its size and name
+func probeSFTP(ctx context.Context, rawurl string, filenameHint string, runtime *RuntimeConfig) (*ProbeResult, error) {
+	utils.Debug("Probing SFTP: %s", rawurl)
+
+	session, err := dialSFTP(ctx, rawurl, runtime)
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+
+	info, err := session.file.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat %s: %w", session.path, err)
+	}
+	if info.IsDir() {
+		return nil, fmt.Errorf("%s is a directory", session.path)
+	}
+
+	result := &ProbeResult{
+		FileSize:      info.Size(),
+		SupportsRange: true,
+		Filename:      path.Base(session.path),
+	}
+	if filenameHint != "" {
+		result.Filename = filenameHint
+	}
+
+	utils.Debug("SFTP probe complete - filename: %s, size: %d", result.Filename, result.FileSize)
+	return result, nil
+}
+
+// downloadSFTP downloads an sftp:// URL with the concurrent downloader,
+// reading task ranges over a shared SFTP session
+func downloadSFTP(ctx context.Context, cfg DownloadConfig, destPath string, fileSize int64) error {
+	session, err := dialSFTP(ctx, cfg.URL, cfg.Runtime)
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+	// Fail reads still blocked on the connection when the download stops
+	stop := context.AfterFunc(ctx, func() { session.Close() })
+	defer stop()
+
+	d := NewConcurrentDownloader(cfg.ID, cfg.ProgressCh, cfg.State, cfg.Runtime)
+	d.Opener = session.openRange
+	return d.Download(ctx, cfg.URL, destPath, fileSize, cfg.Verbose)
+}
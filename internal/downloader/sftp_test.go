@@ -0,0 +1,477 @@
+package downloader
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+
+	"github.com/junaid2005p/surge/internal/config"
+	"github.com/junaid2005p/surge/internal/testutil"
+)
+
+// startTestSFTPServer starts an in-process SSH server exposing the local
+// filesystem over the sftp subsystem with password authentication, and adds
+// its host key to ~/.ssh/known_hosts. Call isolateSSHEnv first.
+func startTestSFTPServer(t *testing.T, user, password string) string {
+	t.Helper()
+
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hostKey, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serverConfig := &ssh.ServerConfig{
+		PasswordCallback: func(c ssh.ConnMetadata, pass []byte) (*ssh.Permissions, error) {
+			if c.User() == user && string(pass) == password {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("access denied")
+		},
+	}
+	serverConfig.AddHostKey(hostKey)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	writeKnownHosts(t, ln.Addr().String(), hostKey.PublicKey())
+
+	go func() {
+		for {
+			nConn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveTestSFTPConn(nConn, serverConfig)
+		}
+	}()
+
+	return ln.Addr().String()
+}
+
+func serveTestSFTPConn(nConn net.Conn, serverConfig *ssh.ServerConfig) {
+	_, chans, reqs, err := ssh.NewServerConn(nConn, serverConfig)
+	if err != nil {
+		nConn.Close()
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+
+	for newChannel := range chans {
+		if newChannel.ChannelType() != "session" {
+			newChannel.Reject(ssh.UnknownChannelType, "unknown channel type")
+			continue
+		}
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			return
+		}
+
+		go func(in <-chan *ssh.Request) {
+			for req := range in {
+				// Payload is a uint32 length-prefixed subsystem name
+				ok := req.Type == "subsystem" && len(req.Payload) > 4 && string(req.Payload[4:]) == "sftp"
+				req.Reply(ok, nil)
+			}
+		}(requests)
+
+		server, err := sftp.NewServer(channel)
+		if err != nil {
+			channel.Close()
+			continue
+		}
+		go func() {
+			server.Serve()
+			server.Close()
+		}()
+	}
+}
+
+// writeKnownHosts replaces ~/.ssh/known_hosts with a single entry for addr
+func writeKnownHosts(t *testing.T, addr string, key ssh.PublicKey) {
+	t.Helper()
+	home, err := os.UserHomeDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := filepath.Join(home, ".ssh")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	line := knownhosts.Line([]string{knownhosts.Normalize(addr)}, key) + "\n"
+	if err := os.WriteFile(filepath.Join(dir, "known_hosts"), []byte(line), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// isolateSSHEnv keeps the developer's agent and ~/.ssh out of the tests
+func isolateSSHEnv(t *testing.T) {
+	t.Helper()
+	t.Setenv("SSH_AUTH_SOCK", "")
+	t.Setenv("HOME", t.TempDir())
+}
+
+func TestIsSFTPURL(t *testing.T) {
+	tests := []struct {
+		url  string
+		want bool
+	}{
+		{"sftp://host/file.bin", true},
+		{"SFTP://user@host:2222/data/file.bin", true},
+		{"https://example.com/file.bin", false},
+		{"ftp://host/file.bin", false},
+		{"not a url", false},
+	}
+
+	for _, tt := range tests {
+		if got := isSFTPURL(tt.url); got != tt.want {
+			t.Errorf("isSFTPURL(%q) = %v, want %v", tt.url, got, tt.want)
+		}
+	}
+}
+
+func TestProbeSFTP(t *testing.T) {
+	isolateSSHEnv(t)
+	addr := startTestSFTPServer(t, "surge", "secret")
+
+	tmpDir, cleanup, err := testutil.TempDir("surge-sftp-probe")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	remote, err := testutil.CreateTestFile(tmpDir, "remote.bin", 100*KB, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	rawurl := fmt.Sprintf("sftp://surge:secret@%s%s", addr, filepath.ToSlash(remote))
+	probe, err := probeSFTP(ctx, rawurl, "", nil)
+	if err != nil {
+		t.Fatalf("probeSFTP failed: %v", err)
+	}
+	if probe.FileSize != 100*KB {
+		t.Errorf("FileSize = %d, want %d", probe.FileSize, 100*KB)
+	}
+	if !probe.SupportsRange {
+		t.Error("SFTP probe should report range support")
+	}
+	if probe.Filename != "remote.bin" {
+		t.Errorf("Filename = %q, want remote.bin", probe.Filename)
+	}
+
+	// Filename hint takes precedence
+	probe, err = probeSFTP(ctx, rawurl, "custom.bin", nil)
+	if err != nil {
+		t.Fatalf("probeSFTP with hint failed: %v", err)
+	}
+	if probe.Filename != "custom.bin" {
+		t.Errorf("Filename = %q, want custom.bin", probe.Filename)
+	}
+}
+
+func TestProbeSFTP_Errors(t *testing.T) {
+	isolateSSHEnv(t)
+	addr := startTestSFTPServer(t, "surge", "secret")
+	tmpDir := t.TempDir()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tests := []struct {
+		name string
+		url  string
+	}{
+		{"wrong password", fmt.Sprintf("sftp://surge:wrong@%s%s/x.bin", addr, filepath.ToSlash(tmpDir))},
+		{"missing file", fmt.Sprintf("sftp://surge:secret@%s%s/missing.bin", addr, filepath.ToSlash(tmpDir))},
+		{"directory path", fmt.Sprintf("sftp://surge:secret@%s%s/", addr, filepath.ToSlash(tmpDir))},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := probeSFTP(ctx, tt.url, "", nil); err == nil {
+				t.Error("expected probe to fail")
+			}
+		})
+	}
+}
+
+func TestProbeSFTP_HostKey(t *testing.T) {
+	isolateSSHEnv(t)
+	addr := startTestSFTPServer(t, "surge", "secret")
+	rawurl := fmt.Sprintf("sftp://surge:secret@%s%s/x.bin", addr, filepath.ToSlash(t.TempDir()))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, other, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := ssh.NewSignerFromKey(other)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeKnownHosts(t, addr, otherKey.PublicKey())
+	if _, err := probeSFTP(ctx, rawurl, "", nil); err == nil || !strings.Contains(err.Error(), "does not match known_hosts") {
+		t.Errorf("changed host key: err = %v", err)
+	}
+
+	writeKnownHosts(t, "127.0.0.2:22", otherKey.PublicKey())
+	if _, err := probeSFTP(ctx, rawurl, "", nil); err == nil || !strings.Contains(err.Error(), "is not in known_hosts") {
+		t.Errorf("unknown host: err = %v", err)
+	}
+
+	home, _ := os.UserHomeDir()
+	os.Remove(filepath.Join(home, ".ssh", "known_hosts"))
+	if _, err := probeSFTP(ctx, rawurl, "", nil); err == nil || !strings.Contains(err.Error(), "cannot verify sftp host keys") {
+		t.Errorf("missing known_hosts: err = %v", err)
+	}
+}
+
+func TestProbeSFTP_StalledHandshake(t *testing.T) {
+	isolateSSHEnv(t)
+	// Accepts connections but never speaks SSH
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			t.Cleanup(func() { conn.Close() })
+		}
+	}()
+	home, _ := os.UserHomeDir()
+	os.MkdirAll(filepath.Join(home, ".ssh"), 0700)
+	if err := os.WriteFile(filepath.Join(home, ".ssh", "known_hosts"), nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err = probeSFTP(ctx, fmt.Sprintf("sftp://surge:secret@%s/x.bin", ln.Addr()), "", nil)
+	if err == nil {
+		t.Fatal("probe of a stalled server should fail")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("probe returned after %v, want it to stop with the context", elapsed)
+	}
+}
+
+func TestContextReader_Cancel(t *testing.T) {
+	pr, pw := io.Pipe()
+	defer pw.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &contextReader{ctx: ctx, r: pr}
+	done := make(chan error, 1)
+	go func() {
+		_, err := r.Read(make([]byte, 16))
+		done <- err
+	}()
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != context.Canceled {
+			t.Errorf("Read error = %v, want context.Canceled", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Read blocked after the context was cancelled")
+	}
+}
+
+func TestTUIDownload_SFTP(t *testing.T) {
+	if err := config.EnsureDirs(); err != nil {
+		t.Fatalf("Failed to create config dirs: %v", err)
+	}
+	isolateSSHEnv(t)
+	addr := startTestSFTPServer(t, "surge", "secret")
+
+	srcDir, cleanupSrc, _ := testutil.TempDir("surge-sftp-src")
+	defer cleanupSrc()
+	outDir, cleanupOut, _ := testutil.TempDir("surge-sftp-out")
+	defer cleanupOut()
+
+	fileSize := int64(512 * KB)
+	remote, err := testutil.CreateTestFile(srcDir, "dataset.bin", fileSize, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rawurl := fmt.Sprintf("sftp://surge:secret@%s%s", addr, filepath.ToSlash(remote))
+	state := NewProgressState("sftp-test", 0)
+	cfg := DownloadConfig{
+		URL:        rawurl,
+		OutputPath: outDir,
+		ID:         "sftp-test",
+		State:      state,
+		Runtime: &RuntimeConfig{
+			MaxConnectionsPerHost: 4,
+			MinChunkSize:          32 * KB,
+			MaxChunkSize:          64 * KB,
+			TargetChunkSize:       32 * KB,
+			WorkerBufferSize:      16 * KB,
+		},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if err := TUIDownload(ctx, cfg); err != nil {
+		t.Fatalf("SFTP download failed: %v", err)
+	}
+
+	destPath := filepath.Join(outDir, "dataset.bin")
+	match, err := testutil.CompareFiles(remote, destPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !match {
+		t.Error("downloaded file does not match remote file")
+	}
+	if state.Downloaded.Load() != fileSize {
+		t.Errorf("Downloaded = %d, want %d", state.Downloaded.Load(), fileSize)
+	}
+}
+
+func TestDownloadSFTP_PauseResume(t *testing.T) {
+	if err := config.EnsureDirs(); err != nil {
+		t.Fatalf("Failed to create config dirs: %v", err)
+	}
+	isolateSSHEnv(t)
+	addr := startTestSFTPServer(t, "surge", "secret")
+
+	srcDir, cleanupSrc, _ := testutil.TempDir("surge-sftp-src")
+	defer cleanupSrc()
+	outDir, cleanupOut, _ := testutil.TempDir("surge-sftp-out")
+	defer cleanupOut()
+
+	fileSize := int64(256 * KB)
+	remote, err := testutil.CreateTestFile(srcDir, "resume.bin", fileSize, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rawurl := fmt.Sprintf("sftp://surge:secret@%s%s", addr, filepath.ToSlash(remote))
+	destPath := filepath.Join(outDir, "resume.bin")
+
+	// Simulate a paused download: first half present, second half remaining
+	half := fileSize / 2
+	data, err := os.ReadFile(remote)
+	if err != nil {
+		t.Fatal(err)
+	}
+	partial := make([]byte, fileSize)
+	copy(partial, data[:half])
+	if err := os.WriteFile(destPath+IncompleteSuffix, partial, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	saved := &DownloadState{
+		ID:         "sftp-resume",
+		URL:        rawurl,
+		DestPath:   destPath,
+		TotalSize:  fileSize,
+		Downloaded: half,
+		Tasks:      []Task{{Offset: half, Length: fileSize - half}},
+		Filename:   "resume.bin",
+	}
+	if err := SaveState(rawurl, destPath, saved); err != nil {
+		t.Fatal(err)
+	}
+	defer DeleteState("sftp-resume", rawurl, destPath)
+
+	state := NewProgressState("sftp-resume", fileSize)
+	cfg := DownloadConfig{
+		URL:        rawurl,
+		OutputPath: outDir,
+		DestPath:   destPath,
+		ID:         "sftp-resume",
+		IsResume:   true,
+		State:      state,
+		Runtime:    &RuntimeConfig{MaxConnectionsPerHost: 2},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if err := TUIDownload(ctx, cfg); err != nil {
+		t.Fatalf("SFTP resume failed: %v", err)
+	}
+
+	match, err := testutil.CompareFiles(remote, destPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !match {
+		t.Error("resumed file does not match remote file")
+	}
+	if _, err := LoadState(rawurl, destPath); err == nil {
+		t.Error("state file should be deleted after successful resume")
+	}
+}
+
+func TestLoadSSHSigners(t *testing.T) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, err := ssh.MarshalPrivateKey(priv, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	encrypted, err := ssh.MarshalPrivateKeyWithPassphrase(priv, "", []byte("hunter2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	plainPath := filepath.Join(dir, "plain")
+	encPath := filepath.Join(dir, "encrypted")
+	if err := os.WriteFile(plainPath, pem.EncodeToMemory(block), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(encPath, pem.EncodeToMemory(encrypted), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := loadSSHSigners(plainPath, ""); len(got) != 1 {
+		t.Errorf("plain key: got %d signers, want 1", len(got))
+	}
+	if got := loadSSHSigners(encPath, ""); len(got) != 0 {
+		t.Errorf("encrypted key without passphrase: got %d signers, want 0", len(got))
+	}
+	if got := loadSSHSigners(encPath, "hunter2"); len(got) != 1 {
+		t.Errorf("encrypted key with passphrase: got %d signers, want 1", len(got))
+	}
+	if got := loadSSHSigners(filepath.Join(dir, "missing"), ""); len(got) != 0 {
+		t.Errorf("missing key: got %d signers, want 0", len(got))
+	}
+}
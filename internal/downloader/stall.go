@@ -0,0 +1,112 @@
+package downloader
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/junaid2005p/surge/internal/utils"
+)
+
+// workerRestarts remembers when a worker was last restarted for each host,
+// across downloads
+var workerRestarts = struct {
+	sync.Mutex
+	last map[string]time.Time
+}{last: make(map[string]time.Time)}
+
+// claimRestart reports whether a worker for host may be restarted now, and if
+// so starts the host's cooldown. A host that is slow across the board would
+// otherwise have its connections torn down one after another.
+func claimRestart(host string, now time.Time) bool {
+	workerRestarts.Lock()
+	defer workerRestarts.Unlock()
+
+	if last, ok := workerRestarts.last[host]; ok && now.Sub(last) < workerRestartCooldown {
+		return false
+	}
+	workerRestarts.last[host] = now
+	return true
+}
+
+// stallDeadline returns when the worker counts as stalled if no more bytes
+// arrive: the stall timeout after LastActivity, which the worker stamps
+// whenever it starts a read or receives data. Before the first byte the
+// worker also gets the grace period to connect.
+func (a *ActiveTask) stallDeadline(stallTimeout, grace time.Duration) time.Time {
+	deadline := time.Unix(0, atomic.LoadInt64(&a.LastActivity)).Add(stallTimeout)
+	if atomic.LoadInt64(&a.CurrentOffset) == a.Task.Offset {
+		if connect := a.StartTime.Add(grace); connect.After(deadline) {
+			deadline = connect
+		}
+	}
+	return deadline
+}
+
+// stallWatch is a worker's read deadline: it cancels the task once its
+// connection delivers no bytes before stallDeadline. The worker moves the
+// deadline forward as reads start and data arrives, and suspends it while
+// handing data to the disk writer, since a slow disk is not the connection's
+// fault.
+type stallWatch struct {
+	d            *ConcurrentDownloader
+	active       *ActiveTask
+	host         string
+	stallTimeout time.Duration
+	grace        time.Duration
+
+	mu        sync.Mutex
+	timer     *time.Timer
+	suspended bool
+}
+
+// watchStall starts the read deadline of a task whose connection is to host
+func (d *ConcurrentDownloader) watchStall(active *ActiveTask, host string) *stallWatch {
+	w := &stallWatch{
+		d:            d,
+		active:       active,
+		host:         host,
+		stallTimeout: d.Runtime.GetStallTimeout(),
+		grace:        d.Runtime.GetSlowWorkerGracePeriod(),
+	}
+	w.mu.Lock()
+	w.timer = time.AfterFunc(time.Until(active.stallDeadline(w.stallTimeout, w.grace)), w.expire)
+	w.mu.Unlock()
+	return w
+}
+
+// extend moves the deadline to stallDeadline after LastActivity was stamped
+func (w *stallWatch) extend() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.suspended = false
+	w.timer.Reset(time.Until(w.active.stallDeadline(w.stallTimeout, w.grace)))
+}
+
+// suspend stops the deadline until the next extend
+func (w *stallWatch) suspend() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.suspended = true
+	w.timer.Stop()
+}
+
+// expire restarts the stalled worker. The worker requeues the unfinished
+// remainder of its task. While the host is cooling down from the last
+// restart (see claimRestart) it checks again after another stall timeout.
+func (w *stallWatch) expire() {
+	if !claimRestart(w.host, time.Now()) {
+		w.mu.Lock()
+		if !w.suspended {
+			w.timer.Reset(w.stallTimeout)
+		}
+		w.mu.Unlock()
+		return
+	}
+	utils.Debug("Stall: no data for %v from %s, restarting worker at offset %d",
+		time.Since(time.Unix(0, atomic.LoadInt64(&w.active.LastActivity))), w.host, atomic.LoadInt64(&w.active.CurrentOffset))
+	w.active.Cancel()
+	if w.d.State != nil {
+		w.d.State.Stalls.Add(1)
+	}
+}
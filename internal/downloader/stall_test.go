@@ -0,0 +1,214 @@
+package downloader
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/junaid2005p/surge/internal/config"
+)
+
+// forgetRestarts clears the restart cooldowns of all hosts and returns a
+// function that puts them back, for t.Cleanup
+func forgetRestarts() func() {
+	workerRestarts.Lock()
+	defer workerRestarts.Unlock()
+	saved := workerRestarts.last
+	workerRestarts.last = make(map[string]time.Time)
+
+	return func() {
+		workerRestarts.Lock()
+		defer workerRestarts.Unlock()
+		workerRestarts.last = saved
+	}
+}
+
+func TestClaimRestart_Cooldown(t *testing.T) {
+	t.Cleanup(forgetRestarts())
+	now := time.Now()
+	if !claimRestart("cooldown.example", now) {
+		t.Fatal("first restart should be allowed")
+	}
+	if claimRestart("cooldown.example", now.Add(workerRestartCooldown/2)) {
+		t.Error("restart during the cooldown should be refused")
+	}
+	if !claimRestart("other.example", now) {
+		t.Error("cooldown should only apply to its own host")
+	}
+	if !claimRestart("cooldown.example", now.Add(workerRestartCooldown)) {
+		t.Error("restart after the cooldown should be allowed")
+	}
+}
+
+func TestStallDeadline(t *testing.T) {
+	start := time.Now().Add(-time.Minute)
+	active := &ActiveTask{
+		Task:          Task{Offset: 100, Length: 100},
+		CurrentOffset: 100,
+		LastActivity:  start.UnixNano(),
+		StartTime:     start,
+	}
+
+	// No bytes yet: the grace period to connect applies
+	if got := active.stallDeadline(time.Second, 5*time.Second); !got.Equal(start.Add(5 * time.Second)) {
+		t.Errorf("deadline before first byte = %v, want %v", got, start.Add(5*time.Second))
+	}
+
+	active.CurrentOffset = 150
+	if got := active.stallDeadline(time.Second, 5*time.Second); !got.Equal(start.Add(time.Second)) {
+		t.Errorf("deadline after first byte = %v, want %v", got, start.Add(time.Second))
+	}
+}
+
+// healthTestWorker returns an active task that started age ago, last received
+// data idle ago and reads at speed bytes/sec
+func healthTestWorker(age, idle time.Duration, speed float64) (*ActiveTask, context.Context) {
+	ctx, cancel := context.WithCancel(context.Background())
+	now := time.Now()
+	return &ActiveTask{
+		Task:          Task{Offset: 0, Length: 100 * MB},
+		CurrentOffset: MB,
+		StopAt:        100 * MB,
+		LastActivity:  now.Add(-idle).UnixNano(),
+		StartTime:     now.Add(-age),
+		Speed:         speed,
+		Cancel:        cancel,
+	}, ctx
+}
+
+func TestStallWatch_RestartsStalledWorker(t *testing.T) {
+	t.Cleanup(forgetRestarts())
+	d := NewConcurrentDownloader("id", nil, NewProgressState("id", 100*MB), &RuntimeConfig{StallTimeout: 50 * time.Millisecond, SlowWorkerGracePeriod: time.Millisecond})
+	stalled, stalledCtx := healthTestWorker(time.Minute, 0, MB)
+	w := d.watchStall(stalled, "stalled.example")
+	defer w.suspend()
+
+	select {
+	case <-stalledCtx.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("stalled worker was not restarted")
+	}
+	if got := d.State.Stalls.Load(); got != 1 {
+		t.Errorf("Stalls = %d, want 1", got)
+	}
+
+	// A worker that keeps receiving data is left alone, and a second stall
+	// on the same host waits for the cooldown
+	again, againCtx := healthTestWorker(time.Minute, 0, MB)
+	w = d.watchStall(again, "stalled.example")
+	defer w.suspend()
+	time.Sleep(200 * time.Millisecond)
+	if againCtx.Err() != nil {
+		t.Error("worker restarted during the host's cooldown")
+	}
+
+	busy, busyCtx := healthTestWorker(time.Minute, 0, MB)
+	w = d.watchStall(busy, "busy.example")
+	defer w.suspend()
+	for i := 0; i < 10; i++ {
+		time.Sleep(20 * time.Millisecond)
+		atomic.StoreInt64(&busy.LastActivity, time.Now().UnixNano())
+		w.extend()
+	}
+	if busyCtx.Err() != nil {
+		t.Error("worker receiving data was restarted")
+	}
+}
+
+func TestConcurrentDownloader_RestartsStalledConnection(t *testing.T) {
+	t.Cleanup(forgetRestarts())
+	if err := config.EnsureDirs(); err != nil {
+		t.Fatal(err)
+	}
+
+	data := randomBytes(t, MB)
+	var stalls atomic.Int32
+	// The first request for the start of the file sends some data, then hangs
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var start, end int64
+		if _, err := fmt.Sscanf(r.Header.Get("Range"), "bytes=%d-%d", &start, &end); err != nil || end >= int64(len(data)) {
+			http.Error(w, "bad range", http.StatusRequestedRangeNotSatisfiable)
+			return
+		}
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, len(data)))
+		w.Header().Set("Content-Length", strconv.FormatInt(end-start+1, 10))
+		w.WriteHeader(http.StatusPartialContent)
+		if start == 0 && stalls.Add(1) == 1 {
+			w.Write(data[:32*KB])
+			w.(http.Flusher).Flush()
+			<-r.Context().Done()
+			return
+		}
+		w.Write(data[start : end+1])
+	}))
+	defer server.Close()
+
+	destPath := filepath.Join(t.TempDir(), "stall.bin")
+	state := NewProgressState("stall-id", int64(len(data)))
+	d := NewConcurrentDownloader("stall-id", nil, state, &RuntimeConfig{
+		MaxConnectionsPerHost: 2,
+		MinChunkSize:          256 * KB,
+		MaxChunkSize:          256 * KB,
+		TargetChunkSize:       256 * KB,
+		StallTimeout:          300 * time.Millisecond,
+		SlowWorkerGracePeriod: 300 * time.Millisecond,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+	if err := d.Download(ctx, server.URL+"/stall.bin", destPath, int64(len(data)), false); err != nil {
+		t.Fatalf("download failed: %v", err)
+	}
+	if got, err := os.ReadFile(destPath); err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("content mismatch (err %v)", err)
+	}
+	if got := state.Stalls.Load(); got != 1 {
+		t.Errorf("Stalls = %d, want 1", got)
+	}
+}
+
+func TestCheckWorkerHealth_SlowWorker(t *testing.T) {
+	t.Cleanup(forgetRestarts())
+	d := NewConcurrentDownloader("id", nil, NewProgressState("id", 100*MB), &RuntimeConfig{})
+	fast1, _ := healthTestWorker(time.Minute, 0, 4*MB)
+	fast2, _ := healthTestWorker(time.Minute, 0, 4*MB)
+	slow, slowCtx := healthTestWorker(time.Minute, 0, 10*KB)
+	d.activeTasks[0] = fast1
+	d.activeTasks[1] = fast2
+	d.activeTasks[2] = slow
+
+	d.checkWorkerHealth("slow.example")
+
+	if slowCtx.Err() == nil {
+		t.Error("slow worker was not restarted")
+	}
+	if got := d.State.SlowRestarts.Load(); got != 1 {
+		t.Errorf("SlowRestarts = %d, want 1", got)
+	}
+	if got := d.State.Stalls.Load(); got != 0 {
+		t.Errorf("Stalls = %d, want 0", got)
+	}
+}
+
+func TestCheckWorkerHealth_KeepsWorkerAboveMinimumSpeed(t *testing.T) {
+	t.Cleanup(forgetRestarts())
+	d := NewConcurrentDownloader("id", nil, NewProgressState("id", 100*MB), &RuntimeConfig{})
+	fast, _ := healthTestWorker(time.Minute, 0, 20*MB)
+	slower, slowerCtx := healthTestWorker(time.Minute, 0, 2*MB)
+	d.activeTasks[0] = fast
+	d.activeTasks[1] = slower
+
+	d.checkWorkerHealth("steady.example")
+
+	if slowerCtx.Err() != nil {
+		t.Error("worker above minAbsoluteSpeed was restarted")
+	}
+}
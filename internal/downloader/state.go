@@ -42,6 +42,18 @@ type DownloadState struct {
 	Filename   string `json:"filename"`
 	CreatedAt  int64  `json:"created_at"` // Unix timestamp
 	PausedAt   int64  `json:"paused_at"`  // Unix timestamp
+	ETag       string `json:"etag,omitempty"`
+	Error      string `json:"error,omitempty"` // Why the download stopped, empty if it was paused
+
+	// Segmented streams (HLS, DASH) resume by segment rather than by byte range
+	Streams []StreamProgress `json:"streams,omitempty"`
+}
+
+// StreamProgress records how far one track of a segmented stream has been written
+type StreamProgress struct {
+	Source       string `json:"source"`        // Media playlist URL or representation being downloaded
+	SegmentsDone int    `json:"segments_done"` // Segments appended to the output
+	Written      int64  `json:"written"`       // Bytes appended to the output
 }
 
 // getStatePath returns the path to the state file using URL+DestPath hash
@@ -90,6 +102,10 @@ func SaveState(url string, destPath string, state *DownloadState) error {
 		Filename: state.Filename,
 		Status:   "paused",
 	}
+	if state.Error != "" {
+		entry.Status = "error"
+		entry.Error = state.Error
+	}
 	_ = AddToMasterList(entry)
 
 	return nil
@@ -148,10 +164,11 @@ type DownloadEntry struct {
 	URL         string `json:"url"`
 	DestPath    string `json:"dest_path"`
 	Filename    string `json:"filename"`
-	Status      string `json:"status"`       // "paused", "completed", "error"
-	TotalSize   int64  `json:"total_size"`   // File size in bytes
-	CompletedAt int64  `json:"completed_at"` // Unix timestamp when completed
-	TimeTaken   int64  `json:"time_taken"`   // Duration in milliseconds (for completed)
+	Status      string `json:"status"`          // "paused", "completed", "error"
+	TotalSize   int64  `json:"total_size"`      // File size in bytes
+	CompletedAt int64  `json:"completed_at"`    // Unix timestamp when completed
+	TimeTaken   int64  `json:"time_taken"`      // Duration in milliseconds (for completed)
+	Error       string `json:"error,omitempty"` // Failure reason (for error)
 }
 
 func getMasterListPath() string {
@@ -272,6 +289,23 @@ func LoadPausedDownloads() ([]DownloadEntry, error) {
 	return paused, nil
 }
 
+// LoadErroredDownloads returns all failed downloads from the master list
+func LoadErroredDownloads() ([]DownloadEntry, error) {
+	list, err := LoadMasterList()
+	if err != nil {
+		return nil, err
+	}
+
+	var errored []DownloadEntry
+	for _, e := range list.Downloads {
+		if e.Status == "error" {
+			errored = append(errored, e)
+		}
+	}
+
+	return errored, nil
+}
+
 // LoadCompletedDownloads returns all completed downloads from the master list
 func LoadCompletedDownloads() ([]DownloadEntry, error) {
 	list, err := LoadMasterList()
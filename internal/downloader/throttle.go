@@ -0,0 +1,288 @@
+package downloader
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/junaid2005p/surge/internal/utils"
+)
+
+// ThrottledError is returned for a 429 or 503 response: the server is asking
+// for fewer or slower requests
+type ThrottledError struct {
+	StatusCode int
+	RetryAfter time.Duration // From the Retry-After header, 0 if absent
+}
+
+func (e *ThrottledError) Error() string {
+	if e.StatusCode == http.StatusTooManyRequests {
+		return "rate limited (429)"
+	}
+	return fmt.Sprintf("server busy (%d)", e.StatusCode)
+}
+
+// parseRetryAfter reads a Retry-After header given in seconds or as an
+// HTTP date. Returns 0 if the header is absent or invalid.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+
+	var d time.Duration
+	if secs, err := strconv.Atoi(value); err == nil {
+		d = time.Duration(secs) * time.Second
+	} else if t, err := http.ParseTime(value); err == nil {
+		d = t.Sub(now)
+	}
+	return min(max(d, 0), maxRetryAfter)
+}
+
+// connThrottle decides how many of a download's workers may hold a
+// connection. The adaptive controller moves the limit with throughput (see
+// connController). A throttled response halves it and pauses all workers (for
+// Retry-After, if given); connections are then added back one at a time as
+// tasks succeed. Every allowed connection is taken from the global budget
+// shared by all downloads.
+type connThrottle struct {
+	mu         sync.Mutex
+	max        int           // Workers the download has, the most connections it can use
+	limit      int           // Connections currently allowed
+	ceiling    int           // Limit to recover to after throttling
+	globalMax  int           // MaxGlobalConnections
+	pauseUntil time.Time     // No new requests before this
+	successes  int           // Tasks finished since the limit last changed
+	strikes    int           // Throttling episodes since the last success
+	changed    chan struct{} // Closed when the limit or pause changes
+	report     func(int)     // Called with the new limit, may be nil
+	streams    bool          // Connections are streams over one connection, see newStreamThrottle
+
+	parked   atomic.Int32 // Workers waiting in wait
+	failures atomic.Int64 // Failed task attempts, for the adaptive controller
+}
+
+// newConnThrottle allows initial of numWorkers connections, as far as the
+// global budget permits; the first connection is always allowed
+func newConnThrottle(initial, numWorkers, globalMax int, report func(int)) *connThrottle {
+	return newThrottle(&connThrottle{max: numWorkers, globalMax: globalMax}, initial, report)
+}
+
+// newStreamThrottle is newConnThrottle for a download whose requests are
+// HTTP/2 streams over one connection: only that connection is taken from the
+// global budget, however many streams are allowed
+func newStreamThrottle(initial, numWorkers int, report func(int)) *connThrottle {
+	return newThrottle(&connThrottle{max: numWorkers, streams: true}, initial, report)
+}
+
+func newThrottle(t *connThrottle, initial int, report func(int)) *connThrottle {
+	t.changed = make(chan struct{})
+	globalConns.Add(1)
+	t.limit = 1
+	t.setLimitLocked(initial)
+	t.ceiling = t.limit
+	t.report = report
+	if report != nil {
+		report(t.limit)
+	}
+	return t
+}
+
+// globalConns counts the connections allowed to all running downloads
+var globalConns atomic.Int64
+
+// reserveConns takes up to n connections from the global budget of max,
+// returning how many it got
+func reserveConns(n, max int) int {
+	for {
+		cur := globalConns.Load()
+		got := min(int64(n), int64(max)-cur)
+		if got <= 0 {
+			return 0
+		}
+		if globalConns.CompareAndSwap(cur, cur+got) {
+			return int(got)
+		}
+	}
+}
+
+// setLimitLocked sets the limit to n (at least 1), taking extra connections
+// from the global budget or giving them back. Returns the limit reached.
+func (t *connThrottle) setLimitLocked(n int) int {
+	n = min(max(n, 1), t.max)
+	switch {
+	case t.streams:
+		// Only the connection counts, taken in newThrottle
+	case n > t.limit:
+		n = t.limit + reserveConns(n-t.limit, t.globalMax)
+	default:
+		globalConns.Add(int64(n - t.limit))
+	}
+	if n != t.limit {
+		t.limit = n
+		t.notifyLocked()
+		if t.report != nil {
+			t.report(n)
+		}
+	}
+	return n
+}
+
+// notifyLocked wakes up workers in wait
+func (t *connThrottle) notifyLocked() {
+	close(t.changed)
+	t.changed = make(chan struct{})
+}
+
+// wake rechecks workers in wait, e.g. after the queue was closed
+func (t *connThrottle) wake() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.notifyLocked()
+}
+
+// release gives the download's connections back to the global budget
+func (t *connThrottle) release() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.streams {
+		globalConns.Add(-1)
+	} else {
+		globalConns.Add(-int64(t.limit))
+	}
+	t.limit = 0
+	t.notifyLocked()
+}
+
+// Parked returns the number of workers waiting in wait
+func (t *connThrottle) Parked() int {
+	return int(t.parked.Load())
+}
+
+// Limit returns the connections currently allowed
+func (t *connThrottle) Limit() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.limit
+}
+
+// wait blocks worker id while it is over the connection limit or requests
+// are paused, until queue is closed
+func (t *connThrottle) wait(ctx context.Context, id int, queue *TaskQueue) error {
+	t.parked.Add(1)
+	defer t.parked.Add(-1)
+
+	for {
+		if queue.Closed() {
+			return nil
+		}
+
+		t.mu.Lock()
+		delay := time.Until(t.pauseUntil)
+		over := id >= t.limit
+		changed := t.changed
+		t.mu.Unlock()
+
+		if delay <= 0 && !over {
+			return nil
+		}
+
+		var timer *time.Timer
+		var timeout <-chan time.Time
+		if delay > 0 {
+			timer = time.NewTimer(delay)
+			timeout = timer.C
+		}
+		select {
+		case <-ctx.Done():
+		case <-changed:
+		case <-timeout:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+}
+
+// throttled records a throttled response and returns how long requests are
+// paused. Responses to requests sent before the pause are part of the same
+// episode and only extend it. Fails once the server keeps throttling without
+// any task succeeding in between.
+func (t *connThrottle) throttled(err *ThrottledError) (time.Duration, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	if now.Before(t.pauseUntil) {
+		if until := now.Add(err.RetryAfter); until.After(t.pauseUntil) {
+			t.pauseUntil = until
+			t.notifyLocked()
+		}
+		return t.pauseUntil.Sub(now), nil
+	}
+
+	t.strikes++
+	if t.strikes > maxThrottleStrikes {
+		return 0, fmt.Errorf("server keeps throttling: %w", err)
+	}
+
+	delay := err.RetryAfter
+	if delay == 0 {
+		delay = min(throttleBaseDelay<<min(t.strikes-1, 8), maxRetryAfter)
+	}
+	t.pauseUntil = now.Add(delay)
+
+	// Recover to just below the level the server objected to
+	old := t.limit
+	t.ceiling = max(old-1, 1)
+	t.setLimitLocked(old / 2)
+	t.successes = 0
+	t.notifyLocked()
+	utils.Debug("Throttled (%v): connections %d -> %d, pausing %v", err, old, t.limit, delay)
+	return delay, nil
+}
+
+// succeeded records a finished task. While recovering from throttling,
+// another connection is allowed after every few of them.
+func (t *connThrottle) succeeded() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.strikes = 0
+	if t.limit >= t.ceiling {
+		return
+	}
+	t.successes++
+	if t.successes >= throttleRampUpTasks {
+		t.successes = 0
+		t.setLimitLocked(t.limit + 1)
+		utils.Debug("Throttle easing: connections -> %d", t.limit)
+	}
+}
+
+// failed records a failed task attempt
+func (t *connThrottle) failed() {
+	t.failures.Add(1)
+}
+
+// adjust moves the limit by delta for the adaptive controller and reports
+// whether it changed. Nothing changes while recovering from throttling.
+func (t *connThrottle) adjust(delta int) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.limit != t.ceiling || time.Now().Before(t.pauseUntil) {
+		return false
+	}
+	old := t.limit
+	t.ceiling = t.setLimitLocked(old + delta)
+	return t.limit != old
+}
@@ -0,0 +1,208 @@
+package downloader
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/junaid2005p/surge/internal/config"
+	"github.com/junaid2005p/surge/internal/testutil"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value string
+		want  time.Duration
+	}{
+		{"", 0},
+		{"3", 3 * time.Second},
+		{" 120 ", 2 * time.Minute},
+		{"-5", 0},
+		{"soon", 0},
+		{"Wed, 01 Jan 2025 12:00:30 GMT", 30 * time.Second},
+		{"Wed, 01 Jan 2025 11:59:00 GMT", 0},
+		{"86400", maxRetryAfter},
+	}
+	for _, tt := range tests {
+		if got := parseRetryAfter(tt.value, now); got != tt.want {
+			t.Errorf("parseRetryAfter(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestConnThrottle(t *testing.T) {
+	th := newConnThrottle(8, 8, GlobalMax, nil)
+	defer th.release()
+	busy := &ThrottledError{StatusCode: http.StatusServiceUnavailable, RetryAfter: time.Second}
+
+	if delay, err := th.throttled(busy); err != nil || delay != time.Second {
+		t.Fatalf("throttled = %v, %v; want 1s pause", delay, err)
+	}
+	// Responses to requests already in flight belong to the same episode
+	th.throttled(busy)
+	if got := th.Limit(); got != 4 {
+		t.Errorf("limit after one throttling episode = %d, want 4", got)
+	}
+
+	// Connections come back one at a time as tasks succeed, to just below
+	// the level that was throttled
+	for i := 0; i < 10*throttleRampUpTasks; i++ {
+		th.succeeded()
+	}
+	if got := th.Limit(); got != 7 {
+		t.Errorf("limit should recover to 7, got %d", got)
+	}
+
+	// Without Retry-After the pause doubles with each episode
+	limited := &ThrottledError{StatusCode: http.StatusTooManyRequests}
+	for _, want := range []time.Duration{throttleBaseDelay, 2 * throttleBaseDelay} {
+		th.pauseUntil = time.Time{}
+		if delay, _ := th.throttled(limited); delay != want {
+			t.Errorf("pause = %v, want %v", delay, want)
+		}
+	}
+
+	// A server that never stops throttling fails the download
+	var err error
+	for i := 0; i <= maxThrottleStrikes && err == nil; i++ {
+		th.pauseUntil = time.Time{}
+		_, err = th.throttled(busy)
+	}
+	var throttledErr *ThrottledError
+	if !errors.As(err, &throttledErr) {
+		t.Errorf("expected a ThrottledError after %d strikes, got %v", maxThrottleStrikes, err)
+	}
+}
+
+func TestConnThrottle_GlobalBudget(t *testing.T) {
+	base := int(globalConns.Load())
+	globalMax := base + 6
+
+	a := newConnThrottle(4, 8, globalMax, nil)
+	b := newConnThrottle(4, 8, globalMax, nil)
+	if a.Limit() != 4 || b.Limit() != 2 {
+		t.Fatalf("limits = %d, %d; want 4, 2 from a budget of 6", a.Limit(), b.Limit())
+	}
+	if a.adjust(+1) {
+		t.Error("adjust should not exceed the global budget")
+	}
+
+	b.release()
+	if !a.adjust(+1) || a.Limit() != 5 {
+		t.Errorf("adjust after release: limit %d, want 5", a.Limit())
+	}
+	a.release()
+	if got := int(globalConns.Load()); got != base {
+		t.Errorf("global connections after release = %d, want %d", got, base)
+	}
+}
+
+func TestStreamThrottle_GlobalBudget(t *testing.T) {
+	base := int(globalConns.Load())
+
+	th := newStreamThrottle(4, 8, nil)
+	if th.Limit() != 4 {
+		t.Errorf("limit = %d, want 4", th.Limit())
+	}
+	if !th.adjust(+1) || th.Limit() != 5 {
+		t.Errorf("adjust: limit %d, want 5", th.Limit())
+	}
+	if got := int(globalConns.Load()); got != base+1 {
+		t.Errorf("global connections = %d, want %d: streams share one connection", got, base+1)
+	}
+
+	th.release()
+	if got := int(globalConns.Load()); got != base {
+		t.Errorf("global connections after release = %d, want %d", got, base)
+	}
+}
+
+func TestConnThrottle_Wait(t *testing.T) {
+	th := newConnThrottle(1, 2, GlobalMax, nil)
+	defer th.release()
+	queue := NewTaskQueue()
+
+	done := make(chan error, 1)
+	go func() { done <- th.wait(context.Background(), 1, queue) }()
+
+	select {
+	case <-done:
+		t.Fatal("worker over the limit should wait")
+	case <-time.After(50 * time.Millisecond):
+	}
+	if th.Parked() != 1 {
+		t.Errorf("Parked() = %d, want 1", th.Parked())
+	}
+
+	th.adjust(+1)
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("wait returned %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("raising the limit should release the worker")
+	}
+}
+
+func TestConcurrentDownloader_HonoursRetryAfter(t *testing.T) {
+	if err := config.EnsureDirs(); err != nil {
+		t.Fatal(err)
+	}
+
+	data := randomBytes(t, 512*KB)
+	var requests, rejected atomic.Int32
+	var pausedUntil atomic.Int64
+	var early atomic.Bool
+	// The first ranged requests are turned away with Retry-After: 1
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if until := pausedUntil.Load(); until != 0 && time.Now().UnixNano() < until-int64(100*time.Millisecond) {
+			early.Store(true)
+		}
+		if requests.Add(1) <= 2 {
+			rejected.Add(1)
+			pausedUntil.Store(time.Now().Add(time.Second).UnixNano())
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, "slow down", http.StatusTooManyRequests)
+			return
+		}
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(data))
+	}))
+	defer server.Close()
+
+	tmpDir, cleanup, err := testutil.TempDir("surge-retry-after")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	destPath := filepath.Join(tmpDir, "throttled.bin")
+	// A single task retry: throttled responses must not use it up
+	runtime := &RuntimeConfig{MaxConnectionsPerHost: 4, MinChunkSize: 64 * KB, MaxTaskRetries: 1}
+	d := NewConcurrentDownloader("throttle-id", nil, NewProgressState("throttle-id", int64(len(data))), runtime)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := d.Download(ctx, server.URL, destPath, int64(len(data)), false); err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+
+	got, err := os.ReadFile(destPath)
+	if err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("content mismatch (err %v)", err)
+	}
+	if rejected.Load() != 2 {
+		t.Errorf("rejected %d requests, want 2", rejected.Load())
+	}
+	if early.Load() {
+		t.Error("requests were sent before Retry-After elapsed")
+	}
+}
@@ -0,0 +1,196 @@
+package downloader
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/junaid2005p/surge/internal/config"
+)
+
+// tlsOptions are the TLS settings of the connections to one host: the global
+// settings with the host's entry of the per-host options applied
+type tlsOptions struct {
+	caFile     string // PEM bundle trusted in addition to the system roots
+	clientCert string // PEM client certificate for mutual TLS
+	clientKey  string // PEM key of clientCert, empty if in the same file
+	minVersion string // "1.0" to "1.3", empty for Go's default
+	pins       string // Comma separated base64 SHA-256 pins of the server's public key
+	insecure   bool   // Skip certificate verification (pins are still checked)
+}
+
+// forHost applies the per-host entry for host, if any
+func (o tlsOptions) forHost(hosts []config.TLSHost, host string) tlsOptions {
+	h := config.LookupTLSHost(hosts, host)
+	if h == nil {
+		return o
+	}
+	if h.CAFile != "" {
+		o.caFile = h.CAFile
+	}
+	if h.ClientCert != "" {
+		o.clientCert, o.clientKey = h.ClientCert, h.ClientKey
+	}
+	if h.MinVersion != "" {
+		o.minVersion = h.MinVersion
+	}
+	o.pins = strings.Join(h.Pins, ",")
+	return o
+}
+
+// tlsHostsFile identifies a version of the per-host TLS options file
+type tlsHostsFile struct {
+	path    string
+	modTime int64 // Unix nanoseconds, 0 if the file does not exist
+	size    int64
+}
+
+var (
+	tlsHostsMu     sync.Mutex
+	tlsHostsLoaded tlsHostsFile
+	tlsHosts       []config.TLSHost
+	tlsHostsErr    error
+	tlsHostsValid  bool
+)
+
+// loadTLSHosts returns the per-host TLS options, reading tls.json again only
+// when it has changed since the last call
+func loadTLSHosts() ([]config.TLSHost, error) {
+	file := tlsHostsFile{path: config.GetTLSHostsPath()}
+	if info, err := os.Stat(file.path); err == nil {
+		file.modTime, file.size = info.ModTime().UnixNano(), info.Size()
+	}
+
+	tlsHostsMu.Lock()
+	defer tlsHostsMu.Unlock()
+	if !tlsHostsValid || tlsHostsLoaded != file {
+		tlsHosts, tlsHostsErr = config.LoadTLSHosts()
+		tlsHostsLoaded, tlsHostsValid = file, true
+	}
+	return tlsHosts, tlsHostsErr
+}
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// tlsConfigKey identifies a built TLS configuration
+type tlsConfigKey struct {
+	base *tls.Config // downloadTLSConfig it was built on
+	opts tlsOptions
+}
+
+var (
+	tlsConfigsMu sync.Mutex
+	tlsConfigs   = make(map[tlsConfigKey]*tls.Config)
+)
+
+// tlsConfigFor returns the TLS configuration for opts, building it on first
+// use. Certificates are read once; failures are not cached, so a fixed file
+// is picked up by the next download. Callers must clone the result.
+func tlsConfigFor(opts tlsOptions) (*tls.Config, error) {
+	if opts == (tlsOptions{}) {
+		return downloadTLSConfig, nil
+	}
+	key := tlsConfigKey{base: downloadTLSConfig, opts: opts}
+
+	tlsConfigsMu.Lock()
+	defer tlsConfigsMu.Unlock()
+	if conf, ok := tlsConfigs[key]; ok {
+		return conf, nil
+	}
+	conf, err := newTLSConfig(opts)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfigs[key] = conf
+	return conf, nil
+}
+
+// newTLSConfig builds the TLS configuration for opts on top of
+// downloadTLSConfig
+func newTLSConfig(opts tlsOptions) (*tls.Config, error) {
+	conf := downloadTLSConfig.Clone()
+	if conf == nil {
+		conf = &tls.Config{}
+	}
+
+	if opts.caFile != "" {
+		pem, err := os.ReadFile(opts.caFile)
+		if err != nil {
+			return nil, fmt.Errorf("CA bundle: %w", err)
+		}
+		pool := conf.RootCAs
+		if pool != nil {
+			pool = pool.Clone()
+		} else if pool, err = x509.SystemCertPool(); err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("CA bundle %s holds no PEM certificates", opts.caFile)
+		}
+		conf.RootCAs = pool
+	}
+
+	if opts.clientCert != "" {
+		keyFile := opts.clientKey
+		if keyFile == "" {
+			keyFile = opts.clientCert
+		}
+		cert, err := tls.LoadX509KeyPair(opts.clientCert, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("client certificate: %w", err)
+		}
+		conf.Certificates = []tls.Certificate{cert}
+	}
+
+	if opts.minVersion != "" {
+		version, ok := tlsVersions[opts.minVersion]
+		if !ok {
+			return nil, fmt.Errorf("unknown minimum TLS version %q (want 1.0, 1.1, 1.2 or 1.3)", opts.minVersion)
+		}
+		conf.MinVersion = version
+	}
+
+	conf.InsecureSkipVerify = opts.insecure
+
+	if opts.pins != "" {
+		pins := make(map[string]bool)
+		for _, pin := range strings.Split(opts.pins, ",") {
+			pin = strings.TrimPrefix(strings.TrimSpace(pin), "sha256//")
+			if sum, err := base64.StdEncoding.DecodeString(pin); err != nil || len(sum) != sha256.Size {
+				return nil, fmt.Errorf("invalid public key pin %q (want the base64 SHA-256 of the key)", pin)
+			}
+			pins[pin] = true
+		}
+		conf.VerifyConnection = func(cs tls.ConnectionState) error {
+			return verifyPins(cs, pins)
+		}
+	}
+	return conf, nil
+}
+
+// errPinMismatch reports a server whose public key matches none of its pins
+var errPinMismatch = errors.New("server public key does not match the pinned keys")
+
+// verifyPins checks the public key of the server's certificate against pins.
+// It runs after certificate verification, and also without it in insecure mode.
+func verifyPins(cs tls.ConnectionState, pins map[string]bool) error {
+	if len(cs.PeerCertificates) == 0 {
+		return errPinMismatch
+	}
+	sum := sha256.Sum256(cs.PeerCertificates[0].RawSubjectPublicKeyInfo)
+	if !pins[base64.StdEncoding.EncodeToString(sum[:])] {
+		return fmt.Errorf("%w: %s", errPinMismatch, cs.ServerName)
+	}
+	return nil
+}
@@ -0,0 +1,247 @@
+package downloader
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/junaid2005p/surge/internal/config"
+)
+
+// writePEM writes der as a PEM block of type typ to a new file in dir
+func writePEM(t *testing.T, dir, name, typ string, der []byte) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// newClientCert creates a self-signed client certificate and writes it and
+// its key to dir
+func newClientCert(t *testing.T, dir string) (cert *x509.Certificate, certFile, keyFile string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "surge test client"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cert, err = x509.ParseCertificate(der); err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, writePEM(t, dir, "client.pem", "CERTIFICATE", der), writePEM(t, dir, "client-key.pem", "EC PRIVATE KEY", keyDER)
+}
+
+// publicKeyPin returns the pin of cert's public key
+func publicKeyPin(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// tlsGet fetches url through a pooled transport with the given TLS settings
+func tlsGet(url string, opts tlsOptions, hosts []config.TLSHost) error {
+	client := &http.Client{Transport: pooledTransport{
+		maxConns: 2, ipVersion: IPVersionAuto, http2: HTTP2Off, http3: HTTP3Off, http3Conns: 1,
+		dns: systemDNS, tls: opts, tlsHosts: hosts,
+	}}
+	resp, err := client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, err = io.Copy(io.Discard, resp.Body)
+	return err
+}
+
+func newTLSTestServer(t *testing.T) *httptest.Server {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestTLSPrivateCAAndClientCert(t *testing.T) {
+	dir := t.TempDir()
+	clientCert, certFile, keyFile := newClientCert(t, dir)
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(clientCert)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	}))
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs}
+	server.StartTLS()
+	defer server.Close()
+	caFile := writePEM(t, dir, "ca.pem", "CERTIFICATE", server.Certificate().Raw)
+
+	if err := tlsGet(server.URL, tlsOptions{}, nil); err == nil {
+		t.Error("a server with a private CA should not be trusted by default")
+	}
+	if err := tlsGet(server.URL, tlsOptions{caFile: caFile}, nil); err == nil {
+		t.Error("the server requires a client certificate")
+	}
+	if err := tlsGet(server.URL, tlsOptions{caFile: caFile, clientCert: certFile, clientKey: keyFile}, nil); err != nil {
+		t.Errorf("download with CA bundle and client certificate failed: %v", err)
+	}
+
+	// The same options from the per-host entry
+	hosts := []config.TLSHost{{Hosts: []string{"127.0.0.1"}, CAFile: caFile, ClientCert: certFile, ClientKey: keyFile}}
+	if err := tlsGet(server.URL, tlsOptions{}, hosts); err != nil {
+		t.Errorf("download with per-host options failed: %v", err)
+	}
+}
+
+func TestTLSInsecure(t *testing.T) {
+	server := newTLSTestServer(t)
+
+	if err := tlsGet(server.URL, tlsOptions{}, nil); err == nil {
+		t.Error("an untrusted certificate should fail verification")
+	}
+	if err := tlsGet(server.URL, tlsOptions{insecure: true}, nil); err != nil {
+		t.Errorf("insecure download failed: %v", err)
+	}
+}
+
+func TestTLSPins(t *testing.T) {
+	server := newTLSTestServer(t)
+	trustServer(t, server)
+	pin := publicKeyPin(server.Certificate())
+	other := base64.StdEncoding.EncodeToString(make([]byte, sha256.Size))
+
+	pinned := func(pins ...string) []config.TLSHost {
+		return []config.TLSHost{{Hosts: []string{"127.0.0.1"}, Pins: pins}}
+	}
+	if err := tlsGet(server.URL, tlsOptions{}, pinned(other, "sha256//"+pin)); err != nil {
+		t.Errorf("download with a matching pin failed: %v", err)
+	}
+	if err := tlsGet(server.URL, tlsOptions{}, pinned(other)); !errors.Is(err, errPinMismatch) {
+		t.Errorf("download with a wrong pin: err = %v, want a pin mismatch", err)
+	}
+	// Pins are checked without certificate verification too
+	if err := tlsGet(server.URL, tlsOptions{insecure: true}, pinned(other)); !errors.Is(err, errPinMismatch) {
+		t.Errorf("insecure download with a wrong pin: err = %v, want a pin mismatch", err)
+	}
+	if err := tlsGet(server.URL, tlsOptions{}, pinned("not-a-pin")); err == nil || !strings.Contains(err.Error(), "invalid public key pin") {
+		t.Errorf("invalid pin: err = %v", err)
+	}
+}
+
+func TestTLSMinVersion(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	}))
+	server.TLS = &tls.Config{MaxVersion: tls.VersionTLS12}
+	server.StartTLS()
+	defer server.Close()
+	trustServer(t, server)
+
+	if err := tlsGet(server.URL, tlsOptions{minVersion: "1.2"}, nil); err != nil {
+		t.Errorf("TLS 1.2 download failed: %v", err)
+	}
+	if err := tlsGet(server.URL, tlsOptions{minVersion: "1.3"}, nil); err == nil {
+		t.Error("a TLS 1.2 server should be refused with a TLS 1.3 minimum")
+	}
+	if err := tlsGet(server.URL, tlsOptions{minVersion: "2.0"}, nil); err == nil || !strings.Contains(err.Error(), "minimum TLS version") {
+		t.Errorf("unknown version: err = %v", err)
+	}
+}
+
+func TestTLSOptionsForHost(t *testing.T) {
+	global := tlsOptions{caFile: "global.pem", clientCert: "global-cert.pem", clientKey: "global-key.pem", minVersion: "1.2", insecure: true}
+	hosts := []config.TLSHost{{Hosts: []string{"artifacts.corp"}, ClientCert: "corp.pem", MinVersion: "1.3", Pins: []string{"a", "b"}}}
+
+	got := global.forHost(hosts, "eu.artifacts.corp")
+	want := tlsOptions{caFile: "global.pem", clientCert: "corp.pem", minVersion: "1.3", pins: "a,b", insecure: true}
+	if got != want {
+		t.Errorf("forHost = %+v, want %+v", got, want)
+	}
+	if got := global.forHost(hosts, "example.com"); got != global {
+		t.Errorf("forHost of another host = %+v, want the global options", got)
+	}
+}
+
+func TestLoadTLSHostsCache(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("relies on XDG_CONFIG_HOME")
+	}
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	path := config.GetTLSHostsPath()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	write := func(content string, modTime time.Time) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	firstHost := func() string {
+		t.Helper()
+		hosts, err := loadTLSHosts()
+		if err != nil || len(hosts) != 1 {
+			t.Fatalf("loadTLSHosts = %v, %v", hosts, err)
+		}
+		return hosts[0].Hosts[0]
+	}
+
+	modTime := time.Now().Add(-time.Hour)
+	write(`[{"hosts":["a.corp"]}]`, modTime)
+	if got := firstHost(); got != "a.corp" {
+		t.Fatalf("host = %s, want a.corp", got)
+	}
+
+	// An unchanged file is not read again
+	write(`[{"hosts":["b.corp"]}]`, modTime)
+	if got := firstHost(); got != "a.corp" {
+		t.Errorf("host = %s, want the cached a.corp", got)
+	}
+
+	write(`[{"hosts":["b.corp"]}]`, modTime.Add(time.Second))
+	if got := firstHost(); got != "b.corp" {
+		t.Errorf("host = %s, want b.corp after the file changed", got)
+	}
+
+	os.Remove(path)
+	if hosts, err := loadTLSHosts(); err != nil || len(hosts) != 0 {
+		t.Errorf("loadTLSHosts after removing the file = %v, %v", hosts, err)
+	}
+}
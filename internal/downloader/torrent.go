@@ -0,0 +1,489 @@
+package downloader
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	alog "github.com/anacrolix/log"
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/anacrolix/torrent/storage"
+	"golang.org/x/time/rate"
+
+	"github.com/junaid2005p/surge/internal/config"
+	"github.com/junaid2005p/surge/internal/messages"
+	"github.com/junaid2005p/surge/internal/utils"
+)
+
+// MagnetScheme is the URI scheme of magnet links
+const MagnetScheme = "magnet"
+
+// TorrentContentType is the MIME type servers use for .torrent files
+const TorrentContentType = "application/x-bittorrent"
+
+const (
+	torrentFileExt      = ".torrent"
+	torrentPollInterval = 500 * time.Millisecond
+	torrentMinBurst     = 256 * KB // Rate limiter burst must fit a whole peer message
+	torrentMaxMetainfo  = 10 * MB  // Refuse absurdly large .torrent downloads
+)
+
+// torrentClientOptions lets tests adjust the shared client config (e.g. disable DHT)
+var torrentClientOptions func(*torrent.ClientConfig)
+
+// The torrent client is shared by all torrent downloads so that they use a single
+// listen port, DHT node and piece completion database.
+var (
+	torrentMu              sync.Mutex
+	torrentClient          *torrent.Client
+	torrentCompletion      storage.PieceCompletion
+	torrentDownloadLimiter = rate.NewLimiter(rate.Inf, torrentMinBurst)
+	torrentUploadLimiter   = rate.NewLimiter(rate.Inf, torrentMinBurst)
+)
+
+// Completed torrents seed in the background, outside the worker pool, until
+// their ratio is met, they are removed or the client is closed
+var (
+	seedingMu sync.Mutex
+	seeding   = make(map[string]*seedingTorrent) // By download ID
+)
+
+// seedingTorrent is a completed torrent still uploading to peers
+type seedingTorrent struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// IsTorrentSource reports whether source is a magnet link or points to a
+// .torrent file, either as a local path or an http(s)/file URL
+func IsTorrentSource(source string) bool {
+	if strings.HasPrefix(strings.ToLower(source), MagnetScheme+":") {
+		return true
+	}
+	p := source
+	if u, err := url.Parse(source); err == nil && len(u.Scheme) > 1 { // Single-letter schemes are Windows drive letters
+		if !isTorrentURLScheme(u.Scheme) {
+			return false
+		}
+		p = u.Path
+	}
+	return strings.EqualFold(filepath.Ext(p), torrentFileExt)
+}
+
+func isTorrentURLScheme(scheme string) bool {
+	switch strings.ToLower(scheme) {
+	case "http", "https", "file":
+		return true
+	}
+	return false
+}
+
+// localTorrentPath returns the filesystem path for a local .torrent source, or ""
+// if the source is remote
+func localTorrentPath(source string) string {
+	u, err := url.Parse(source)
+	if err != nil || len(u.Scheme) <= 1 { // Single-letter schemes are Windows drive letters
+		return source
+	}
+	if strings.EqualFold(u.Scheme, "file") {
+		return filepath.FromSlash(u.Path)
+	}
+	return ""
+}
+
+// LocalTorrentFile returns the absolute path of a local .torrent file source,
+// or "" if source is a URL or magnet link
+func LocalTorrentFile(source string) string {
+	if !IsTorrentSource(source) || strings.HasPrefix(strings.ToLower(source), MagnetScheme+":") {
+		return ""
+	}
+	p := localTorrentPath(source)
+	if p == "" {
+		return ""
+	}
+	if abs, err := filepath.Abs(p); err == nil {
+		return abs
+	}
+	return p
+}
+
+// sharedTorrentClient returns the process-wide torrent client, creating it on
+// first use, and applies the current bandwidth limits
+func sharedTorrentClient(runtime *RuntimeConfig) (*torrent.Client, storage.PieceCompletion, error) {
+	torrentMu.Lock()
+	defer torrentMu.Unlock()
+
+	setRateLimit(torrentDownloadLimiter, runtime.GetTorrentDownloadLimit())
+	setRateLimit(torrentUploadLimiter, runtime.GetTorrentUploadLimit())
+
+	if torrentClient != nil {
+		return torrentClient, torrentCompletion, nil
+	}
+
+	dataDir := filepath.Join(config.GetStateDir(), "torrents")
+	completion, err := storage.NewBoltPieceCompletion(dataDir)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open torrent piece database: %w", err)
+	}
+
+	logger := alog.NewLogger("surge")
+	logger.Handlers = []alog.Handler{alog.DiscardHandler} // Never write to the TUI's terminal
+
+	cfg := torrent.NewDefaultClientConfig()
+	cfg.DataDir = dataDir
+	cfg.DefaultStorage = storage.NewFileOpts(storage.NewFileClientOpts{
+		ClientBaseDir:   dataDir,
+		PieceCompletion: completion,
+	})
+	cfg.Seed = true
+	cfg.NoDefaultPortForwarding = true
+	cfg.DownloadRateLimiter = torrentDownloadLimiter
+	cfg.UploadRateLimiter = torrentUploadLimiter
+	cfg.HTTPUserAgent = runtime.GetUserAgent()
+	cfg.Logger = logger
+	if torrentClientOptions != nil {
+		torrentClientOptions(cfg)
+	}
+
+	client, err := torrent.NewClient(cfg)
+	if err != nil && cfg.ListenPort != 0 {
+		// Default port taken (e.g. another instance): let the OS pick one
+		utils.Debug("Torrent: listen on port %d failed (%v), using a random port", cfg.ListenPort, err)
+		cfg.ListenPort = 0
+		client, err = torrent.NewClient(cfg)
+	}
+	if err != nil {
+		completion.Close()
+		return nil, nil, fmt.Errorf("failed to start torrent client: %w", err)
+	}
+
+	torrentClient = client
+	torrentCompletion = completion
+	utils.Debug("Torrent client listening on port %d", client.LocalPort())
+	return torrentClient, torrentCompletion, nil
+}
+
+// CloseTorrentClient shuts down the shared torrent client, if one was started
+func CloseTorrentClient() {
+	stopAllSeeding()
+
+	torrentMu.Lock()
+	defer torrentMu.Unlock()
+
+	if torrentClient == nil {
+		return
+	}
+	torrentClient.Close()
+	torrentCompletion.Close()
+	torrentClient = nil
+	torrentCompletion = nil
+}
+
+// setRateLimit applies a bytes/second limit, where 0 means unlimited
+func setRateLimit(l *rate.Limiter, bytesPerSec int) {
+	if bytesPerSec <= 0 {
+		l.SetLimit(rate.Inf)
+		return
+	}
+	l.SetLimit(rate.Limit(bytesPerSec))
+	l.SetBurst(max(bytesPerSec, torrentMinBurst))
+}
+
+// loadTorrentSpec resolves a magnet link, .torrent URL or local .torrent file
+func loadTorrentSpec(ctx context.Context, source string, runtime *RuntimeConfig) (*torrent.TorrentSpec, error) {
+	if strings.HasPrefix(strings.ToLower(source), MagnetScheme+":") {
+		spec, err := torrent.TorrentSpecFromMagnetUri(source)
+		if err != nil {
+			return nil, fmt.Errorf("invalid magnet link: %w", err)
+		}
+		return spec, nil
+	}
+
+	var mi *metainfo.MetaInfo
+	var err error
+	if p := localTorrentPath(source); p != "" {
+		mi, err = metainfo.LoadFromFile(p)
+	} else {
+		mi, err = fetchMetainfo(ctx, source, runtime)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load torrent: %w", err)
+	}
+
+	spec, err := torrent.TorrentSpecFromMetaInfoErr(mi)
+	if err != nil {
+		return nil, fmt.Errorf("invalid torrent: %w", err)
+	}
+	return spec, nil
+}
+
+// fetchMetainfo downloads and parses a .torrent file over HTTP
+func fetchMetainfo(ctx context.Context, rawurl string, runtime *RuntimeConfig) (*metainfo.MetaInfo, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawurl, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", runtime.GetUserAgent())
+
+	resp, err := probeClient(runtime).Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+	return metainfo.Load(&limitedReader{r: resp.Body, n: torrentMaxMetainfo})
+}
+
+// limitedReader is io.LimitReader that fails instead of silently truncating
+type limitedReader struct {
+	r io.Reader
+	n int64
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.n <= 0 {
+		return 0, fmt.Errorf("response exceeds size limit")
+	}
+	if int64(len(p)) > l.n {
+		p = p[:l.n]
+	}
+	n, err := l.r.Read(p)
+	l.n -= int64(n)
+	return n, err
+}
+
+// downloadTorrent downloads a torrent into cfg.OutputPath. Single-file torrents
+// are saved as OutputPath/<name>, multi-file torrents as the directory OutputPath/<name>/.
+// Pieces are verified against the torrent's hashes as they arrive; progress survives
+// pause/restart through the piece completion database in the state directory.
+func downloadTorrent(ctx context.Context, cfg DownloadConfig) error {
+	client, completion, err := sharedTorrentClient(cfg.Runtime)
+	if err != nil {
+		return err
+	}
+
+	spec, err := loadTorrentSpec(ctx, cfg.URL, cfg.Runtime)
+	if err != nil {
+		return err
+	}
+
+	outputDir := cfg.OutputPath
+	if outputDir == "" {
+		outputDir = "."
+	}
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+	spec.Storage = storage.NewFileOpts(storage.NewFileClientOpts{
+		ClientBaseDir:   outputDir,
+		PieceCompletion: completion,
+	})
+
+	t, isNew, err := client.AddTorrentSpec(spec)
+	if err != nil {
+		return fmt.Errorf("failed to add torrent: %w", err)
+	}
+	if !isNew {
+		return fmt.Errorf("torrent %s is already being downloaded", spec.InfoHash.HexString())
+	}
+	seeds := false
+	defer func() {
+		if !seeds {
+			t.Drop()
+		}
+	}()
+
+	// Create cancellable context for pause support
+	downloadCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	if cfg.State != nil {
+		cfg.State.CancelFunc = cancel
+	}
+
+	// Magnet links need metadata from peers before we know names and sizes
+	name := spec.DisplayName
+	if name == "" {
+		name = spec.InfoHash.HexString()
+	}
+	select {
+	case <-t.GotInfo():
+	case <-downloadCtx.Done():
+		saveTorrentPause(cfg, filepath.Join(outputDir, name), 0, 0)
+		return nil
+	}
+
+	name = t.Info().BestName()
+	destPath := filepath.Join(outputDir, name)
+	totalSize := t.Length()
+	utils.Debug("Torrent %s: %s (%d bytes, %d pieces)", t.InfoHash().HexString(), name, totalSize, t.NumPieces())
+
+	if cfg.ProgressCh != nil {
+		cfg.ProgressCh <- messages.DownloadStartedMsg{
+			DownloadID: cfg.ID,
+			URL:        cfg.URL,
+			Filename:   name,
+			Total:      totalSize,
+			DestPath:   destPath,
+		}
+	}
+	if cfg.State != nil {
+		cfg.State.Downloaded.Store(t.BytesCompleted())
+		cfg.State.SetTotalSize(totalSize)
+	}
+
+	t.DownloadAll()
+
+	ticker := time.NewTicker(torrentPollInterval)
+	defer ticker.Stop()
+
+	for {
+		completed := t.BytesCompleted()
+		updateTorrentProgress(cfg.State, t, completed)
+		if completed >= totalSize {
+			break
+		}
+
+		select {
+		case <-downloadCtx.Done():
+			saveTorrentPause(cfg, destPath, totalSize, completed)
+			return nil
+		case <-ticker.C:
+		}
+	}
+
+	_ = DeleteState(cfg.ID, cfg.URL, destPath)
+	if cfg.IsResume && cfg.DestPath != "" && cfg.DestPath != destPath {
+		_ = DeleteState(cfg.ID, cfg.URL, cfg.DestPath) // Paused before metadata arrived
+	}
+
+	if ratio := cfg.Runtime.GetTorrentSeedRatio(); ratio > 0 {
+		seeds = true
+		startSeeding(cfg.ID, cfg.State, t, ratio)
+	}
+
+	return nil
+}
+
+// updateTorrentProgress publishes torrent progress, reporting peers as connections
+func updateTorrentProgress(state *ProgressState, t *torrent.Torrent, completed int64) {
+	if state == nil {
+		return
+	}
+	state.Downloaded.Store(completed)
+	state.Peers.Store(int32(t.Stats().ActivePeers))
+}
+
+// startSeeding seeds t in the background and drops it when seeding ends
+func startSeeding(id string, state *ProgressState, t *torrent.Torrent, ratio float64) {
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &seedingTorrent{cancel: cancel, done: make(chan struct{})}
+
+	seedingMu.Lock()
+	seeding[id] = s
+	seedingMu.Unlock()
+
+	go func() {
+		defer close(s.done)
+		seedTorrent(ctx, state, t, ratio)
+		t.Drop()
+
+		seedingMu.Lock()
+		if seeding[id] == s {
+			delete(seeding, id)
+		}
+		seedingMu.Unlock()
+		cancel()
+	}()
+}
+
+// StopSeeding stops seeding the completed torrent download id, if it still
+// seeds, and waits for it to be dropped
+func StopSeeding(id string) {
+	seedingMu.Lock()
+	s := seeding[id]
+	seedingMu.Unlock()
+
+	if s != nil {
+		s.cancel()
+		<-s.done
+	}
+}
+
+// stopAllSeeding stops every seeding torrent and waits for them to be dropped
+func stopAllSeeding() {
+	seedingMu.Lock()
+	all := make([]*seedingTorrent, 0, len(seeding))
+	for _, s := range seeding {
+		all = append(all, s)
+	}
+	seedingMu.Unlock()
+
+	for _, s := range all {
+		s.cancel()
+		<-s.done
+	}
+}
+
+// isSeeding reports whether download id is still seeding
+func isSeeding(id string) bool {
+	seedingMu.Lock()
+	defer seedingMu.Unlock()
+	return seeding[id] != nil
+}
+
+// seedTorrent uploads to peers until ratio × size has been uploaded or ctx is cancelled
+func seedTorrent(ctx context.Context, state *ProgressState, t *torrent.Torrent, ratio float64) {
+	target := int64(math.Ceil(ratio * float64(t.Length())))
+	utils.Debug("Torrent %s: seeding until %d bytes uploaded", t.Name(), target)
+
+	ticker := time.NewTicker(torrentPollInterval)
+	defer ticker.Stop()
+
+	for {
+		stats := t.Stats()
+		if state != nil {
+			state.Peers.Store(int32(stats.ActivePeers))
+		}
+		if uploaded := stats.BytesWrittenData.Int64(); uploaded >= target {
+			utils.Debug("Torrent %s: seed ratio reached (%d bytes uploaded)", t.Name(), uploaded)
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// saveTorrentPause records a paused torrent in the master list. No tasks are
+// saved: verified pieces are tracked by the piece completion database.
+func saveTorrentPause(cfg DownloadConfig, destPath string, totalSize, downloaded int64) {
+	if cfg.State == nil || !cfg.State.IsPaused() {
+		return
+	}
+	state := &DownloadState{
+		URL:        cfg.URL,
+		ID:         cfg.ID,
+		DestPath:   destPath,
+		TotalSize:  totalSize,
+		Downloaded: downloaded,
+		Filename:   filepath.Base(destPath),
+	}
+	if err := SaveState(cfg.URL, destPath, state); err != nil {
+		utils.Debug("Failed to save torrent pause state: %v", err)
+	}
+}
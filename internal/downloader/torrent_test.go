@@ -0,0 +1,412 @@
+package downloader
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	alog "github.com/anacrolix/log"
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/anacrolix/torrent/storage"
+	tea "github.com/charmbracelet/bubbletea"
+	"golang.org/x/time/rate"
+
+	"github.com/junaid2005p/surge/internal/config"
+	"github.com/junaid2005p/surge/internal/messages"
+	"github.com/junaid2005p/surge/internal/testutil"
+)
+
+// useTestTorrentClient keeps the shared client local-only and tears it down after the test
+func useTestTorrentClient(t *testing.T) {
+	t.Helper()
+	if err := config.EnsureDirs(); err != nil {
+		t.Fatalf("Failed to create config dirs: %v", err)
+	}
+	CloseTorrentClient()
+	torrentClientOptions = func(cfg *torrent.ClientConfig) {
+		cfg.NoDHT = true
+		cfg.DisablePEX = true
+		cfg.DisableIPv6 = true
+		cfg.ListenPort = 0
+	}
+	t.Cleanup(func() {
+		CloseTorrentClient()
+		torrentClientOptions = nil
+	})
+}
+
+// testSwarm is a local tracker plus a single seeding peer
+type testSwarm struct {
+	mi      *metainfo.MetaInfo
+	info    metainfo.Info
+	srcPath string
+	seeder  *torrent.Client
+}
+
+// startTestSwarm creates a random file, seeds it from an in-process client
+// and serves an HTTP tracker that hands out the seeder's address
+func startTestSwarm(t *testing.T, name string, size int64) *testSwarm {
+	t.Helper()
+
+	srcDir := t.TempDir()
+	srcPath, err := testutil.CreateTestFile(srcDir, name, size, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logger := alog.NewLogger("seeder")
+	logger.Handlers = []alog.Handler{alog.DiscardHandler}
+
+	cfg := torrent.NewDefaultClientConfig()
+	cfg.Seed = true
+	cfg.NoDHT = true
+	cfg.DisablePEX = true
+	cfg.DisableIPv6 = true
+	cfg.ListenPort = 0
+	cfg.DataDir = srcDir
+	cfg.DefaultStorage = storage.NewFileOpts(storage.NewFileClientOpts{
+		ClientBaseDir:   srcDir,
+		PieceCompletion: storage.NewMapPieceCompletion(),
+	})
+	cfg.Logger = logger
+	seeder, err := torrent.NewClient(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { seeder.Close() })
+
+	tracker := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		peer := make([]byte, 6) // BEP 23 compact peer: IPv4 + port
+		copy(peer, net.IPv4(127, 0, 0, 1).To4())
+		binary.BigEndian.PutUint16(peer[4:], uint16(seeder.LocalPort()))
+		resp, _ := bencode.Marshal(map[string]interface{}{
+			"interval": 60,
+			"peers":    string(peer),
+		})
+		w.Write(resp)
+	}))
+	t.Cleanup(tracker.Close)
+
+	info := metainfo.Info{PieceLength: 32 * KB}
+	if err := info.BuildFromFilePath(srcPath); err != nil {
+		t.Fatal(err)
+	}
+	infoBytes, err := bencode.Marshal(info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mi := &metainfo.MetaInfo{
+		InfoBytes: infoBytes,
+		Announce:  tracker.URL + "/announce",
+	}
+
+	seed, err := seeder.AddTorrent(mi)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seed.VerifyData()
+	if seed.BytesCompleted() != size {
+		t.Fatalf("seeder has %d of %d bytes", seed.BytesCompleted(), size)
+	}
+
+	return &testSwarm{mi: mi, info: info, srcPath: srcPath, seeder: seeder}
+}
+
+func (s *testSwarm) writeTorrentFile(t *testing.T) string {
+	t.Helper()
+	p := filepath.Join(t.TempDir(), s.info.Name+".torrent")
+	f, err := os.Create(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := s.mi.Write(f); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func (s *testSwarm) magnet() string {
+	h := s.mi.HashInfoBytes()
+	m := s.mi.Magnet(&h, &s.info)
+	return m.String()
+}
+
+func TestIsTorrentSource(t *testing.T) {
+	tests := []struct {
+		source string
+		want   bool
+	}{
+		{"magnet:?xt=urn:btih:c9e15763f722f23e98a29decdfae341b98d53056", true},
+		{"MAGNET:?xt=urn:btih:c9e15763f722f23e98a29decdfae341b98d53056", true},
+		{"https://example.com/ubuntu.iso.torrent", true},
+		{"https://example.com/ubuntu.iso.torrent?passkey=abc", true},
+		{"file:///home/user/ubuntu.iso.torrent", true},
+		{"/home/user/ubuntu.iso.torrent", true},
+		{"ubuntu.iso.torrent", true},
+		{`C:\Users\me\ubuntu.iso.torrent`, true},
+		{"https://example.com/ubuntu.iso", false},
+		{"https://example.com/download.php?file=a.torrent", false},
+		{"sftp://host/files/a.torrent", false},
+	}
+
+	for _, tt := range tests {
+		if got := IsTorrentSource(tt.source); got != tt.want {
+			t.Errorf("IsTorrentSource(%q) = %v, want %v", tt.source, got, tt.want)
+		}
+	}
+}
+
+func TestLocalTorrentFile(t *testing.T) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := LocalTorrentFile("a.torrent"), filepath.Join(cwd, "a.torrent"); got != want {
+		t.Errorf("LocalTorrentFile(relative) = %q, want %q", got, want)
+	}
+	for _, source := range []string{
+		"https://example.com/a.torrent",
+		"magnet:?xt=urn:btih:c9e15763f722f23e98a29decdfae341b98d53056",
+		"https://example.com/a.zip",
+	} {
+		if got := LocalTorrentFile(source); got != "" {
+			t.Errorf("LocalTorrentFile(%q) = %q, want empty", source, got)
+		}
+	}
+}
+
+func TestTUIDownload_TorrentSeedsInBackground(t *testing.T) {
+	useTestTorrentClient(t)
+	swarm := startTestSwarm(t, "seeded.bin", 256*KB)
+	outDir := t.TempDir()
+
+	cfg := DownloadConfig{
+		URL:        swarm.writeTorrentFile(t),
+		OutputPath: outDir,
+		ID:         "torrent-seed",
+		State:      NewProgressState("torrent-seed", 0),
+		Runtime:    &RuntimeConfig{TorrentSeedRatio: 100}, // Never met by the lone peer
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	// The download returns once complete, leaving the torrent seeding
+	if err := TUIDownload(ctx, cfg); err != nil {
+		t.Fatalf("torrent download failed: %v", err)
+	}
+	if !isSeeding("torrent-seed") {
+		t.Fatal("completed torrent should keep seeding")
+	}
+
+	StopSeeding("torrent-seed")
+	if isSeeding("torrent-seed") {
+		t.Error("StopSeeding should stop the torrent")
+	}
+}
+
+func TestTUIDownload_TorrentFile(t *testing.T) {
+	useTestTorrentClient(t)
+	swarm := startTestSwarm(t, "payload.bin", 512*KB)
+	outDir := t.TempDir()
+
+	progressCh := make(chan tea.Msg, 10)
+	state := NewProgressState("torrent-file", 0)
+	cfg := DownloadConfig{
+		URL:        swarm.writeTorrentFile(t),
+		OutputPath: outDir,
+		ID:         "torrent-file",
+		ProgressCh: progressCh,
+		State:      state,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if err := TUIDownload(ctx, cfg); err != nil {
+		t.Fatalf("torrent download failed: %v", err)
+	}
+
+	destPath := filepath.Join(outDir, "payload.bin")
+	match, err := testutil.CompareFiles(swarm.srcPath, destPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !match {
+		t.Error("downloaded file does not match seeded file")
+	}
+	if state.Downloaded.Load() != 512*KB {
+		t.Errorf("Downloaded = %d, want %d", state.Downloaded.Load(), 512*KB)
+	}
+
+	select {
+	case msg := <-progressCh:
+		started, ok := msg.(messages.DownloadStartedMsg)
+		if !ok {
+			t.Fatalf("expected DownloadStartedMsg, got %T", msg)
+		}
+		if started.Filename != "payload.bin" || started.Total != 512*KB || started.DestPath != destPath {
+			t.Errorf("unexpected start message: %+v", started)
+		}
+	default:
+		t.Error("no DownloadStartedMsg sent")
+	}
+}
+
+func TestTUIDownload_Magnet(t *testing.T) {
+	useTestTorrentClient(t)
+	swarm := startTestSwarm(t, "magnet.bin", 256*KB)
+	outDir := t.TempDir()
+
+	cfg := DownloadConfig{
+		URL:        swarm.magnet(),
+		OutputPath: outDir,
+		ID:         "torrent-magnet",
+		State:      NewProgressState("torrent-magnet", 0),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if err := TUIDownload(ctx, cfg); err != nil {
+		t.Fatalf("magnet download failed: %v", err)
+	}
+
+	match, err := testutil.CompareFiles(swarm.srcPath, filepath.Join(outDir, "magnet.bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !match {
+		t.Error("downloaded file does not match seeded file")
+	}
+}
+
+func TestTUIDownload_TorrentContentType(t *testing.T) {
+	useTestTorrentClient(t)
+	swarm := startTestSwarm(t, "served.bin", 128*KB)
+	outDir := t.TempDir()
+
+	// .torrent served without the extension in the URL
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", TorrentContentType)
+		swarm.mi.Write(w)
+	}))
+	defer server.Close()
+
+	cfg := DownloadConfig{
+		URL:        server.URL + "/download.php?id=1",
+		OutputPath: outDir,
+		ID:         "torrent-served",
+		State:      NewProgressState("torrent-served", 0),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if err := TUIDownload(ctx, cfg); err != nil {
+		t.Fatalf("torrent download failed: %v", err)
+	}
+
+	match, err := testutil.CompareFiles(swarm.srcPath, filepath.Join(outDir, "served.bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !match {
+		t.Error("downloaded file does not match seeded file")
+	}
+}
+
+func TestTUIDownload_TorrentPauseResume(t *testing.T) {
+	useTestTorrentClient(t)
+	fileSize := int64(2 * MB)
+	swarm := startTestSwarm(t, "slow.bin", fileSize)
+	outDir := t.TempDir()
+	source := swarm.writeTorrentFile(t)
+	destPath := filepath.Join(outDir, "slow.bin")
+	defer DeleteState("torrent-pause", source, destPath)
+
+	// Rate limit the first session so there is time to pause it
+	state := NewProgressState("torrent-pause", 0)
+	cfg := DownloadConfig{
+		URL:        source,
+		OutputPath: outDir,
+		ID:         "torrent-pause",
+		State:      state,
+		Runtime:    &RuntimeConfig{TorrentDownloadLimit: 256 * KB},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	errCh := make(chan error, 1)
+	go func() { errCh <- TUIDownload(ctx, cfg) }()
+
+	deadline := time.Now().Add(20 * time.Second)
+	for state.Downloaded.Load() == 0 && time.Now().Before(deadline) {
+		time.Sleep(50 * time.Millisecond)
+	}
+	state.Pause()
+
+	if err := <-errCh; err != nil {
+		t.Fatalf("paused download returned error: %v", err)
+	}
+
+	saved, err := LoadState(source, destPath)
+	if err != nil {
+		t.Fatalf("pause state not saved: %v", err)
+	}
+	if saved.Downloaded == 0 || saved.Downloaded >= fileSize {
+		t.Errorf("saved Downloaded = %d, want partial progress", saved.Downloaded)
+	}
+	if saved.TotalSize != fileSize {
+		t.Errorf("saved TotalSize = %d, want %d", saved.TotalSize, fileSize)
+	}
+
+	// Resume without a limit
+	state.Resume()
+	cfg.IsResume = true
+	cfg.DestPath = destPath
+	cfg.Runtime = nil
+	if err := TUIDownload(ctx, cfg); err != nil {
+		t.Fatalf("resume failed: %v", err)
+	}
+
+	match, err := testutil.CompareFiles(swarm.srcPath, destPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !match {
+		t.Error("resumed file does not match seeded file")
+	}
+	if _, err := LoadState(source, destPath); err == nil {
+		t.Error("state file should be deleted after completion")
+	}
+}
+
+func TestSetRateLimit(t *testing.T) {
+	l := torrentDownloadLimiter
+	defer setRateLimit(l, 0)
+
+	setRateLimit(l, 64*KB)
+	if l.Limit() != 64*KB {
+		t.Errorf("Limit = %v, want %d", l.Limit(), 64*KB)
+	}
+	if l.Burst() < torrentMinBurst {
+		t.Errorf("Burst = %d, want at least %d", l.Burst(), torrentMinBurst)
+	}
+
+	setRateLimit(l, 0)
+	if l.Limit() != rate.Inf {
+		t.Errorf("Limit = %v, want unlimited", l.Limit())
+	}
+}
@@ -0,0 +1,259 @@
+package downloader
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/http/httpproxy"
+
+	"github.com/junaid2005p/surge/internal/config"
+)
+
+// hostTransport is the transport shared by all downloads from one host, so
+// idle connections are reused across downloads instead of redoing TCP and TLS
+// handshakes. Its MaxConnsPerHost applies to all of them together.
+type hostTransport struct {
+	*http.Transport
+	open atomic.Int32 // Connections currently open
+}
+
+// transportKey identifies the downloads that can share a transport
+type transportKey struct {
+	scheme    string
+	host      string       // host[:port], lower case
+	maxConns  int          // MaxConnectionsPerHost when the transport was created
+	http2     string       // HTTP/2 mode, HTTP2Off for HTTP/1.1 only
+	slot      int          // Which of the separate transports of HTTP2Connections
+	ipVersion string       // IP version preference for the host's addresses
+	dns       *dnsResolver // Resolves the host's addresses
+	tls       tlsOptions   // TLS settings for the host
+	proxy     string       // Proxy URL, empty for direct connections
+}
+
+// downloadTLSConfig is the base TLS configuration of download connections,
+// nil for the defaults; the TLS settings apply on top of it (see
+// tlsConfigFor). Tests replace it to trust their servers.
+var downloadTLSConfig *tls.Config
+
+var (
+	transportsMu sync.Mutex
+	transports   = make(map[transportKey]*hostTransport)
+)
+
+// sharedTransport returns the transport for key, creating it on first use
+func sharedTransport(key transportKey) *hostTransport {
+	transportsMu.Lock()
+	defer transportsMu.Unlock()
+	t, ok := transports[key]
+	if !ok {
+		t = newHostTransport(key)
+		transports[key] = t
+	}
+	return t
+}
+
+// newHostTransport creates a transport tuned for concurrent downloads. Unless
+// key selects HTTP/2 it speaks HTTP/1.1 only, so every concurrent request gets
+// its own TCP connection. Connections are spread over the addresses of the
+// host (see dialEdge).
+func newHostTransport(key transportKey) *hostTransport {
+	maxConns := key.maxConns
+	t := &hostTransport{}
+	tlsConf, _ := tlsConfigFor(key.tls) // Checked by pooledTransport
+	dialer := &net.Dialer{
+		Timeout:   DialTimeout,
+		KeepAlive: KeepAliveDuration,
+	}
+	var proxy func(*http.Request) (*url.URL, error)
+	if proxyURL, err := url.Parse(key.proxy); key.proxy != "" && err == nil {
+		proxy = http.ProxyURL(proxyURL)
+	}
+
+	t.Transport = &http.Transport{
+		Proxy: proxy,
+
+		// Connection pooling
+		MaxIdleConns:        DefaultMaxIdleConns,
+		MaxIdleConnsPerHost: maxConns + 2, // Slightly more than max to handle bursts
+		MaxConnsPerHost:     maxConns,
+
+		TLSClientConfig: tlsConf.Clone(), // Set up per transport (ALPN)
+
+		// Timeouts to prevent hung connections
+		IdleConnTimeout:       DefaultIdleConnTimeout,
+		TLSHandshakeTimeout:   DefaultTLSHandshakeTimeout,
+		ResponseHeaderTimeout: DefaultResponseHeaderTimeout,
+		ExpectContinueTimeout: DefaultExpectContinueTimeout,
+
+		// Performance tuning
+		DisableCompression: true, // Files are usually already compressed
+
+		// Dial settings for TCP reliability, counting open connections
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			conn, err := dialEdge(ctx, dialer, key.dns, network, addr, key.ipVersion)
+			if err != nil {
+				return nil, err
+			}
+			t.open.Add(1)
+			return &countedConn{Conn: conn, open: &t.open}, nil
+		},
+	}
+	if key.http2 == HTTP2Connections || key.http2 == HTTP2Streams {
+		t.ForceAttemptHTTP2 = true
+	} else {
+		// FORCE HTTP/1.1 for multiple TCP connections
+		t.TLSNextProto = make(map[string]func(authority string, c *tls.Conn) http.RoundTripper)
+	}
+	return t
+}
+
+// countedConn takes itself off its transport's count when closed
+type countedConn struct {
+	net.Conn
+	open *atomic.Int32
+	once sync.Once
+}
+
+func (c *countedConn) Close() error {
+	c.once.Do(func() { c.open.Add(-1) })
+	return c.Conn.Close()
+}
+
+// pooledTransport sends each request through the shared transport of its
+// host, which also covers redirects to another host (e.g. a CDN). Requests
+// go over HTTP/3 where the HTTP/3 settings select it (see http3Endpoint).
+// TLS settings are applied per host (see tlsOptions.forHost).
+type pooledTransport struct {
+	maxConns   int
+	ipVersion  string           // IP version preference
+	dns        *dnsResolver     // Resolves hosts, for TCP and QUIC
+	http2      string           // HTTP/2 mode
+	http3      string           // HTTP/3 mode
+	http3Hosts []string         // Hosts that always try HTTP/3
+	http3Conns int              // QUIC connections per host
+	tls        tlsOptions       // Global TLS settings
+	tlsHosts   []config.TLSHost // Per-host TLS options
+	tlsErr     error            // Why the per-host TLS options could not be loaded
+}
+
+func (p pooledTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	tlsOpts, err := p.tlsOptionsFor(req.URL)
+	if err != nil {
+		return nil, err
+	}
+	proxy, err := proxyFor(req.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	// QUIC can't go through an HTTP proxy
+	if addr, ok := p.http3Endpoint(req.URL, time.Now()); ok && proxy == nil {
+		if resp, done, err := roundTripHTTP3(req, addr, p.http3Conns, p.dns, tlsOpts); done {
+			return resp, err
+		}
+	}
+
+	key := transportKey{scheme: req.URL.Scheme, host: strings.ToLower(req.URL.Host), maxConns: p.maxConns, http2: p.http2, ipVersion: p.ipVersion, dns: p.dns, tls: tlsOpts}
+	if proxy != nil {
+		key.proxy = proxy.String()
+	}
+	var rt http.RoundTripper
+	switch p.http2 {
+	case HTTP2Connections:
+		rt = spreadTransportFor(key)
+	default:
+		rt = sharedTransport(key)
+	}
+
+	resp, err := rt.RoundTrip(req)
+	if err == nil {
+		recordAltSvc(req.URL, resp.Header.Get("Alt-Svc"), time.Now())
+	}
+	return resp, err
+}
+
+// proxyFor returns the proxy for requests to u from HTTP_PROXY, HTTPS_PROXY
+// and NO_PROXY, or nil to connect directly. Unlike http.ProxyFromEnvironment
+// it does not cache the environment.
+func proxyFor(u *url.URL) (*url.URL, error) {
+	return httpproxy.FromEnvironment().ProxyFunc()(u)
+}
+
+// tlsOptionsFor returns the TLS options for requests to u, failing if they
+// cannot be used
+func (p pooledTransport) tlsOptionsFor(u *url.URL) (tlsOptions, error) {
+	if u.Scheme != "https" {
+		return tlsOptions{}, nil
+	}
+	if p.tlsErr != nil {
+		return tlsOptions{}, p.tlsErr
+	}
+	opts := p.tls.forHost(p.tlsHosts, u.Hostname())
+	_, err := tlsConfigFor(opts)
+	return opts, err
+}
+
+// newDownloadClient returns a client whose connections are pooled per host
+// with those of all other downloads
+func newDownloadClient(runtime *RuntimeConfig) *http.Client {
+	tlsHosts, tlsErr := loadTLSHosts()
+	tlsOpts := tlsOptions{
+		caFile:     runtime.GetTLSCAFile(),
+		clientCert: runtime.GetTLSClientCert(),
+		clientKey:  runtime.GetTLSClientKey(),
+		minVersion: runtime.GetTLSMinVersion(),
+		insecure:   runtime.GetTLSInsecure(),
+	}
+	dns := runtime.GetDNS()
+	return &http.Client{
+		Transport: pooledTransport{
+			maxConns:   runtime.GetMaxConnectionsPerHost(),
+			ipVersion:  runtime.GetIPVersion(),
+			dns:        dnsResolverFor(dns, runtime.GetResolve(), dohTLSOptions(dns, tlsOpts, tlsHosts)),
+			http2:      runtime.GetHTTP2(),
+			http3:      runtime.GetHTTP3(),
+			http3Hosts: runtime.GetHTTP3Hosts(),
+			http3Conns: runtime.GetHTTP3Connections(),
+			tls:        tlsOpts,
+			tlsHosts:   tlsHosts,
+			tlsErr:     tlsErr,
+		},
+	}
+}
+
+// hostConnections returns how many connections all downloads together hold
+// open to the host of rawurl
+func hostConnections(rawurl string) int {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return 0
+	}
+	host := strings.ToLower(u.Host)
+
+	transportsMu.Lock()
+	defer transportsMu.Unlock()
+	n := 0
+	for key, t := range transports {
+		if key.scheme == u.Scheme && key.host == host {
+			n += int(t.open.Load())
+		}
+	}
+	return n
+}
+
+// closeIdleConnections closes the idle connections of all shared transports
+func closeIdleConnections() {
+	transportsMu.Lock()
+	defer transportsMu.Unlock()
+	for _, t := range transports {
+		t.CloseIdleConnections()
+	}
+	closeIdleHTTP3Connections()
+}
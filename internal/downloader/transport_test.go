@@ -0,0 +1,186 @@
+package downloader
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSharedTransport(t *testing.T) {
+	key := func(host string, maxConns int) transportKey {
+		return transportKey{scheme: "https", host: host, maxConns: maxConns, http2: HTTP2Off, ipVersion: IPVersionAuto, dns: systemDNS}
+	}
+
+	if sharedTransport(key("pool.example.com", 8)) != sharedTransport(key("pool.example.com", 8)) {
+		t.Error("downloads from the same host should share a transport")
+	}
+	if sharedTransport(key("pool.example.com", 8)) == sharedTransport(key("other.example.com", 8)) {
+		t.Error("different hosts should not share a transport")
+	}
+	if sharedTransport(key("pool.example.com", 8)) == sharedTransport(key("pool.example.com", 16)) {
+		t.Error("a changed connection limit should get a new transport")
+	}
+	if got := sharedTransport(key("pool.example.com", 8)).MaxConnsPerHost; got != 8 {
+		t.Errorf("MaxConnsPerHost = %d, want 8", got)
+	}
+}
+
+func TestNewDownloadClient_SharesTransports(t *testing.T) {
+	var hosts sync.Map
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hosts.Store(r.RemoteAddr, true)
+	}))
+	defer server.Close()
+	u, _ := url.Parse(server.URL)
+
+	// Separate clients for the same host and limit use the same transport
+	for i := 0; i < 3; i++ {
+		resp, err := newDownloadClient(&RuntimeConfig{MaxConnectionsPerHost: 3}).Get(server.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}
+	n := 0
+	hosts.Range(func(_, _ any) bool { n++; return true })
+	if n != 1 {
+		t.Errorf("three requests from separate clients used %d connections, want 1", n)
+	}
+	if tr := sharedTransport(transportKey{scheme: "http", host: u.Host, maxConns: 3, http2: HTTP2Off, ipVersion: IPVersionAuto, dns: systemDNS}); tr.open.Load() != 1 {
+		t.Errorf("shared transport holds %d connections, want the client's 1", tr.open.Load())
+	}
+}
+
+func TestDownloadClient_ReusesConnectionsAcrossDownloads(t *testing.T) {
+	data := randomBytes(t, 256*KB)
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(data))
+	}))
+	var dials atomic.Int32
+	server.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			dials.Add(1)
+		}
+	}
+	server.Start()
+	defer server.Close()
+
+	outDir := t.TempDir()
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	for _, name := range []string{"one.bin", "two.bin", "three.bin"} {
+		err := TUIDownload(ctx, DownloadConfig{
+			URL:        server.URL + "/" + name,
+			OutputPath: outDir,
+			ID:         name,
+			Filename:   name,
+			Runtime:    &RuntimeConfig{},
+		})
+		if err != nil {
+			t.Fatalf("download of %s failed: %v", name, err)
+		}
+		if got, err := os.ReadFile(filepath.Join(outDir, name)); err != nil || !bytes.Equal(got, data) {
+			t.Fatalf("%s content mismatch (err %v)", name, err)
+		}
+	}
+
+	if n := dials.Load(); n != 1 {
+		t.Errorf("opened %d connections for three small downloads, want 1", n)
+	}
+	if n := hostConnections(server.URL); n != 1 {
+		t.Errorf("hostConnections = %d, want 1 idle connection", n)
+	}
+}
+
+// startConnectProxy starts an HTTP proxy that tunnels CONNECT requests to
+// target, whatever host they name. The local addresses of the tunnels'
+// upstream connections are stored in tunnels.
+func startConnectProxy(t *testing.T, target string, tunnels *sync.Map) *httptest.Server {
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodConnect {
+			http.Error(w, "CONNECT only", http.StatusMethodNotAllowed)
+			return
+		}
+		upstream, err := net.Dial("tcp", target)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		tunnels.Store(upstream.LocalAddr().String(), true)
+		w.WriteHeader(http.StatusOK)
+		client, buf, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			upstream.Close()
+			return
+		}
+		go func() {
+			io.Copy(upstream, buf)
+			upstream.Close()
+		}()
+		io.Copy(client, upstream)
+		client.Close()
+	}))
+	t.Cleanup(proxy.Close)
+	return proxy
+}
+
+func TestDownloadClient_HTTPSProxy(t *testing.T) {
+	data := randomBytes(t, 256*KB)
+	var tunnels sync.Map
+	var proxied, direct atomic.Int32
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := tunnels.Load(r.RemoteAddr); ok {
+			proxied.Add(1)
+		} else {
+			direct.Add(1)
+		}
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(data))
+	}))
+	defer server.Close()
+	trustServer(t, server)
+	u, _ := url.Parse(server.URL)
+	proxy := startConnectProxy(t, u.Host, &tunnels)
+
+	// example.com is in the test certificate; the override lets the direct
+	// download reach the server too
+	rawurl := "https://example.com:" + u.Port() + "/proxied.bin"
+	runtime := &RuntimeConfig{MaxConnectionsPerHost: 2, Resolve: []string{"example.com:" + u.Port() + ":127.0.0.1"}}
+	download := func(name string) {
+		t.Helper()
+		outDir := t.TempDir()
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := TUIDownload(ctx, DownloadConfig{URL: rawurl, OutputPath: outDir, ID: name, Filename: name, Runtime: runtime}); err != nil {
+			t.Fatalf("%s: download failed: %v", name, err)
+		}
+		if got, err := os.ReadFile(filepath.Join(outDir, name)); err != nil || !bytes.Equal(got, data) {
+			t.Fatalf("%s: content mismatch (err %v)", name, err)
+		}
+	}
+
+	t.Setenv("HTTPS_PROXY", proxy.URL)
+	t.Setenv("NO_PROXY", "")
+	download("proxied.bin")
+	if proxied.Load() == 0 || direct.Load() != 0 {
+		t.Fatalf("requests: %d through the proxy, %d direct; want all through HTTPS_PROXY", proxied.Load(), direct.Load())
+	}
+
+	// Connections through the proxy are not reused for direct requests
+	before := proxied.Load()
+	t.Setenv("NO_PROXY", "example.com")
+	download("direct.bin")
+	if proxied.Load() != before || direct.Load() == 0 {
+		t.Errorf("requests: %d more through the proxy, %d direct; want all direct", proxied.Load()-before, direct.Load())
+	}
+}
@@ -0,0 +1,266 @@
+package downloader
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/junaid2005p/surge/internal/messages"
+	"github.com/junaid2005p/surge/internal/utils"
+)
+
+// WebDAV URL schemes; they map onto plain HTTP(S) requests
+const (
+	WebDAVScheme       = "webdav"
+	WebDAVSecureScheme = "webdavs"
+)
+
+// webdavPropfindBody asks only for the properties needed to walk a tree
+const webdavPropfindBody = `<?xml version="1.0" encoding="utf-8"?>` +
+	`<D:propfind xmlns:D="DAV:"><D:prop><D:resourcetype/><D:getcontentlength/></D:prop></D:propfind>`
+
+// isWebDAVURL reports whether rawurl uses the webdav:// or webdavs:// scheme
+func isWebDAVURL(rawurl string) bool {
+	u, err := url.Parse(rawurl)
+	return err == nil && (strings.EqualFold(u.Scheme, WebDAVScheme) || strings.EqualFold(u.Scheme, WebDAVSecureScheme))
+}
+
+// webdavHTTPURL rewrites a webdav(s):// URL to the http(s):// URL it is served from.
+// Other URLs are returned unchanged.
+func webdavHTTPURL(rawurl string) string {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return rawurl
+	}
+	switch strings.ToLower(u.Scheme) {
+	case WebDAVScheme:
+		u.Scheme = "http"
+	case WebDAVSecureScheme:
+		u.Scheme = "https"
+	default:
+		return rawurl
+	}
+	return u.String()
+}
+
+// davMultistatus is the body of a 207 Multi-Status PROPFIND response
+type davMultistatus struct {
+	Responses []davResponse `xml:"DAV: response"`
+}
+
+type davResponse struct {
+	Href     string        `xml:"DAV: href"`
+	Propstat []davPropstat `xml:"DAV: propstat"`
+}
+
+type davPropstat struct {
+	Status string `xml:"DAV: status"`
+	Prop   struct {
+		ResourceType struct {
+			Collection *struct{} `xml:"DAV: collection"`
+		} `xml:"DAV: resourcetype"`
+		ContentLength string `xml:"DAV: getcontentlength"`
+	} `xml:"DAV: prop"`
+}
+
+// davResource is a single entry of a PROPFIND listing
+type davResource struct {
+	Path       string // Unescaped server path
+	Collection bool
+	Size       int64
+}
+
+// resource extracts the properties reported with a 200 status
+func (r davResponse) resource(base *url.URL) (davResource, error) {
+	href, err := url.Parse(strings.TrimSpace(r.Href))
+	if err != nil {
+		return davResource{}, fmt.Errorf("invalid href %q: %w", r.Href, err)
+	}
+	res := davResource{Path: base.ResolveReference(href).Path}
+	for _, ps := range r.Propstat {
+		if ps.Status != "" && !strings.Contains(ps.Status, " 200 ") {
+			continue
+		}
+		if ps.Prop.ResourceType.Collection != nil {
+			res.Collection = true
+		}
+		if ps.Prop.ContentLength != "" {
+			res.Size, _ = strconv.ParseInt(strings.TrimSpace(ps.Prop.ContentLength), 10, 64)
+		}
+	}
+	return res, nil
+}
+
+// propfindWebDAV lists rawurl (an http(s) URL) with the given Depth header ("0" or "1")
+func propfindWebDAV(ctx context.Context, rawurl, depth string, runtime *RuntimeConfig) ([]davResource, error) {
+	base, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, fmt.Errorf("invalid webdav url: %w", err)
+	}
+
+	reqCtx, cancel := context.WithTimeout(ctx, ProbeTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(reqCtx, "PROPFIND", rawurl, strings.NewReader(webdavPropfindBody))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create PROPFIND request: %w", err)
+	}
+	req.Header.Set("Depth", depth)
+	req.Header.Set("Content-Type", "application/xml; charset=utf-8")
+	req.Header.Set("User-Agent", runtime.GetUserAgent())
+
+	resp, err := probeClient(runtime).Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("PROPFIND %s failed: %w", rawurl, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusMultiStatus {
+		return nil, fmt.Errorf("PROPFIND %s: unexpected status code: %d", rawurl, resp.StatusCode)
+	}
+
+	var ms davMultistatus
+	if err := xml.NewDecoder(&limitedReader{r: resp.Body, n: maxPlaylistSize}).Decode(&ms); err != nil {
+		return nil, fmt.Errorf("invalid PROPFIND response: %w", err)
+	}
+
+	resources := make([]davResource, 0, len(ms.Responses))
+	for _, r := range ms.Responses {
+		res, err := r.resource(base)
+		if err != nil {
+			return nil, err
+		}
+		resources = append(resources, res)
+	}
+	return resources, nil
+}
+
+// isWebDAVCollection reports whether rawurl (an http(s) URL) is a WebDAV collection.
+// Any failure (including servers that do not speak WebDAV) reports false.
+func isWebDAVCollection(ctx context.Context, rawurl string, runtime *RuntimeConfig) bool {
+	resources, err := propfindWebDAV(ctx, rawurl, "0", runtime)
+	if err != nil {
+		utils.Debug("PROPFIND %s: %v", rawurl, err)
+		return false
+	}
+	return len(resources) > 0 && resources[0].Collection
+}
+
+// probeWebDAV probes a webdav(s):// URL. Collections are reported with
+// IsCollection set; files are probed over HTTP like any other download.
+func probeWebDAV(ctx context.Context, rawurl, filenameHint string, runtime *RuntimeConfig) (*ProbeResult, error) {
+	httpURL := webdavHTTPURL(rawurl)
+	if isWebDAVCollection(ctx, httpURL, runtime) {
+		return &ProbeResult{IsCollection: true}, nil
+	}
+	return probeServer(ctx, httpURL, filenameHint, runtime)
+}
+
+// listWebDAVTree walks the collection at rawurl (an http(s) URL) and returns every file below it
+func listWebDAVTree(ctx context.Context, rawurl string, runtime *RuntimeConfig) ([]davResource, error) {
+	root, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, fmt.Errorf("invalid webdav url: %w", err)
+	}
+	rootPath := collectionPath(root.Path)
+
+	var files []davResource
+	visited := map[string]bool{rootPath: true}
+	pending := []string{rootPath}
+
+	for len(pending) > 0 {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		dir := pending[0]
+		pending = pending[1:]
+
+		u := *root
+		u.Path, u.RawPath, u.RawQuery = dir, "", ""
+		resources, err := propfindWebDAV(ctx, u.String(), "1", runtime)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, res := range resources {
+			p := path.Clean(res.Path)
+			if res.Collection {
+				p = collectionPath(p)
+			}
+			// Skip the collection itself and anything the server reports outside the tree
+			if p == dir || !strings.HasPrefix(p, rootPath) {
+				continue
+			}
+			if res.Collection {
+				if !visited[p] {
+					visited[p] = true
+					pending = append(pending, p)
+				}
+				continue
+			}
+			res.Path = p
+			files = append(files, res)
+			if len(files) > maxDiscoveredFiles {
+				return nil, fmt.Errorf("webdav collection has more than %d files", maxDiscoveredFiles)
+			}
+		}
+	}
+	return files, nil
+}
+
+// collectionPath normalises a collection path to end with a single slash
+func collectionPath(p string) string {
+	p = path.Clean("/" + p)
+	if p == "/" {
+		return p
+	}
+	return p + "/"
+}
+
+// webdavDiscoveredFiles maps the files of a collection to downloads that
+// recreate the remote layout under outputPath/<collection name>/. File URLs
+// keep the scheme and credentials of collectionURL.
+func webdavDiscoveredFiles(collectionURL, outputPath string, files []davResource) ([]messages.DiscoveredFile, error) {
+	paths := make([]string, len(files))
+	for i, f := range files {
+		paths[i] = f.Path
+	}
+	return mirrorDiscoveredFiles(collectionURL, outputPath, paths)
+}
+
+// queueWebDAVCollection lists a collection recursively and queues every file as its own download
+func queueWebDAVCollection(ctx context.Context, cfg DownloadConfig) error {
+	files, err := listWebDAVTree(ctx, webdavHTTPURL(cfg.URL), cfg.Runtime)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("webdav collection is empty: %s", cfg.URL)
+	}
+
+	discovered, err := webdavDiscoveredFiles(cfg.URL, cfg.OutputPath, files)
+	if err != nil {
+		return err
+	}
+	return queueDiscoveredFiles(cfg, discovered)
+}
+
+// downloadWebDAV downloads a single WebDAV file. Requests go to the http(s)
+// URL while progress and resume state stay keyed by the webdav(s):// URL.
+func downloadWebDAV(ctx context.Context, cfg DownloadConfig, destPath string, probe *ProbeResult) error {
+	httpURL := webdavHTTPURL(cfg.URL)
+
+	if probe.SupportsRange && probe.FileSize > 0 {
+		d := NewConcurrentDownloader(cfg.ID, cfg.ProgressCh, cfg.State, cfg.Runtime)
+		d.FetchURL = httpURL
+		return d.Download(ctx, cfg.URL, destPath, probe.FileSize, cfg.Verbose)
+	}
+
+	d := NewSingleDownloader(cfg.ID, cfg.ProgressCh, cfg.State, cfg.Runtime)
+	return d.Download(ctx, httpURL, destPath, probe.FileSize, probe.Filename, cfg.Verbose)
+}
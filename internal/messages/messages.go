@@ -11,6 +11,10 @@ type ProgressMsg struct {
 	Total             int64
 	Speed             float64 // bytes per second
 	ActiveConnections int
+	ConnectionLimit   int // Connections the adaptive controller allows, 0 if not adaptive
+	Peers             int // Connected peers (torrent downloads only)
+	Stalls            int // Workers restarted after their connection stopped delivering data
+	SlowRestarts      int // Workers restarted for being far slower than the others
 }
 
 // DownloadCompleteMsg signals that the download finished successfully
@@ -27,6 +31,16 @@ type DownloadErrorMsg struct {
 	Err        error
 }
 
+// DownloadRetryMsg signals that a failed download will be retried
+// automatically after Delay, resuming from its saved progress
+type DownloadRetryMsg struct {
+	DownloadID  string
+	Attempt     int // 1 for the first retry
+	MaxAttempts int
+	Delay       time.Duration
+	Err         error // Why the previous attempt failed
+}
+
 // DownloadStartedMsg is sent when a download actually starts (after metadata fetch)
 type DownloadStartedMsg struct {
 	DownloadID string
@@ -36,6 +50,13 @@ type DownloadStartedMsg struct {
 	DestPath   string // Full path to the destination file
 }
 
+// DiskSpaceLowMsg is sent when all downloads were paused because the disk
+// holding Dir ran low on space
+type DiskSpaceLowMsg struct {
+	Dir  string
+	Free int64 // Bytes
+}
+
 type DownloadPausedMsg struct {
 	DownloadID string
 	Downloaded int64
@@ -44,3 +65,18 @@ type DownloadPausedMsg struct {
 type DownloadResumedMsg struct {
 	DownloadID string
 }
+
+// DownloadsDiscoveredMsg is sent when a download expands into several files
+// (e.g. a WebDAV collection). Each file should be queued as its own download;
+// the original download does not produce a file itself.
+type DownloadsDiscoveredMsg struct {
+	DownloadID string
+	Source     string // URL that was expanded
+	Files      []DiscoveredFile
+}
+
+// DiscoveredFile is a single file found while expanding a download
+type DiscoveredFile struct {
+	URL        string
+	OutputPath string // Directory to save into (mirrors the remote layout)
+}
@@ -0,0 +1,211 @@
+package tui
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/junaid2005p/surge/internal/downloader"
+
+	"github.com/charmbracelet/bubbles/key"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// grabListHeight is the number of links shown at once in the link grabber
+const grabListHeight = 12
+
+// linksGrabbedMsg carries the result of fetching a page for the link grabber
+type linksGrabbedMsg struct {
+	URL   string
+	Links []downloader.GrabbedLink
+	Err   error
+}
+
+// grabLinksCmd fetches the page in the background
+func grabLinksCmd(url string, runtime *downloader.RuntimeConfig) tea.Cmd {
+	return func() tea.Msg {
+		links, err := downloader.GrabLinks(context.Background(), url, runtime)
+		return linksGrabbedMsg{URL: url, Links: links, Err: err}
+	}
+}
+
+// startGrab switches to the link grabber and starts fetching url
+func (m RootModel) startGrab(url, path string) (RootModel, tea.Cmd) {
+	m.state = GrabState
+	m.grabSource = url
+	m.grabPath = path
+	m.grabLinks = nil
+	m.grabSelected = make(map[string]bool)
+	m.grabCursor = 0
+	m.grabCategory = 0
+	m.grabLoading = true
+	m.grabErr = nil
+	m.grabFilter.SetValue("")
+	m.grabFilter.Focus()
+	return m, grabLinksCmd(url, ConvertRuntimeConfig(m.Settings.ToRuntimeConfig()))
+}
+
+// visibleGrabLinks returns the links passing the current category and filter
+func (m RootModel) visibleGrabLinks() []downloader.GrabbedLink {
+	category := downloader.LinkCategories[m.grabCategory]
+	filter := m.grabFilter.Value()
+
+	var visible []downloader.GrabbedLink
+	for _, l := range m.grabLinks {
+		if l.InCategory(category) && l.Matches(filter) {
+			visible = append(visible, l)
+		}
+	}
+	return visible
+}
+
+// updateGrab handles keys in the link grabber
+func (m RootModel) updateGrab(msg tea.KeyMsg) (RootModel, tea.Cmd) {
+	visible := m.visibleGrabLinks()
+
+	switch {
+	case key.Matches(msg, m.keys.Grab.Cancel):
+		m.grabFilter.Blur()
+		m.state = DashboardState
+		return m, nil
+
+	case key.Matches(msg, m.keys.Grab.Up):
+		if m.grabCursor > 0 {
+			m.grabCursor--
+		}
+		return m, nil
+
+	case key.Matches(msg, m.keys.Grab.Down):
+		if m.grabCursor < len(visible)-1 {
+			m.grabCursor++
+		}
+		return m, nil
+
+	case key.Matches(msg, m.keys.Grab.Toggle):
+		if m.grabCursor < len(visible) {
+			u := visible[m.grabCursor].URL
+			m.grabSelected[u] = !m.grabSelected[u]
+		}
+		return m, nil
+
+	case key.Matches(msg, m.keys.Grab.SelectAll):
+		// Selects every shown link, or clears them if all are selected already
+		all := true
+		for _, l := range visible {
+			all = all && m.grabSelected[l.URL]
+		}
+		for _, l := range visible {
+			m.grabSelected[l.URL] = !all
+		}
+		return m, nil
+
+	case key.Matches(msg, m.keys.Grab.Category):
+		m.grabCategory = (m.grabCategory + 1) % len(downloader.LinkCategories)
+		m.grabCursor = 0
+		return m, nil
+
+	case key.Matches(msg, m.keys.Grab.Enqueue):
+		// Chosen links in page order; the highlighted one if nothing was chosen
+		var chosen []string
+		for _, l := range m.grabLinks {
+			if m.grabSelected[l.URL] {
+				chosen = append(chosen, l.URL)
+			}
+		}
+		if len(chosen) == 0 && m.grabCursor < len(visible) {
+			chosen = append(chosen, visible[m.grabCursor].URL)
+		}
+		if len(chosen) == 0 {
+			return m, nil
+		}
+
+		m.grabFilter.Blur()
+		m.state = DashboardState
+		for _, u := range chosen {
+			m, _ = m.startDownload(u, m.grabPath, "")
+		}
+		m.addLogEntry(LogStyleStarted.Render(fmt.Sprintf("⬇ Queued %d links from %s", len(chosen), m.grabSource)))
+		return m, nil
+	}
+
+	// Everything else edits the filter
+	var cmd tea.Cmd
+	m.grabFilter, cmd = m.grabFilter.Update(msg)
+	m.grabCursor = 0
+	return m, cmd
+}
+
+// viewGrab renders the link grabber
+func (m RootModel) viewGrab() string {
+	width := 100
+	if m.width < width+4 {
+		width = m.width - 4
+	}
+	height := grabListHeight + 9
+
+	labelStyle := lipgloss.NewStyle().Width(10).Foreground(ColorLightGray)
+	dimStyle := lipgloss.NewStyle().Foreground(ColorGray)
+
+	var body []string
+	visible := m.visibleGrabLinks()
+	switch {
+	case m.grabLoading:
+		body = append(body, dimStyle.Render("Fetching "+truncateString(m.grabSource, width-20)+" ..."))
+	case m.grabErr != nil:
+		body = append(body, lipgloss.NewStyle().Foreground(ColorNeonPink).Render("✖ "+m.grabErr.Error()))
+	case len(visible) == 0:
+		body = append(body, dimStyle.Render("No links match"))
+	default:
+		// Keep the cursor inside the visible window
+		start := 0
+		if m.grabCursor >= grabListHeight {
+			start = m.grabCursor - grabListHeight + 1
+		}
+		end := min(start+grabListHeight, len(visible))
+
+		nameWidth := width - 30
+		for i := start; i < end; i++ {
+			l := visible[i]
+			check := "[ ]"
+			if m.grabSelected[l.URL] {
+				check = "[x]"
+			}
+			line := fmt.Sprintf("%s %-9s %s", check, l.Category, truncateString(l.Name, nameWidth))
+			if i == m.grabCursor {
+				body = append(body, lipgloss.NewStyle().Foreground(ColorNeonPink).Bold(true).Render("> "+line))
+			} else {
+				body = append(body, lipgloss.NewStyle().Foreground(ColorLightGray).Render("  "+line))
+			}
+		}
+	}
+	for len(body) < grabListHeight {
+		body = append(body, "")
+	}
+
+	selected := 0
+	for _, on := range m.grabSelected {
+		if on {
+			selected++
+		}
+	}
+	status := dimStyle.Render(fmt.Sprintf("%d of %d links shown, %d selected → %s",
+		len(visible), len(m.grabLinks), selected, m.grabPath))
+
+	content := lipgloss.JoinVertical(lipgloss.Left,
+		"",
+		lipgloss.JoinHorizontal(lipgloss.Left, labelStyle.Render("Filter:"), m.grabFilter.View()),
+		lipgloss.JoinHorizontal(lipgloss.Left, labelStyle.Render("Type:"),
+			lipgloss.NewStyle().Foreground(ColorNeonCyan).Render(downloader.LinkCategories[m.grabCategory])),
+		"",
+		strings.Join(body, "\n"),
+		"",
+		status,
+		m.help.View(m.keys.Grab),
+	)
+
+	paddedContent := lipgloss.NewStyle().Padding(0, 2).Render(content)
+	box := renderBtopBox(PaneTitleStyle.Render(" Grab Links "), "", paddedContent, width, height, ColorNeonPink)
+
+	return lipgloss.Place(m.width, m.height, lipgloss.Center, lipgloss.Center, box)
+}
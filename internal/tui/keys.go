@@ -6,6 +6,8 @@ import "github.com/charmbracelet/bubbles/key"
 type KeyMap struct {
 	Dashboard      DashboardKeyMap
 	Input          InputKeyMap
+	Grab           GrabKeyMap
+	Replace        ReplaceKeyMap
 	FilePicker     FilePickerKeyMap
 	History        HistoryKeyMap
 	Duplicate      DuplicateKeyMap
@@ -19,11 +21,13 @@ type DashboardKeyMap struct {
 	TabQueued key.Binding
 	TabActive key.Binding
 	TabDone   key.Binding
+	TabErrors key.Binding
 	NextTab   key.Binding
 	Add       key.Binding
 	Search    key.Binding
 	Pause     key.Binding
 	Delete    key.Binding
+	Replace   key.Binding
 	Settings  key.Binding
 	Log       key.Binding
 	History   key.Binding
@@ -42,12 +46,31 @@ type DashboardKeyMap struct {
 
 // InputKeyMap defines keybindings for the add download input
 type InputKeyMap struct {
-	Tab    key.Binding
-	Enter  key.Binding
-	Esc    key.Binding
-	Up     key.Binding
-	Down   key.Binding
-	Cancel key.Binding
+	Tab       key.Binding
+	Enter     key.Binding
+	Esc       key.Binding
+	Up        key.Binding
+	Down      key.Binding
+	Recursive key.Binding
+	Grab      key.Binding
+	Cancel    key.Binding
+}
+
+// GrabKeyMap defines keybindings for the link grabber
+type GrabKeyMap struct {
+	Up        key.Binding
+	Down      key.Binding
+	Toggle    key.Binding
+	SelectAll key.Binding
+	Category  key.Binding
+	Enqueue   key.Binding
+	Cancel    key.Binding
+}
+
+// ReplaceKeyMap defines keybindings for the replace URL dialog
+type ReplaceKeyMap struct {
+	Confirm key.Binding
+	Cancel  key.Binding
 }
 
 // FilePickerKeyMap defines keybindings for the file picker
@@ -119,6 +142,10 @@ var Keys = KeyMap{
 			key.WithKeys("e"),
 			key.WithHelp("e", "done tab"),
 		),
+		TabErrors: key.NewBinding(
+			key.WithKeys("r"),
+			key.WithHelp("r", "errors tab"),
+		),
 		NextTab: key.NewBinding(
 			key.WithKeys("tab"),
 			key.WithHelp("tab", "next tab"),
@@ -139,6 +166,10 @@ var Keys = KeyMap{
 			key.WithKeys("x"),
 			key.WithHelp("x", "delete"),
 		),
+		Replace: key.NewBinding(
+			key.WithKeys("u"),
+			key.WithHelp("u", "replace url"),
+		),
 		Settings: key.NewBinding(
 			key.WithKeys("s"),
 			key.WithHelp("s", "settings"),
@@ -209,6 +240,54 @@ var Keys = KeyMap{
 			key.WithKeys("down"),
 			key.WithHelp("↓", "next"),
 		),
+		Recursive: key.NewBinding(
+			key.WithKeys("ctrl+r"),
+			key.WithHelp("ctrl+r", "recursive"),
+		),
+		Grab: key.NewBinding(
+			key.WithKeys("ctrl+g"),
+			key.WithHelp("ctrl+g", "grab links"),
+		),
+		Cancel: key.NewBinding(
+			key.WithKeys("esc"),
+			key.WithHelp("esc", "cancel"),
+		),
+	},
+	Grab: GrabKeyMap{
+		Up: key.NewBinding(
+			key.WithKeys("up"),
+			key.WithHelp("↑", "up"),
+		),
+		Down: key.NewBinding(
+			key.WithKeys("down"),
+			key.WithHelp("↓", "down"),
+		),
+		Toggle: key.NewBinding(
+			key.WithKeys(" "),
+			key.WithHelp("space", "select"),
+		),
+		SelectAll: key.NewBinding(
+			key.WithKeys("ctrl+a"),
+			key.WithHelp("ctrl+a", "select all shown"),
+		),
+		Category: key.NewBinding(
+			key.WithKeys("tab"),
+			key.WithHelp("tab", "type"),
+		),
+		Enqueue: key.NewBinding(
+			key.WithKeys("enter"),
+			key.WithHelp("enter", "download"),
+		),
+		Cancel: key.NewBinding(
+			key.WithKeys("esc"),
+			key.WithHelp("esc", "cancel"),
+		),
+	},
+	Replace: ReplaceKeyMap{
+		Confirm: key.NewBinding(
+			key.WithKeys("enter"),
+			key.WithHelp("enter", "replace & resume"),
+		),
 		Cancel: key.NewBinding(
 			key.WithKeys("esc"),
 			key.WithHelp("esc", "cancel"),
@@ -334,24 +413,40 @@ var Keys = KeyMap{
 
 // ShortHelp returns keybindings to show in the mini help view
 func (k DashboardKeyMap) ShortHelp() []key.Binding {
-	return []key.Binding{k.TabQueued, k.TabActive, k.TabDone, k.Add, k.Search, k.Pause, k.Delete, k.Settings, k.Quit}
+	return []key.Binding{k.TabQueued, k.TabActive, k.TabDone, k.TabErrors, k.Add, k.Search, k.Pause, k.Delete, k.Settings, k.Quit}
 }
 
 // FullHelp returns keybindings for the expanded help view
 func (k DashboardKeyMap) FullHelp() [][]key.Binding {
 	return [][]key.Binding{
-		{k.TabQueued, k.TabActive, k.TabDone, k.NextTab},
-		{k.Add, k.Search, k.Pause, k.Delete, k.Settings},
+		{k.TabQueued, k.TabActive, k.TabDone, k.TabErrors, k.NextTab},
+		{k.Add, k.Search, k.Pause, k.Delete, k.Replace, k.Settings},
 		{k.Log, k.History, k.Quit},
 	}
 }
 
 func (k InputKeyMap) ShortHelp() []key.Binding {
-	return []key.Binding{k.Tab, k.Enter, k.Esc}
+	return []key.Binding{k.Tab, k.Enter, k.Recursive, k.Grab, k.Esc}
 }
 
 func (k InputKeyMap) FullHelp() [][]key.Binding {
-	return [][]key.Binding{{k.Tab, k.Enter, k.Esc}}
+	return [][]key.Binding{{k.Tab, k.Enter, k.Recursive, k.Grab, k.Esc}}
+}
+
+func (k GrabKeyMap) ShortHelp() []key.Binding {
+	return []key.Binding{k.Up, k.Down, k.Toggle, k.SelectAll, k.Category, k.Enqueue, k.Cancel}
+}
+
+func (k GrabKeyMap) FullHelp() [][]key.Binding {
+	return [][]key.Binding{{k.Up, k.Down, k.Toggle, k.SelectAll, k.Category, k.Enqueue, k.Cancel}}
+}
+
+func (k ReplaceKeyMap) ShortHelp() []key.Binding {
+	return []key.Binding{k.Confirm, k.Cancel}
+}
+
+func (k ReplaceKeyMap) FullHelp() [][]key.Binding {
+	return [][]key.Binding{{k.Confirm, k.Cancel}}
 }
 
 func (k FilePickerKeyMap) ShortHelp() []key.Binding {
@@ -3,6 +3,7 @@ package tui
 import (
 	"fmt"
 	"io"
+	"time"
 
 	"github.com/junaid2005p/surge/internal/utils"
 
@@ -31,7 +32,7 @@ func (i DownloadItem) Description() string {
 	switch {
 	case d.err != nil:
 		statusIcon = "✖"
-		status = "Error"
+		status = "Error: " + truncateString(d.err.Error(), 40)
 		stateColor = ColorStateError // 🔴 Red
 	case d.done:
 		statusIcon = "✔"
@@ -41,6 +42,10 @@ func (i DownloadItem) Description() string {
 		statusIcon = "⏸"
 		status = "Paused"
 		stateColor = ColorStatePaused // 🟡 Orange
+	case time.Now().Before(d.retryAt):
+		statusIcon = "↻"
+		status = fmt.Sprintf("Retry %d/%d in %s", d.retryAttempt, d.retryMax, time.Until(d.retryAt).Round(time.Second))
+		stateColor = ColorStatePaused // 🟡 Orange
 	case d.Speed == 0 && d.Downloaded == 0:
 		statusIcon = "⋯"
 		status = "Queued"
@@ -259,7 +264,9 @@ func (m *RootModel) UpdateListItems() {
 			for _, d := range m.downloads {
 				if d.ID == targetID {
 					newTab := -1
-					if d.done {
+					if d.err != nil {
+						newTab = TabErrors
+					} else if d.done {
 						newTab = TabDone
 					} else if d.Speed > 0 {
 						newTab = TabActive
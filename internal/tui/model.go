@@ -1,6 +1,7 @@
 package tui
 
 import (
+	"errors"
 	"os"
 	"path/filepath"
 	"strings"
@@ -31,12 +32,15 @@ const (
 	SearchState                               //SearchState is 6
 	SettingsState                             //SettingsState is 7
 	ExtensionConfirmationState                //ExtensionConfirmationState is 8
+	GrabState                                 //GrabState is 9
+	ReplaceURLState                           //ReplaceURLState is 10
 )
 
 const (
 	TabQueued = 0
 	TabActive = 1
 	TabDone   = 2
+	TabErrors = 3
 )
 
 // StartDownloadMsg is sent from the HTTP server to start a new download
@@ -46,6 +50,15 @@ type StartDownloadMsg struct {
 	Filename string
 }
 
+// ReplaceURLMsg is sent from the HTTP server to move a paused or failed
+// download to a new URL. The outcome is sent on Result, which must be buffered.
+type ReplaceURLMsg struct {
+	ID     string // Download to change; if empty, the download with URL
+	URL    string
+	NewURL string
+	Result chan<- error
+}
+
 type DownloadModel struct {
 	ID          string
 	URL         string
@@ -55,6 +68,12 @@ type DownloadModel struct {
 	Downloaded  int64
 	Speed       float64
 	Connections int
+	ConnLimit   int // Connections the adaptive controller currently allows
+	Peers       int
+
+	// Workers restarted by the health monitor
+	Stalls       int
+	SlowRestarts int
 
 	StartTime time.Time
 	Elapsed   time.Duration
@@ -68,6 +87,11 @@ type DownloadModel struct {
 	done   bool
 	err    error
 	paused bool
+
+	// Automatic retry after a failure
+	retryAttempt int
+	retryMax     int
+	retryAt      time.Time
 }
 
 type RootModel struct {
@@ -75,9 +99,10 @@ type RootModel struct {
 	width        int
 	height       int
 	state        UIState
-	activeTab    int // 0=Queued, 1=Active, 2=Done
+	activeTab    int // 0=Queued, 1=Active, 2=Done, 3=Errors
 	inputs       []textinput.Model
 	focusedInput int
+	recursive    bool         // Add-download form: crawl the URL as a directory listing
 	progressChan chan tea.Msg // Channel for events only (start/complete/error)
 
 	// File picker for directory selection
@@ -124,6 +149,23 @@ type RootModel struct {
 	SelectedDownloadID string // ID of the currently selected download
 	ManualTabSwitch    bool   // Whether the last tab switch was manual
 
+	// Link grabber
+	grabSource   string                   // Page the links were taken from
+	grabPath     string                   // Output directory for the chosen links
+	grabLinks    []downloader.GrabbedLink // All links found on the page
+	grabSelected map[string]bool          // Chosen links by URL
+	grabCursor   int                      // Cursor within the visible links
+	grabCategory int                      // Index into downloader.LinkCategories
+	grabFilter   textinput.Model          // Filter typed by the user
+	grabLoading  bool                     // Whether the page is still being fetched
+	grabErr      error                    // Error fetching the page
+
+	// Replace URL dialog
+	replaceID    string          // Download whose URL is being replaced
+	replaceInput textinput.Model // New URL typed by the user
+	replaceBusy  bool            // Whether the new URL is being checked
+	replaceErr   error           // Why the last replacement was refused
+
 	// Search functionality
 	searchInput  textinput.Model // Text input for search
 	searchActive bool            // Whether search mode is active
@@ -210,6 +252,31 @@ func InitialRootModel() RootModel {
 		}
 	}
 
+	// Load failed downloads from master list (for Errors tab persistence)
+	if erroredEntries, err := downloader.LoadErroredDownloads(); err == nil {
+		for _, entry := range erroredEntries {
+			dm := NewDownloadModel(entry.ID, entry.URL, entry.Filename, entry.TotalSize)
+			dm.done = true
+			reason := entry.Error
+			if reason == "" {
+				reason = "download failed"
+			}
+			dm.err = errors.New(reason)
+			dm.Destination = entry.DestPath
+			// Load progress kept for a retry
+			if state, err := downloader.LoadState(entry.URL, entry.DestPath); err == nil {
+				dm.Downloaded = state.Downloaded
+				dm.Total = state.TotalSize
+				dm.state.Downloaded.Store(state.Downloaded)
+				dm.state.SetTotalSize(state.TotalSize)
+				if state.TotalSize > 0 {
+					dm.progress.SetPercent(float64(state.Downloaded) / float64(state.TotalSize))
+				}
+			}
+			downloads = append(downloads, dm)
+		}
+	}
+
 	// Load completed downloads from master list (for Done tab persistence)
 	if completedEntries, err := downloader.LoadCompletedDownloads(); err == nil {
 		for _, entry := range completedEntries {
@@ -249,6 +316,18 @@ func InitialRootModel() RootModel {
 	searchInput.Width = 30
 	searchInput.Prompt = ""
 
+	// Initialize replace URL input
+	replaceInput := textinput.New()
+	replaceInput.Placeholder = "https://cdn.example.com/file.zip?signature=..."
+	replaceInput.Width = 60
+	replaceInput.Prompt = ""
+
+	// Initialize link grabber filter
+	grabFilter := textinput.New()
+	grabFilter.Placeholder = "*.iso, name or URL part"
+	grabFilter.Width = InputWidth
+	grabFilter.Prompt = ""
+
 	return RootModel{
 		downloads:     downloads,
 		inputs:        []textinput.Model{urlInput, pathInput, filenameInput},
@@ -265,6 +344,8 @@ func InitialRootModel() RootModel {
 		Settings:      settings,
 		SettingsInput: settingsInput,
 		searchInput:   searchInput,
+		grabFilter:    grabFilter,
+		replaceInput:  replaceInput,
 		keys:          Keys,
 	}
 }
@@ -296,7 +377,11 @@ func (m RootModel) getFilteredDownloads() []*DownloadModel {
 				continue
 			}
 		case TabDone:
-			if !d.done {
+			if !d.done || d.err != nil {
+				continue
+			}
+		case TabErrors:
+			if d.err == nil {
 				continue
 			}
 		}
@@ -0,0 +1,161 @@
+package tui
+
+import (
+	"context"
+	"errors"
+
+	"github.com/junaid2005p/surge/internal/downloader"
+
+	"github.com/charmbracelet/bubbles/key"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// urlReplacedMsg carries the result of moving a download to a new URL
+type urlReplacedMsg struct {
+	ID  string
+	URL string
+	Err error
+}
+
+// replaceURLCmd checks the new URL and moves the saved progress to it in the
+// background. The outcome is also sent on result, if set.
+func replaceURLCmd(d *DownloadModel, newURL string, runtime *downloader.RuntimeConfig, result chan<- error) tea.Cmd {
+	id, oldURL, destPath := d.ID, d.URL, d.Destination
+	return func() tea.Msg {
+		err := downloader.ReplaceURL(context.Background(), oldURL, newURL, destPath, runtime)
+		if result != nil {
+			result <- err
+		}
+		return urlReplacedMsg{ID: id, URL: newURL, Err: err}
+	}
+}
+
+// canReplaceURL reports whether d is paused or failed with progress to keep
+func canReplaceURL(d *DownloadModel) bool {
+	return d.Destination != "" && (d.paused || d.err != nil)
+}
+
+// findReplaceTarget returns the download a ReplaceURLMsg refers to
+func (m RootModel) findReplaceTarget(msg ReplaceURLMsg) (*DownloadModel, error) {
+	for _, d := range m.downloads {
+		if (msg.ID != "" && d.ID == msg.ID) || (msg.ID == "" && d.URL == msg.URL && !(d.done && d.err == nil)) {
+			if !canReplaceURL(d) {
+				return nil, errors.New("only paused or failed downloads can change URL")
+			}
+			return d, nil
+		}
+	}
+	return nil, errors.New("download not found")
+}
+
+// startReplace opens the replace URL dialog for d
+func (m RootModel) startReplace(d *DownloadModel) RootModel {
+	m.state = ReplaceURLState
+	m.replaceID = d.ID
+	m.replaceBusy = false
+	m.replaceErr = nil
+	m.replaceInput.SetValue("")
+	m.replaceInput.Focus()
+	return m
+}
+
+// applyReplacedURL points the download at its new URL and resumes it
+func (m RootModel) applyReplacedURL(msg urlReplacedMsg) (RootModel, tea.Cmd) {
+	if m.state == ReplaceURLState && m.replaceID == msg.ID {
+		m.replaceBusy = false
+		m.replaceErr = msg.Err
+		if msg.Err == nil {
+			m.replaceInput.Blur()
+			m.state = DashboardState
+		}
+	}
+
+	for _, d := range m.downloads {
+		if d.ID != msg.ID {
+			continue
+		}
+		if msg.Err != nil {
+			m.addLogEntry(LogStyleError.Render("✖ URL not replaced: " + d.Filename))
+			return m, nil
+		}
+		d.URL = msg.URL
+		if d.err != nil {
+			// Failed downloads resume like paused ones
+			d.err = nil
+			d.done = false
+			d.state.Error.Store(nil)
+		}
+		m.addLogEntry(LogStyleStarted.Render("↻ URL replaced: " + d.Filename))
+		cmd := m.resumeDownload(d)
+		m.UpdateListItems()
+		return m, cmd
+	}
+	return m, nil
+}
+
+// updateReplace handles keys in the replace URL dialog
+func (m RootModel) updateReplace(msg tea.KeyMsg) (RootModel, tea.Cmd) {
+	switch {
+	case key.Matches(msg, m.keys.Replace.Cancel):
+		m.replaceInput.Blur()
+		m.state = DashboardState
+		return m, nil
+
+	case key.Matches(msg, m.keys.Replace.Confirm):
+		newURL := m.replaceInput.Value()
+		if newURL == "" || m.replaceBusy {
+			return m, nil
+		}
+		for _, d := range m.downloads {
+			if d.ID == m.replaceID && canReplaceURL(d) {
+				m.replaceBusy = true
+				m.replaceErr = nil
+				return m, replaceURLCmd(d, newURL, ConvertRuntimeConfig(m.Settings.ToRuntimeConfig()), nil)
+			}
+		}
+		m.state = DashboardState
+		return m, nil
+	}
+
+	var cmd tea.Cmd
+	m.replaceInput, cmd = m.replaceInput.Update(msg)
+	return m, cmd
+}
+
+// viewReplace renders the replace URL dialog
+func (m RootModel) viewReplace() string {
+	labelStyle := lipgloss.NewStyle().Width(10).Foreground(ColorLightGray)
+	dimStyle := lipgloss.NewStyle().Foreground(ColorGray)
+
+	var current string
+	for _, d := range m.downloads {
+		if d.ID == m.replaceID {
+			current = d.URL
+		}
+	}
+
+	status := dimStyle.Render("Size, ETag and already downloaded data must match")
+	switch {
+	case m.replaceBusy:
+		status = dimStyle.Render("Checking the new URL ...")
+	case m.replaceErr != nil:
+		status = lipgloss.NewStyle().Foreground(ColorNeonPink).Render("✖ " + truncateString(m.replaceErr.Error(), 70))
+	}
+
+	content := lipgloss.JoinVertical(lipgloss.Left,
+		"",
+		lipgloss.JoinHorizontal(lipgloss.Left, labelStyle.Render("Current:"), dimStyle.Render(truncateString(current, 60))),
+		"",
+		lipgloss.JoinHorizontal(lipgloss.Left, labelStyle.Render("New URL:"), m.replaceInput.View()),
+		"",
+		status,
+		"",
+		m.help.View(m.keys.Replace),
+	)
+
+	paddedContent := lipgloss.NewStyle().Padding(0, 2).Render(content)
+	box := renderBtopBox(PaneTitleStyle.Render(" Replace URL "), "", paddedContent, 80, 11, ColorNeonPink)
+
+	return lipgloss.Place(m.width, m.height, lipgloss.Center, lipgloss.Center, box)
+}
@@ -75,6 +75,10 @@ func (r *ProgressReporter) PollCmd() tea.Cmd {
 			Total:             total,
 			Speed:             r.lastSpeed,
 			ActiveConnections: int(connections),
+			ConnectionLimit:   int(r.state.ConnLimit.Load()),
+			Peers:             int(r.state.Peers.Load()),
+			Stalls:            int(r.state.Stalls.Load()),
+			SlowRestarts:      int(r.state.SlowRestarts.Load()),
 		}
 	})
 }
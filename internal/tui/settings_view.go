@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"reflect"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/junaid2005p/surge/internal/config"
@@ -169,10 +170,32 @@ func (m RootModel) getSettingsValues(category string) map[string]interface{} {
 		values["warn_on_duplicate"] = m.Settings.General.WarnOnDuplicate
 		values["extension_prompt"] = m.Settings.General.ExtensionPrompt
 		values["auto_resume"] = m.Settings.General.AutoResume
+		values["preallocate_files"] = m.Settings.General.PreallocateFiles
+		values["min_free_space"] = m.Settings.General.MinFreeSpace
 	case "Connections":
 		values["max_connections_per_host"] = m.Settings.Connections.MaxConnectionsPerHost
 		values["max_global_connections"] = m.Settings.Connections.MaxGlobalConnections
 		values["user_agent"] = m.Settings.Connections.UserAgent
+		values["ssh_key_file"] = m.Settings.Connections.SSHKeyFile
+		values["torrent_download_limit"] = m.Settings.Connections.TorrentDownloadLimit
+		values["torrent_upload_limit"] = m.Settings.Connections.TorrentUploadLimit
+		values["torrent_seed_ratio"] = m.Settings.Connections.TorrentSeedRatio
+		values["stream_quality"] = m.Settings.Connections.StreamQuality
+		values["s3_endpoint"] = m.Settings.Connections.S3Endpoint
+		values["s3_region"] = m.Settings.Connections.S3Region
+		values["s3_path_style"] = m.Settings.Connections.S3PathStyle
+		values["oci_platform"] = m.Settings.Connections.OCIPlatform
+		values["http3"] = m.Settings.Connections.HTTP3
+		values["http3_hosts"] = m.Settings.Connections.HTTP3Hosts
+		values["http3_connections"] = m.Settings.Connections.HTTP3Connections
+		values["http2"] = m.Settings.Connections.HTTP2
+		values["ip_version"] = m.Settings.Connections.IPVersion
+		values["dns"] = m.Settings.Connections.DNS
+		values["resolve"] = m.Settings.Connections.Resolve
+		values["tls_ca_file"] = m.Settings.Connections.TLSCAFile
+		values["tls_client_cert"] = m.Settings.Connections.TLSClientCert
+		values["tls_client_key"] = m.Settings.Connections.TLSClientKey
+		values["tls_min_version"] = m.Settings.Connections.TLSMinVersion
 	case "Chunks":
 		values["min_chunk_size"] = m.Settings.Chunks.MinChunkSize
 		values["max_chunk_size"] = m.Settings.Chunks.MaxChunkSize
@@ -184,6 +207,8 @@ func (m RootModel) getSettingsValues(category string) map[string]interface{} {
 		values["slow_worker_grace_period"] = m.Settings.Performance.SlowWorkerGracePeriod
 		values["stall_timeout"] = m.Settings.Performance.StallTimeout
 		values["speed_ema_alpha"] = m.Settings.Performance.SpeedEmaAlpha
+		values["max_download_retries"] = m.Settings.Performance.MaxDownloadRetries
+		values["download_retry_delay"] = m.Settings.Performance.DownloadRetryDelay
 	}
 
 	return values
@@ -226,6 +251,12 @@ func (m *RootModel) setGeneralSetting(key, value, typ string) error {
 		m.Settings.General.ExtensionPrompt = !m.Settings.General.ExtensionPrompt
 	case "auto_resume":
 		m.Settings.General.AutoResume = !m.Settings.General.AutoResume
+	case "preallocate_files":
+		m.Settings.General.PreallocateFiles = !m.Settings.General.PreallocateFiles
+	case "min_free_space":
+		if v, err := strconv.Atoi(value); err == nil && v >= 0 {
+			m.Settings.General.MinFreeSpace = v
+		}
 	}
 	return nil
 }
@@ -242,6 +273,70 @@ func (m *RootModel) setConnectionsSetting(key, value, typ string) error {
 		}
 	case "user_agent":
 		m.Settings.Connections.UserAgent = value
+	case "ssh_key_file":
+		m.Settings.Connections.SSHKeyFile = value
+	case "torrent_download_limit":
+		// Parse as KB/s and convert to bytes/s
+		if v, err := strconv.ParseFloat(value, 64); err == nil && v >= 0 {
+			m.Settings.Connections.TorrentDownloadLimit = int(v * 1024)
+		}
+	case "torrent_upload_limit":
+		if v, err := strconv.ParseFloat(value, 64); err == nil && v >= 0 {
+			m.Settings.Connections.TorrentUploadLimit = int(v * 1024)
+		}
+	case "torrent_seed_ratio":
+		if v, err := strconv.ParseFloat(value, 64); err == nil && v >= 0 {
+			m.Settings.Connections.TorrentSeedRatio = v
+		}
+	case "stream_quality":
+		m.Settings.Connections.StreamQuality = value
+	case "s3_endpoint":
+		m.Settings.Connections.S3Endpoint = value
+	case "s3_region":
+		m.Settings.Connections.S3Region = value
+	case "s3_path_style":
+		m.Settings.Connections.S3PathStyle = !m.Settings.Connections.S3PathStyle
+	case "oci_platform":
+		m.Settings.Connections.OCIPlatform = value
+	case "http3":
+		switch value = strings.ToLower(strings.TrimSpace(value)); value {
+		case "off", "auto", "on":
+			m.Settings.Connections.HTTP3 = value
+		}
+	case "http3_hosts":
+		m.Settings.Connections.HTTP3Hosts = value
+	case "http3_connections":
+		if v, err := strconv.Atoi(value); err == nil && v >= 1 {
+			m.Settings.Connections.HTTP3Connections = v
+		}
+	case "http2":
+		switch value = strings.ToLower(strings.TrimSpace(value)); value {
+		case "off", "connections", "streams":
+			m.Settings.Connections.HTTP2 = value
+		}
+	case "ip_version":
+		switch value = strings.ToLower(strings.TrimSpace(value)); value {
+		case "auto", "ipv4", "ipv6", "prefer-ipv4", "prefer-ipv6":
+			m.Settings.Connections.IPVersion = value
+		}
+	case "dns":
+		if value = strings.TrimSpace(value); value == "" {
+			value = "system"
+		}
+		m.Settings.Connections.DNS = value
+	case "resolve":
+		m.Settings.Connections.Resolve = value
+	case "tls_ca_file":
+		m.Settings.Connections.TLSCAFile = strings.TrimSpace(value)
+	case "tls_client_cert":
+		m.Settings.Connections.TLSClientCert = strings.TrimSpace(value)
+	case "tls_client_key":
+		m.Settings.Connections.TLSClientKey = strings.TrimSpace(value)
+	case "tls_min_version":
+		switch value = strings.TrimSpace(value); value {
+		case "", "1.0", "1.1", "1.2", "1.3":
+			m.Settings.Connections.TLSMinVersion = value
+		}
 	}
 	return nil
 }
@@ -302,6 +397,18 @@ func (m *RootModel) setPerformanceSetting(key, value, typ string) error {
 		if v, err := time.ParseDuration(value); err == nil {
 			m.Settings.Performance.StallTimeout = v
 		}
+	case "max_download_retries":
+		if v, err := strconv.Atoi(value); err == nil && v >= 0 {
+			m.Settings.Performance.MaxDownloadRetries = v
+		}
+	case "download_retry_delay":
+		// Check if it's just a number, if so add "s"
+		if _, err := strconv.ParseFloat(value, 64); err == nil {
+			value += "s"
+		}
+		if v, err := time.ParseDuration(value); err == nil {
+			m.Settings.Performance.DownloadRetryDelay = v
+		}
 	case "speed_ema_alpha":
 		if v, err := strconv.ParseFloat(value, 64); err == nil {
 			// Clamp to valid range 0.0-1.0
@@ -354,13 +461,15 @@ func (m RootModel) getSettingsCount() int {
 func (m RootModel) getSettingUnit() string {
 	key := m.getCurrentSettingKey()
 	switch key {
-	case "min_chunk_size", "max_chunk_size", "target_chunk_size":
+	case "min_chunk_size", "max_chunk_size", "target_chunk_size", "min_free_space":
 		return " MB"
 	case "worker_buffer_size":
 		return " KB"
-	case "max_task_retries":
+	case "torrent_download_limit", "torrent_upload_limit":
+		return " KB/s"
+	case "max_task_retries", "max_download_retries":
 		return " retries"
-	case "slow_worker_grace_period", "stall_timeout":
+	case "slow_worker_grace_period", "stall_timeout", "download_retry_delay":
 		return " seconds"
 	case "slow_worker_threshold", "speed_ema_alpha":
 		return " (0.0-1.0)"
@@ -377,13 +486,13 @@ func formatSettingValueForEdit(value interface{}, typ, key string) string {
 			mb := float64(v) / (1024 * 1024)
 			return fmt.Sprintf("%.1f", mb)
 		}
-	case "worker_buffer_size":
+	case "worker_buffer_size", "torrent_download_limit", "torrent_upload_limit":
 		v := reflect.ValueOf(value)
 		if v.Kind() == reflect.Int {
 			kb := float64(v.Int()) / 1024
 			return fmt.Sprintf("%.0f", kb)
 		}
-	case "slow_worker_grace_period", "stall_timeout":
+	case "slow_worker_grace_period", "stall_timeout", "download_retry_delay":
 		// Show duration as plain seconds number (e.g., "5" instead of "5s")
 		if d, ok := value.(time.Duration); ok {
 			return fmt.Sprintf("%.0f", d.Seconds())
@@ -462,6 +571,10 @@ func (m *RootModel) resetSettingToDefault(category, key string, defaults *config
 			m.Settings.General.ExtensionPrompt = defaults.General.ExtensionPrompt
 		case "auto_resume":
 			m.Settings.General.AutoResume = defaults.General.AutoResume
+		case "preallocate_files":
+			m.Settings.General.PreallocateFiles = defaults.General.PreallocateFiles
+		case "min_free_space":
+			m.Settings.General.MinFreeSpace = defaults.General.MinFreeSpace
 		}
 	case "Connections":
 		switch key {
@@ -471,6 +584,46 @@ func (m *RootModel) resetSettingToDefault(category, key string, defaults *config
 			m.Settings.Connections.MaxGlobalConnections = defaults.Connections.MaxGlobalConnections
 		case "user_agent":
 			m.Settings.Connections.UserAgent = defaults.Connections.UserAgent
+		case "ssh_key_file":
+			m.Settings.Connections.SSHKeyFile = defaults.Connections.SSHKeyFile
+		case "torrent_download_limit":
+			m.Settings.Connections.TorrentDownloadLimit = defaults.Connections.TorrentDownloadLimit
+		case "torrent_upload_limit":
+			m.Settings.Connections.TorrentUploadLimit = defaults.Connections.TorrentUploadLimit
+		case "torrent_seed_ratio":
+			m.Settings.Connections.TorrentSeedRatio = defaults.Connections.TorrentSeedRatio
+		case "stream_quality":
+			m.Settings.Connections.StreamQuality = defaults.Connections.StreamQuality
+		case "s3_endpoint":
+			m.Settings.Connections.S3Endpoint = defaults.Connections.S3Endpoint
+		case "s3_region":
+			m.Settings.Connections.S3Region = defaults.Connections.S3Region
+		case "s3_path_style":
+			m.Settings.Connections.S3PathStyle = defaults.Connections.S3PathStyle
+		case "oci_platform":
+			m.Settings.Connections.OCIPlatform = defaults.Connections.OCIPlatform
+		case "http3":
+			m.Settings.Connections.HTTP3 = defaults.Connections.HTTP3
+		case "http3_hosts":
+			m.Settings.Connections.HTTP3Hosts = defaults.Connections.HTTP3Hosts
+		case "http3_connections":
+			m.Settings.Connections.HTTP3Connections = defaults.Connections.HTTP3Connections
+		case "http2":
+			m.Settings.Connections.HTTP2 = defaults.Connections.HTTP2
+		case "ip_version":
+			m.Settings.Connections.IPVersion = defaults.Connections.IPVersion
+		case "dns":
+			m.Settings.Connections.DNS = defaults.Connections.DNS
+		case "resolve":
+			m.Settings.Connections.Resolve = defaults.Connections.Resolve
+		case "tls_ca_file":
+			m.Settings.Connections.TLSCAFile = defaults.Connections.TLSCAFile
+		case "tls_client_cert":
+			m.Settings.Connections.TLSClientCert = defaults.Connections.TLSClientCert
+		case "tls_client_key":
+			m.Settings.Connections.TLSClientKey = defaults.Connections.TLSClientKey
+		case "tls_min_version":
+			m.Settings.Connections.TLSMinVersion = defaults.Connections.TLSMinVersion
 		}
 	case "Chunks":
 		switch key {
@@ -495,6 +648,10 @@ func (m *RootModel) resetSettingToDefault(category, key string, defaults *config
 			m.Settings.Performance.StallTimeout = defaults.Performance.StallTimeout
 		case "speed_ema_alpha":
 			m.Settings.Performance.SpeedEmaAlpha = defaults.Performance.SpeedEmaAlpha
+		case "max_download_retries":
+			m.Settings.Performance.MaxDownloadRetries = defaults.Performance.MaxDownloadRetries
+		case "download_retry_delay":
+			m.Settings.Performance.DownloadRetryDelay = defaults.Performance.DownloadRetryDelay
 		}
 	}
 }
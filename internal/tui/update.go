@@ -1,6 +1,7 @@
 package tui
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -29,12 +30,32 @@ func notificationTickCmd() tea.Cmd {
 	})
 }
 
-// convertRuntimeConfig converts config.RuntimeConfig to downloader.RuntimeConfig
-func convertRuntimeConfig(rc *config.RuntimeConfig) *downloader.RuntimeConfig {
+// ConvertRuntimeConfig converts config.RuntimeConfig to downloader.RuntimeConfig
+func ConvertRuntimeConfig(rc *config.RuntimeConfig) *downloader.RuntimeConfig {
 	return &downloader.RuntimeConfig{
 		MaxConnectionsPerHost: rc.MaxConnectionsPerHost,
 		MaxGlobalConnections:  rc.MaxGlobalConnections,
 		UserAgent:             rc.UserAgent,
+		SSHKeyFile:            rc.SSHKeyFile,
+		TorrentDownloadLimit:  rc.TorrentDownloadLimit,
+		TorrentUploadLimit:    rc.TorrentUploadLimit,
+		TorrentSeedRatio:      rc.TorrentSeedRatio,
+		StreamQuality:         rc.StreamQuality,
+		S3Endpoint:            rc.S3Endpoint,
+		S3Region:              rc.S3Region,
+		S3PathStyle:           rc.S3PathStyle,
+		OCIPlatform:           rc.OCIPlatform,
+		HTTP3:                 rc.HTTP3,
+		HTTP3Hosts:            rc.HTTP3Hosts,
+		HTTP3Connections:      rc.HTTP3Connections,
+		HTTP2:                 rc.HTTP2,
+		IPVersion:             rc.IPVersion,
+		DNS:                   rc.DNS,
+		Resolve:               rc.Resolve,
+		TLSCAFile:             rc.TLSCAFile,
+		TLSClientCert:         rc.TLSClientCert,
+		TLSClientKey:          rc.TLSClientKey,
+		TLSMinVersion:         rc.TLSMinVersion,
 		MinChunkSize:          rc.MinChunkSize,
 		MaxChunkSize:          rc.MaxChunkSize,
 		TargetChunkSize:       rc.TargetChunkSize,
@@ -43,7 +64,11 @@ func convertRuntimeConfig(rc *config.RuntimeConfig) *downloader.RuntimeConfig {
 		SlowWorkerThreshold:   rc.SlowWorkerThreshold,
 		SlowWorkerGracePeriod: rc.SlowWorkerGracePeriod,
 		StallTimeout:          rc.StallTimeout,
+		MaxDownloadRetries:    rc.MaxDownloadRetries,
+		DownloadRetryDelay:    rc.DownloadRetryDelay,
 		SpeedEmaAlpha:         rc.SpeedEmaAlpha,
+		PreallocateFiles:      rc.PreallocateFiles,
+		MinFreeSpace:          rc.MinFreeSpace,
 	}
 }
 
@@ -85,6 +110,16 @@ func (m RootModel) checkForDuplicate(url string) *DownloadModel {
 
 // startDownload initiates a new download
 func (m RootModel) startDownload(url, path, filename string) (RootModel, tea.Cmd) {
+	return m.enqueueDownload(url, path, filename, nil)
+}
+
+// startCrawl queues url as a recursive crawl of an HTTP directory listing;
+// the files it finds come back as a DownloadsDiscoveredMsg
+func (m RootModel) startCrawl(url, path string) (RootModel, tea.Cmd) {
+	return m.enqueueDownload(url, path, "", &downloader.CrawlOptions{Depth: downloader.DefaultCrawlDepth})
+}
+
+func (m RootModel) enqueueDownload(url, path, filename string, crawl *downloader.CrawlOptions) (RootModel, tea.Cmd) {
 	// Generate unique filename to avoid overwriting
 	// Note: We do this check here because it applies to ALL new downloads
 	finalFilename := m.generateUniqueFilename(path, filename)
@@ -101,7 +136,8 @@ func (m RootModel) startDownload(url, path, filename string) (RootModel, tea.Cmd
 		Verbose:    false,
 		ProgressCh: m.progressChan,
 		State:      newDownload.state,
-		Runtime:    convertRuntimeConfig(m.Settings.ToRuntimeConfig()),
+		Runtime:    ConvertRuntimeConfig(m.Settings.ToRuntimeConfig()),
+		Crawl:      crawl,
 	}
 
 	utils.Debug("Adding to Queue: %s -> %s", url, finalFilename)
@@ -114,6 +150,49 @@ func (m RootModel) startDownload(url, path, filename string) (RootModel, tea.Cmd
 	return m, nil
 }
 
+// resumeDownload adds a paused download back to the pool using its saved state
+func (m RootModel) resumeDownload(d *DownloadModel) tea.Cmd {
+	d.paused = false
+	d.state.Resume()
+	// Use the download's actual destination directory
+	outputPath := filepath.Dir(d.Destination)
+	if outputPath == "" || outputPath == "." {
+		outputPath = m.Settings.General.DefaultDownloadDir
+		if outputPath == "" {
+			outputPath = m.PWD
+		}
+	}
+	cfg := downloader.DownloadConfig{
+		URL:        d.URL,
+		OutputPath: outputPath,
+		DestPath:   d.Destination, // Full path for state lookup
+		ID:         d.ID,
+		Filename:   d.Filename,
+		Verbose:    false,
+		IsResume:   true, // Explicit resume - use saved state
+		ProgressCh: m.progressChan,
+		State:      d.state,
+		Runtime:    ConvertRuntimeConfig(m.Settings.ToRuntimeConfig()),
+	}
+	m.Pool.Add(cfg)
+	// Restart polling
+	return d.reporter.PollCmd()
+}
+
+// retryDownload re-queues a failed download, resuming from its saved progress
+func (m RootModel) retryDownload(d *DownloadModel) tea.Cmd {
+	d.err = nil
+	d.done = false
+	d.retryAttempt, d.retryMax, d.retryAt = 0, 0, time.Time{}
+	d.state.Error.Store(nil)
+	m.addLogEntry(LogStyleStarted.Render("↻ Retrying: " + d.Filename))
+	if m.Pool.Retry(d.ID) {
+		return d.reporter.PollCmd()
+	}
+	// Failed in an earlier session: resume from the saved state
+	return m.resumeDownload(d)
+}
+
 // Update handles messages and updates the model
 func (m RootModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	var cmds []tea.Cmd
@@ -185,8 +264,19 @@ func (m RootModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 				d.Downloaded = msg.Downloaded
 				d.Speed = msg.Speed
+				if time.Now().Before(d.retryAt) {
+					d.Speed = 0 // Waiting for an automatic retry
+				}
 				d.Elapsed = time.Since(d.StartTime)
 				d.Connections = msg.ActiveConnections
+				d.ConnLimit = msg.ConnectionLimit
+				d.Peers = msg.Peers
+				d.Stalls = msg.Stalls
+				d.SlowRestarts = msg.SlowRestarts
+				// Streams refine their size estimate as segments arrive
+				if msg.Total > 0 {
+					d.Total = msg.Total
+				}
 
 				if d.Total > 0 {
 					percentage := float64(d.Downloaded) / float64(d.Total)
@@ -271,13 +361,74 @@ func (m RootModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				d.err = msg.Err
 				d.done = true
 				// Add log entry
-				m.addLogEntry(LogStyleError.Render("✖ Error: " + d.Filename))
+				d.retryAttempt, d.retryMax, d.retryAt = 0, 0, time.Time{}
+				if errors.Is(msg.Err, downloader.ErrLinkRejected) {
+					m.addLogEntry(LogStyleError.Render("✖ Link rejected: " + d.Filename + " (u to replace URL)"))
+				} else if downloader.IsDiskSpaceError(msg.Err) {
+					m.addLogEntry(LogStyleError.Render("✖ Not enough disk space: " + d.Filename))
+				} else {
+					m.addLogEntry(LogStyleError.Render("✖ Error: " + d.Filename))
+				}
+				break
+			}
+		}
+		m.UpdateListItems()
+		cmds = append(cmds, listenForActivity(m.progressChan))
+
+	case messages.DownloadRetryMsg:
+		for _, d := range m.downloads {
+			if d.ID == msg.DownloadID {
+				d.retryAttempt, d.retryMax = msg.Attempt, msg.MaxAttempts
+				d.retryAt = time.Now().Add(msg.Delay)
+				d.Speed = 0
+				m.addLogEntry(LogStylePaused.Render(fmt.Sprintf("↻ Retry %d/%d in %s: %s",
+					msg.Attempt, msg.MaxAttempts, msg.Delay.Round(time.Second), d.Filename)))
 				break
 			}
 		}
 		m.UpdateListItems()
 		cmds = append(cmds, listenForActivity(m.progressChan))
 
+	case ReplaceURLMsg:
+		// Replacement requested through the HTTP server
+		d, err := m.findReplaceTarget(msg)
+		if err != nil {
+			msg.Result <- err
+			return m, nil
+		}
+		return m, replaceURLCmd(d, msg.NewURL, ConvertRuntimeConfig(m.Settings.ToRuntimeConfig()), msg.Result)
+
+	case urlReplacedMsg:
+		return m.applyReplacedURL(msg)
+
+	case linksGrabbedMsg:
+		// Ignore results for a page the user has already left
+		if m.state == GrabState && msg.URL == m.grabSource {
+			m.grabLoading = false
+			m.grabLinks, m.grabErr = msg.Links, msg.Err
+		}
+		return m, nil
+
+	case messages.DownloadsDiscoveredMsg:
+		// The expanded download (e.g. a WebDAV folder) is replaced by one entry per file
+		for i, d := range m.downloads {
+			if d.ID == msg.DownloadID {
+				m.downloads = append(m.downloads[:i], m.downloads[i+1:]...)
+				break
+			}
+		}
+		for _, f := range msg.Files {
+			m, _ = m.startDownload(f.URL, f.OutputPath, "")
+		}
+		m.addLogEntry(LogStyleStarted.Render(fmt.Sprintf("⬇ Queued %d files from %s", len(msg.Files), msg.Source)))
+		m.UpdateListItems()
+		cmds = append(cmds, listenForActivity(m.progressChan))
+
+	case messages.DiskSpaceLowMsg:
+		m.addLogEntry(LogStyleError.Render(fmt.Sprintf("⚠ Disk space low in %s (%s free): paused all downloads",
+			msg.Dir, utils.ConvertBytesToHumanReadable(msg.Free))))
+		cmds = append(cmds, listenForActivity(m.progressChan))
+
 	case messages.DownloadPausedMsg:
 		for _, d := range m.downloads {
 			if d.ID == msg.DownloadID {
@@ -422,6 +573,13 @@ func (m RootModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				m.UpdateListItems()
 				return m, nil
 			}
+			if key.Matches(msg, m.keys.Dashboard.TabErrors) {
+				m.activeTab = TabErrors
+				m.ManualTabSwitch = true
+				m.updateListTitle()
+				m.UpdateListItems()
+				return m, nil
+			}
 			// Quit
 			if key.Matches(msg, m.keys.Dashboard.Quit) {
 				// Graceful shutdown: pause all active downloads to save state
@@ -437,6 +595,7 @@ func (m RootModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			if key.Matches(msg, m.keys.Dashboard.Add) {
 				m.state = InputState
 				m.focusedInput = 0
+				m.recursive = false
 				m.inputs[0].SetValue("")
 				m.inputs[0].Focus()
 				// Use default download dir from settings
@@ -453,7 +612,7 @@ func (m RootModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 			// Next Tab
 			if key.Matches(msg, m.keys.Dashboard.NextTab) {
-				m.activeTab = (m.activeTab + 1) % 3
+				m.activeTab = (m.activeTab + 1) % 4
 				m.ManualTabSwitch = true
 				m.updateListTitle()
 				m.UpdateListItems()
@@ -499,6 +658,8 @@ func (m RootModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 								}
 								time.Sleep(50 * time.Millisecond)
 							}
+							// Segmented streams keep fetched segments beside the partial file
+							_ = os.RemoveAll(surgeFile + ".parts")
 						}
 
 						// Remove completed downloads from master list (for Done tab persistence)
@@ -526,36 +687,14 @@ func (m RootModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			}
 
 			// Pause/Resume toggle - get selected download from list
+			// (retries failed downloads)
 			if key.Matches(msg, m.keys.Dashboard.Pause) {
 				if d := m.GetSelectedDownload(); d != nil {
-					if !d.done {
+					if d.err != nil {
+						cmds = append(cmds, m.retryDownload(d))
+					} else if !d.done {
 						if d.paused {
-							// Resume: create config and add to pool
-							d.paused = false
-							d.state.Resume()
-							// Use the download's actual destination directory
-							outputPath := filepath.Dir(d.Destination)
-							if outputPath == "" || outputPath == "." {
-								outputPath = m.Settings.General.DefaultDownloadDir
-								if outputPath == "" {
-									outputPath = m.PWD
-								}
-							}
-							cfg := downloader.DownloadConfig{
-								URL:        d.URL,
-								OutputPath: outputPath,
-								DestPath:   d.Destination, // Full path for state lookup
-								ID:         d.ID,
-								Filename:   d.Filename,
-								Verbose:    false,
-								IsResume:   true, // Explicit resume - use saved state
-								ProgressCh: m.progressChan,
-								State:      d.state,
-								Runtime:    convertRuntimeConfig(m.Settings.ToRuntimeConfig()),
-							}
-							m.Pool.Add(cfg)
-							// Restart polling
-							cmds = append(cmds, d.reporter.PollCmd())
+							cmds = append(cmds, m.resumeDownload(d))
 						} else {
 							m.Pool.Pause(d.ID)
 						}
@@ -565,6 +704,14 @@ func (m RootModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				return m, tea.Batch(cmds...)
 			}
 
+			// Replace the URL of a paused or failed download (e.g. an expired link)
+			if key.Matches(msg, m.keys.Dashboard.Replace) {
+				if d := m.GetSelectedDownload(); d != nil && canReplaceURL(d) {
+					m = m.startReplace(d)
+				}
+				return m, nil
+			}
+
 			// Toggle log focus
 			if key.Matches(msg, m.keys.Dashboard.Log) {
 				m.logFocused = !m.logFocused
@@ -634,6 +781,24 @@ func (m RootModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				m.filepicker.CurrentDirectory = m.PWD
 				return m, m.filepicker.Init()
 			}
+			if key.Matches(msg, m.keys.Input.Recursive) {
+				m.recursive = !m.recursive
+				return m, nil
+			}
+			if key.Matches(msg, m.keys.Input.Grab) {
+				url := m.inputs[0].Value()
+				if url == "" {
+					return m, nil
+				}
+				path := m.inputs[1].Value()
+				if path == "" {
+					path = m.Settings.General.DefaultDownloadDir
+					if path == "" {
+						path = "."
+					}
+				}
+				return m.startGrab(url, path)
+			}
 			if key.Matches(msg, m.keys.Input.Enter) {
 				// Navigate through inputs: URL -> Path -> Filename -> Start
 				if m.focusedInput < 2 {
@@ -661,6 +826,11 @@ func (m RootModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				}
 				filename := m.inputs[2].Value()
 
+				if m.recursive {
+					m.state = DashboardState
+					return m.startCrawl(url, path)
+				}
+
 				// Check for duplicate URL
 				if d := m.checkForDuplicate(url); d != nil {
 					m.pendingURL = url
@@ -745,6 +915,12 @@ func (m RootModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 			return m, cmd
 
+		case GrabState:
+			return m.updateGrab(msg)
+
+		case ReplaceURLState:
+			return m.updateReplace(msg)
+
 		case HistoryState:
 			if key.Matches(msg, m.keys.History.Close) {
 				m.state = DashboardState
@@ -987,6 +1163,8 @@ func (m *RootModel) updateListTitle() {
 		m.list.Title = "⬇️ Active"
 	case TabDone:
 		m.list.Title = "✅ Completed"
+	case TabErrors:
+		m.list.Title = "✖ Errors"
 	}
 }
 
@@ -5,6 +5,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/junaid2005p/surge/internal/downloader"
 	"github.com/junaid2005p/surge/internal/utils"
 
 	"github.com/charmbracelet/lipgloss"
@@ -30,6 +31,11 @@ func (m RootModel) View() string {
 		if m.focusedInput == 1 {
 			hintStyle = lipgloss.NewStyle().MarginLeft(1).Foreground(ColorNeonPink) // Highlighted
 		}
+		recursive := lipgloss.NewStyle().Foreground(ColorLightGray).Render("[ ] off")
+		if m.recursive {
+			recursive = lipgloss.NewStyle().Foreground(ColorNeonPink).Render(
+				fmt.Sprintf("[x] crawl directory listing (depth %d)", downloader.DefaultCrawlDepth))
+		}
 		pathLine := lipgloss.JoinHorizontal(lipgloss.Left,
 			labelStyle.Render("Path:"),
 			m.inputs[1].View(),
@@ -44,6 +50,8 @@ func (m RootModel) View() string {
 			pathLine,
 			"", // Spacer
 			lipgloss.JoinHorizontal(lipgloss.Left, labelStyle.Render("Filename:"), m.inputs[2].View()),
+			"", // Spacer
+			lipgloss.JoinHorizontal(lipgloss.Left, labelStyle.Render("Recurse:"), recursive),
 			"", // Bottom spacer
 			"",
 			// Render dynamic help
@@ -53,7 +61,7 @@ func (m RootModel) View() string {
 		// Apply padding to the content before boxing it
 		paddedContent := lipgloss.NewStyle().Padding(0, 2).Render(content)
 
-		box := renderBtopBox(PaneTitleStyle.Render(" Add Download "), "", paddedContent, 80, 11, ColorNeonPink)
+		box := renderBtopBox(PaneTitleStyle.Render(" Add Download "), "", paddedContent, 80, 13, ColorNeonPink)
 
 		return lipgloss.Place(m.width, m.height, lipgloss.Center, lipgloss.Center, box)
 	}
@@ -79,6 +87,14 @@ func (m RootModel) View() string {
 		return m.viewSettings()
 	}
 
+	if m.state == GrabState {
+		return m.viewGrab()
+	}
+
+	if m.state == ReplaceURLState {
+		return m.viewReplace()
+	}
+
 	if m.state == DuplicateWarningState {
 		warningContent := lipgloss.JoinVertical(lipgloss.Center,
 			lipgloss.NewStyle().Foreground(ColorNeonPink).Bold(true).Render("⚠ DUPLICATE DETECTED"),
@@ -152,7 +168,7 @@ func (m RootModel) View() string {
                 /____/       `
 
 	// Calculate stats for tab bar
-	active, queued, downloaded := m.CalculateStats()
+	active, queued, downloaded, failed := m.CalculateStats()
 
 	// Logo takes ~45% of header width
 	logoWidth := int(float64(leftWidth) * 0.45)
@@ -330,7 +346,7 @@ func (m RootModel) View() string {
 
 	// --- SECTION 3: DOWNLOAD LIST (Bottom Left) ---
 	// Tab Bar
-	tabBar := renderTabs(m.activeTab, active, queued, downloaded)
+	tabBar := renderTabs(m.activeTab, active, queued, downloaded, failed)
 
 	// Search bar (shown when search is active or has a query)
 	var leftTitle string
@@ -611,13 +627,28 @@ func renderFocusedDetails(d *DownloadModel, w int) string {
 		etaStr = "∞"
 	}
 
+	// Torrents report connected peers instead of HTTP connections
+	connsLabel, conns := "Conns:", fmt.Sprintf("%d", d.Connections)
+	if d.Peers > 0 || downloader.IsTorrentSource(d.URL) {
+		connsLabel, conns = "Peers:", fmt.Sprintf("%d", d.Peers)
+	} else if d.ConnLimit > 0 {
+		// Active connections out of those the adaptive controller allows
+		conns = fmt.Sprintf("%d / %d", d.Connections, d.ConnLimit)
+	}
+
 	// Stats section with ETA
-	statsSection := lipgloss.JoinVertical(lipgloss.Left,
+	stats := []string{
 		lipgloss.JoinHorizontal(lipgloss.Left, StatsLabelStyle.Render("Speed:"), StatsValueStyle.Render(fmt.Sprintf("%.2f MB/s", d.Speed/Megabyte))),
 		lipgloss.JoinHorizontal(lipgloss.Left, StatsLabelStyle.Render("ETA:"), StatsValueStyle.Render(etaStr)),
-		lipgloss.JoinHorizontal(lipgloss.Left, StatsLabelStyle.Render("Conns:"), StatsValueStyle.Render(fmt.Sprintf("%d", d.Connections))),
-		lipgloss.JoinHorizontal(lipgloss.Left, StatsLabelStyle.Render("Elapsed:"), StatsValueStyle.Render(d.Elapsed.Round(time.Second).String())),
-	)
+		lipgloss.JoinHorizontal(lipgloss.Left, StatsLabelStyle.Render(connsLabel), StatsValueStyle.Render(conns)),
+	}
+	// Connections the health monitor restarted, once there are any
+	if d.Stalls > 0 || d.SlowRestarts > 0 {
+		restarts := fmt.Sprintf("%d stalled, %d slow", d.Stalls, d.SlowRestarts)
+		stats = append(stats, lipgloss.JoinHorizontal(lipgloss.Left, StatsLabelStyle.Render("Restarts:"), StatsValueStyle.Render(restarts)))
+	}
+	stats = append(stats, lipgloss.JoinHorizontal(lipgloss.Left, StatsLabelStyle.Render("Elapsed:"), StatsValueStyle.Render(d.Elapsed.Round(time.Second).String())))
+	statsSection := lipgloss.JoinVertical(lipgloss.Left, stats...)
 
 	// Combine all sections with status box at top
 	content := lipgloss.JoinVertical(lipgloss.Left,
@@ -673,9 +704,11 @@ func (m RootModel) calcTotalSpeed() float64 {
 	return total / Megabyte
 }
 
-func (m RootModel) CalculateStats() (active, queued, downloaded int) {
+func (m RootModel) CalculateStats() (active, queued, downloaded, failed int) {
 	for _, d := range m.downloads {
-		if d.done {
+		if d.err != nil {
+			failed++
+		} else if d.done {
 			downloaded++
 		} else if d.Speed > 0 {
 			active++
@@ -694,7 +727,7 @@ func truncateString(s string, i int) string {
 	return s
 }
 
-func renderTabs(activeTab, activeCount, queuedCount, doneCount int) string {
+func renderTabs(activeTab, activeCount, queuedCount, doneCount, errorCount int) string {
 	tabs := []struct {
 		Label string
 		Count int
@@ -702,6 +735,7 @@ func renderTabs(activeTab, activeCount, queuedCount, doneCount int) string {
 		{"Queued", queuedCount},
 		{"Active", activeCount},
 		{"Done", doneCount},
+		{"Errors", errorCount},
 	}
 	var rendered []string
 	for i, t := range tabs {
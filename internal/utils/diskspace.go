@@ -0,0 +1,9 @@
+package utils
+
+import "path/filepath"
+
+// FreeSpaceFor returns the bytes available to the user on the filesystem
+// that would hold path, which need not exist yet
+func FreeSpaceFor(path string) (int64, error) {
+	return FreeSpace(filepath.Dir(path))
+}
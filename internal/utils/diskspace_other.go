@@ -0,0 +1,15 @@
+//go:build !linux && !darwin && !freebsd && !windows
+
+package utils
+
+import "errors"
+
+// FreeSpace is not supported on this platform
+func FreeSpace(dir string) (int64, error) {
+	return 0, errors.ErrUnsupported
+}
+
+// AllocatedBytes is not supported on this platform: files count as empty
+func AllocatedBytes(path string) int64 {
+	return 0
+}
@@ -0,0 +1,24 @@
+//go:build linux || darwin || freebsd
+
+package utils
+
+import "golang.org/x/sys/unix"
+
+// FreeSpace returns the bytes available to the user on the filesystem of dir
+func FreeSpace(dir string) (int64, error) {
+	var st unix.Statfs_t
+	if err := unix.Statfs(dir, &st); err != nil {
+		return 0, err
+	}
+	return int64(st.Bavail) * int64(st.Bsize), nil
+}
+
+// AllocatedBytes returns the disk space path occupies, which is less than its
+// size for a sparse file. Returns 0 if the file does not exist.
+func AllocatedBytes(path string) int64 {
+	var st unix.Stat_t
+	if err := unix.Stat(path, &st); err != nil {
+		return 0
+	}
+	return int64(st.Blocks) * 512
+}
@@ -0,0 +1,23 @@
+//go:build windows
+
+package utils
+
+import "golang.org/x/sys/windows"
+
+// FreeSpace returns the bytes available to the user on the filesystem of dir
+func FreeSpace(dir string) (int64, error) {
+	path, err := windows.UTF16PtrFromString(dir)
+	if err != nil {
+		return 0, err
+	}
+	var free uint64
+	if err := windows.GetDiskFreeSpaceEx(path, &free, nil, nil); err != nil {
+		return 0, err
+	}
+	return int64(free), nil
+}
+
+// AllocatedBytes is not determined on Windows: files count as empty
+func AllocatedBytes(path string) int64 {
+	return 0
+}